@@ -0,0 +1,129 @@
+package contracts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Consumer collects the interactions a consumer's tests declare with one
+// provider and, once the test that created it ends, compares them with the
+// committed contract. The whole set must be declared under that test: the
+// comparison is skipped when it fails, and a run filtered to some of its
+// subtests reports the others as removed.
+type Consumer struct {
+	mu       sync.Mutex
+	contract Contract
+}
+
+// NewConsumer starts the contract between consumer and provider.
+func NewConsumer(t *testing.T, consumer, provider string) *Consumer {
+	t.Helper()
+	c := &Consumer{contract: Contract{Consumer: consumer, Provider: provider}}
+	t.Cleanup(func() {
+		if !t.Failed() {
+			c.check(t)
+		}
+	})
+	return c
+}
+
+// Serve adds i to the contract and starts a mock provider that answers i's
+// response to i's request. It returns the mock's base URL; the test fails
+// when the request differs from i's or never arrives.
+func (c *Consumer) Serve(t *testing.T, i Interaction) string {
+	t.Helper()
+	c.mu.Lock()
+	c.contract.Interactions = append(c.contract.Interactions, i)
+	c.mu.Unlock()
+
+	var called atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called.Store(true)
+		if err := i.Request.match(r); err != nil {
+			t.Errorf("%s: %v", i.Description, err)
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		for name, value := range i.Response.Headers {
+			w.Header().Set(name, value)
+		}
+		if len(i.Response.Body) > 0 && w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(i.Response.Status)
+		w.Write(i.Response.Body)
+	}))
+	t.Cleanup(func() {
+		srv.Close()
+		if !called.Load() {
+			t.Errorf("%s: the provider was never called", i.Description)
+		}
+	})
+	return srv.URL
+}
+
+// match reports how r differs from the declared request.
+func (req Request) match(r *http.Request) error {
+	if r.Method != req.Method || r.URL.Path != req.Path {
+		return fmt.Errorf("got %s %s, want %s %s", r.Method, r.URL.Path, req.Method, req.Path)
+	}
+	for name, value := range req.Headers {
+		if got := r.Header.Get(name); got != value {
+			return fmt.Errorf("header %s = %q, want %q", name, got, value)
+		}
+	}
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if len(req.Body) == 0 {
+		return nil
+	}
+	var got, want any
+	if err := json.Unmarshal(raw, &got); err != nil {
+		return fmt.Errorf("body is not JSON: %q", raw)
+	}
+	if err := json.Unmarshal(req.Body, &want); err != nil {
+		return fmt.Errorf("declared body: %w", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		return fmt.Errorf("body = %s, want %s", raw, req.Body)
+	}
+	return nil
+}
+
+// check compares the declared contract with the committed one, or writes it
+// when UPDATE_CONTRACTS is set.
+func (c *Consumer) check(t *testing.T) {
+	c.mu.Lock()
+	declared, err := c.contract.encode()
+	c.mu.Unlock()
+	if err != nil {
+		t.Errorf("encode contract: %v", err)
+		return
+	}
+	path := File(c.contract.Consumer, c.contract.Provider)
+	if os.Getenv("UPDATE_CONTRACTS") != "" {
+		if err := os.WriteFile(path, declared, 0o644); err != nil {
+			t.Errorf("write contract: %v", err)
+		}
+		return
+	}
+	committed, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("read contract: %v (run with UPDATE_CONTRACTS=1 to create it)", err)
+		return
+	}
+	if !bytes.Equal(committed, declared) {
+		t.Errorf("%s is out of date with the interactions declared here: run with UPDATE_CONTRACTS=1, commit the file and make sure the %s tests still pass", path, c.contract.Provider)
+	}
+}
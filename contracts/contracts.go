@@ -0,0 +1,84 @@
+// Package contracts keeps the HTTP APIs between the services in step. A
+// consumer's gateway tests declare the interactions they rely on, each one a
+// request the gateway sends and the response it expects, and run the gateway
+// against a mock provider answering exactly that. The interactions are kept
+// in pacts/<consumer>-<provider>.json, and the provider's handler tests
+// replay every one against the real handler.
+//
+// A consumer test fails when what it declares no longer matches the
+// committed file; UPDATE_CONTRACTS=1 rewrites the file instead, and the
+// provider tests then check the new version. Either side drifting fails a
+// test.
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// Contract is every interaction a consumer has with a provider.
+type Contract struct {
+	Consumer     string        `json:"consumer"`
+	Provider     string        `json:"provider"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is one request and the response the consumer expects to it.
+// State names what the provider must hold for that response, such as "a
+// reservation is open"; the provider test sets it up before replaying.
+type Interaction struct {
+	Description string   `json:"description"`
+	State       string   `json:"providerState,omitempty"`
+	Request     Request  `json:"request"`
+	Response    Response `json:"response"`
+}
+
+// Request is what the consumer sends. Headers lists only the ones the
+// provider depends on.
+type Request struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// Response is what the consumer expects back. The provider's body must have
+// every field of Body with a value of the same JSON type; the fields named
+// in Exact must also have the same value. A response without Body is only
+// checked on its status and headers.
+type Response struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+	Exact   []string          `json:"exact,omitempty"`
+}
+
+// File is where the contract between consumer and provider is kept.
+func File(consumer, provider string) string {
+	_, self, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(self), "pacts", consumer+"-"+provider+".json")
+}
+
+// Load reads the contract between consumer and provider.
+func Load(consumer, provider string) (Contract, error) {
+	raw, err := os.ReadFile(File(consumer, provider))
+	if err != nil {
+		return Contract{}, err
+	}
+	var c Contract
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return Contract{}, fmt.Errorf("%s-%s contract: %w", consumer, provider, err)
+	}
+	return c, nil
+}
+
+func (c Contract) encode() ([]byte, error) {
+	raw, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(raw, '\n'), nil
+}
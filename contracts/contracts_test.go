@@ -0,0 +1,70 @@
+package contracts
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestResponse_Match(t *testing.T) {
+	want := Response{
+		Status: http.StatusOK,
+		Body:   json.RawMessage(`{"reservationId":1,"status":"reserved","allocations":[{"warehouseId":1}]}`),
+		Exact:  []string{"status"},
+	}
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		err    string
+	}{
+		{"extra fields and other values", 200, `{"reservationId":7,"status":"reserved","allocations":[{"warehouseId":2,"quantity":1}],"totalFee":2}`, ""},
+		{"other status", 202, `{}`, "status 202, want 200"},
+		{"missing field", 200, `{"status":"reserved","allocations":[]}`, "body.reservationId is missing"},
+		{"field of another type", 200, `{"reservationId":"7","status":"reserved","allocations":[]}`, "body.reservationId is a string, want a number"},
+		{"array element of another shape", 200, `{"reservationId":7,"status":"reserved","allocations":[{}]}`, "body.allocations[0].warehouseId is missing"},
+		{"exact field with another value", 200, `{"reservationId":7,"status":"backordered","allocations":[]}`, "body.status = backordered, want reserved"},
+		{"not JSON", 200, `Reserved`, "body is not JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := want.match(&http.Response{StatusCode: tt.status, Header: http.Header{}}, []byte(tt.body))
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("match = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("match = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRequest_Match(t *testing.T) {
+	want := Request{
+		Method:  http.MethodPost,
+		Path:    "/charge",
+		Headers: map[string]string{"Idempotency-Key": "k"},
+		Body:    json.RawMessage(`{"amount":20}`),
+	}
+	request := func(path, key, body string) *http.Request {
+		r, _ := http.NewRequest(http.MethodPost, "http://provider"+path, strings.NewReader(body))
+		r.Header.Set("Idempotency-Key", key)
+		return r
+	}
+	if err := want.match(request("/charge", "k", `{ "amount": 20.0 }`)); err != nil {
+		t.Errorf("equal request: %v", err)
+	}
+	if err := want.match(request("/charges", "k", `{"amount":20}`)); err == nil {
+		t.Error("other path matched")
+	}
+	if err := want.match(request("/charge", "", `{"amount":20}`)); err == nil {
+		t.Error("missing header matched")
+	}
+	if err := want.match(request("/charge", "k", `{"amount":20,"currency":"BRL"}`)); err == nil {
+		t.Error("other body matched")
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/giovaniif/e-commerce/contracts
+
+go 1.24.5
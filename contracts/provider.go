@@ -0,0 +1,169 @@
+package contracts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// States sets up the provider states the interactions name. A state may
+// return values for top-level fields of the request body, for the ids the
+// provider picks while setting it up: the reservation it opened, or the item
+// it emptied so the other states keep theirs.
+type States map[string]func(t *testing.T) map[string]any
+
+// Verify replays every interaction of contract against the provider at
+// baseURL, each in a subtest after setting up its state.
+func Verify(t *testing.T, baseURL string, contract Contract, states States) {
+	t.Helper()
+	if len(contract.Interactions) == 0 {
+		t.Fatalf("%s-%s contract has no interactions", contract.Consumer, contract.Provider)
+	}
+	for _, i := range contract.Interactions {
+		t.Run(i.Description, func(t *testing.T) {
+			var params map[string]any
+			if i.State != "" {
+				setUp, ok := states[i.State]
+				if !ok {
+					t.Fatalf("no setup for provider state %q", i.State)
+				}
+				params = setUp(t)
+			}
+			body, err := withParams(i.Request.Body, params)
+			if err != nil {
+				t.Fatalf("request body: %v", err)
+			}
+			req, err := http.NewRequest(i.Request.Method, baseURL+i.Request.Path, bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			for name, value := range i.Request.Headers {
+				req.Header.Set(name, value)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("%s %s: %v", i.Request.Method, i.Request.Path, err)
+			}
+			defer resp.Body.Close()
+			raw, _ := io.ReadAll(resp.Body)
+			if err := i.Response.match(resp, raw); err != nil {
+				t.Errorf("%s %s: %v", i.Request.Method, i.Request.Path, err)
+			}
+		})
+	}
+}
+
+// withParams overwrites top-level fields of a JSON object body.
+func withParams(body json.RawMessage, params map[string]any) ([]byte, error) {
+	if len(params) == 0 {
+		return body, nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range params {
+		fields[name] = value
+	}
+	return json.Marshal(fields)
+}
+
+// match reports how the provider's response differs from the expected one.
+func (want Response) match(resp *http.Response, raw []byte) error {
+	if resp.StatusCode != want.Status {
+		return fmt.Errorf("status %d, want %d (body %q)", resp.StatusCode, want.Status, raw)
+	}
+	for name, value := range want.Headers {
+		if got := resp.Header.Get(name); got != value {
+			return fmt.Errorf("header %s = %q, want %q", name, got, value)
+		}
+	}
+	if len(want.Body) == 0 {
+		return nil
+	}
+	var got, expected any
+	if err := json.Unmarshal(raw, &got); err != nil {
+		return fmt.Errorf("body is not JSON: %q", raw)
+	}
+	if err := json.Unmarshal(want.Body, &expected); err != nil {
+		return fmt.Errorf("declared body: %w", err)
+	}
+	if err := like(expected, got, "body"); err != nil {
+		return err
+	}
+	gotFields, _ := got.(map[string]any)
+	expectedFields, _ := expected.(map[string]any)
+	for _, name := range want.Exact {
+		if !reflect.DeepEqual(gotFields[name], expectedFields[name]) {
+			return fmt.Errorf("body.%s = %v, want %v", name, gotFields[name], expectedFields[name])
+		}
+	}
+	return nil
+}
+
+// like checks that got has the shape of want: the same JSON types, every
+// field of want's objects, and array elements shaped like want's first one.
+func like(want, got any, path string) error {
+	switch want := want.(type) {
+	case map[string]any:
+		fields, ok := got.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s is %s, want an object", path, kind(got))
+		}
+		names := make([]string, 0, len(want))
+		for name := range want {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			value, ok := fields[name]
+			if !ok {
+				return fmt.Errorf("%s.%s is missing", path, name)
+			}
+			if err := like(want[name], value, path+"."+name); err != nil {
+				return err
+			}
+		}
+	case []any:
+		elems, ok := got.([]any)
+		if !ok {
+			return fmt.Errorf("%s is %s, want an array", path, kind(got))
+		}
+		if len(want) == 0 {
+			return nil
+		}
+		for n, elem := range elems {
+			if err := like(want[0], elem, fmt.Sprintf("%s[%d]", path, n)); err != nil {
+				return err
+			}
+		}
+	default:
+		if kind(got) != kind(want) {
+			return fmt.Errorf("%s is %s, want %s", path, kind(got), kind(want))
+		}
+	}
+	return nil
+}
+
+func kind(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case float64:
+		return "a number"
+	case string:
+		return "a string"
+	case []any:
+		return "an array"
+	case map[string]any:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,64 @@
+package hmacauth
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	chargeMethod = "/test.v1.PaymentService/Charge"
+	healthMethod = "/grpc.health.v1.Health/Check"
+)
+
+// signedContext runs req through the client interceptor of signer and
+// returns the incoming context the callee would see.
+func signedContext(t *testing.T, signer *Signer, method string, req any) context.Context {
+	t.Helper()
+	var md metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+	if err := UnaryClientInterceptor(signer)(context.Background(), method, req, nil, nil, invoker); err != nil {
+		t.Fatalf("client interceptor: %v", err)
+	}
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func TestUnaryInterceptors(t *testing.T) {
+	interceptor := UnaryServerInterceptor(NewVerifier([]Key{key}, NewMemoryNonces(), 0), chargeMethod)
+	handler := func(ctx context.Context, req any) (any, error) { return req, nil }
+	call := func(ctx context.Context, method string, req any) error {
+		_, err := interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+	req := wrapperspb.Int64(4250)
+
+	ctx := signedContext(t, NewSigner(key), chargeMethod, req)
+	if err := call(ctx, chargeMethod, req); err != nil {
+		t.Fatalf("signed call: %v", err)
+	}
+	if err := call(ctx, chargeMethod, req); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("replayed call = %v, want Unauthenticated", err)
+	}
+	ctx = signedContext(t, NewSigner(key), chargeMethod, req)
+	if err := call(ctx, chargeMethod, wrapperspb.Int64(1)); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("call with another message = %v, want Unauthenticated", err)
+	}
+	err := call(context.Background(), chargeMethod, req)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("unsigned call = %v, want Unauthenticated", err)
+	}
+	if details := status.Convert(err).Details(); len(details) != 1 {
+		t.Errorf("unsigned call details = %v, want an ErrorInfo", details)
+	}
+	if err := call(context.Background(), healthMethod, req); err != nil {
+		t.Errorf("unguarded call: %v", err)
+	}
+}
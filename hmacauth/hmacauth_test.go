@@ -0,0 +1,102 @@
+package hmacauth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	key     = Key{ID: "order", Secret: []byte("0123456789abcdef0123456789abcdef")}
+	oldKey  = Key{ID: "order-old", Secret: []byte("fedcba9876543210fedcba9876543210")}
+	testNow = time.Unix(1_800_000_000, 0)
+)
+
+func newVerifier(keys ...Key) *Verifier {
+	v := NewVerifier(keys, NewMemoryNonces(), time.Minute)
+	v.now = func() time.Time { return testNow }
+	return v
+}
+
+func signAt(k Key, at time.Time, method, target, body string) Signature {
+	s := NewSigner(k)
+	s.now = func() time.Time { return at }
+	return s.Sign(method, target, []byte(body))
+}
+
+func TestVerify_AcceptsSignedRequestsOnce(t *testing.T) {
+	v := newVerifier(key, oldKey)
+	ctx := context.Background()
+	for _, k := range []Key{key, oldKey} {
+		sig := signAt(k, testNow.Add(-30*time.Second), "POST", "/v1/reserve", `{"itemId":1}`)
+		if err := v.Verify(ctx, "POST", "/v1/reserve", []byte(`{"itemId":1}`), sig); err != nil {
+			t.Fatalf("%s: Verify: %v", k.ID, err)
+		}
+		if err := v.Verify(ctx, "POST", "/v1/reserve", []byte(`{"itemId":1}`), sig); !errors.Is(err, ErrReplayed) {
+			t.Errorf("%s: replay = %v, want %v", k.ID, err, ErrReplayed)
+		}
+	}
+}
+
+func TestVerify_RejectsTamperedRequests(t *testing.T) {
+	v := newVerifier(key)
+	sig := signAt(key, testNow, "POST", "/v1/reserve", `{"itemId":1}`)
+	cases := []struct {
+		name                 string
+		method, target, body string
+		sig                  Signature
+		want                 error
+	}{
+		{"unsigned", "POST", "/v1/reserve", `{"itemId":1}`, Signature{}, ErrUnsigned},
+		{"other body", "POST", "/v1/reserve", `{"itemId":2}`, sig, ErrInvalidSignature},
+		{"other target", "POST", "/v1/release", `{"itemId":1}`, sig, ErrInvalidSignature},
+		{"other method", "PUT", "/v1/reserve", `{"itemId":1}`, sig, ErrInvalidSignature},
+		{"unknown key", "POST", "/v1/reserve", `{"itemId":1}`, signAt(oldKey, testNow, "POST", "/v1/reserve", `{"itemId":1}`), ErrUnknownKey},
+		{"too old", "POST", "/v1/reserve", `{"itemId":1}`, signAt(key, testNow.Add(-2*time.Minute), "POST", "/v1/reserve", `{"itemId":1}`), ErrExpired},
+		{"too new", "POST", "/v1/reserve", `{"itemId":1}`, signAt(key, testNow.Add(2*time.Minute), "POST", "/v1/reserve", `{"itemId":1}`), ErrExpired},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := v.Verify(context.Background(), tc.method, tc.target, []byte(tc.body), tc.sig)
+			if !errors.Is(err, tc.want) || !errors.Is(err, ErrRejected) {
+				t.Errorf("Verify = %v, want %v", err, tc.want)
+			}
+		})
+	}
+
+	// A rejected request does not use up its nonce.
+	if err := v.Verify(context.Background(), "POST", "/v1/reserve", []byte(`{"itemId":1}`), sig); err != nil {
+		t.Errorf("Verify after rejections: %v", err)
+	}
+}
+
+type failingNonces struct{}
+
+func (failingNonces) Claim(context.Context, string, time.Duration) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func TestVerify_ReportsNonceStoreFailures(t *testing.T) {
+	v := NewVerifier([]Key{key}, failingNonces{}, 0)
+	err := v.Verify(context.Background(), "POST", "/v1/reserve", nil, NewSigner(key).Sign("POST", "/v1/reserve", nil))
+	if err == nil || errors.Is(err, ErrRejected) {
+		t.Errorf("Verify = %v, want a nonce store error", err)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys(" order:" + string(key.Secret) + ", order-old:" + string(oldKey.Secret))
+	if err != nil {
+		t.Fatalf("ParseKeys: %v", err)
+	}
+	if len(keys) != 2 || keys[0].ID != "order" || string(keys[1].Secret) != string(oldKey.Secret) {
+		t.Errorf("ParseKeys = %+v", keys)
+	}
+	for _, bad := range []string{"", "order", "order:short", ":" + string(key.Secret), "a:" + string(key.Secret) + ",a:" + string(key.Secret)} {
+		if _, err := ParseKeys(bad); err == nil {
+			t.Errorf("ParseKeys(%q) accepted", strings.ReplaceAll(bad, string(key.Secret), "…"))
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package hmacauth
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The problem codes Middleware answers with, the same the services use for
+// their own RFC 7807 errors.
+const (
+	CodeUnauthenticated = "unauthenticated"
+	CodeUnavailable     = "unavailable"
+)
+
+// SetHeader writes sig to the headers of a request.
+func (sig Signature) SetHeader(h http.Header) {
+	h.Set(HeaderKeyID, sig.KeyID)
+	h.Set(HeaderTimestamp, sig.Timestamp)
+	h.Set(HeaderNonce, sig.Nonce)
+	h.Set(HeaderSignature, sig.Value)
+}
+
+func signatureFromHeader(h http.Header) Signature {
+	return Signature{
+		KeyID:     h.Get(HeaderKeyID),
+		Timestamp: h.Get(HeaderTimestamp),
+		Nonce:     h.Get(HeaderNonce),
+		Value:     h.Get(HeaderSignature),
+	}
+}
+
+// Transport signs every request it sends with signer before handing it to
+// Base, http.DefaultTransport when nil.
+type Transport struct {
+	Base   http.RoundTripper
+	Signer *Signer
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	// A RoundTripper must not change the request it is given.
+	signed := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		signed.Body = io.NopCloser(bytes.NewReader(body))
+		signed.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	}
+	t.Signer.Sign(req.Method, req.URL.RequestURI(), body).SetHeader(signed.Header)
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(signed)
+}
+
+// Middleware lets through only requests signed by a key of v, answering
+// the others with a 401 unauthenticated problem, and 503 when the nonce
+// store cannot be reached.
+func Middleware(v *Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.Header("WWW-Authenticate", "HMAC-SHA256")
+			abort(c, http.StatusUnauthorized, CodeUnauthenticated, "Authentication required", "failed to read request body")
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// The target as sent: routers may rewrite URL.Path, say to serve a
+		// legacy path under its version prefix.
+		target := c.Request.RequestURI
+		if target == "" {
+			target = c.Request.URL.RequestURI()
+		}
+		err = v.Verify(c.Request.Context(), c.Request.Method, target, body, signatureFromHeader(c.Request.Header))
+		switch {
+		case errors.Is(err, ErrRejected):
+			c.Header("WWW-Authenticate", "HMAC-SHA256")
+			abort(c, http.StatusUnauthorized, CodeUnauthenticated, "Authentication required", err.Error())
+			return
+		case err != nil:
+			slog.ErrorContext(c.Request.Context(), "request signature check failed", "error", err)
+			abort(c, http.StatusServiceUnavailable, CodeUnavailable, "The service is unavailable", "nonce store unavailable")
+			return
+		}
+		c.Next()
+	}
+}
+
+// abort answers with an application/problem+json body.
+func abort(c *gin.Context, status int, code, title, detail string) {
+	c.Header("Content-Type", "application/problem+json")
+	c.AbortWithStatusJSON(status, gin.H{
+		"type":     "urn:e-commerce:problem:" + code,
+		"title":    title,
+		"status":   status,
+		"detail":   detail,
+		"instance": c.Request.URL.Path,
+		"code":     code,
+	})
+}
@@ -0,0 +1,84 @@
+package hmacauth
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newServer serves POST /v1/reserve behind Middleware, echoing the body it
+// was handed.
+func newServer(t *testing.T, v *Verifier) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/v1/reserve", Middleware(v), func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, "reserved "+string(body))
+	})
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func post(t *testing.T, client *http.Client, url string) (int, string) {
+	t.Helper()
+	resp, err := client.Post(url, "application/json", strings.NewReader(`{"itemId":1}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestTransportAndMiddleware(t *testing.T) {
+	ts := newServer(t, NewVerifier([]Key{key}, NewMemoryNonces(), 0))
+	signed := &http.Client{Transport: &Transport{Signer: NewSigner(key)}}
+
+	if code, body := post(t, signed, ts.URL+"/v1/reserve?warehouse=2"); code != http.StatusOK || body != `reserved {"itemId":1}` {
+		t.Fatalf("signed request = %d %q", code, body)
+	}
+	// Every request gets its own nonce.
+	if code, body := post(t, signed, ts.URL+"/v1/reserve"); code != http.StatusOK {
+		t.Fatalf("second signed request = %d %q", code, body)
+	}
+
+	code, body := post(t, http.DefaultClient, ts.URL+"/v1/reserve")
+	if code != http.StatusUnauthorized || !strings.Contains(body, `"code":"unauthenticated"`) {
+		t.Fatalf("unsigned request = %d %s, want an unauthenticated problem", code, body)
+	}
+
+	other := &http.Client{Transport: &Transport{Signer: NewSigner(oldKey)}}
+	if code, _ := post(t, other, ts.URL+"/v1/reserve"); code != http.StatusUnauthorized {
+		t.Errorf("request signed by an unknown key = %d, want 401", code)
+	}
+}
+
+func TestMiddleware_RejectsReplays(t *testing.T) {
+	ts := newServer(t, NewVerifier([]Key{key}, NewMemoryNonces(), 0))
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/v1/reserve", strings.NewReader(`{"itemId":1}`))
+	NewSigner(key).Sign(http.MethodPost, "/v1/reserve", []byte(`{"itemId":1}`)).SetHeader(req.Header)
+
+	send := func() (int, string) {
+		replay := req.Clone(req.Context())
+		replay.Body = io.NopCloser(strings.NewReader(`{"itemId":1}`))
+		resp, err := http.DefaultClient.Do(replay)
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	if code, body := send(); code != http.StatusOK {
+		t.Fatalf("first request = %d %q", code, body)
+	}
+	if code, body := send(); code != http.StatusUnauthorized || !strings.Contains(body, "nonce already used") {
+		t.Errorf("replayed request = %d %s, want a 401 naming the reused nonce", code, body)
+	}
+}
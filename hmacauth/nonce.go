@@ -0,0 +1,61 @@
+package hmacauth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// NonceStore remembers the nonces of verified requests.
+type NonceStore interface {
+	// Claim records nonce for ttl, reporting false when it was already
+	// recorded.
+	Claim(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+// MemoryNonces keeps nonces in process memory. It only protects a single
+// replica: a request replayed to another one is accepted.
+type MemoryNonces struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+	now     func() time.Time
+}
+
+func NewMemoryNonces() *MemoryNonces {
+	return &MemoryNonces{expires: make(map[string]time.Time), now: time.Now}
+}
+
+func (s *MemoryNonces) Claim(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if until, ok := s.expires[nonce]; ok && now.Before(until) {
+		return false, nil
+	}
+	// Sweep expired nonces once the map has grown, so it stays about as big
+	// as the requests of one window.
+	if len(s.expires) >= 1024 {
+		for n, until := range s.expires {
+			if !now.Before(until) {
+				delete(s.expires, n)
+			}
+		}
+	}
+	s.expires[nonce] = now.Add(ttl)
+	return true, nil
+}
+
+// RedisNonces keeps nonces in Redis, shared by every replica.
+type RedisNonces struct {
+	client *redis.Client
+}
+
+func NewRedisNonces(client *redis.Client) *RedisNonces {
+	return &RedisNonces{client: client}
+}
+
+func (s *RedisNonces) Claim(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, "hmacauth:nonce:"+nonce, 1, ttl).Result()
+}
@@ -0,0 +1,190 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const (
+	// MetadataKey is the gRPC metadata carrying the key, the Idempotency-Key
+	// header of a gRPC call.
+	MetadataKey      = "idempotency-key"
+	MetadataReplayed = "idempotent-replayed"
+
+	// ErrorDomain is the domain of the google.rpc.ErrorInfo gRPC errors
+	// carry, the same the services use for their own.
+	ErrorDomain = "e-commerce"
+
+	// headerMessage names, in the record of a gRPC call, the type of the
+	// response message its body holds.
+	headerMessage = "Grpc-Message-Type"
+)
+
+// Method configures idempotency for one gRPC method the way Config does for
+// a route. Key defaults to the idempotency-key metadata.
+type Method struct {
+	Scope    string
+	Key      func(ctx context.Context, req any) string
+	Required bool
+	Lease    time.Duration
+	TTL      time.Duration
+	Stale    func(ctx context.Context, resp Response) bool
+}
+
+// FromMetadata reads the key from the idempotency-key metadata.
+func FromMetadata(ctx context.Context, req any) string {
+	if values := metadata.ValueFromIncomingContext(ctx, MetadataKey); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// UnaryServerInterceptor is Middleware for gRPC. methods maps full method
+// names, such as "/payment.v1.PaymentService/Charge", to their
+// configuration; calls to other methods pass through.
+//
+// Only successful calls are recorded, as the marshalled response; a replay
+// sends the idempotent-replayed header. Errors are statuses with an
+// ErrorInfo whose reason is one of the Code* codes. A method sharing its
+// scope with a route keeps a key from running twice across the two, as the
+// fingerprints differ and the second is refused as a reused key.
+func UnaryServerInterceptor(store Store, methods map[string]Method) grpc.UnaryServerInterceptor {
+	configs := make(map[string]Config, len(methods))
+	keys := make(map[string]func(context.Context, any) string, len(methods))
+	stales := make(map[string]func(context.Context, Response) bool, len(methods))
+	for name, m := range methods {
+		cfg := Config{Store: store, Scope: m.Scope, Required: m.Required, Lease: m.Lease, TTL: m.TTL}
+		if cfg.Lease <= 0 {
+			cfg.Lease = DefaultLease
+		}
+		if cfg.TTL <= 0 {
+			cfg.TTL = DefaultTTL
+		}
+		configs[name] = cfg
+		keys[name] = m.Key
+		stales[name] = m.Stale
+		if keys[name] == nil {
+			keys[name] = FromMetadata
+		}
+	}
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		cfg, ok := configs[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+		clientKey := keys[info.FullMethod](ctx, req)
+		if clientKey == "" {
+			if cfg.Required {
+				return nil, grpcError(codes.InvalidArgument, CodeInvalidRequest, MetadataKey+" metadata is required")
+			}
+			return handler(ctx, req)
+		}
+		if len(clientKey) > MaxKeyLength {
+			return nil, grpcError(codes.InvalidArgument, CodeInvalidRequest, keyTooLong)
+		}
+		body, err := proto.MarshalOptions{Deterministic: true}.Marshal(req.(proto.Message))
+		if err != nil {
+			return nil, grpcError(codes.InvalidArgument, CodeInvalidRequest, "failed to read request")
+		}
+		fingerprint := Fingerprint("GRPC", info.FullMethod, body)
+		key := cfg.Scope + ":" + clientKey
+
+		owner := newOwner()
+		var stale func(Response) bool
+		if isStale := stales[info.FullMethod]; isStale != nil {
+			stale = func(resp Response) bool { return isStale(ctx, resp) }
+		}
+		claim, err := acquire(ctx, cfg.Store, key, owner, fingerprint, cfg.Lease, stale)
+		switch {
+		case errors.Is(err, ErrInProgress):
+			return nil, grpcError(codes.Aborted, CodeInProgress, err.Error())
+		case err != nil:
+			slog.ErrorContext(ctx, "idempotency acquire failed", "scope", cfg.Scope, "error", err)
+			return nil, grpcError(codes.Unavailable, CodeUnavailable, "idempotency store unavailable")
+		case claim.Record != nil:
+			if claim.Record.Fingerprint != fingerprint {
+				return nil, grpcError(codes.FailedPrecondition, CodeKeyReused, MetadataKey+" was already used with a different request")
+			}
+			return replayMessage(ctx, claim.Record.Response)
+		}
+
+		storeCtx := context.WithoutCancel(ctx)
+		recorded := false
+		hb := startHeartbeat(storeCtx, cfg, key, owner)
+		defer func() {
+			if hb.stop() {
+				return
+			}
+			if !recorded {
+				if err := cfg.Store.Release(storeCtx, key, owner); err != nil {
+					slog.ErrorContext(ctx, "idempotency release failed", "scope", cfg.Scope, "error", err)
+				}
+			}
+		}()
+		if claim.TakenOver {
+			slog.WarnContext(ctx, "idempotency key taken over after lease expiry", "scope", cfg.Scope)
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil || hb.stop() {
+			return resp, err
+		}
+		msg := resp.(proto.Message)
+		raw, err := proto.Marshal(msg)
+		if err != nil {
+			slog.ErrorContext(ctx, "idempotency record failed", "scope", cfg.Scope, "error", err)
+			return resp, nil
+		}
+		// A gRPC record keeps codes.OK as its status.
+		record := Record{
+			Fingerprint: fingerprint,
+			Response: Response{
+				StatusCode: int(codes.OK),
+				Header:     http.Header{headerMessage: {string(msg.ProtoReflect().Descriptor().FullName())}},
+				Body:       raw,
+			},
+		}
+		if err := cfg.Store.Complete(storeCtx, key, owner, record, cfg.TTL); err != nil {
+			slog.ErrorContext(ctx, "idempotency complete failed", "scope", cfg.Scope, "error", err)
+			return resp, nil
+		}
+		recorded = true
+		return resp, nil
+	}
+}
+
+// replayMessage rebuilds a recorded response message.
+func replayMessage(ctx context.Context, resp Response) (any, error) {
+	name := protoreflect.FullName(resp.Header.Get(headerMessage))
+	messageType, err := protoregistry.GlobalTypes.FindMessageByName(name)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "recorded response of unknown type %q", name)
+	}
+	msg := messageType.New().Interface()
+	if err := proto.Unmarshal(resp.Body, msg); err != nil {
+		return nil, status.Error(codes.Internal, "recorded response is unreadable")
+	}
+	_ = grpc.SetHeader(ctx, metadata.Pairs(MetadataReplayed, "true"))
+	return msg, nil
+}
+
+// grpcError is the gRPC counterpart of abort.
+func grpcError(code codes.Code, reason, message string) error {
+	st, err := status.New(code, message).WithDetails(&errdetails.ErrorInfo{Reason: reason, Domain: ErrorDomain})
+	if err != nil {
+		return status.Error(code, message)
+	}
+	return st.Err()
+}
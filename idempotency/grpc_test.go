@@ -0,0 +1,119 @@
+package idempotency
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const chargeMethod = "/test.v1.PaymentService/Charge"
+
+// newInterceptor guards chargeMethod, whose handler echoes the request and
+// fails while fail is set.
+func newInterceptor(store Store) (func(key string, req *wrapperspb.StringValue) (any, error), *int, *bool) {
+	interceptor := UnaryServerInterceptor(store, map[string]Method{
+		chargeMethod: {Scope: "test", Required: true},
+	})
+	calls, fail := 0, false
+	handler := func(ctx context.Context, req any) (any, error) {
+		calls++
+		if fail {
+			return nil, status.Error(codes.Internal, "charge failed")
+		}
+		return wrapperspb.String("charged " + req.(*wrapperspb.StringValue).GetValue()), nil
+	}
+	call := func(key string, req *wrapperspb.StringValue) (any, error) {
+		ctx := context.Background()
+		if key != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(MetadataKey, key))
+		}
+		return interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: chargeMethod}, handler)
+	}
+	return call, &calls, &fail
+}
+
+func reason(err error) string {
+	for _, d := range status.Convert(err).Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			return info.GetReason()
+		}
+	}
+	return ""
+}
+
+func TestUnaryServerInterceptor_ReplaysCompletedResponse(t *testing.T) {
+	call, calls, _ := newInterceptor(NewMemoryStore())
+
+	first, err := call("k-1", wrapperspb.String("10"))
+	if err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	second, err := call("k-1", wrapperspb.String("10"))
+	if err != nil {
+		t.Fatalf("second call: %v", err)
+	}
+	if *calls != 1 {
+		t.Fatalf("expected handler to run once, ran %d times", *calls)
+	}
+	if got, want := second.(*wrapperspb.StringValue).GetValue(), first.(*wrapperspb.StringValue).GetValue(); got != want {
+		t.Errorf("replayed %q, want %q", got, want)
+	}
+}
+
+func TestUnaryServerInterceptor_RejectsReusedMissingAndLongKeys(t *testing.T) {
+	call, calls, _ := newInterceptor(NewMemoryStore())
+
+	if _, err := call("k-1", wrapperspb.String("10")); err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	_, err := call("k-1", wrapperspb.String("20"))
+	if status.Code(err) != codes.FailedPrecondition || reason(err) != CodeKeyReused {
+		t.Errorf("reused key = %v (%s), want FailedPrecondition %s", err, reason(err), CodeKeyReused)
+	}
+	_, err = call("", wrapperspb.String("10"))
+	if status.Code(err) != codes.InvalidArgument || reason(err) != CodeInvalidRequest {
+		t.Errorf("missing key = %v (%s), want InvalidArgument %s", err, reason(err), CodeInvalidRequest)
+	}
+	_, err = call(strings.Repeat("k", MaxKeyLength+1), wrapperspb.String("10"))
+	if status.Code(err) != codes.InvalidArgument || reason(err) != CodeInvalidRequest {
+		t.Errorf("key too long = %v (%s), want InvalidArgument %s", err, reason(err), CodeInvalidRequest)
+	}
+	if *calls != 1 {
+		t.Errorf("handler ran %d times, want once", *calls)
+	}
+}
+
+func TestUnaryServerInterceptor_ReleasesKeyOnError(t *testing.T) {
+	call, calls, fail := newInterceptor(NewMemoryStore())
+
+	*fail = true
+	if _, err := call("k-1", wrapperspb.String("10")); status.Code(err) != codes.Internal {
+		t.Fatalf("failing call = %v, want Internal", err)
+	}
+	*fail = false
+	if _, err := call("k-1", wrapperspb.String("10")); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if *calls != 2 {
+		t.Errorf("handler ran %d times, want twice", *calls)
+	}
+}
+
+func TestUnaryServerInterceptor_StoreDownIsUnavailable(t *testing.T) {
+	call, calls, _ := newInterceptor(failingStore{})
+
+	_, err := call("k-1", wrapperspb.String("10"))
+	if status.Code(err) != codes.Unavailable || reason(err) != CodeUnavailable {
+		t.Errorf("store down = %v (%s), want Unavailable %s", err, reason(err), CodeUnavailable)
+	}
+	if *calls != 0 {
+		t.Errorf("handler ran %d times, want never", *calls)
+	}
+}
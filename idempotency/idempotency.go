@@ -0,0 +1,85 @@
+// Package idempotency makes HTTP endpoints and gRPC methods safe to retry.
+// A request carrying an idempotency key claims the key for a lease before
+// its handler runs; a retry with the same key gets the first response back
+// instead of running the handler again, and a duplicate arriving while the
+// first is still in flight is rejected until it finishes or its lease
+// expires.
+//
+// The request holding a key renews its lease while the handler runs. When
+// its replica dies the lease runs out and the next request with the key
+// takes over, so a crash never blocks a key for longer than one lease.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrInProgress is returned by Store.Acquire while another owner holds
+	// an unexpired lease on the key.
+	ErrInProgress = errors.New("request with this idempotency key is in progress")
+	// ErrLeaseLost is returned when the caller no longer owns the key: its
+	// lease expired and another request took it over.
+	ErrLeaseLost = errors.New("idempotency lease lost")
+)
+
+// Response is a captured HTTP response, replayed as is. The response of a
+// gRPC call is kept as its marshalled message.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+}
+
+// Record is a completed key: the request it was first used with and the
+// response that request got.
+type Record struct {
+	Fingerprint string   `json:"fingerprint"`
+	Response    Response `json:"response"`
+}
+
+// Claim is the outcome of a successful Store.Acquire. Record is set when the
+// key already completed; otherwise the caller owns the key. TakenOver tells
+// that an earlier owner let its lease expire while handling the same request
+// (same fingerprint), so it may have done part of the work.
+type Claim struct {
+	Record    *Record
+	TakenOver bool
+}
+
+// Store keeps idempotency keys. Implementations must make every method
+// atomic across the replicas sharing the store, and only let the current
+// owner extend, complete or release a key.
+type Store interface {
+	// Acquire claims key for owner until the lease runs out, or returns the
+	// record when the key already completed. It fails with ErrInProgress
+	// while another owner's lease has not expired.
+	Acquire(ctx context.Context, key, owner, fingerprint string, lease time.Duration) (Claim, error)
+	// Extend renews owner's lease on key.
+	Extend(ctx context.Context, key, owner string, lease time.Duration) error
+	// Complete stores the record of owner's finished request for ttl.
+	Complete(ctx context.Context, key, owner string, record Record, ttl time.Duration) error
+	// Release drops owner's claim of a request that did not finish, so the
+	// key can be used again.
+	Release(ctx context.Context, key, owner string) error
+	// Forget drops key's record while it is still record, so the next
+	// Acquire claims the key afresh. A key being processed, or completed
+	// with another record, is left alone.
+	Forget(ctx context.Context, key string, record Record) error
+}
+
+// acquire claims key like Store.Acquire. A record of the same request that
+// stale reports no longer stands is forgotten and the key claimed again.
+func acquire(ctx context.Context, store Store, key, owner, fingerprint string, lease time.Duration, stale func(Response) bool) (Claim, error) {
+	claim, err := store.Acquire(ctx, key, owner, fingerprint, lease)
+	if err != nil || claim.Record == nil || claim.Record.Fingerprint != fingerprint || stale == nil || !stale(claim.Record.Response) {
+		return claim, err
+	}
+	if err := store.Forget(ctx, key, *claim.Record); err != nil {
+		return Claim{}, err
+	}
+	return store.Acquire(ctx, key, owner, fingerprint, lease)
+}
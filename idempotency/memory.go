@@ -0,0 +1,99 @@
+package idempotency
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	owner       string
+	fingerprint string
+	record      *Record
+	leaseUntil  time.Time
+	expiresAt   time.Time
+}
+
+// MemoryStore keeps keys in process memory. It only protects a single
+// replica and loses every key on restart.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	now     func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*memoryEntry), now: time.Now}
+}
+
+func (s *MemoryStore) Acquire(ctx context.Context, key, owner, fingerprint string, lease time.Duration) (Claim, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var claim Claim
+	if e, ok := s.entries[key]; ok {
+		switch {
+		case e.record != nil && now.Before(e.expiresAt):
+			record := *e.record
+			return Claim{Record: &record}, nil
+		case e.record == nil && now.Before(e.leaseUntil):
+			return Claim{}, ErrInProgress
+		case e.record == nil:
+			claim.TakenOver = e.fingerprint == fingerprint
+		}
+	}
+	s.entries[key] = &memoryEntry{owner: owner, fingerprint: fingerprint, leaseUntil: now.Add(lease)}
+	return claim, nil
+}
+
+// owned returns the processing entry of key if owner still holds it.
+func (s *MemoryStore) owned(key, owner string) (*memoryEntry, error) {
+	e, ok := s.entries[key]
+	if !ok || e.record != nil || e.owner != owner {
+		return nil, ErrLeaseLost
+	}
+	return e, nil
+}
+
+func (s *MemoryStore) Extend(ctx context.Context, key, owner string, lease time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.owned(key, owner)
+	if err != nil {
+		return err
+	}
+	e.leaseUntil = s.now().Add(lease)
+	return nil
+}
+
+func (s *MemoryStore) Complete(ctx context.Context, key, owner string, record Record, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.owned(key, owner)
+	if err != nil {
+		return err
+	}
+	e.record = &record
+	e.expiresAt = s.now().Add(ttl)
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.owned(key, owner); err != nil {
+		return err
+	}
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryStore) Forget(ctx context.Context, key string, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok && e.record != nil && reflect.DeepEqual(*e.record, record) {
+		delete(s.entries, key)
+	}
+	return nil
+}
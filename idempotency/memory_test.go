@@ -0,0 +1,36 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore_ForgetKeepsOtherRecords(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	if _, err := store.Acquire(ctx, "k", "a", "f", time.Minute); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	current := Record{Fingerprint: "f", Response: Response{StatusCode: http.StatusOK, Body: []byte("second")}}
+	if err := store.Complete(ctx, "k", "a", current, time.Hour); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+
+	// A replica that saw an older record does not drop the current one.
+	older := Record{Fingerprint: "f", Response: Response{StatusCode: http.StatusOK, Body: []byte("first")}}
+	if err := store.Forget(ctx, "k", older); err != nil {
+		t.Fatalf("forget: %v", err)
+	}
+	if claim, err := store.Acquire(ctx, "k", "b", "f", time.Minute); err != nil || claim.Record == nil {
+		t.Fatalf("expected the current record to be kept, got %+v, %v", claim, err)
+	}
+
+	if err := store.Forget(ctx, "k", current); err != nil {
+		t.Fatalf("forget: %v", err)
+	}
+	if claim, err := store.Acquire(ctx, "k", "b", "f", time.Minute); err != nil || claim.Record != nil {
+		t.Fatalf("expected the key to be claimed afresh, got %+v, %v", claim, err)
+	}
+}
@@ -0,0 +1,274 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+
+	DefaultLease = 30 * time.Second
+	DefaultTTL   = 24 * time.Hour
+
+	// MaxKeyLength bounds, in bytes, the key a request brings, after Key has
+	// added whatever it namespaces it with. A longer key is refused as
+	// invalid rather than left for the store to choke on.
+	MaxKeyLength = 1024
+)
+
+// keyTooLong is the detail of the problem refusing a key over MaxKeyLength.
+var keyTooLong = fmt.Sprintf("%s is longer than %d bytes", HeaderKey, MaxKeyLength)
+
+// Config configures Middleware. Scope namespaces the keys of one endpoint so
+// the same client key sent to two endpoints never collides. Key defaults to
+// the Idempotency-Key header; when it returns "" the request runs without
+// idempotency, or is rejected with 400 if Required.
+//
+// Recover is called instead of the handler when the request takes over a key
+// whose previous owner died mid-request. It gets the client key and can look
+// up how far that attempt got: when it writes a response itself
+// response and returns true, the response is recorded like the handler's;
+// when it returns false, without writing, the handler runs again.
+//
+// Stale is asked before a recorded response is replayed. When it reports
+// that the response no longer stands, say because what it created has since
+// been undone, the record is forgotten and the request runs as the first
+// one with its key.
+type Config struct {
+	Store    Store
+	Scope    string
+	Key      func(c *gin.Context) string
+	Required bool
+	Lease    time.Duration
+	TTL      time.Duration
+	Recover  func(c *gin.Context, key string) bool
+	Stale    func(c *gin.Context, resp Response) bool
+}
+
+// FromHeader reads the key from the Idempotency-Key header.
+func FromHeader(c *gin.Context) string {
+	return c.GetHeader(HeaderKey)
+}
+
+// Middleware claims the request's key before the handler runs and records
+// the response once it has been written. Only 2xx responses are recorded;
+// anything else releases the key, so a retry runs the handler again. A key
+// reused with a different method, path or body is rejected with 422. Errors
+// are answered as RFC 7807 problems with the Code* codes.
+//
+// The lease is renewed every third of its length while the handler runs. If
+// a renewal finds the key taken over, the response is not recorded: the new
+// owner records its own.
+func Middleware(cfg Config) gin.HandlerFunc {
+	if cfg.Key == nil {
+		cfg.Key = FromHeader
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = DefaultLease
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTTL
+	}
+	return func(c *gin.Context) {
+		clientKey := cfg.Key(c)
+		if clientKey == "" {
+			if cfg.Required {
+				abort(c, http.StatusBadRequest, CodeInvalidRequest, "The request is invalid", HeaderKey+" header is required")
+				return
+			}
+			c.Next()
+			return
+		}
+		if len(clientKey) > MaxKeyLength {
+			abort(c, http.StatusBadRequest, CodeInvalidRequest, "The request is invalid", keyTooLong)
+			return
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			abort(c, http.StatusBadRequest, CodeInvalidRequest, "The request is invalid", "failed to read request body")
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		fingerprint := Fingerprint(c.Request.Method, c.FullPath(), body)
+		key := cfg.Scope + ":" + clientKey
+
+		ctx := c.Request.Context()
+		owner := newOwner()
+		var stale func(Response) bool
+		if cfg.Stale != nil {
+			stale = func(resp Response) bool { return cfg.Stale(c, resp) }
+		}
+		claim, err := acquire(ctx, cfg.Store, key, owner, fingerprint, cfg.Lease, stale)
+		switch {
+		case errors.Is(err, ErrInProgress):
+			c.Header("Retry-After", "1")
+			abort(c, http.StatusConflict, CodeInProgress, "A request with the same Idempotency-Key is in progress", err.Error())
+			return
+		case err != nil:
+			slog.ErrorContext(ctx, "idempotency acquire failed", "scope", cfg.Scope, "error", err)
+			abort(c, http.StatusServiceUnavailable, CodeUnavailable, "The service is unavailable", "idempotency store unavailable")
+			return
+		case claim.Record != nil:
+			if claim.Record.Fingerprint != fingerprint {
+				abort(c, http.StatusUnprocessableEntity, CodeKeyReused, "The Idempotency-Key was used with a different request", HeaderKey+" was already used with a different request")
+				return
+			}
+			replay(c, claim.Record.Response)
+			return
+		}
+
+		// The outcome is recorded even when the client has gone away, or a
+		// retry would run the handler a second time.
+		storeCtx := context.WithoutCancel(ctx)
+		recorded := false
+		hb := startHeartbeat(storeCtx, cfg, key, owner)
+		defer func() {
+			if hb.stop() {
+				return
+			}
+			if !recorded {
+				if err := cfg.Store.Release(storeCtx, key, owner); err != nil {
+					slog.ErrorContext(ctx, "idempotency release failed", "scope", cfg.Scope, "error", err)
+				}
+			}
+		}()
+
+		w := &capturingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		if claim.TakenOver {
+			slog.WarnContext(ctx, "idempotency key taken over after lease expiry", "scope", cfg.Scope)
+		}
+		if claim.TakenOver && cfg.Recover != nil && cfg.Recover(c, clientKey) {
+			c.Abort()
+		} else {
+			c.Next()
+		}
+
+		status := w.Status()
+		if status < 200 || status >= 300 || hb.stop() {
+			return
+		}
+		record := Record{
+			Fingerprint: fingerprint,
+			Response: Response{
+				StatusCode: status,
+				Header:     w.Header().Clone(),
+				Body:       w.body.Bytes(),
+			},
+		}
+		if err := cfg.Store.Complete(storeCtx, key, owner, record, cfg.TTL); err != nil {
+			slog.ErrorContext(ctx, "idempotency complete failed", "scope", cfg.Scope, "error", err)
+			return
+		}
+		recorded = true
+	}
+}
+
+// heartbeat renews a lease until stopped.
+type heartbeat struct {
+	done chan struct{}
+	lost chan struct{}
+	once bool
+}
+
+func startHeartbeat(ctx context.Context, cfg Config, key, owner string) *heartbeat {
+	hb := &heartbeat{done: make(chan struct{}), lost: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(cfg.Lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-hb.done:
+				return
+			case <-ticker.C:
+			}
+			err := cfg.Store.Extend(ctx, key, owner, cfg.Lease)
+			if errors.Is(err, ErrLeaseLost) {
+				slog.WarnContext(ctx, "idempotency lease lost", "scope", cfg.Scope)
+				close(hb.lost)
+				return
+			}
+			if err != nil {
+				slog.ErrorContext(ctx, "idempotency lease renewal failed", "scope", cfg.Scope, "error", err)
+			}
+		}
+	}()
+	return hb
+}
+
+// stop ends the renewals and reports whether the lease was lost.
+func (hb *heartbeat) stop() bool {
+	if !hb.once {
+		hb.once = true
+		close(hb.done)
+	}
+	select {
+	case <-hb.lost:
+		return true
+	default:
+		return false
+	}
+}
+
+// newOwner returns a random id for one request's claim.
+func newOwner() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Fingerprint identifies a request by method, route and body.
+func Fingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// replay writes a recorded response. Headers the current request already set,
+// such as its request id, are kept over the recorded ones.
+func replay(c *gin.Context, resp Response) {
+	header := c.Writer.Header()
+	for name, values := range resp.Header {
+		if _, set := header[name]; set {
+			continue
+		}
+		header[name] = values
+	}
+	c.Header(HeaderReplayed, "true")
+	c.Status(resp.StatusCode)
+	_, _ = c.Writer.Write(resp.Body)
+	c.Abort()
+}
+
+// capturingWriter copies the body written by the handler.
+type capturingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *capturingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,330 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type failingStore struct{}
+
+func (failingStore) Acquire(ctx context.Context, key, owner, fingerprint string, lease time.Duration) (Claim, error) {
+	return Claim{}, errors.New("store down")
+}
+func (failingStore) Extend(ctx context.Context, key, owner string, lease time.Duration) error {
+	return nil
+}
+func (failingStore) Complete(ctx context.Context, key, owner string, record Record, ttl time.Duration) error {
+	return nil
+}
+func (failingStore) Release(ctx context.Context, key, owner string) error        { return nil }
+func (failingStore) Forget(ctx context.Context, key string, record Record) error { return nil }
+
+// newRouter serves POST /charge, answering with status and counting calls.
+func newRouter(store Store, status int, required bool) (*gin.Engine, *int) {
+	gin.SetMode(gin.TestMode)
+	calls := 0
+	r := gin.New()
+	r.POST("/charge", Middleware(Config{Store: store, Scope: "test", Required: required}), func(c *gin.Context) {
+		calls++
+		c.String(status, "charged %d", calls)
+	})
+	return r, &calls
+}
+
+func post(r http.Handler, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/charge", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(HeaderKey, key)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddleware_ReplaysCompletedResponse(t *testing.T) {
+	r, calls := newRouter(NewMemoryStore(), http.StatusOK, true)
+
+	first := post(r, "k-1", `{"amount":10}`)
+	second := post(r, "k-1", `{"amount":10}`)
+
+	if *calls != 1 {
+		t.Fatalf("expected handler to run once, ran %d times", *calls)
+	}
+	if second.Code != http.StatusOK || second.Body.String() != first.Body.String() {
+		t.Fatalf("expected replay of %d %q, got %d %q", first.Code, first.Body.String(), second.Code, second.Body.String())
+	}
+	if second.Header().Get(HeaderReplayed) != "true" {
+		t.Errorf("expected %s header on replay", HeaderReplayed)
+	}
+	if second.Header().Get("Content-Type") != first.Header().Get("Content-Type") {
+		t.Errorf("expected recorded Content-Type %q, got %q", first.Header().Get("Content-Type"), second.Header().Get("Content-Type"))
+	}
+}
+
+func TestMiddleware_FailedResponseReleasesKey(t *testing.T) {
+	r, calls := newRouter(NewMemoryStore(), http.StatusInternalServerError, true)
+
+	post(r, "k-2", `{}`)
+	post(r, "k-2", `{}`)
+
+	if *calls != 2 {
+		t.Fatalf("expected handler to run again after a failure, ran %d times", *calls)
+	}
+}
+
+func TestMiddleware_InFlightDuplicateConflicts(t *testing.T) {
+	store := NewMemoryStore()
+	if _, err := store.Acquire(context.Background(), "test:k-3", "other", Fingerprint(http.MethodPost, "/charge", []byte(`{}`)), time.Minute); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	r, calls := newRouter(store, http.StatusOK, true)
+
+	w := post(r, "k-3", `{}`)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected Retry-After on 409")
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/problem+json") || !strings.Contains(w.Body.String(), `"code":"idempotency_in_progress"`) {
+		t.Errorf("expected an idempotency_in_progress problem, got %s %s", ct, w.Body.String())
+	}
+	if *calls != 0 {
+		t.Fatalf("expected handler not to run, ran %d times", *calls)
+	}
+}
+
+func TestMiddleware_ExpiredLeaseIsTakenOver(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	if _, err := store.Acquire(context.Background(), "test:k-4", "crashed", "", time.Second); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	now = now.Add(2 * time.Second)
+	r, calls := newRouter(store, http.StatusOK, true)
+
+	w := post(r, "k-4", `{}`)
+
+	if w.Code != http.StatusOK || *calls != 1 {
+		t.Fatalf("expected expired lease to be taken over, got %d after %d calls", w.Code, *calls)
+	}
+}
+
+func TestMiddleware_KeyReusedWithDifferentBody(t *testing.T) {
+	r, calls := newRouter(NewMemoryStore(), http.StatusOK, true)
+
+	post(r, "k-5", `{"amount":10}`)
+	w := post(r, "k-5", `{"amount":20}`)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", w.Code)
+	}
+	if *calls != 1 {
+		t.Fatalf("expected handler to run once, ran %d times", *calls)
+	}
+}
+
+func TestMiddleware_MissingKey(t *testing.T) {
+	required, _ := newRouter(NewMemoryStore(), http.StatusOK, true)
+	if w := post(required, "", `{}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 when the key is required, got %d", w.Code)
+	}
+
+	optional, calls := newRouter(NewMemoryStore(), http.StatusOK, false)
+	post(optional, "", `{}`)
+	post(optional, "", `{}`)
+	if *calls != 2 {
+		t.Fatalf("expected every keyless request to run, ran %d times", *calls)
+	}
+}
+
+func TestMiddleware_KeyTooLong(t *testing.T) {
+	r, calls := newRouter(NewMemoryStore(), http.StatusOK, true)
+	if w := post(r, strings.Repeat("k", MaxKeyLength+1), `{}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a key over %d bytes, got %d", MaxKeyLength, w.Code)
+	}
+	if w := post(r, strings.Repeat("k", MaxKeyLength), `{}`); w.Code != http.StatusOK {
+		t.Fatalf("expected a key of %d bytes to be served, got %d", MaxKeyLength, w.Code)
+	}
+	if *calls != 1 {
+		t.Fatalf("expected handler to run once, ran %d times", *calls)
+	}
+}
+
+func TestMiddleware_StoreUnavailable(t *testing.T) {
+	r, calls := newRouter(failingStore{}, http.StatusOK, true)
+
+	w := post(r, "k-6", `{}`)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+	if *calls != 0 {
+		t.Fatalf("expected handler not to run, ran %d times", *calls)
+	}
+}
+
+// crashedStore returns a store holding key for a request with body that
+// crashed and let its lease expire.
+func crashedStore(t *testing.T, key, body string) *MemoryStore {
+	t.Helper()
+	store := NewMemoryStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	fingerprint := Fingerprint(http.MethodPost, "/charge", []byte(body))
+	if _, err := store.Acquire(context.Background(), "test:"+key, "crashed", fingerprint, time.Second); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	now = now.Add(2 * time.Second)
+	return store
+}
+
+func TestMiddleware_TakeoverConsultsRecover(t *testing.T) {
+	store := crashedStore(t, "k-7", `{}`)
+	gin.SetMode(gin.TestMode)
+	calls, recovered := 0, ""
+	r := gin.New()
+	r.POST("/charge", Middleware(Config{Store: store, Scope: "test", Recover: func(c *gin.Context, key string) bool {
+		recovered = key
+		c.String(http.StatusOK, "already charged")
+		return true
+	}}), func(c *gin.Context) {
+		calls++
+		c.String(http.StatusOK, "charged")
+	})
+
+	first := post(r, "k-7", `{}`)
+	second := post(r, "k-7", `{}`)
+
+	if recovered != "k-7" {
+		t.Fatalf("expected Recover with the client key, got %q", recovered)
+	}
+	if calls != 0 {
+		t.Fatalf("expected handler not to run, ran %d times", calls)
+	}
+	if first.Body.String() != "already charged" || second.Body.String() != "already charged" {
+		t.Fatalf("expected recovered response to be recorded, got %q then %q", first.Body.String(), second.Body.String())
+	}
+}
+
+func TestMiddleware_TakeoverRunsHandlerWhenNotRecovered(t *testing.T) {
+	store := crashedStore(t, "k-8", `{}`)
+	gin.SetMode(gin.TestMode)
+	calls := 0
+	r := gin.New()
+	r.POST("/charge", Middleware(Config{Store: store, Scope: "test", Recover: func(c *gin.Context, key string) bool {
+		return false
+	}}), func(c *gin.Context) {
+		calls++
+		c.String(http.StatusOK, "charged")
+	})
+
+	if w := post(r, "k-8", `{}`); w.Code != http.StatusOK || calls != 1 {
+		t.Fatalf("expected handler to run, got %d after %d calls", w.Code, calls)
+	}
+}
+
+func TestMiddleware_TakeoverWithDifferentBodySkipsRecover(t *testing.T) {
+	store := crashedStore(t, "k-9", `{"amount":10}`)
+	gin.SetMode(gin.TestMode)
+	recovered := false
+	r := gin.New()
+	r.POST("/charge", Middleware(Config{Store: store, Scope: "test", Recover: func(c *gin.Context, key string) bool {
+		recovered = true
+		return false
+	}}), func(c *gin.Context) {
+		c.String(http.StatusOK, "charged")
+	})
+
+	post(r, "k-9", `{"amount":20}`)
+
+	if recovered {
+		t.Fatalf("expected Recover not to run for a different request")
+	}
+}
+
+func TestMiddleware_HeartbeatKeepsLease(t *testing.T) {
+	store := NewMemoryStore()
+	gin.SetMode(gin.TestMode)
+	started, finish := make(chan struct{}), make(chan struct{})
+	r := gin.New()
+	r.POST("/charge", Middleware(Config{Store: store, Scope: "test", Lease: 30 * time.Millisecond}), func(c *gin.Context) {
+		close(started)
+		<-finish
+		c.String(http.StatusOK, "charged")
+	})
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- post(r, "k-10", `{}`) }()
+	<-started
+
+	time.Sleep(100 * time.Millisecond)
+	w := post(r, "k-10", `{}`)
+	close(finish)
+	<-done
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected the renewed lease to hold the key, got %d", w.Code)
+	}
+}
+
+func TestMiddleware_LostLeaseIsNotRecorded(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	var mu sync.Mutex
+	store.now = func() time.Time { mu.Lock(); defer mu.Unlock(); return now }
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/charge", Middleware(Config{Store: store, Scope: "test", Lease: 30 * time.Millisecond}), func(c *gin.Context) {
+		// Another replica takes the key over while this one stalls.
+		mu.Lock()
+		now = now.Add(time.Minute)
+		mu.Unlock()
+		if _, err := store.Acquire(context.Background(), "test:k-11", "other", "", time.Hour); err != nil {
+			t.Errorf("takeover: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		c.String(http.StatusOK, "charged")
+	})
+
+	post(r, "k-11", `{}`)
+
+	if _, err := store.Acquire(context.Background(), "test:k-11", "third", "", time.Hour); !errors.Is(err, ErrInProgress) {
+		t.Fatalf("expected the new owner to keep the key, got %v", err)
+	}
+}
+
+func TestMiddleware_StaleRecordRunsHandlerAgain(t *testing.T) {
+	store := NewMemoryStore()
+	gin.SetMode(gin.TestMode)
+	calls := 0
+	stale := map[string]bool{}
+	r := gin.New()
+	r.POST("/charge", Middleware(Config{Store: store, Scope: "test", Stale: func(c *gin.Context, resp Response) bool {
+		return stale[string(resp.Body)]
+	}}), func(c *gin.Context) {
+		calls++
+		c.String(http.StatusOK, "charged %d", calls)
+	})
+
+	post(r, "k-12", `{}`)
+	stale["charged 1"] = true
+	second := post(r, "k-12", `{}`)
+	third := post(r, "k-12", `{}`)
+
+	if calls != 2 {
+		t.Fatalf("expected the stale record to run the handler once more, ran %d times", calls)
+	}
+	if second.Body.String() != "charged 2" || third.Body.String() != "charged 2" || third.Header().Get(HeaderReplayed) != "true" {
+		t.Fatalf("expected the new response to be recorded, got %q then %q", second.Body.String(), third.Body.String())
+	}
+}
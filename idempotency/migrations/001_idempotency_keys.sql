@@ -0,0 +1,14 @@
+-- One row per idempotency key. While processing, owner and lease_until say
+-- who holds the key and until when; expires_at is how long the row is kept
+-- and what the purge job deletes by.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key VARCHAR(255) PRIMARY KEY,
+    fingerprint VARCHAR(64) NOT NULL,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('processing', 'completed')),
+    owner VARCHAR(64),
+    lease_until TIMESTAMPTZ,
+    response JSONB,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
@@ -0,0 +1,4 @@
+-- Stored keys are the scope and the caller's key, which services compose
+-- from the tenant, the customer and the client's key: more than 255
+-- characters fit. Middleware bounds the caller's part at MaxKeyLength.
+ALTER TABLE idempotency_keys ALTER COLUMN key TYPE TEXT;
@@ -0,0 +1,242 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"time"
+)
+
+// migrateLockId is the advisory lock Migrate holds while it runs.
+const migrateLockId = 7_100_037
+
+// migrations holds the schema PostgresStore needs, applied in file name
+// order by Migrate.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// PostgresStore keeps keys in Postgres. Acquire locks the row it inspects,
+// and the other operations only touch a row the caller still owns. The
+// caller registers a driver and runs Migrate before serving.
+type PostgresStore struct {
+	db        *sql.DB
+	retention time.Duration
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db, retention: DefaultTTL}
+}
+
+func (s *PostgresStore) Acquire(ctx context.Context, key, owner, fingerprint string, lease time.Duration) (Claim, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Claim{}, fmt.Errorf("begin idempotency claim: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Inserts a new key, or locks the existing row so no other replica can
+	// take it over at the same time.
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (key, fingerprint, status, owner, lease_until, expires_at)
+		VALUES ($1, $2, 'processing', $3, NOW() + $4 * INTERVAL '1 millisecond', NOW() + $5 * INTERVAL '1 millisecond')
+		ON CONFLICT (key) DO NOTHING
+	`, key, fingerprint, owner, lease.Milliseconds(), s.retention.Milliseconds()); err != nil {
+		return Claim{}, fmt.Errorf("claim idempotency key: %w", err)
+	}
+	var status, storedOwner, storedFingerprint string
+	var leaseExpired, expired bool
+	var response []byte
+	err = tx.QueryRowContext(ctx, `
+		SELECT status, COALESCE(owner, ''), fingerprint, COALESCE(lease_until < NOW(), FALSE), expires_at < NOW(), response
+		FROM idempotency_keys WHERE key = $1 FOR UPDATE
+	`, key).Scan(&status, &storedOwner, &storedFingerprint, &leaseExpired, &expired, &response)
+	if err != nil {
+		return Claim{}, fmt.Errorf("get idempotency key: %w", err)
+	}
+
+	var claim Claim
+	switch {
+	case storedOwner == owner && status == statusProcessing:
+		// Just inserted.
+	case expired:
+	case status == statusCompleted:
+		record := Record{Fingerprint: storedFingerprint}
+		if err := json.Unmarshal(response, &record.Response); err != nil {
+			return Claim{}, fmt.Errorf("unmarshal: %w", err)
+		}
+		return Claim{Record: &record}, nil
+	case !leaseExpired:
+		return Claim{}, ErrInProgress
+	default:
+		claim.TakenOver = storedFingerprint == fingerprint
+	}
+	if storedOwner != owner {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE idempotency_keys
+			SET fingerprint = $2, status = 'processing', owner = $3, response = NULL,
+				lease_until = NOW() + $4 * INTERVAL '1 millisecond', expires_at = NOW() + $5 * INTERVAL '1 millisecond'
+			WHERE key = $1
+		`, key, fingerprint, owner, lease.Milliseconds(), s.retention.Milliseconds()); err != nil {
+			return Claim{}, fmt.Errorf("take over idempotency key: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Claim{}, fmt.Errorf("commit idempotency claim: %w", err)
+	}
+	return claim, nil
+}
+
+// owned runs query against key's row while owner still holds it.
+func (s *PostgresStore) owned(ctx context.Context, query string, args ...any) error {
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (s *PostgresStore) Extend(ctx context.Context, key, owner string, lease time.Duration) error {
+	err := s.owned(ctx, `
+		UPDATE idempotency_keys SET lease_until = NOW() + $3 * INTERVAL '1 millisecond'
+		WHERE key = $1 AND owner = $2 AND status = 'processing'
+	`, key, owner, lease.Milliseconds())
+	if err != nil && !errors.Is(err, ErrLeaseLost) {
+		return fmt.Errorf("extend idempotency key: %w", err)
+	}
+	return err
+}
+
+func (s *PostgresStore) Complete(ctx context.Context, key, owner string, record Record, ttl time.Duration) error {
+	response, err := json.Marshal(record.Response)
+	if err != nil {
+		return err
+	}
+	err = s.owned(ctx, `
+		UPDATE idempotency_keys
+		SET fingerprint = $3, status = 'completed', owner = NULL, lease_until = NULL, response = $4,
+			expires_at = NOW() + $5 * INTERVAL '1 millisecond'
+		WHERE key = $1 AND owner = $2 AND status = 'processing'
+	`, key, owner, record.Fingerprint, response, ttl.Milliseconds())
+	if err != nil && !errors.Is(err, ErrLeaseLost) {
+		return fmt.Errorf("complete idempotency key: %w", err)
+	}
+	return err
+}
+
+func (s *PostgresStore) Release(ctx context.Context, key, owner string) error {
+	err := s.owned(ctx, `DELETE FROM idempotency_keys WHERE key = $1 AND owner = $2 AND status = 'processing'`, key, owner)
+	if err != nil && !errors.Is(err, ErrLeaseLost) {
+		return fmt.Errorf("release idempotency key: %w", err)
+	}
+	return err
+}
+
+func (s *PostgresStore) Forget(ctx context.Context, key string, record Record) error {
+	response, err := json.Marshal(record.Response)
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE key = $1 AND status = 'completed' AND fingerprint = $2 AND response = $3::jsonb AND expires_at >= NOW()
+	`, key, record.Fingerprint, response); err != nil {
+		return fmt.Errorf("forget idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Migrate applies the migrations not applied yet, each in its own
+// transaction, and records them in idempotency_schema_migrations. Replicas
+// starting together serialize on an advisory lock.
+func (s *PostgresStore) Migrate(ctx context.Context) error {
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrateLockId); err != nil {
+		return fmt.Errorf("migrate lock: %w", err)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, migrateLockId)
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS idempotency_schema_migrations (
+			name VARCHAR(255) PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`); err != nil {
+		return fmt.Errorf("create migrations table: %w", err)
+	}
+	for _, name := range names {
+		if err := migrate(ctx, conn, name); err != nil {
+			return fmt.Errorf("migration %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func migrate(ctx context.Context, conn *sql.Conn, name string) error {
+	script, err := migrations.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `INSERT INTO idempotency_schema_migrations (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Purge deletes keys past their retention and returns how many it deleted.
+// Expired rows are already ignored by Acquire; purging only reclaims space.
+func (s *PostgresStore) Purge(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at < NOW()`)
+	if err != nil {
+		return 0, fmt.Errorf("purge idempotency keys: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// RunPurge calls Purge every interval until ctx is done.
+func (s *PostgresStore) RunPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n, err := s.Purge(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "idempotency purge failed", "error", err)
+			continue
+		}
+		if n > 0 {
+			slog.InfoContext(ctx, "idempotency keys purged", "count", n)
+		}
+	}
+}
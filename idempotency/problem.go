@@ -0,0 +1,27 @@
+package idempotency
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// The problem codes the middleware answers with, the same the services use
+// for their own RFC 7807 errors.
+const (
+	CodeInvalidRequest = "invalid_request"
+	CodeInProgress     = "idempotency_in_progress"
+	CodeKeyReused      = "idempotency_key_reused"
+	CodeUnavailable    = "unavailable"
+)
+
+// abort answers with an application/problem+json body.
+func abort(c *gin.Context, status int, code, title, detail string) {
+	c.Header("Content-Type", "application/problem+json")
+	c.AbortWithStatusJSON(status, gin.H{
+		"type":     "urn:e-commerce:problem:" + code,
+		"title":    title,
+		"status":   status,
+		"detail":   detail,
+		"instance": c.Request.URL.Path,
+		"code":     code,
+	})
+}
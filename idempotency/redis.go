@@ -0,0 +1,164 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisKeyPrefix = "idempotency:"
+
+	statusProcessing = "processing"
+	statusCompleted  = "completed"
+)
+
+// redisEntry is the JSON value of a key. LeaseUntil is in Unix milliseconds
+// of the Redis clock, so replicas with skewed clocks agree on expiry.
+type redisEntry struct {
+	Status      string  `json:"status"`
+	Owner       string  `json:"owner,omitempty"`
+	Fingerprint string  `json:"fingerprint,omitempty"`
+	LeaseUntil  int64   `json:"lease_until,omitempty"`
+	Record      *Record `json:"record,omitempty"`
+}
+
+// RedisStore keeps keys in Redis. Every operation is a script that checks
+// status, owner and lease in the same step as the write.
+type RedisStore struct {
+	client *redis.Client
+	// retention is how long a processing key is kept: long enough to notice
+	// a takeover after its lease expires.
+	retention time.Duration
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client, retention: DefaultTTL}
+}
+
+// The scripts read the clock with TIME; entries are JSON built by cjson.
+
+// acquireScript returns {'claimed'}, {'taken_over'}, {'in_progress'} or
+// {'completed', entry}.
+// KEYS: key. ARGV: owner, fingerprint, lease ms, retention ms.
+var acquireScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local result = 'claimed'
+local data = redis.call('GET', KEYS[1])
+if data then
+  local e = cjson.decode(data)
+  if e.status == 'completed' then
+    return {'completed', data}
+  end
+  if tonumber(e.lease_until) > now then
+    return {'in_progress'}
+  end
+  if e.fingerprint == ARGV[2] then
+    result = 'taken_over'
+  end
+end
+local entry = cjson.encode({status = 'processing', owner = ARGV[1], fingerprint = ARGV[2], lease_until = now + tonumber(ARGV[3])})
+redis.call('SET', KEYS[1], entry, 'PX', ARGV[4])
+return {result}
+`)
+
+// ownedScript applies ARGV[2] to a processing key held by ARGV[1]: 'extend'
+// renews the lease by ARGV[3] ms, 'complete' stores the entry ARGV[3] for
+// ARGV[4] ms and 'release' deletes the key. Returns 1, or 0 when the lease
+// was lost.
+var ownedScript = redis.NewScript(`
+local data = redis.call('GET', KEYS[1])
+if not data then
+  return 0
+end
+local e = cjson.decode(data)
+if e.status ~= 'processing' or e.owner ~= ARGV[1] then
+  return 0
+end
+if ARGV[2] == 'extend' then
+  local t = redis.call('TIME')
+  e.lease_until = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000) + tonumber(ARGV[3])
+  redis.call('SET', KEYS[1], cjson.encode(e), 'KEEPTTL')
+elseif ARGV[2] == 'complete' then
+  redis.call('SET', KEYS[1], ARGV[3], 'PX', ARGV[4])
+else
+  redis.call('DEL', KEYS[1])
+end
+return 1
+`)
+
+// forgetScript deletes KEYS[1] while its entry is still ARGV[1].
+var forgetScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+func (s *RedisStore) Acquire(ctx context.Context, key, owner, fingerprint string, lease time.Duration) (Claim, error) {
+	res, err := acquireScript.Run(ctx, s.client, []string{redisKeyPrefix + key}, owner, fingerprint, lease.Milliseconds(), s.retention.Milliseconds()).StringSlice()
+	if err != nil {
+		return Claim{}, fmt.Errorf("redis acquire: %w", err)
+	}
+	switch res[0] {
+	case "claimed":
+		return Claim{}, nil
+	case "taken_over":
+		return Claim{TakenOver: true}, nil
+	case "in_progress":
+		return Claim{}, ErrInProgress
+	}
+	var entry redisEntry
+	if err := json.Unmarshal([]byte(res[1]), &entry); err != nil {
+		return Claim{}, fmt.Errorf("unmarshal: %w", err)
+	}
+	if entry.Record == nil {
+		return Claim{}, errors.New("completed idempotency key without record")
+	}
+	return Claim{Record: entry.Record}, nil
+}
+
+func (s *RedisStore) owned(ctx context.Context, key, owner string, args ...any) error {
+	n, err := ownedScript.Run(ctx, s.client, []string{redisKeyPrefix + key}, append([]any{owner}, args...)...).Int()
+	if err != nil {
+		return fmt.Errorf("redis %s: %w", args[0], err)
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (s *RedisStore) Extend(ctx context.Context, key, owner string, lease time.Duration) error {
+	return s.owned(ctx, key, owner, "extend", lease.Milliseconds())
+}
+
+func (s *RedisStore) Complete(ctx context.Context, key, owner string, record Record, ttl time.Duration) error {
+	raw, err := json.Marshal(redisEntry{Status: statusCompleted, Record: &record})
+	if err != nil {
+		return err
+	}
+	return s.owned(ctx, key, owner, "complete", raw, ttl.Milliseconds())
+}
+
+func (s *RedisStore) Release(ctx context.Context, key, owner string) error {
+	return s.owned(ctx, key, owner, "release")
+}
+
+// Forget compares the stored entry with the one Complete wrote for record,
+// which encodes to the same bytes.
+func (s *RedisStore) Forget(ctx context.Context, key string, record Record) error {
+	raw, err := json.Marshal(redisEntry{Status: statusCompleted, Record: &record})
+	if err != nil {
+		return err
+	}
+	if err := forgetScript.Run(ctx, s.client, []string{redisKeyPrefix + key}, raw).Err(); err != nil && !errors.Is(err, redis.Nil) {
+		return fmt.Errorf("redis forget: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+//go:build integration
+
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	orderprotocols "github.com/giovaniif/e-commerce/order/protocols"
+)
+
+// Item 1 costs 10.00 in the Stock seed data.
+const (
+	itemId    = 1
+	itemPrice = 10.0
+)
+
+func TestCheckout_ReservesChargesAndCompletes(t *testing.T) {
+	s := startSystem(t, systemOptions{})
+
+	code, body := s.Checkout("happy-1", itemId, 2)
+	if code != http.StatusOK || body != "Checkout successful" {
+		t.Fatalf("checkout = %d %q", code, body)
+	}
+	if got := s.Payments.Charged(); !reflect.DeepEqual(got, []float64{2 * itemPrice}) {
+		t.Errorf("charged = %v, want [%v]", got, 2*itemPrice)
+	}
+	want := []orderprotocols.Order{{IdempotencyKey: "happy-1", ItemId: itemId, Quantity: 2, ReservationId: 1, Status: "completed"}}
+	if got := s.Orders.Orders(); !reflect.DeepEqual(got, want) {
+		t.Errorf("orders = %+v, want %+v", got, want)
+	}
+	// Reserved, then completed.
+	s.WaitForStock(itemId, stockLevel{Available: initialStock - 2, Completed: 2, LastEventId: 2})
+}
+
+func TestCheckout_OverGRPC(t *testing.T) {
+	s := startSystem(t, systemOptions{transport: "grpc"})
+
+	code, body := s.Checkout("grpc-1", itemId, 2)
+	if code != http.StatusOK || body != "Checkout successful" {
+		t.Fatalf("checkout = %d %q", code, body)
+	}
+	if got := s.Payments.Charged(); !reflect.DeepEqual(got, []float64{2 * itemPrice}) {
+		t.Errorf("charged = %v, want [%v]", got, 2*itemPrice)
+	}
+	s.WaitForStock(itemId, stockLevel{Available: initialStock - 2, Completed: 2, LastEventId: 2})
+
+	s.Payments.Decline()
+	code, body = s.Checkout("grpc-2", itemId, 3)
+	if code != http.StatusPaymentRequired || !strings.Contains(body, `"code":"payment_declined"`) {
+		t.Fatalf("declined checkout = %d %q, want a payment_declined problem", code, body)
+	}
+	// Reserved and completed, then reserved and released.
+	s.WaitForStock(itemId, stockLevel{Available: initialStock - 2, Completed: 2, LastEventId: 4})
+}
+
+func TestCheckout_SignsServiceCalls(t *testing.T) {
+	for _, transport := range []string{"http", "grpc"} {
+		t.Run(transport, func(t *testing.T) {
+			s := startSystem(t, systemOptions{transport: transport, serviceAuth: true})
+
+			code, body := s.Checkout("signed-1", itemId, 2)
+			if code != http.StatusOK || body != "Checkout successful" {
+				t.Fatalf("checkout = %d %q", code, body)
+			}
+			s.WaitForStock(itemId, stockLevel{Available: initialStock - 2, Completed: 2, LastEventId: 2})
+
+			// Anyone else calling Stock directly is turned away.
+			code, raw := s.stockCall(t, http.MethodPost, "/v1/reserve", `{"itemId":1,"quantity":1}`)
+			if code != http.StatusUnauthorized || !strings.Contains(string(raw), `"code":"unauthenticated"`) {
+				t.Fatalf("unsigned reserve = %d %s, want an unauthenticated problem", code, raw)
+			}
+			s.WaitForStock(itemId, stockLevel{Available: initialStock - 2, Completed: 2, LastEventId: 2})
+		})
+	}
+}
+
+func TestCheckout_DeclinedChargeReleasesStock(t *testing.T) {
+	s := startSystem(t, systemOptions{})
+	s.Payments.Decline()
+
+	code, body := s.Checkout("decline-1", itemId, 3)
+	if code != http.StatusPaymentRequired || !strings.Contains(body, `"code":"payment_declined"`) {
+		t.Fatalf("checkout = %d %q, want a payment_declined problem", code, body)
+	}
+	if got := s.Payments.Charged(); len(got) != 0 {
+		t.Errorf("charged = %v, want nothing", got)
+	}
+	if got := s.Orders.Orders(); len(got) != 0 {
+		t.Errorf("orders = %+v, want none", got)
+	}
+	// Reserved, then released.
+	s.WaitForStock(itemId, stockLevel{Available: initialStock, LastEventId: 2})
+}
+
+// TestCheckout_RetryAfterDeclineReservesAgain retries a declined checkout
+// with its key. Stock must not replay the released reservation, or Payment
+// would charge for stock that went back on sale.
+func TestCheckout_RetryAfterDeclineReservesAgain(t *testing.T) {
+	for _, transport := range []string{"http", "grpc"} {
+		t.Run(transport, func(t *testing.T) {
+			s := startSystem(t, systemOptions{transport: transport})
+			s.Payments.Decline()
+			if code, body := s.Checkout("retry-1", itemId, 3); code != http.StatusPaymentRequired {
+				t.Fatalf("declined checkout = %d %q, want 402", code, body)
+			}
+
+			s.Payments.Accept()
+			code, body := s.Checkout("retry-1", itemId, 3)
+			if code != http.StatusOK || body != "Checkout successful" {
+				t.Fatalf("retried checkout = %d %q", code, body)
+			}
+			if got := s.Payments.Charged(); !reflect.DeepEqual(got, []float64{3 * itemPrice}) {
+				t.Errorf("charged = %v, want [%v]", got, 3*itemPrice)
+			}
+			want := []orderprotocols.Order{{IdempotencyKey: "retry-1", ItemId: itemId, Quantity: 3, ReservationId: 2, Status: "completed"}}
+			if got := s.Orders.Orders(); !reflect.DeepEqual(got, want) {
+				t.Errorf("orders = %+v, want %+v", got, want)
+			}
+			// Reserved and released, then reserved again and completed.
+			s.WaitForStock(itemId, stockLevel{Available: initialStock - 3, Completed: 3, LastEventId: 4})
+		})
+	}
+}
+
+func TestCheckout_OutOfStockChargesNothing(t *testing.T) {
+	s := startSystem(t, systemOptions{})
+
+	code, body := s.Checkout("stockout-1", itemId, initialStock+1)
+	if code != http.StatusConflict || !strings.Contains(body, `"code":"insufficient_stock"`) {
+		t.Fatalf("checkout = %d %q, want an insufficient_stock problem", code, body)
+	}
+	if got := s.Payments.Charged(); len(got) != 0 {
+		t.Errorf("charged = %v, want nothing", got)
+	}
+	if got := s.Orders.Orders(); len(got) != 0 {
+		t.Errorf("orders = %+v, want none", got)
+	}
+	s.WaitForStock(itemId, stockLevel{Available: initialStock})
+	if level := s.StockLevel(itemId); level.LastEventId != 0 {
+		t.Errorf("stock events written for a rejected reserve: %+v", level)
+	}
+}
+
+func TestCheckout_BackorderCompletesAfterRestock(t *testing.T) {
+	s := startSystem(t, systemOptions{})
+	s.drainStock(t, itemId)
+	if code, body := s.stockCall(t, http.MethodPut, "/v1/items/1/backorder", `{"backorderable":true,"cap":5}`); code != http.StatusOK {
+		t.Fatalf("backorder policy = %d %s", code, body)
+	}
+
+	code, body := s.Checkout("backorder-1", itemId, 2)
+	if code != http.StatusAccepted {
+		t.Fatalf("checkout = %d %q, want 202", code, body)
+	}
+	if got := s.Payments.Charged(); !reflect.DeepEqual(got, []float64{2 * itemPrice}) {
+		t.Errorf("charged = %v, want [%v]", got, 2*itemPrice)
+	}
+	orders := s.Orders.Orders()
+	if len(orders) != 1 || orders[0].Status != orderprotocols.OrderStatusBackordered {
+		t.Fatalf("orders = %+v, want one backordered", orders)
+	}
+	reservationId := orders[0].ReservationId
+	// Nothing completes the order before the restock.
+	time.Sleep(200 * time.Millisecond)
+	if got := s.Orders.Orders()[0].Status; got != orderprotocols.OrderStatusBackordered {
+		t.Fatalf("order before the restock = %q, want backordered", got)
+	}
+
+	code, raw := s.stockCall(t, http.MethodPost, "/v1/items/1/restock", `{"warehouseId":1,"quantity":3}`)
+	if code != http.StatusOK {
+		t.Fatalf("restock = %d %s", code, raw)
+	}
+	var restocked struct {
+		AllocatedReservationIds []int32 `json:"allocatedReservationIds"`
+	}
+	if err := json.Unmarshal(raw, &restocked); err != nil || !reflect.DeepEqual(restocked.AllocatedReservationIds, []int32{reservationId}) {
+		t.Fatalf("restock = %s, want reservation %d allocated", raw, reservationId)
+	}
+
+	// Order completes the reservation it was charged for and the order.
+	eventually(t, func() bool {
+		return s.Orders.Orders()[0].Status == orderprotocols.OrderStatusCompleted
+	}, "backordered order not completed after the restock")
+	s.WaitForStock(itemId, stockLevel{Available: 1, Reserved: initialStock, Completed: 2})
+	if got := s.Payments.Charged(); len(got) != 1 {
+		t.Errorf("charged = %v, want the checkout's charge only", got)
+	}
+}
+
+func TestCheckout_SlowChargeTimesOut(t *testing.T) {
+	s := startSystem(t, systemOptions{checkoutTimeout: 300 * time.Millisecond})
+	s.Payments.Delay(5 * time.Second)
+
+	began := time.Now()
+	code, body := s.Checkout("timeout-1", itemId, 1)
+	if code != http.StatusGatewayTimeout {
+		t.Fatalf("checkout = %d %q, want 504", code, body)
+	}
+	if elapsed := time.Since(began); elapsed > 2*time.Second {
+		t.Errorf("checkout answered after %v, want about the 300ms timeout", elapsed)
+	}
+	// Order hanging up cancels the charge in Payment.
+	eventually(t, func() bool { return s.Payments.Canceled() == 1 }, "charge was not canceled")
+	if got := s.Payments.Charged(); len(got) != 0 {
+		t.Errorf("charged = %v, want nothing", got)
+	}
+	if got := s.Orders.Orders(); len(got) != 0 {
+		t.Errorf("orders = %+v, want none", got)
+	}
+}
+
+func TestCheckout_DuplicateKeyIsProcessedOnce(t *testing.T) {
+	s := startSystem(t, systemOptions{})
+
+	for i := range 2 {
+		code, body := s.Checkout("dup-1", itemId, 2)
+		if code != http.StatusOK || body != "Checkout successful" {
+			t.Fatalf("checkout %d = %d %q", i+1, code, body)
+		}
+	}
+	if code, _ := s.Checkout("dup-1", itemId, 3); code != http.StatusUnprocessableEntity {
+		t.Errorf("key reused with another body = %d, want 422", code)
+	}
+	if got := s.Payments.Charged(); len(got) != 1 {
+		t.Errorf("charged = %v, want one charge", got)
+	}
+	if got := s.Orders.Orders(); len(got) != 1 {
+		t.Errorf("orders = %+v, want one", got)
+	}
+	s.WaitForStock(itemId, stockLevel{Available: initialStock - 2, Completed: 2, LastEventId: 2})
+	// Give a stray second reservation time to reach the projection.
+	time.Sleep(200 * time.Millisecond)
+	if level := s.StockLevel(itemId); level.Available != initialStock-2 || level.Reserved != 0 {
+		t.Errorf("stock after duplicate = %+v, want one reservation of 2", level)
+	}
+}
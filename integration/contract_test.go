@@ -0,0 +1,89 @@
+//go:build integration
+
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/giovaniif/e-commerce/contracts"
+)
+
+// TestStock_HonorsOrderContract replays what Order's stock gateway declared
+// in contracts/pacts/order-stock.json. The Stock module verifies it over its
+// in-memory repository; here the handlers run over Postgres and Redis. Each
+// state works on an item of its own: item 1 stays in stock.
+func TestStock_HonorsOrderContract(t *testing.T) {
+	contract, err := contracts.Load("order", "stock")
+	if err != nil {
+		t.Fatalf("load contract: %v", err)
+	}
+	s := startSystem(t, systemOptions{})
+
+	contracts.Verify(t, s.StockURL, contract, contracts.States{
+		"the item is in stock": func(t *testing.T) map[string]any {
+			return map[string]any{"itemId": 1}
+		},
+		"the item is out of stock": func(t *testing.T) map[string]any {
+			s.drainStock(t, 2)
+			return map[string]any{"itemId": 2}
+		},
+		"the item is out of stock and backorderable": func(t *testing.T) map[string]any {
+			s.drainStock(t, 3)
+			if code, body := s.stockCall(t, http.MethodPut, "/v1/items/3/backorder", `{"backorderable":true,"cap":10}`); code != http.StatusOK {
+				t.Fatalf("backorder policy = %d %s", code, body)
+			}
+			return map[string]any{"itemId": 3}
+		},
+		"a reservation is open": func(t *testing.T) map[string]any {
+			code, body := s.stockCall(t, http.MethodPost, "/v1/reserve", `{"itemId":4,"quantity":1}`)
+			if code != http.StatusOK {
+				t.Fatalf("reserve = %d %s", code, body)
+			}
+			var reservation struct {
+				ReservationId int32 `json:"reservationId"`
+			}
+			if err := json.Unmarshal(body, &reservation); err != nil {
+				t.Fatalf("decode reservation: %v", err)
+			}
+			return map[string]any{"reservationId": reservation.ReservationId}
+		},
+	})
+}
+
+// drainStock reserves the item one unit at a time until Stock refuses.
+func (s *system) drainStock(t *testing.T, itemId int32) {
+	t.Helper()
+	for range initialStock {
+		code, body := s.stockCall(t, http.MethodPost, "/v1/reserve", fmt.Sprintf(`{"itemId":%d,"quantity":1}`, itemId))
+		if code == http.StatusConflict {
+			return
+		}
+		if code != http.StatusOK {
+			t.Fatalf("drain item %d: %d %s", itemId, code, body)
+		}
+	}
+	if code, _ := s.stockCall(t, http.MethodPost, "/v1/reserve", fmt.Sprintf(`{"itemId":%d,"quantity":1}`, itemId)); code != http.StatusConflict {
+		t.Fatalf("item %d still in stock after %d reserves", itemId, initialStock)
+	}
+}
+
+func (s *system) stockCall(t *testing.T, method, path, body string) (int, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, s.StockURL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("stock request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, raw
+}
@@ -0,0 +1,13 @@
+// Package integration runs Order, Payment and Stock together in one process
+// and drives checkouts through their HTTP APIs.
+//
+// Redis is a miniredis instance, Postgres an embedded server (its binaries
+// are downloaded and cached on the first run) with a fresh database per
+// test, and MongoDB is replaced by the in-memory order and charge gateways.
+// Set INTEGRATION_POSTGRES_URL to use an existing server instead; each test
+// still creates and drops its own database there.
+//
+// The tests are behind the integration build tag:
+//
+//	go test -tags integration ./...
+package integration
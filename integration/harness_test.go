@@ -0,0 +1,383 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/gin-gonic/gin"
+	orderapi "github.com/giovaniif/e-commerce/order/cmd/api"
+	orderconfig "github.com/giovaniif/e-commerce/order/infra/config"
+	ordergateways "github.com/giovaniif/e-commerce/order/infra/gateways"
+	checkout "github.com/giovaniif/e-commerce/order/use_cases"
+	paymentapi "github.com/giovaniif/e-commerce/payment/cmd/api"
+	paymentconfig "github.com/giovaniif/e-commerce/payment/infra/config"
+	paymentgateways "github.com/giovaniif/e-commerce/payment/infra/gateways"
+	paymentprotocols "github.com/giovaniif/e-commerce/payment/protocols"
+	stockapi "github.com/giovaniif/e-commerce/stock/cmd/api"
+	stockconfig "github.com/giovaniif/e-commerce/stock/infra/config"
+	_ "github.com/lib/pq"
+)
+
+const (
+	// initialStock is every item's stock when a system starts, split evenly
+	// between the two warehouses.
+	initialStock = 10
+	stockSchema  = "../stock/db/init.sql"
+	// serviceKeys is the key Order signs with and Stock and Payment accept
+	// when a system runs with service authentication.
+	serviceKeys = "order:integration-service-key-0123456789abcdef"
+)
+
+// postgresURL points at the server the per-test databases are created on.
+var postgresURL string
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	gin.SetMode(gin.TestMode)
+	// Checkouts retry Stock calls; keep the backoff out of the test time.
+	checkout.BASE_DELAY = 10 * time.Millisecond
+
+	if postgresURL = os.Getenv("INTEGRATION_POSTGRES_URL"); postgresURL != "" {
+		return m.Run()
+	}
+	dir, err := os.MkdirTemp("", "integration-postgres")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "postgres dir: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	port, err := freePort()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "postgres port: %v\n", err)
+		return 1
+	}
+	pgConfig := embeddedpostgres.DefaultConfig().
+		Version(embeddedpostgres.V16).
+		Port(port).
+		RuntimePath(filepath.Join(dir, "runtime")).
+		DataPath(filepath.Join(dir, "data")).
+		Logger(io.Discard)
+	pg := embeddedpostgres.NewDatabase(pgConfig)
+	if err := pg.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "start embedded postgres: %v\n", err)
+		return 1
+	}
+	defer pg.Stop()
+	postgresURL = pgConfig.GetConnectionURL() + "?sslmode=disable"
+	return m.Run()
+}
+
+func freePort() (uint32, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return uint32(l.Addr().(*net.TCPAddr).Port), nil
+}
+
+// newStockDatabase creates a database with the Stock schema and seed data,
+// dropped when the test ends, and returns its URL.
+func newStockDatabase(t *testing.T) string {
+	t.Helper()
+	admin, err := sql.Open("postgres", postgresURL)
+	if err != nil {
+		t.Fatalf("open postgres: %v", err)
+	}
+	name := fmt.Sprintf("stock_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE DATABASE " + name); err != nil {
+		t.Fatalf("create database: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP DATABASE " + name + " WITH (FORCE)")
+		admin.Close()
+	})
+
+	u, err := url.Parse(postgresURL)
+	if err != nil {
+		t.Fatalf("postgres url: %v", err)
+	}
+	u.Path = "/" + name
+	schema, err := os.ReadFile(stockSchema)
+	if err != nil {
+		t.Fatalf("read stock schema: %v", err)
+	}
+	db, err := sql.Open("postgres", u.String())
+	if err != nil {
+		t.Fatalf("open stock database: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatalf("apply stock schema: %v", err)
+	}
+	return u.String()
+}
+
+// payments is Payment's charge gateway: the in-memory one standing in for
+// MongoDB, with the failures a scenario asks for in front of it.
+type payments struct {
+	*paymentgateways.ChargeGatewayMemory
+
+	mu       sync.Mutex
+	decline  bool
+	delay    time.Duration
+	canceled int
+}
+
+func (p *payments) Charge(ctx context.Context, amount float64) error {
+	p.mu.Lock()
+	decline, delay := p.decline, p.delay
+	p.mu.Unlock()
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			p.mu.Lock()
+			p.canceled++
+			p.mu.Unlock()
+			return ctx.Err()
+		}
+	}
+	if decline {
+		return fmt.Errorf("card declined: %w", paymentprotocols.ErrDeclined)
+	}
+	return p.ChargeGatewayMemory.Charge(ctx, amount)
+}
+
+func (p *payments) Decline() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.decline = true
+}
+
+// Accept lets charges through again after Decline.
+func (p *payments) Accept() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.decline = false
+}
+
+func (p *payments) Delay(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.delay = d
+}
+
+// Canceled counts the charges abandoned because Order went away.
+func (p *payments) Canceled() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.canceled
+}
+
+// system is the three services running in process and listening on free
+// ports, sharing one miniredis.
+type system struct {
+	t        *testing.T
+	OrderURL string
+	StockURL string
+	Orders   *ordergateways.OrderGatewayMemory
+	Payments *payments
+}
+
+type systemOptions struct {
+	checkoutTimeout time.Duration
+	// transport is how Order calls Stock and Payment; empty means HTTP.
+	transport string
+	// serviceAuth has Order sign its calls and Stock and Payment require it.
+	serviceAuth bool
+}
+
+// startSystem boots Stock, Payment and Order, in that order, and shuts them
+// down when the test ends.
+func startSystem(t *testing.T, opts systemOptions) *system {
+	t.Helper()
+	redis := miniredis.RunT(t)
+	postgres := newStockDatabase(t)
+
+	t.Setenv("ENV_FILE", "")
+	t.Setenv("APP_ENV", "")
+	t.Setenv("STARTUP_MODE", "lenient")
+	t.Setenv("REDIS_ADDR", redis.Addr())
+	t.Setenv("MONGO_URL", "")
+	t.Setenv("IDEMPOTENCY_STORE", "")
+	t.Setenv("POSTGRES_URL", postgres)
+	t.Setenv("STOCK_INITIAL_QUANTITY", fmt.Sprint(initialStock))
+	t.Setenv("STOCK_JOURNAL_INTERVAL_MS", "10")
+	t.Setenv("STOCK_PROJECTOR_INTERVAL_MS", "10")
+	t.Setenv("SERVICE_AUTH_ENABLED", "false")
+	t.Setenv("SERVICE_AUTH_KEYS", "")
+	if opts.serviceAuth {
+		t.Setenv("SERVICE_AUTH_ENABLED", "true")
+		t.Setenv("SERVICE_AUTH_KEYS", serviceKeys)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	s := &system{
+		t:        t,
+		Orders:   ordergateways.NewOrderGatewayMemory(),
+		Payments: &payments{ChargeGatewayMemory: paymentgateways.NewChargeGatewayMemory()},
+	}
+
+	stockCfg, err := stockconfig.Load()
+	if err != nil {
+		t.Fatalf("stock config: %v", err)
+	}
+	stockCfg.Port, stockCfg.GRPCPort = 0, 0
+	stock, err := stockapi.NewServer(ctx, stockCfg, stockapi.Deps{})
+	if err != nil {
+		t.Fatalf("stock: %v", err)
+	}
+	start(t, "stock", stock)
+	s.StockURL = "http://" + stock.Addr()
+
+	paymentCfg, err := paymentconfig.Load()
+	if err != nil {
+		t.Fatalf("payment config: %v", err)
+	}
+	paymentCfg.Port, paymentCfg.GRPCPort = 0, 0
+	payment, err := paymentapi.NewServer(ctx, paymentCfg, paymentapi.Deps{Charges: s.Payments})
+	if err != nil {
+		t.Fatalf("payment: %v", err)
+	}
+	start(t, "payment", payment)
+
+	t.Setenv("STOCK_BASE_URL", s.StockURL)
+	t.Setenv("PAYMENT_BASE_URL", "http://"+payment.Addr())
+	t.Setenv("STOCK_GRPC_ADDR", stock.GRPCAddr())
+	t.Setenv("PAYMENT_GRPC_ADDR", payment.GRPCAddr())
+	if opts.transport != "" {
+		t.Setenv("DOWNSTREAM_TRANSPORT", opts.transport)
+	}
+	orderCfg, err := orderconfig.Load()
+	if err != nil {
+		t.Fatalf("order config: %v", err)
+	}
+	orderCfg.Port = 0
+	orderCfg.Checkout.BackorderInterval = 20 * time.Millisecond
+	if opts.checkoutTimeout > 0 {
+		orderCfg.Checkout.Timeout = opts.checkoutTimeout
+	}
+	order, err := orderapi.NewServer(ctx, orderCfg, orderapi.Deps{Orders: s.Orders})
+	if err != nil {
+		t.Fatalf("order: %v", err)
+	}
+	start(t, "order", order)
+	s.OrderURL = "http://" + order.Addr()
+	return s
+}
+
+type lifecycle interface {
+	Start() error
+	Shutdown(ctx context.Context) error
+}
+
+// start starts a service and registers its shutdown; cleanups run last in
+// first out, so Order stops before the services it calls.
+func start(t *testing.T, name string, server lifecycle) {
+	t.Helper()
+	if err := server.Start(); err != nil {
+		t.Fatalf("start %s: %v", name, err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			t.Errorf("shutdown %s: %v", name, err)
+		}
+	})
+}
+
+// Checkout posts a checkout to Order and returns its status and body.
+func (s *system) Checkout(key string, itemId, quantity int32) (int, string) {
+	s.t.Helper()
+	body := fmt.Sprintf(`{"itemId":%d,"quantity":%d}`, itemId, quantity)
+	req, err := http.NewRequest(http.MethodPost, s.OrderURL+"/v1/checkout", strings.NewReader(body))
+	if err != nil {
+		s.t.Fatalf("checkout request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		s.t.Fatalf("checkout: %v", err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(raw)
+}
+
+// stockLevel is the projected stock of an item across its warehouses.
+type stockLevel struct {
+	Available   int64 `json:"available"`
+	Reserved    int64 `json:"reserved"`
+	Completed   int64 `json:"completed"`
+	LastEventId int64 `json:"lastEventId"`
+}
+
+// StockLevel reads the item's projection from Stock; it is zero while the
+// projector has not seeded the item yet.
+func (s *system) StockLevel(itemId int32) stockLevel {
+	s.t.Helper()
+	resp, err := http.Get(fmt.Sprintf("%s/v1/items/%d/stock", s.StockURL, itemId))
+	if err != nil {
+		s.t.Fatalf("stock level: %v", err)
+	}
+	defer resp.Body.Close()
+	var level stockLevel
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&level); err != nil {
+			s.t.Fatalf("decode stock level: %v", err)
+		}
+	}
+	return level
+}
+
+// WaitForStock waits for the projection to settle on want, the events
+// behind it included; the projector trails the reservations by an interval.
+func (s *system) WaitForStock(itemId int32, want stockLevel) {
+	s.t.Helper()
+	var got stockLevel
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		got = s.StockLevel(itemId)
+		if got.Available == want.Available && got.Reserved == want.Reserved &&
+			got.Completed == want.Completed && got.LastEventId >= want.LastEventId {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	s.t.Fatalf("stock of item %d = %+v, want %+v", itemId, got, want)
+}
+
+// eventually polls cond for up to 5s.
+func eventually(t *testing.T, cond func() bool, format string, args ...any) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf(format, args...)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
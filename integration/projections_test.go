@@ -0,0 +1,287 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/giovaniif/e-commerce/stock/infra/projections"
+	"github.com/giovaniif/e-commerce/stock/infra/repositories"
+)
+
+// openStockDatabase returns a connection to a fresh Stock database, closed
+// when the test ends.
+func openStockDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("postgres", newStockDatabase(t))
+	if err != nil {
+		t.Fatalf("open stock database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+type stockEvent struct {
+	reservationId int64
+	itemId        int32
+	eventType     string
+	quantity      int32
+}
+
+const appendEvent = `
+	INSERT INTO stock_events (reservation_id, item_id, warehouse_id, event_type, quantity)
+	VALUES ($1, $2, 1, $3, $4)
+`
+
+// appendEvents writes events to stock_events on warehouse 1.
+func appendEvents(t *testing.T, db *sql.DB, events ...stockEvent) {
+	t.Helper()
+	for _, e := range events {
+		if _, err := db.Exec(appendEvent, e.reservationId, e.itemId, e.eventType, e.quantity); err != nil {
+			t.Fatalf("append %s event: %v", e.eventType, err)
+		}
+	}
+}
+
+// project applies batches until the projector has caught up.
+func project(t *testing.T, db *sql.DB) {
+	t.Helper()
+	p := projections.NewProjector(db, 100, 0)
+	for {
+		applied, err := p.ApplyBatch(context.Background())
+		if err != nil {
+			t.Fatalf("apply batch: %v", err)
+		}
+		if applied == 0 {
+			return
+		}
+	}
+}
+
+type projectedState struct {
+	levels       map[[2]int32][4]int64
+	reservations map[int64]string
+}
+
+// projected reads the projection tables: the counters of every location and
+// the status of every reservation.
+func projected(t *testing.T, db *sql.DB) projectedState {
+	t.Helper()
+	state := projectedState{levels: map[[2]int32][4]int64{}, reservations: map[int64]string{}}
+	rows, err := db.Query(`SELECT item_id, warehouse_id, available, reserved, completed, backordered FROM item_stock_levels`)
+	if err != nil {
+		t.Fatalf("read stock levels: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key [2]int32
+		var level [4]int64
+		if err := rows.Scan(&key[0], &key[1], &level[0], &level[1], &level[2], &level[3]); err != nil {
+			t.Fatalf("scan stock level: %v", err)
+		}
+		state.levels[key] = level
+	}
+	rows, err = db.Query(`SELECT reservation_id, status FROM reservations`)
+	if err != nil {
+		t.Fatalf("read reservations: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var status string
+		if err := rows.Scan(&id, &status); err != nil {
+			t.Fatalf("scan reservation: %v", err)
+		}
+		state.reservations[id] = status
+	}
+	return state
+}
+
+// checkpoint reads how far the projector has applied stock_events.
+func checkpoint(t *testing.T, db *sql.DB) int64 {
+	t.Helper()
+	var id int64
+	if err := db.QueryRow(`SELECT last_event_id FROM projection_checkpoints WHERE name = 'stock'`).Scan(&id); err != nil {
+		t.Fatalf("read checkpoint: %v", err)
+	}
+	return id
+}
+
+// Warehouse 1 of every item starts with half of the seeded stock.
+const seededPerWarehouse = 500_000_000
+
+func TestProjections_ProjectorAppliesBatchesFromTheCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	db := openStockDatabase(t)
+	p := projections.NewProjector(db, 2, 0)
+
+	appendEvents(t, db,
+		stockEvent{1, 1, "reserved", 2},
+		stockEvent{2, 1, "reserved", 3},
+		stockEvent{2, 1, "released", 3},
+	)
+	for _, want := range []struct{ applied, checkpoint int }{{2, 2}, {1, 3}, {0, 3}} {
+		applied, err := p.ApplyBatch(ctx)
+		if err != nil || applied != want.applied {
+			t.Fatalf("apply batch = %d, %v; want %d", applied, err, want.applied)
+		}
+		if got := checkpoint(t, db); got != int64(want.checkpoint) {
+			t.Fatalf("checkpoint = %d, want %d", got, want.checkpoint)
+		}
+	}
+
+	// A release seen twice only moves stock once.
+	appendEvents(t, db, stockEvent{2, 1, "released", 3})
+	project(t, db)
+	state := projected(t, db)
+	if got, want := state.levels[[2]int32{1, 1}], [4]int64{seededPerWarehouse - 2, 2, 0, 0}; got != want {
+		t.Errorf("item 1 at warehouse 1 = %v, want %v", got, want)
+	}
+	if want := map[int64]string{1: "reserved", 2: "canceled"}; !reflect.DeepEqual(state.reservations, want) {
+		t.Errorf("reservations = %v, want %v", state.reservations, want)
+	}
+	if got := checkpoint(t, db); got != 4 {
+		t.Errorf("checkpoint = %d, want 4", got)
+	}
+}
+
+func TestProjections_RebuildReplaysTheWholeLog(t *testing.T) {
+	ctx := context.Background()
+	db := openStockDatabase(t)
+
+	appendEvents(t, db,
+		stockEvent{1, 1, "reserved", 2},
+		stockEvent{2, 2, "backordered", 1},
+		stockEvent{0, 2, "restocked", 4},
+		stockEvent{2, 2, "allocated", 1},
+		stockEvent{1, 1, "completed", 2},
+	)
+	project(t, db)
+	live := projected(t, db)
+	// Whatever the live tables drifted to, the rebuild starts over.
+	if _, err := db.Exec(`UPDATE item_stock_levels SET available = 0; DELETE FROM reservations`); err != nil {
+		t.Fatalf("corrupt projections: %v", err)
+	}
+
+	last, err := projections.Rebuild(ctx, db, 2)
+	if err != nil || last != 5 {
+		t.Fatalf("rebuild = %d, %v; want 5", last, err)
+	}
+	if rebuilt := projected(t, db); !reflect.DeepEqual(rebuilt, live) {
+		t.Errorf("rebuilt projections = %+v, want %+v", rebuilt, live)
+	}
+	if got := checkpoint(t, db); got != 5 {
+		t.Errorf("checkpoint = %d, want 5", got)
+	}
+}
+
+// TestProjections_LateCommitIsNotSkipped holds a write to stock_events open
+// while the event writer flushes another batch. Had the writer taken the next
+// id and committed first, the projector would move past the open write's id
+// and never apply it.
+func TestProjections_LateCommitIsNotSkipped(t *testing.T) {
+	ctx := context.Background()
+	db := openStockDatabase(t)
+	writer := repositories.NewEventWriter(db, 10, 10, time.Hour, nil)
+	t.Cleanup(func() { writer.Close(context.Background()) })
+
+	slow, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin slow write: %v", err)
+	}
+	defer slow.Rollback()
+	if _, err := slow.Exec(`SELECT pg_advisory_xact_lock($1)`, repositories.StockEventsLockId); err != nil {
+		t.Fatalf("lock stock events: %v", err)
+	}
+	if _, err := slow.Exec(appendEvent, 1, 1, "reserved", 2); err != nil {
+		t.Fatalf("slow write: %v", err)
+	}
+
+	if err := writer.Write(ctx, repositories.StockEvent{JournalId: "1-0", ReservationId: 2, ItemId: 1, WarehouseId: 1, EventType: "reserved", Quantity: 3}); err != nil {
+		t.Fatalf("queue event: %v", err)
+	}
+	flushed := make(chan error, 1)
+	go func() { flushed <- writer.Flush(ctx) }()
+	eventually(t, func() bool {
+		var waiting bool
+		db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pg_locks WHERE locktype = 'advisory' AND NOT granted)`).Scan(&waiting)
+		return waiting
+	}, "event writer did not wait for the open write")
+	project(t, db)
+	if got := checkpoint(t, db); got != 0 {
+		t.Fatalf("checkpoint with a write still open = %d, want 0", got)
+	}
+
+	if err := slow.Commit(); err != nil {
+		t.Fatalf("commit slow write: %v", err)
+	}
+	if err := <-flushed; err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	project(t, db)
+	state := projected(t, db)
+	if got, want := state.levels[[2]int32{1, 1}], [4]int64{seededPerWarehouse - 5, 5, 0, 0}; got != want {
+		t.Errorf("item 1 at warehouse 1 = %v, want %v", got, want)
+	}
+	if want := map[int64]string{1: "reserved", 2: "reserved"}; !reflect.DeepEqual(state.reservations, want) {
+		t.Errorf("reservations = %v, want %v", state.reservations, want)
+	}
+}
+
+func TestProjections_RebuildFromSnapshotWithoutItemChanges(t *testing.T) {
+	ctx := context.Background()
+	db := openStockDatabase(t)
+	snapshotter := projections.NewSnapshotter(db, 0)
+
+	appendEvents(t, db,
+		stockEvent{1, 1, "reserved", 2},
+		stockEvent{2, 2, "reserved", 3},
+		stockEvent{1, 1, "completed", 2},
+	)
+	project(t, db)
+	if id, err := snapshotter.TakeSnapshot(ctx); err != nil || id != 3 {
+		t.Fatalf("first snapshot = %d, %v; want 3", id, err)
+	}
+
+	// A repeated complete moves the checkpoint but no stock level, so the
+	// next snapshot has open reservations and no item rows of its own.
+	appendEvents(t, db, stockEvent{1, 1, "completed", 2})
+	project(t, db)
+	if id, err := snapshotter.TakeSnapshot(ctx); err != nil || id != 4 {
+		t.Fatalf("second snapshot = %d, %v; want 4", id, err)
+	}
+	if id, err := snapshotter.TakeSnapshot(ctx); err != nil || id != 0 {
+		t.Fatalf("snapshot without new events = %d, %v; want 0", id, err)
+	}
+	if id, err := projections.LatestSnapshotId(ctx, db); err != nil || id != 4 {
+		t.Fatalf("latest snapshot = %d, %v; want 4", id, err)
+	}
+	var older int
+	if err := db.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM stock_snapshots WHERE event_id < 4)
+		     + (SELECT COUNT(*) FROM reservation_snapshots WHERE event_id < 4)
+	`).Scan(&older); err != nil || older != 0 {
+		t.Fatalf("rows left from the first snapshot = %d, %v; want 0", older, err)
+	}
+
+	appendEvents(t, db, stockEvent{2, 2, "released", 3})
+	project(t, db)
+	live := projected(t, db)
+
+	last, err := projections.RebuildFromSnapshot(ctx, db, 100)
+	if err != nil || last != 5 {
+		t.Fatalf("rebuild = %d, %v; want 5", last, err)
+	}
+	rebuilt := projected(t, db)
+	if !reflect.DeepEqual(rebuilt.levels, live.levels) {
+		t.Errorf("rebuilt levels = %v, want %v", rebuilt.levels, live.levels)
+	}
+	// Reservation 1 closed before the snapshot and is not carried over.
+	if want := map[int64]string{2: "canceled"}; !reflect.DeepEqual(rebuilt.reservations, want) {
+		t.Errorf("rebuilt reservations = %v, want %v", rebuilt.reservations, want)
+	}
+}
@@ -0,0 +1,66 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/giovaniif/e-commerce/stock/infra/schema"
+)
+
+// TestSchema_MigrateAddsWarehousesToAnOlderDatabase takes a database back to
+// before warehouses, as it was left by an older db/init.sql, and migrates it.
+func TestSchema_MigrateAddsWarehousesToAnOlderDatabase(t *testing.T) {
+	ctx := context.Background()
+	db := openStockDatabase(t)
+	if _, err := db.Exec(`
+		ALTER TABLE stock_events DROP COLUMN warehouse_id;
+		ALTER TABLE reservations DROP COLUMN warehouse_id;
+		ALTER TABLE reservations ADD PRIMARY KEY (reservation_id);
+		DELETE FROM item_warehouse_stock WHERE item_id = 3;
+		INSERT INTO stock_events (reservation_id, item_id, event_type, quantity) VALUES (1, 3, 'reserved', 2);
+		INSERT INTO reservations (reservation_id, item_id, quantity, status, last_event_id, reserved_at, updated_at)
+		VALUES (1, 3, 2, 'reserved', 1, NOW(), NOW());
+	`); err != nil {
+		t.Fatalf("take the schema back: %v", err)
+	}
+
+	for range 2 {
+		if err := schema.Migrate(ctx, db); err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
+	}
+
+	var eventWarehouse, reservationWarehouse int
+	if err := db.QueryRow(`SELECT warehouse_id FROM stock_events WHERE reservation_id = 1`).Scan(&eventWarehouse); err != nil || eventWarehouse != 1 {
+		t.Errorf("event warehouse = %d, %v; want 1", eventWarehouse, err)
+	}
+	if err := db.QueryRow(`SELECT warehouse_id FROM reservations WHERE reservation_id = 1`).Scan(&reservationWarehouse); err != nil || reservationWarehouse != 1 {
+		t.Errorf("reservation warehouse = %d, %v; want 1", reservationWarehouse, err)
+	}
+	// The reservation is keyed by warehouse again, so it can span two.
+	if _, err := db.Exec(`
+		INSERT INTO reservations (reservation_id, warehouse_id, item_id, quantity, status, last_event_id, reserved_at, updated_at)
+		VALUES (1, 2, 3, 1, 'reserved', 1, NOW(), NOW())
+	`); err != nil {
+		t.Errorf("reserve item 3 at warehouse 2 under the same reservation: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO stock_events (reservation_id, item_id, warehouse_id, event_type, quantity) VALUES (2, 3, 9, 'reserved', 1)`); err == nil {
+		t.Error("event at an unknown warehouse accepted")
+	}
+
+	var atFirst, atSecond int64
+	if err := db.QueryRow(`
+		SELECT
+			(SELECT initial_stock FROM item_warehouse_stock WHERE item_id = 3 AND warehouse_id = 1),
+			(SELECT initial_stock FROM item_warehouse_stock WHERE item_id = 3 AND warehouse_id = 2)
+	`).Scan(&atFirst, &atSecond); err != nil || atFirst != 2*seededPerWarehouse || atSecond != 0 {
+		t.Errorf("item 3 initial stock = %d and %d, %v; want all of it at warehouse 1", atFirst, atSecond, err)
+	}
+
+	var applied int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM stock_schema_migrations`).Scan(&applied); err != nil || applied != 1 {
+		t.Errorf("applied migrations = %d, %v; want 1", applied, err)
+	}
+}
@@ -0,0 +1,124 @@
+import http from 'k6/http';
+import { check } from 'k6';
+import { Counter } from 'k6/metrics';
+
+const BASE_URL = __ENV.BASE_URL || 'http://nginx';
+const SCENARIO = __ENV.SCENARIO || 'payment_outage';
+// Nginx does not expose /admin, so the rules go straight to the services on
+// the compose network, with the token every replica is started with.
+const ADMIN_URLS = {
+  order: __ENV.ORDER_ADMIN_URL || 'http://order:3131',
+  payment: __ENV.PAYMENT_ADMIN_URL || 'http://payment:3132',
+  stock: __ENV.STOCK_ADMIN_URL || 'http://stock:3133',
+};
+const ADMIN_TOKEN = __ENV.ADMIN_TOKEN || '';
+// Every replica keeps its own rules and the service name resolves to one
+// of them at random, so each call is repeated often enough to reach all.
+const FANOUT = parseInt(__ENV.FAULT_FANOUT || '50', 10);
+
+const checkoutsSucceeded = new Counter('checkouts_succeeded');
+const checkoutsFailed = new Counter('checkouts_failed');
+
+/**
+ * Chaos scenarios: fault rules set on the services through
+ * PUT /admin/faults before the run and cleared after it, while checkouts
+ * keep coming. Pick one with --env SCENARIO=<name>.
+ *
+ *   payment_outage   30% of POST /v2/charge answered with 503
+ *   slow_reserve     2s added to every POST /v1/reserve
+ *   dropped_reserve  10% of POST /v1/reserve connections dropped
+ *   stock_timeouts   20% of Order's stock.Reserve calls fail with a 504
+ *
+ * The services must run with FAULTS_ENABLED=true and an ADMIN_TOKEN, and
+ * k6 on the compose network to reach them.
+ *
+ * Run:
+ *   docker run --rm -i --network payments_app -e SCENARIO=slow_reserve -e ADMIN_TOKEN \
+ *     grafana/k6 run --out influxdb=http://influxdb:8086/k6 - <load-test/chaos.js
+ */
+const SCENARIOS = {
+  payment_outage: {
+    payment: [{ target: 'POST /v2/charge', status: 503, percent: 30 }],
+  },
+  slow_reserve: {
+    stock: [{ target: 'POST /v1/reserve', latencyMs: 2000 }],
+  },
+  dropped_reserve: {
+    stock: [{ target: 'POST /v1/reserve', drop: true, percent: 10 }],
+  },
+  stock_timeouts: {
+    order: [{ target: 'stock.Reserve', status: 504, percent: 20 }],
+  },
+};
+
+export const options = {
+  // Resolve the service names on every call, so the admin calls spread
+  // over the replicas.
+  dns: { ttl: '0', select: 'random' },
+  scenarios: {
+    chaos: {
+      executor: 'constant-arrival-rate',
+      rate: 200,
+      timeUnit: '1s',
+      duration: '2m',
+      preAllocatedVUs: 200,
+      maxVUs: 2000,
+      exec: 'checkout',
+    },
+  },
+};
+
+function setFaults(service, rules) {
+  const url = `${ADMIN_URLS[service]}/admin/faults`;
+  const headers = { Authorization: `Bearer ${ADMIN_TOKEN}` };
+  for (let i = 0; i < FANOUT; i++) {
+    const res = rules
+      ? http.put(url, JSON.stringify(rules), {
+          headers: Object.assign({ 'Content-Type': 'application/json' }, headers),
+        })
+      : http.del(url, null, { headers });
+    if (res.status !== 200 && res.status !== 204) {
+      throw new Error(`${service} faults: ${res.status} ${res.body}`);
+    }
+  }
+}
+
+export function setup() {
+  if (!ADMIN_TOKEN) {
+    throw new Error('ADMIN_TOKEN is required to set the fault rules');
+  }
+  const scenario = SCENARIOS[SCENARIO];
+  if (!scenario) {
+    throw new Error(`unknown SCENARIO ${SCENARIO}: one of ${Object.keys(SCENARIOS).join(', ')}`);
+  }
+  for (const service of ['order', 'payment', 'stock']) {
+    setFaults(service, scenario[service] || []);
+  }
+}
+
+export function teardown() {
+  for (const service of ['order', 'payment', 'stock']) {
+    setFaults(service, null);
+  }
+}
+
+export function checkout() {
+  const res = http.post(
+    `${BASE_URL}/order/v2/checkout`,
+    JSON.stringify({ itemId: 1, quantity: 1 }),
+    {
+      headers: {
+        'Content-Type': 'application/json',
+        'Idempotency-Key': `chaos-${__VU}-${__ITER}-${Date.now()}`,
+      },
+      timeout: '35s',
+    }
+  );
+
+  const ok = check(res, { 'checkout 200/202': (r) => r.status === 200 || r.status === 202 });
+  if (ok) {
+    checkoutsSucceeded.add(1);
+  } else {
+    checkoutsFailed.add(1);
+  }
+}
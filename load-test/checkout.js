@@ -86,7 +86,7 @@ export function checkout() {
   ordersInitiated.add(1);
 
   const res = http.post(
-    `${BASE_URL}/checkout`,
+    `${BASE_URL}/v2/checkout`,
     JSON.stringify({ itemId: item.id, quantity }),
     {
       headers: {
@@ -98,7 +98,8 @@ export function checkout() {
     }
   );
 
-  const ok = check(res, { 'checkout 200': (r) => r.status === 200 });
+  // 202 is a successful checkout of a backordered item.
+  const ok = check(res, { 'checkout 200/202': (r) => r.status === 200 || r.status === 202 });
   if (ok) {
     ordersSucceeded.add(1);
   } else {
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giovaniif/e-commerce/idempotency"
+	"github.com/giovaniif/e-commerce/order/infra/auth"
+	"github.com/giovaniif/e-commerce/order/infra/backends"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// newAuthenticator builds the authenticator cfg.Auth describes, or nil when
+// checkouts are anonymous. keys replaces the configured API key store when
+// set. An unreachable key store is kept, with a check that reports it:
+// there is nothing to fall back to that would accept the same keys.
+func (s *Server) newAuthenticator(ctx context.Context, keys auth.KeyStore) (*auth.Authenticator, []backends.Check, error) {
+	cfg := s.cfg
+	if !cfg.Auth.Enabled {
+		fmt.Println("Checkout authentication: off (set AUTH_ENABLED)")
+		return nil, nil, nil
+	}
+	var checks []backends.Check
+	if keys == nil {
+		switch cfg.Auth.APIKeyStore {
+		case "redis":
+			rdb := redis.NewClient(&redis.Options{Addr: cfg.RedisAddr})
+			s.closers = append(s.closers, rdb.Close)
+			checks = append(checks, backends.Check{Name: "api_keys_redis", Probe: func(ctx context.Context) error { return rdb.Ping(ctx).Err() }})
+			keys = auth.NewRedisKeyStore(rdb)
+		case "mongo":
+			client, err := mongo.Connect(options.Client().ApplyURI(cfg.MongoURL))
+			if err != nil {
+				return nil, nil, fmt.Errorf("API key store: %w", err)
+			}
+			s.closers = append(s.closers, func() error { return client.Disconnect(context.Background()) })
+			checks = append(checks, backends.Check{Name: "api_keys_mongo", Probe: func(ctx context.Context) error { return client.Ping(ctx, nil) }})
+			keys = auth.NewMongoKeyStore(client)
+		}
+		for _, check := range checks {
+			if err := check.Probe(ctx); err != nil {
+				fmt.Printf("API key store unavailable, waiting for it: %v\n", err)
+			}
+		}
+	}
+	var verifier *auth.JWTVerifier
+	if cfg.Auth.JWKSFile != "" {
+		v, err := auth.LoadJWTVerifier(cfg.Auth.JWKSFile, auth.JWTConfig{
+			Issuer:      cfg.Auth.Issuer,
+			Audience:    cfg.Auth.Audience,
+			TenantClaim: cfg.Auth.TenantClaim,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		verifier = v
+	}
+	fmt.Printf("Checkout authentication: API keys (%s), JWT (%t)\n", cfg.Auth.APIKeyStore, verifier != nil)
+	return auth.NewAuthenticator(keys, verifier), checks, nil
+}
+
+// authenticate puts the caller of a checkout in the request context, or
+// lets every request through when authentication is off.
+func (s *Server) authenticate() gin.HandlerFunc {
+	if s.authenticator == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return s.authenticator.Middleware
+}
+
+// checkoutKey is the Idempotency-Key of a checkout scoped to its caller, so
+// the same key sent by two customers names two checkouts, all the way down
+// to Stock and Payment.
+func checkoutKey(c *gin.Context) string {
+	key := idempotency.FromHeader(c)
+	if key == "" {
+		return ""
+	}
+	return auth.FromContext(c.Request.Context()).ScopeKey(key)
+}
@@ -2,111 +2,115 @@ package api
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/giovaniif/e-commerce/idempotency"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/redis/go-redis/v9"
-	"github.com/giovaniif/e-commerce/order/infra/gateways"
+	"github.com/giovaniif/e-commerce/order/infra/auth"
+	"github.com/giovaniif/e-commerce/order/infra/config"
 	"github.com/giovaniif/e-commerce/order/infra/loki"
 	"github.com/giovaniif/e-commerce/order/infra/metrics"
+	"github.com/giovaniif/e-commerce/order/infra/problem"
 	"github.com/giovaniif/e-commerce/order/infra/requestid"
 	"github.com/giovaniif/e-commerce/order/infra/tracing"
+	"github.com/giovaniif/e-commerce/order/infra/version"
 	"github.com/giovaniif/e-commerce/order/protocols"
 	checkout "github.com/giovaniif/e-commerce/order/use_cases"
-	"go.mongodb.org/mongo-driver/v2/mongo"
-	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
-const defaultCheckoutTimeoutSec = 30
+const backendProbeInterval = 2 * time.Second
+
+// The unversioned /checkout is v1 as it was called before the API moved
+// under /v1; v1 itself gives way to v2, which answers in JSON.
+var (
+	unversioned = version.Deprecation{
+		To:     "/v1",
+		Since:  time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+		Sunset: time.Date(2027, 4, 30, 0, 0, 0, 0, time.UTC),
+	}
+	v1Deprecation = version.Deprecation{
+		From:   "/v1",
+		To:     "/v2",
+		Since:  time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+		Sunset: time.Date(2027, 10, 31, 0, 0, 0, 0, time.UTC),
+	}
+)
 
 type CheckoutRequest struct {
 	ItemId   int32 `json:"itemId"`
 	Quantity int32 `json:"quantity"`
 }
 
-func StartServer() {
-	stockBaseURL := os.Getenv("STOCK_BASE_URL")
-	if stockBaseURL == "" {
-		stockBaseURL = "http://localhost:3133"
-	}
-	paymentBaseURL := os.Getenv("PAYMENT_BASE_URL")
-	if paymentBaseURL == "" {
-		paymentBaseURL = "http://localhost:3132"
-	}
-
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			MaxIdleConns:        2000,
-			MaxIdleConnsPerHost: 1000,
-			IdleConnTimeout:     90 * time.Second,
-		},
-	}
-	stockGateway := gateways.NewStockGatewayHttp(httpClient, stockBaseURL)
-	paymentGateway := gateways.NewPaymentGatewayHttp(httpClient, paymentBaseURL)
-
-	var checkoutGateway protocols.CheckoutGateway
-	if redisAddr := os.Getenv("REDIS_ADDR"); redisAddr != "" {
-		rdb := redis.NewClient(&redis.Options{Addr: redisAddr})
-		if err := rdb.Ping(context.Background()).Err(); err != nil {
-			fmt.Printf("Redis ping failed (%s), using in-memory idempotency: %v\n", redisAddr, err)
-			checkoutGateway = gateways.NewCheckoutGatewayMemory()
-		} else {
-			checkoutGateway = gateways.NewCheckoutGatewayRedis(rdb)
-			fmt.Println("Checkout idempotency: Redis (TTL 24h)")
-		}
-	} else {
-		checkoutGateway = gateways.NewCheckoutGatewayMemory()
-		fmt.Println("Checkout idempotency: in-memory (set REDIS_ADDR for Redis)")
-	}
+// CheckoutResponse is the v2 answer to a checkout.
+type CheckoutResponse struct {
+	Status string `json:"status"`
+}
 
-	sleeperGateway := gateways.NewSleeper()
-
-	var orderGateway protocols.OrderGateway
-	if mongoURL := os.Getenv("MONGO_URL"); mongoURL != "" {
-		mongoClient, err := mongo.Connect(options.Client().ApplyURI(mongoURL))
-		if err != nil {
-			fmt.Printf("MongoDB connect failed (%s), using noop order gateway: %v\n", mongoURL, err)
-			orderGateway = &OrderGatewayNoop{}
-		} else if err := mongoClient.Ping(context.Background(), nil); err != nil {
-			fmt.Printf("MongoDB ping failed (%s), using noop order gateway: %v\n", mongoURL, err)
-			orderGateway = &OrderGatewayNoop{}
-		} else {
-			orderGateway = gateways.NewOrderGatewayMongo(mongoClient)
-			fmt.Println("Order gateway: MongoDB")
-		}
-	} else {
-		orderGateway = &OrderGatewayNoop{}
-		fmt.Println("Order gateway: noop (set MONGO_URL for MongoDB)")
+// StartServer runs the Order service until SIGINT or SIGTERM: it loads the
+// configuration, sets up the process-wide logging and tracing, and serves a
+// Server built from real backends.
+func StartServer() {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Invalid configuration: %v\n", err)
+		os.Exit(1)
 	}
-
-	checkoutUseCase := checkout.NewCheckout(stockGateway, paymentGateway, checkoutGateway, sleeperGateway, orderGateway)
+	checkout.MAX_RETRIES = cfg.Checkout.MaxRetries
+	checkout.BASE_DELAY = cfg.Checkout.RetryBaseDelay
 
 	logOut := io.Writer(os.Stdout)
 	var lokiWriter *loki.Writer
-	if lokiURL := os.Getenv("LOKI_URL"); lokiURL != "" {
-		if lw := loki.NewWriter(lokiURL, "order"); lw != nil {
+	if cfg.LokiURL != "" {
+		if lw := loki.NewWriter(cfg.LokiURL, "order"); lw != nil {
 			lokiWriter = lw
 			logOut = io.MultiWriter(os.Stdout, lw)
 		}
 	}
 	slog.SetDefault(slog.New(slog.NewJSONHandler(logOut, &slog.HandlerOptions{Level: slog.LevelInfo})))
-	slog.Info("order service started", "port", 3131)
+	shutdownTracing := tracing.Init("order", cfg.OTLPEndpoint)
 
-	shutdownTracing := tracing.Init("order")
+	server, err := NewServer(context.Background(), cfg, Deps{})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := server.Start(); err != nil {
+		fmt.Printf("Order server: %v\n", err)
+		os.Exit(1)
+	}
+	slog.Info("order service started", "port", cfg.Port)
+	fmt.Printf("Order is running on port %d\n", cfg.Port)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+	fmt.Println("Order shutting down...")
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		fmt.Printf("Order shutdown: %v\n", err)
+	} else {
+		fmt.Println("Order stopped")
+	}
 	if shutdownTracing != nil {
-		defer shutdownTracing()
+		shutdownTracing()
+	}
+	if lokiWriter != nil {
+		_ = lokiWriter.Close()
 	}
+}
 
+// routes builds the Order API around the checkout use case.
+func (s *Server) routes(checkoutUseCase *checkout.Checkout, idempotencyStore idempotency.Store) http.Handler {
+	cfg, monitor := s.cfg, s.monitor
 	r := gin.Default()
 	r.Use(func(c *gin.Context) {
 		id := c.GetHeader("X-Request-ID")
@@ -122,95 +126,143 @@ func StartServer() {
 	})
 	r.Use(tracing.Middleware("order"))
 	r.Use(metrics.Middleware)
+	r.Use(s.spec.Validate)
 
+	r.GET("/openapi.json", s.spec.Serve)
 	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 	r.GET("/health", func(c *gin.Context) {
-		status := "healthy"
-		redisCheck := "n/a"
-		if redisAddr := os.Getenv("REDIS_ADDR"); redisAddr != "" {
-			rdb := redis.NewClient(&redis.Options{Addr: redisAddr})
-			if err := rdb.Ping(c.Request.Context()).Err(); err != nil {
-				status = "degraded"
-				redisCheck = "down"
-			} else {
-				redisCheck = "up"
+		code, status := http.StatusOK, "healthy"
+		if !monitor.Ready() {
+			status = "degraded"
+			if cfg.Strict() {
+				code, status = http.StatusServiceUnavailable, "unavailable"
 			}
-			_ = rdb.Close()
 		}
-		c.JSON(http.StatusOK, gin.H{"status": status, "checks": gin.H{"redis": redisCheck}})
+		c.JSON(code, gin.H{"status": status, "checks": monitor.Report().Checks})
 	})
-
-	checkoutTimeoutSec := defaultCheckoutTimeoutSec
-	if s := os.Getenv("CHECKOUT_TIMEOUT_SECONDS"); s != "" {
-		if n, err := strconv.Atoi(s); err == nil && n > 0 {
-			checkoutTimeoutSec = n
-		}
+	r.GET("/livez", monitor.Livez)
+	r.GET("/readyz", monitor.Readyz)
+	// The admin routes are for operators on the internal network, and only
+	// with the admin token; Nginx does not expose them.
+	admin := r.Group("/admin", s.adminAuth())
+	if cfg.AdminEnabled {
+		admin.GET("/config", func(c *gin.Context) {
+			effective, err := cfg.Effective()
+			if err != nil {
+				problems.Abort(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, effective)
+		})
+	}
+	if s.faults != nil {
+		admin.GET("/faults", s.faults.List)
+		admin.PUT("/faults", s.faults.Replace)
+		admin.DELETE("/faults", s.faults.Clear)
 	}
 
-	r.POST("/checkout", func(c *gin.Context) {
-		contextWithTimeout, cancel := context.WithTimeout(c.Request.Context(), time.Duration(checkoutTimeoutSec)*time.Second)
-		defer cancel()
-
-		var checkoutRequest CheckoutRequest
-		if err := c.ShouldBindJSON(&checkoutRequest); err != nil {
-			c.String(http.StatusBadRequest, err.Error())
-			return
-		}
+	// checkoutIdempotency guards a checkout answered by respond, which also
+	// answers a request recovered from an order saved by a dead replica.
+	checkoutIdempotency := func(respond func(*gin.Context, checkout.Output)) gin.HandlerFunc {
+		return idempotency.Middleware(idempotency.Config{
+			Store:    idempotencyStore,
+			Scope:    "order:checkout",
+			Key:      checkoutKey,
+			Required: true,
+			// A checkout may retry its downstream calls for most of its timeout.
+			Lease: cfg.Checkout.Timeout,
+			// A checkout whose replica died may have saved its order already;
+			// answer from it instead of running the saga again.
+			Recover: func(c *gin.Context, key string) bool {
+				out, found, err := checkoutUseCase.Recover(c.Request.Context(), key)
+				if err != nil {
+					slog.ErrorContext(c.Request.Context(), "checkout recovery failed", "error", err)
+					return false
+				}
+				if !found {
+					return false
+				}
+				respond(c, out)
+				return true
+			},
+		})
+	}
+	// Both versions run the same checkout; they differ only in how they
+	// answer a successful one.
+	runCheckout := func(respond func(*gin.Context, checkout.Output)) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			contextWithTimeout, cancel := context.WithTimeout(c.Request.Context(), cfg.Checkout.Timeout)
+			defer cancel()
 
-		idempotencyKey := c.GetHeader("Idempotency-Key")
-		if idempotencyKey == "" {
-			c.String(http.StatusBadRequest, "Idempotency-Key header is required")
-			return
-		}
+			var checkoutRequest CheckoutRequest
+			if err := c.ShouldBindJSON(&checkoutRequest); err != nil {
+				problem.Abort(c, problem.New(http.StatusBadRequest, problem.InvalidRequest, err.Error()))
+				return
+			}
 
-		requestID := requestid.FromContext(contextWithTimeout)
-		err := checkoutUseCase.Checkout(contextWithTimeout, checkout.Input{
-			ItemId:         checkoutRequest.ItemId,
-			Quantity:       checkoutRequest.Quantity,
-			IdempotencyKey: idempotencyKey,
-		})
-		if err != nil {
-			if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
-				slog.ErrorContext(contextWithTimeout, "checkout timeout", "request_id", requestID, "item_id", checkoutRequest.ItemId, "quantity", checkoutRequest.Quantity, "error", err)
-				c.String(http.StatusGatewayTimeout, err.Error())
+			principal := auth.FromContext(contextWithTimeout)
+			requestID := requestid.FromContext(contextWithTimeout)
+			out, err := checkoutUseCase.Checkout(contextWithTimeout, checkout.Input{
+				ItemId:         checkoutRequest.ItemId,
+				Quantity:       checkoutRequest.Quantity,
+				IdempotencyKey: checkoutKey(c),
+				CustomerId:     principal.CustomerID,
+				TenantId:       principal.TenantID,
+			})
+			if err != nil {
+				p := problems.For(err)
+				if p.Code == problem.Timeout {
+					slog.ErrorContext(contextWithTimeout, "checkout timeout", "request_id", requestID, "customer_id", principal.CustomerID, "item_id", checkoutRequest.ItemId, "quantity", checkoutRequest.Quantity, "error", err)
+				} else {
+					slog.ErrorContext(contextWithTimeout, "checkout failed", "request_id", requestID, "customer_id", principal.CustomerID, "item_id", checkoutRequest.ItemId, "quantity", checkoutRequest.Quantity, "code", p.Code, "error", err)
+				}
+				problem.Abort(c, p)
 			} else {
-				slog.ErrorContext(contextWithTimeout, "checkout failed", "request_id", requestID, "item_id", checkoutRequest.ItemId, "quantity", checkoutRequest.Quantity, "error", err)
-				c.String(http.StatusInternalServerError, err.Error())
+				respond(c, out)
 			}
-		} else {
-			c.String(http.StatusOK, "Checkout successful")
 		}
-	})
+	}
 
-	srv := &http.Server{Addr: ":3131", Handler: r}
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			fmt.Printf("Order server: %v\n", err)
-		}
-	}()
-	fmt.Println("Order is running on port 3131")
+	v1 := r.Group("/v1", v1Deprecation.Middleware)
+	v1.POST("/checkout", s.gate(), s.authenticate(), checkoutIdempotency(checkoutResponse), runCheckout(checkoutResponse))
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
-	<-quit
-	fmt.Println("Order shutting down...")
-	if shutdownTracing != nil {
-		shutdownTracing()
-	}
-	if lokiWriter != nil {
-		_ = lokiWriter.Close()
+	v2 := r.Group("/v2")
+	v2.POST("/checkout", s.gate(), s.authenticate(), checkoutIdempotency(checkoutResponseV2), runCheckout(checkoutResponseV2))
+	return version.Legacy(r, unversioned, "/checkout")
+}
+
+func checkoutResponse(c *gin.Context, out checkout.Output) {
+	if out.Status == protocols.OrderStatusBackordered {
+		c.String(http.StatusAccepted, "Checkout successful: item backordered")
+		return
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		fmt.Printf("Order shutdown: %v\n", err)
-	} else {
-		fmt.Println("Order stopped")
+	c.String(http.StatusOK, "Checkout successful")
+}
+
+// checkoutResponseV2 answers a checkout with the status of its order, 202
+// when the item is on backorder.
+func checkoutResponseV2(c *gin.Context, out checkout.Output) {
+	code := http.StatusOK
+	if out.Status == protocols.OrderStatusBackordered {
+		code = http.StatusAccepted
 	}
+	c.JSON(code, CheckoutResponse{Status: out.Status})
 }
 
 type OrderGatewayNoop struct{}
 
-func (g *OrderGatewayNoop) SaveOrder(ctx context.Context, idempotencyKey string, itemId int32, quantity int32) error {
+func (g *OrderGatewayNoop) SaveOrder(ctx context.Context, order protocols.Order) error {
+	return nil
+}
+
+func (g *OrderGatewayNoop) FindOrderStatus(ctx context.Context, idempotencyKey string) (string, error) {
+	return "", nil
+}
+
+func (g *OrderGatewayNoop) FindBackorderedOrders(ctx context.Context) ([]protocols.Order, error) {
+	return nil, nil
+}
+
+func (g *OrderGatewayNoop) UpdateOrderStatus(ctx context.Context, idempotencyKey string, status string) error {
 	return nil
 }
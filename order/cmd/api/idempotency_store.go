@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/giovaniif/e-commerce/idempotency"
+	"github.com/giovaniif/e-commerce/order/infra/backends"
+	_ "github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+)
+
+// newIdempotencyStore builds the store cfg.Idempotency picks. The Postgres
+// store is migrated; purging its expired keys is left to the caller. The
+// client it opens is closed on Shutdown.
+//
+// When strict, a backend that is down is kept, with a check that reports it
+// until it is reachable; otherwise an unreachable backend falls back to
+// memory and its client is closed right away.
+func (s *Server) newIdempotencyStore(ctx context.Context) (idempotency.Store, []backends.Check, error) {
+	cfg := s.cfg
+	switch cfg.Idempotency.Store {
+	case "postgres":
+		db, err := sql.Open("postgres", cfg.Idempotency.PostgresURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("open idempotency postgres: %w", err)
+		}
+		store := idempotency.NewPostgresStore(db)
+		check := backends.Check{Name: "idempotency_postgres", Probe: migrateOnce(store, db)}
+		if err := check.Probe(ctx); err != nil {
+			if !cfg.Strict() {
+				fmt.Printf("Postgres migration failed, using in-memory idempotency: %v\n", err)
+				db.Close()
+				return idempotency.NewMemoryStore(), nil, nil
+			}
+			fmt.Printf("Idempotency Postgres unavailable, waiting for it: %v\n", err)
+		}
+		s.closers = append(s.closers, db.Close)
+		fmt.Println("Checkout idempotency: Postgres (TTL 24h)")
+		return store, []backends.Check{check}, nil
+	case "redis":
+		rdb := redis.NewClient(&redis.Options{Addr: cfg.RedisAddr})
+		check := backends.Check{Name: "redis", Probe: func(ctx context.Context) error { return rdb.Ping(ctx).Err() }}
+		if err := check.Probe(ctx); err != nil {
+			if !cfg.Strict() {
+				fmt.Printf("Redis ping failed (%s), using in-memory idempotency: %v\n", cfg.RedisAddr, err)
+				rdb.Close()
+				return idempotency.NewMemoryStore(), nil, nil
+			}
+			fmt.Printf("Redis unavailable (%s), waiting for it: %v\n", cfg.RedisAddr, err)
+		}
+		s.closers = append(s.closers, rdb.Close)
+		fmt.Println("Checkout idempotency: Redis (TTL 24h)")
+		return idempotency.NewRedisStore(rdb), []backends.Check{check}, nil
+	}
+	fmt.Println("Checkout idempotency: in-memory (set IDEMPOTENCY_STORE or REDIS_ADDR)")
+	return idempotency.NewMemoryStore(), nil, nil
+}
+
+// migrateOnce probes the database, applying the migrations the first time it
+// is reachable.
+func migrateOnce(store *idempotency.PostgresStore, db *sql.DB) func(context.Context) error {
+	var migrated atomic.Bool
+	return func(ctx context.Context) error {
+		if !migrated.Load() {
+			if err := store.Migrate(ctx); err != nil {
+				return err
+			}
+			migrated.Store(true)
+		}
+		return db.PingContext(ctx)
+	}
+}
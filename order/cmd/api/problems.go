@@ -0,0 +1,25 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/giovaniif/e-commerce/order/infra"
+	"github.com/giovaniif/e-commerce/order/infra/problem"
+)
+
+// problems maps the errors of a checkout to the problem it is answered with.
+// Refusals from Stock and Payment keep their code; a downstream that kept
+// failing is a 502 and one that ran out of time a 504.
+var problems = problem.Mapper{
+	{Err: context.DeadlineExceeded, Status: http.StatusGatewayTimeout, Code: problem.Timeout},
+	{Err: context.Canceled, Status: http.StatusGatewayTimeout, Code: problem.Timeout},
+	{Err: infra.ErrTimeout, Status: http.StatusGatewayTimeout, Code: problem.Timeout},
+	{Err: infra.ErrItemNotFound, Status: http.StatusNotFound, Code: problem.ItemNotFound},
+	{Err: infra.ErrInsufficientStock, Status: http.StatusConflict, Code: problem.InsufficientStock},
+	{Err: infra.ErrPurchaseLimitExceeded, Status: http.StatusTooManyRequests, Code: problem.PurchaseLimitExceeded},
+	{Err: infra.ErrPaymentDeclined, Status: http.StatusPaymentRequired, Code: problem.PaymentDeclined},
+	{Err: infra.ErrReservationClosed, Status: http.StatusConflict, Code: problem.ReservationClosed},
+	{Err: infra.ErrInProgress, Status: http.StatusConflict, Code: problem.IdempotencyInProgress},
+	{Err: infra.ErrNetwork, Status: http.StatusBadGateway, Code: problem.Unavailable},
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giovaniif/e-commerce/hmacauth"
+	"github.com/giovaniif/e-commerce/idempotency"
+	"github.com/giovaniif/e-commerce/order/infra/auth"
+	"github.com/giovaniif/e-commerce/order/infra/backends"
+	"github.com/giovaniif/e-commerce/order/infra/config"
+	"github.com/giovaniif/e-commerce/order/infra/faults"
+	"github.com/giovaniif/e-commerce/order/infra/gateways"
+	"github.com/giovaniif/e-commerce/order/infra/openapi"
+	"github.com/giovaniif/e-commerce/order/protocols"
+	checkout "github.com/giovaniif/e-commerce/order/use_cases"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"google.golang.org/grpc"
+)
+
+// Deps are the collaborators the Order server is built from. A nil field is
+// built from the configuration, so tests can replace any of them with a fake
+// and keep the rest real.
+type Deps struct {
+	// HTTPClient is shared by the Stock and Payment gateways and their checks.
+	HTTPClient  *http.Client
+	Stock       protocols.StockGateway
+	Payment     protocols.PaymentGateway
+	Orders      protocols.OrderGateway
+	Sleeper     protocols.Sleeper
+	Idempotency idempotency.Store
+	// APIKeys stands in for the configured API key store when AUTH_ENABLED.
+	APIKeys auth.KeyStore
+}
+
+// Server is a wired Order service: its HTTP handler and the background work
+// behind it. Nothing listens or runs in the background until Start.
+type Server struct {
+	cfg           config.Config
+	handler       http.Handler
+	monitor       *backends.Monitor
+	faults        *faults.Injector
+	authenticator *auth.Authenticator
+	signer        *hmacauth.Signer
+	spec          *openapi.Spec
+	background    []func(context.Context)
+	closers       []func() error
+
+	listener net.Listener
+	srv      *http.Server
+	stop     context.CancelFunc
+}
+
+// NewServer builds the Order service from cfg and deps. ctx bounds the
+// probes made while connecting to backends. In strict mode a backend that
+// cannot be set up is an error; in lenient mode it is replaced in process.
+func NewServer(ctx context.Context, cfg config.Config, deps Deps) (_ *Server, err error) {
+	s := &Server{cfg: cfg}
+	defer func() {
+		if err != nil {
+			s.close()
+		}
+	}()
+	if s.spec, err = openapi.Load(); err != nil {
+		return nil, err
+	}
+
+	httpClient := deps.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{
+			Transport: &http.Transport{
+				MaxIdleConns:        cfg.HTTPClient.MaxIdleConns,
+				MaxIdleConnsPerHost: cfg.HTTPClient.MaxIdleConnsPerHost,
+				IdleConnTimeout:     cfg.HTTPClient.IdleConnTimeout,
+			},
+		}
+	}
+
+	if s.signer, err = s.newServiceSigner(); err != nil {
+		return nil, err
+	}
+	httpClient = signedClient(httpClient, s.signer)
+
+	var checks []backends.Check
+	idempotencyStore := deps.Idempotency
+	if idempotencyStore == nil {
+		store, storeChecks, err := s.newIdempotencyStore(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if pg, ok := store.(*idempotency.PostgresStore); ok {
+			s.background = append(s.background, func(ctx context.Context) { pg.RunPurge(ctx, cfg.Idempotency.PurgeInterval) })
+		}
+		idempotencyStore = store
+		checks = append(checks, storeChecks...)
+	}
+
+	orderGateway := deps.Orders
+	if orderGateway == nil {
+		gateway, check, err := s.newOrderGateway(ctx)
+		if err != nil {
+			return nil, err
+		}
+		orderGateway = gateway
+		if check != nil {
+			checks = append(checks, *check)
+		}
+	}
+
+	authenticator, authChecks, err := s.newAuthenticator(ctx, deps.APIKeys)
+	if err != nil {
+		return nil, err
+	}
+	s.authenticator = authenticator
+	checks = append(checks, authChecks...)
+
+	// Order can take checkouts while Stock or Payment are down (they fail
+	// and are retried), so those checks only show up in the report.
+	stockGateway := deps.Stock
+	if stockGateway == nil {
+		if cfg.Transport == "grpc" {
+			conn, err := s.dial(cfg.StockGRPCAddr)
+			if err != nil {
+				return nil, fmt.Errorf("stock gRPC client: %w", err)
+			}
+			stockGateway = gateways.NewStockGatewayGrpc(conn)
+			checks = append(checks, backends.GRPCCheck("stock", conn))
+		} else {
+			stockGateway = gateways.NewStockGatewayHttp(httpClient, cfg.StockBaseURL)
+			checks = append(checks, backends.HTTPCheck("stock", httpClient, cfg.StockBaseURL+"/livez"))
+		}
+	}
+	paymentGateway := deps.Payment
+	if paymentGateway == nil {
+		if cfg.Transport == "grpc" {
+			conn, err := s.dial(cfg.PaymentGRPCAddr)
+			if err != nil {
+				return nil, fmt.Errorf("payment gRPC client: %w", err)
+			}
+			paymentGateway = gateways.NewPaymentGatewayGrpc(conn)
+			checks = append(checks, backends.GRPCCheck("payment", conn))
+		} else {
+			paymentGateway = gateways.NewPaymentGatewayHttp(httpClient, cfg.PaymentBaseURL)
+			checks = append(checks, backends.HTTPCheck("payment", httpClient, cfg.PaymentBaseURL+"/livez"))
+		}
+	}
+	fmt.Printf("Downstream transport: %s\n", cfg.Transport)
+	if cfg.Faults.Enabled {
+		s.faults = faults.NewInjector(cfg.Faults.Rules)
+		stockGateway = s.faults.Stock(stockGateway)
+		paymentGateway = s.faults.Payment(paymentGateway)
+		fmt.Printf("Fault injection enabled with %d rule(s)\n", len(cfg.Faults.Rules))
+	}
+	sleeper := deps.Sleeper
+	if sleeper == nil {
+		sleeper = gateways.NewSleeper()
+	}
+
+	s.monitor = backends.NewMonitor(checks...)
+	s.background = append(s.background, func(ctx context.Context) { s.monitor.Run(ctx, backendProbeInterval) })
+
+	checkoutUseCase := checkout.NewCheckout(stockGateway, paymentGateway, sleeper, orderGateway)
+	s.background = append(s.background, func(ctx context.Context) { checkoutUseCase.RunBackorders(ctx, cfg.Checkout.BackorderInterval) })
+	s.handler = s.routes(checkoutUseCase, idempotencyStore)
+	return s, nil
+}
+
+// dial opens a gRPC connection the server closes on Shutdown, signing
+// every call when service authentication is on.
+func (s *Server) dial(addr string) (*grpc.ClientConn, error) {
+	var interceptors []grpc.UnaryClientInterceptor
+	if s.signer != nil {
+		interceptors = append(interceptors, hmacauth.UnaryClientInterceptor(s.signer))
+	}
+	conn, err := gateways.DialGRPC(addr, interceptors...)
+	if err != nil {
+		return nil, err
+	}
+	s.closers = append(s.closers, conn.Close)
+	return conn, nil
+}
+
+// newOrderGateway connects to MongoDB when MONGO_URL is set, returning the
+// check that tracks it; the client is closed on Shutdown. In lenient mode an
+// unreachable MongoDB is replaced by the noop gateway; in strict mode the
+// client is kept and reconnects on its own.
+func (s *Server) newOrderGateway(ctx context.Context) (protocols.OrderGateway, *backends.Check, error) {
+	cfg := s.cfg
+	if cfg.MongoURL == "" {
+		fmt.Println("Order gateway: noop (set MONGO_URL for MongoDB)")
+		return &OrderGatewayNoop{}, nil, nil
+	}
+	mongoClient, err := mongo.Connect(options.Client().ApplyURI(cfg.MongoURL))
+	if err != nil {
+		if cfg.Strict() {
+			return nil, nil, fmt.Errorf("MongoDB connect failed: %w", err)
+		}
+		fmt.Printf("MongoDB connect failed, using noop order gateway: %v\n", err)
+		return &OrderGatewayNoop{}, nil, nil
+	}
+	if err := mongoClient.Ping(ctx, nil); err != nil {
+		if !cfg.Strict() {
+			fmt.Printf("MongoDB ping failed, using noop order gateway: %v\n", err)
+			mongoClient.Disconnect(context.Background())
+			return &OrderGatewayNoop{}, nil, nil
+		}
+		fmt.Printf("MongoDB unavailable, waiting for it: %v\n", err)
+	}
+	s.closers = append(s.closers, func() error { return mongoClient.Disconnect(context.Background()) })
+	fmt.Println("Order gateway: MongoDB")
+	check := backends.Check{Name: "mongo", Probe: func(ctx context.Context) error { return mongoClient.Ping(ctx, nil) }}
+	return gateways.NewOrderGatewayMongo(mongoClient), &check, nil
+}
+
+// Handler serves the Order API. It can be mounted on an httptest.Server
+// without calling Start; the backend checks are then never probed, so only
+// lenient mode lets requests through.
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// Start listens on the configured port, port 0 picking a free one, and runs
+// the background work until Shutdown.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.cfg.Port))
+	if err != nil {
+		return err
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	for _, run := range s.background {
+		go run(ctx)
+	}
+	s.listener, s.stop = listener, stop
+	s.srv = &http.Server{Handler: s.handler}
+	go func() {
+		if err := s.srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("Order server: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// Addr is the address Start listens on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Shutdown stops the background work and waits for in-flight requests until
+// ctx is done, then closes the connections and clients the server opened.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.srv == nil {
+		return s.close()
+	}
+	s.stop()
+	err := s.srv.Shutdown(ctx)
+	return errors.Join(err, s.close())
+}
+
+func (s *Server) close() error {
+	var err error
+	for _, closeConn := range s.closers {
+		err = errors.Join(err, closeConn())
+	}
+	s.closers = nil
+	return err
+}
+
+// gate holds requests back in strict mode until the required backends are
+// reachable; lenient mode already fell back for whatever was down at boot
+// and just reports it.
+func (s *Server) gate() gin.HandlerFunc {
+	if s.cfg.Strict() {
+		return s.monitor.Gate()
+	}
+	return func(c *gin.Context) { c.Next() }
+}
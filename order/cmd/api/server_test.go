@@ -0,0 +1,588 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/giovaniif/e-commerce/hmacauth"
+	"github.com/giovaniif/e-commerce/order/infra/config"
+	"github.com/giovaniif/e-commerce/order/protocols"
+)
+
+// adminToken guards the /admin routes of the tests that set ADMIN_TOKEN.
+const adminToken = "admin-0123456789abcdef0123456789abcdef"
+
+// downstream fakes the Stock and Payment endpoints the Order gateways call,
+// recording each call as "path" or "path:amount". A chargeCode makes Payment
+// refuse the charge with that problem code; a verifier makes both turn away
+// calls not signed by one of its keys. With backorder, Stock backorders
+// every reservation and refuses to complete it until restocked.
+type downstream struct {
+	mu         sync.Mutex
+	calls      []string
+	chargeCode string
+	verifier   *hmacauth.Verifier
+	backorder  bool
+	restocked  bool
+}
+
+// guard puts h behind the verifier of d, if any.
+func (d *downstream) guard(h http.Handler) http.Handler {
+	if d.verifier == nil {
+		return h
+	}
+	r := gin.New()
+	r.NoRoute(hmacauth.Middleware(d.verifier), func(c *gin.Context) {
+		c.Status(http.StatusOK) // NoRoute starts out as a 404
+		h.ServeHTTP(c.Writer, c.Request)
+	})
+	return r
+}
+
+func (d *downstream) record(call string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls = append(d.calls, call)
+}
+
+func (d *downstream) Calls() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.calls...)
+}
+
+func (d *downstream) stock() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/reserve", func(w http.ResponseWriter, r *http.Request) {
+		d.record("reserve")
+		w.Header().Set("Content-Type", "application/json")
+		if d.backorder {
+			w.WriteHeader(http.StatusAccepted)
+			io.WriteString(w, `{"reservationId":7,"totalFee":42.5,"status":"backordered"}`)
+			return
+		}
+		io.WriteString(w, `{"reservationId":7,"totalFee":42.5,"status":"reserved"}`)
+	})
+	mux.HandleFunc("POST /v1/complete", func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		waiting := d.backorder && !d.restocked
+		d.mu.Unlock()
+		if waiting {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, `{"status":409,"code":"reservation_backordered"}`)
+			return
+		}
+		d.record("complete")
+	})
+	mux.HandleFunc("POST /v1/release", func(w http.ResponseWriter, r *http.Request) { d.record("release") })
+	return d.guard(mux)
+}
+
+func (d *downstream) payment() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v2/charge", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			AmountCents int64 `json:"amountCents"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		d.record(fmt.Sprintf("charge:%g", float64(req.AmountCents)/100))
+		if d.chargeCode != "" {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusPaymentRequired)
+			fmt.Fprintf(w, `{"status":402,"code":%q}`, d.chargeCode)
+		}
+	})
+	return d.guard(mux)
+}
+
+type fakeOrders struct {
+	mu    sync.Mutex
+	saved map[string]protocols.Order
+}
+
+func (f *fakeOrders) SaveOrder(ctx context.Context, order protocols.Order) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.saved[order.IdempotencyKey] = order
+	return nil
+}
+
+func (f *fakeOrders) FindOrderStatus(ctx context.Context, idempotencyKey string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.saved[idempotencyKey].Status, nil
+}
+
+func (f *fakeOrders) FindBackorderedOrders(ctx context.Context) ([]protocols.Order, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var orders []protocols.Order
+	for _, o := range f.saved {
+		if o.Status == protocols.OrderStatusBackordered {
+			orders = append(orders, o)
+		}
+	}
+	return orders, nil
+}
+
+func (f *fakeOrders) UpdateOrderStatus(ctx context.Context, idempotencyKey string, status string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if o, ok := f.saved[idempotencyKey]; ok {
+		o.Status = status
+		f.saved[idempotencyKey] = o
+	}
+	return nil
+}
+
+type noSleep struct{}
+
+func (noSleep) Sleep(time.Duration) {}
+
+// newTestServer builds an Order server in lenient mode against d from the
+// default configuration, adjusted by configure when given.
+func newTestServer(t *testing.T, d *downstream, orders *fakeOrders, configure func(*config.Config)) *Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	stock := httptest.NewServer(d.stock())
+	t.Cleanup(stock.Close)
+	payment := httptest.NewServer(d.payment())
+	t.Cleanup(payment.Close)
+
+	t.Setenv("ENV_FILE", "")
+	t.Setenv("STARTUP_MODE", "lenient")
+	t.Setenv("STOCK_BASE_URL", stock.URL)
+	t.Setenv("PAYMENT_BASE_URL", payment.URL)
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config: %v", err)
+	}
+	if configure != nil {
+		configure(&cfg)
+	}
+	server, err := NewServer(context.Background(), cfg, Deps{Orders: orders, Sleeper: noSleep{}})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	return server
+}
+
+func postCheckout(t *testing.T, url, key string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url+"/checkout", strings.NewReader(`{"itemId":1,"quantity":2}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("checkout: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestServer_CheckoutReservesChargesAndCompletes(t *testing.T) {
+	d := &downstream{}
+	orders := &fakeOrders{saved: map[string]protocols.Order{}}
+	ts := httptest.NewServer(newTestServer(t, d, orders, nil).Handler())
+	defer ts.Close()
+
+	code, body := postCheckout(t, ts.URL, "order-1")
+	if code != http.StatusOK || body != "Checkout successful" {
+		t.Fatalf("checkout = %d %q", code, body)
+	}
+	want := []string{"reserve", "charge:42.5", "complete"}
+	if got := d.Calls(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("downstream calls = %v, want %v", got, want)
+	}
+	if status := orders.saved["order-1"].Status; status != "completed" {
+		t.Errorf("saved order status = %q, want completed", status)
+	}
+
+	// A retry with the same key is answered without calling downstream.
+	code, body = postCheckout(t, ts.URL, "order-1")
+	if code != http.StatusOK || body != "Checkout successful" {
+		t.Fatalf("replayed checkout = %d %q", code, body)
+	}
+	if got := d.Calls(); len(got) != len(want) {
+		t.Errorf("replay called downstream: %v", got)
+	}
+}
+
+func TestServer_CheckoutReleasesStockWhenChargeFails(t *testing.T) {
+	d := &downstream{chargeCode: "payment_declined"}
+	orders := &fakeOrders{saved: map[string]protocols.Order{}}
+	ts := httptest.NewServer(newTestServer(t, d, orders, nil).Handler())
+	defer ts.Close()
+
+	code, body := postCheckout(t, ts.URL, "order-2")
+	if code != http.StatusPaymentRequired || !strings.Contains(body, `"code":"payment_declined"`) {
+		t.Fatalf("checkout = %d %s, want a payment_declined problem", code, body)
+	}
+	want := []string{"reserve", "charge:42.5", "release"}
+	if got := d.Calls(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("downstream calls = %v, want %v", got, want)
+	}
+	if len(orders.saved) != 0 {
+		t.Errorf("saved orders = %v, want none", orders.saved)
+	}
+}
+
+func TestServer_CompletesBackordersOnceRestocked(t *testing.T) {
+	d := &downstream{backorder: true}
+	orders := &fakeOrders{saved: map[string]protocols.Order{}}
+	server := newTestServer(t, d, orders, func(cfg *config.Config) {
+		cfg.Port = 0
+		cfg.Checkout.BackorderInterval = 10 * time.Millisecond
+	})
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer server.Shutdown(context.Background())
+	url := "http://" + server.Addr()
+
+	code, body := postCheckout(t, url, "backorder-1")
+	if code != http.StatusAccepted {
+		t.Fatalf("checkout = %d %q, want 202", code, body)
+	}
+	status := func() string {
+		orders.mu.Lock()
+		defer orders.mu.Unlock()
+		return orders.saved["backorder-1"].Status
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := status(); got != protocols.OrderStatusBackordered {
+		t.Fatalf("order before the restock = %q, want backordered", got)
+	}
+
+	d.mu.Lock()
+	d.restocked = true
+	d.mu.Unlock()
+	deadline := time.Now().Add(5 * time.Second)
+	for status() != protocols.OrderStatusCompleted {
+		if time.Now().After(deadline) {
+			t.Fatalf("order after the restock = %q, want completed", status())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	want := []string{"reserve", "charge:42.5", "complete"}
+	if got := d.Calls(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("downstream calls = %v, want %v", got, want)
+	}
+}
+
+func TestServer_StartServesUntilShutdown(t *testing.T) {
+	server := newTestServer(t, &downstream{}, &fakeOrders{saved: map[string]protocols.Order{}}, func(cfg *config.Config) { cfg.Port = 0 })
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	resp, err := http.Get("http://" + server.Addr() + "/livez")
+	if err != nil {
+		t.Fatalf("livez: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("livez status = %d, want 200", resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if _, err := http.Get("http://" + server.Addr() + "/livez"); err == nil {
+		t.Error("server still answering after Shutdown")
+	}
+}
+
+func TestServer_ClosesTheClientsItOpened(t *testing.T) {
+	mr := miniredis.RunT(t)
+	t.Setenv("REDIS_ADDR", mr.Addr())
+	connections := func() int { return mr.CurrentConnectionCount() }
+	closed := func(when string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for connections() > 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("%d Redis connection(s) still open %s", connections(), when)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	server := newTestServer(t, &downstream{}, &fakeOrders{saved: map[string]protocols.Order{}}, nil)
+	ts := httptest.NewServer(server.Handler())
+	if code, body := postCheckout(t, ts.URL, "order-1"); code != http.StatusOK {
+		t.Fatalf("checkout = %d %q", code, body)
+	}
+	ts.Close()
+	if connections() == 0 {
+		t.Fatal("checkout idempotency did not go through Redis")
+	}
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	closed("after Shutdown")
+
+	// A server that fails to build closes what it opened before failing.
+	t.Setenv("AUTH_ENABLED", "true")
+	t.Setenv("AUTH_JWKS_FILE", filepath.Join(t.TempDir(), "missing.json"))
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config: %v", err)
+	}
+	if _, err := NewServer(context.Background(), cfg, Deps{Orders: &fakeOrders{}}); err == nil {
+		t.Fatal("NewServer accepted a missing JWKS file")
+	}
+	closed("after NewServer failed")
+}
+
+func TestServer_InjectedStockTimeoutsFailTheCheckout(t *testing.T) {
+	t.Setenv("FAULTS_ENABLED", "true")
+	t.Setenv("FAULTS", `[{"target":"stock.Reserve","status":504}]`)
+	t.Setenv("ADMIN_TOKEN", adminToken)
+	d := &downstream{}
+	orders := &fakeOrders{saved: map[string]protocols.Order{}}
+	ts := httptest.NewServer(newTestServer(t, d, orders, nil).Handler())
+	defer ts.Close()
+
+	code, body := postCheckout(t, ts.URL, "order-3")
+	if code != http.StatusGatewayTimeout || !strings.Contains(body, `"code":"timeout"`) {
+		t.Fatalf("checkout = %d %q, want a timeout problem from the injected 504", code, body)
+	}
+	if got := d.Calls(); len(got) != 0 {
+		t.Errorf("downstream calls = %v, want none", got)
+	}
+
+	// Clearing the rules takes the admin token, and lets the next checkout
+	// through.
+	clearFaults := func(token string) int {
+		req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/admin/faults", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("clear faults: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := clearFaults(""); code != http.StatusUnauthorized {
+		t.Fatalf("clear faults without the admin token = %d, want 401", code)
+	}
+	if code, _ := postCheckout(t, ts.URL, "order-5"); code != http.StatusGatewayTimeout {
+		t.Fatalf("checkout after a refused clear = %d, want the injected timeout", code)
+	}
+	if code := clearFaults(adminToken); code != http.StatusOK && code != http.StatusNoContent {
+		t.Fatalf("clear faults = %d, want success", code)
+	}
+	if code, body := postCheckout(t, ts.URL, "order-4"); code != http.StatusOK {
+		t.Fatalf("checkout after clearing = %d %q", code, body)
+	}
+}
+
+func TestServer_RejectsCheckoutsTheSpecForbids(t *testing.T) {
+	d := &downstream{}
+	orders := &fakeOrders{saved: map[string]protocols.Order{}}
+	ts := httptest.NewServer(newTestServer(t, d, orders, nil).Handler())
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/checkout", strings.NewReader(`{"itemId":1,"quantity":"two"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", "order-5")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("checkout: %v", err)
+	}
+	defer resp.Body.Close()
+	var answer struct {
+		Code   string `json:"code"`
+		Detail string `json:"detail"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest || answer.Code != "invalid_request" || !strings.Contains(answer.Detail, "body.quantity") {
+		t.Fatalf("checkout = %d %+v, want an invalid_request problem naming body.quantity", resp.StatusCode, answer)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Content-Type = %q, want application/problem+json", ct)
+	}
+	if got := d.Calls(); len(got) != 0 {
+		t.Errorf("downstream calls = %v, want none", got)
+	}
+
+	spec, err := http.Get(ts.URL + "/openapi.json")
+	if err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+	defer spec.Body.Close()
+	var doc struct {
+		Paths map[string]any `json:"paths"`
+	}
+	if err := json.NewDecoder(spec.Body).Decode(&doc); err != nil {
+		t.Fatalf("decode openapi.json: %v", err)
+	}
+	for _, path := range []string{"/v1/checkout", "/v2/checkout"} {
+		if _, ok := doc.Paths[path]; !ok {
+			t.Errorf("openapi.json has no %s", path)
+		}
+	}
+}
+
+func TestServer_ServesCheckoutVersionsSideBySide(t *testing.T) {
+	d := &downstream{}
+	orders := &fakeOrders{saved: map[string]protocols.Order{}}
+	ts := httptest.NewServer(newTestServer(t, d, orders, nil).Handler())
+	defer ts.Close()
+
+	cases := []struct {
+		path, body   string
+		sunset, link string
+	}{
+		{"/checkout", "Checkout successful", "Fri, 30 Apr 2027 00:00:00 GMT", `</v1/checkout>; rel="successor-version"`},
+		{"/v1/checkout", "Checkout successful", "Sun, 31 Oct 2027 00:00:00 GMT", `</v2/checkout>; rel="successor-version"`},
+		{"/v2/checkout", `{"status":"completed"}`, "", ""},
+	}
+	for i, tc := range cases {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+tc.path, strings.NewReader(`{"itemId":1,"quantity":2}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", fmt.Sprintf("version-%d", i))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != tc.body {
+			t.Fatalf("%s = %d %q, want 200 %q", tc.path, resp.StatusCode, body, tc.body)
+		}
+		if got := resp.Header.Get("Deprecation") != ""; got != (tc.sunset != "") {
+			t.Errorf("%s: deprecated = %v", tc.path, got)
+		}
+		if got := resp.Header.Get("Sunset"); got != tc.sunset {
+			t.Errorf("%s: Sunset = %q, want %q", tc.path, got, tc.sunset)
+		}
+		if got := resp.Header.Get("Link"); got != tc.link {
+			t.Errorf("%s: Link = %q, want %q", tc.path, got, tc.link)
+		}
+	}
+}
+
+// signedToken is an ES256 JWT for customer in tenant-1, and the JWKS that
+// verifies it.
+func signedToken(t *testing.T, customer string) (token string, jwks []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := base64.RawURLEncoding.EncodeToString
+	jwks, _ = json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "EC", "crv": "P-256", "kid": "test",
+		"x": enc(key.X.FillBytes(make([]byte, 32))), "y": enc(key.Y.FillBytes(make([]byte, 32))),
+	}}})
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": "test"})
+	claims, _ := json.Marshal(map[string]any{"sub": customer, "tenant_id": "tenant-1", "exp": time.Now().Add(time.Hour).Unix()})
+	signed := enc(header) + "." + enc(claims)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + enc(append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)), jwks
+}
+
+func TestServer_CheckoutAuthenticatesCustomers(t *testing.T) {
+	token, jwks := signedToken(t, "customer-1")
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AUTH_ENABLED", "true")
+	t.Setenv("AUTH_JWKS_FILE", jwksFile)
+	d := &downstream{}
+	orders := &fakeOrders{saved: map[string]protocols.Order{}}
+	ts := httptest.NewServer(newTestServer(t, d, orders, nil).Handler())
+	defer ts.Close()
+
+	checkoutAs := func(authorization, key string) (int, string) {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/v2/checkout", strings.NewReader(`{"itemId":1,"quantity":2}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("checkout: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	for _, authorization := range []string{"", "Bearer not-a-token"} {
+		if code, body := checkoutAs(authorization, "order-6"); code != http.StatusUnauthorized || !strings.Contains(body, `"code":"unauthenticated"`) {
+			t.Fatalf("checkout with %q = %d %s, want an unauthenticated problem", authorization, code, body)
+		}
+	}
+	if got := d.Calls(); len(got) != 0 {
+		t.Fatalf("unauthenticated checkouts called downstream: %v", got)
+	}
+
+	if code, body := checkoutAs("Bearer "+token, "order-6"); code != http.StatusOK {
+		t.Fatalf("authenticated checkout = %d %s", code, body)
+	}
+	want := protocols.Order{IdempotencyKey: "tenant-1/customer-1/order-6", CustomerId: "customer-1", TenantId: "tenant-1", ItemId: 1, Quantity: 2, ReservationId: 7, Status: "completed"}
+	if got := orders.saved[want.IdempotencyKey]; got != want {
+		t.Errorf("saved order = %+v, want %+v", got, want)
+	}
+}
+
+func TestServer_SignsItsCallsToStockAndPayment(t *testing.T) {
+	const keys = "order:0123456789abcdef0123456789abcdef"
+	parsed, _ := hmacauth.ParseKeys(keys)
+	d := &downstream{verifier: hmacauth.NewVerifier(parsed, hmacauth.NewMemoryNonces(), 0)}
+	orders := &fakeOrders{saved: map[string]protocols.Order{}}
+
+	unsigned := httptest.NewServer(newTestServer(t, d, orders, nil).Handler())
+	defer unsigned.Close()
+	if code, body := postCheckout(t, unsigned.URL, "order-unsigned"); code != http.StatusInternalServerError {
+		t.Fatalf("checkout without service authentication = %d %s, want 500", code, body)
+	}
+	if calls := d.Calls(); len(calls) != 0 {
+		t.Fatalf("downstream calls = %v, want none let through", calls)
+	}
+
+	signed := httptest.NewServer(newTestServer(t, d, orders, func(cfg *config.Config) {
+		cfg.ServiceAuth = config.ServiceAuthConfig{Enabled: true, Keys: keys}
+	}).Handler())
+	defer signed.Close()
+	if code, body := postCheckout(t, signed.URL, "order-signed"); code != http.StatusOK {
+		t.Fatalf("signed checkout = %d %s", code, body)
+	}
+	want := []string{"reserve", "charge:42.5", "complete"}
+	if got := d.Calls(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("downstream calls = %v, want %v", got, want)
+	}
+}
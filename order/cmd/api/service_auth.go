@@ -0,0 +1,53 @@
+package api
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giovaniif/e-commerce/hmacauth"
+	"github.com/giovaniif/e-commerce/order/infra/problem"
+)
+
+// newServiceSigner signs the calls to Stock and Payment with the first key
+// of cfg.ServiceAuth, or is nil when service authentication is off.
+func (s *Server) newServiceSigner() (*hmacauth.Signer, error) {
+	cfg := s.cfg.ServiceAuth
+	if !cfg.Enabled {
+		fmt.Println("Service authentication: off (set SERVICE_AUTH_ENABLED)")
+		return nil, nil
+	}
+	keys, err := hmacauth.ParseKeys(cfg.Keys)
+	if err != nil {
+		return nil, fmt.Errorf("SERVICE_AUTH_KEYS: %w", err)
+	}
+	fmt.Printf("Service authentication: signing with key %q\n", keys[0].ID)
+	return hmacauth.NewSigner(keys[0]), nil
+}
+
+// signedClient is client with every request it sends signed by signer. The
+// client itself is left alone: an injected one may be shared.
+func signedClient(client *http.Client, signer *hmacauth.Signer) *http.Client {
+	if signer == nil {
+		return client
+	}
+	signed := *client
+	signed.Transport = &hmacauth.Transport{Base: client.Transport, Signer: signer}
+	return &signed
+}
+
+// adminAuth lets through only calls bearing the admin token, as
+// "Authorization: Bearer <token>". The /admin routes change how the service
+// behaves, so without a token configured they refuse every call.
+func (s *Server) adminAuth() gin.HandlerFunc {
+	want := []byte("Bearer " + s.cfg.AdminToken)
+	return func(c *gin.Context) {
+		if s.cfg.AdminToken == "" || subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), want) != 1 {
+			c.Header("WWW-Authenticate", "Bearer")
+			problem.Abort(c, problem.New(http.StatusUnauthorized, problem.Unauthenticated, "admin token required"))
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,152 @@
+// Package auth authenticates the callers of the public checkout API, by an
+// API key sent in X-API-Key or a JWT bearer token, and puts who they are in
+// the request context: the customer whose orders, purchase limits and
+// idempotency keys the checkout is scoped to, and the tenant it belongs to.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giovaniif/e-commerce/order/infra/metrics"
+	"github.com/giovaniif/e-commerce/order/infra/problem"
+)
+
+// APIKeyHeader carries an API key.
+const APIKeyHeader = "X-API-Key"
+
+// Methods a principal authenticated with.
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+var (
+	// ErrMissingCredentials is returned when a request carries neither an
+	// API key nor a bearer token.
+	ErrMissingCredentials = errors.New("missing credentials")
+	// ErrInvalidCredentials is returned for an unknown or revoked API key, and
+	// for a token that does not verify.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Principal is who a request was authenticated as.
+type Principal struct {
+	CustomerID string
+	TenantID   string
+	Method     string
+}
+
+// ScopeKey scopes a client's Idempotency-Key to the principal, so two
+// customers sending the same key never share a checkout. Without a customer
+// the key is returned as is.
+func (p Principal) ScopeKey(key string) string {
+	if p.CustomerID == "" {
+		return key
+	}
+	return url.PathEscape(p.TenantID) + "/" + url.PathEscape(p.CustomerID) + "/" + key
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx carrying p.
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal in ctx, the zero Principal for an
+// unauthenticated request.
+func FromContext(ctx context.Context) Principal {
+	p, _ := ctx.Value(principalKey{}).(Principal)
+	return p
+}
+
+// Authenticator checks the credentials of a request against the API keys
+// in keys and the tokens jwt verifies; either may be nil to refuse that
+// kind of credential.
+type Authenticator struct {
+	keys KeyStore
+	jwt  *JWTVerifier
+}
+
+func NewAuthenticator(keys KeyStore, jwt *JWTVerifier) *Authenticator {
+	return &Authenticator{keys: keys, jwt: jwt}
+}
+
+// Authenticate returns who r was sent by. An API key wins over a bearer
+// token when both are sent. Errors other than ErrMissingCredentials and
+// ErrInvalidCredentials mean the key store could not be reached.
+func (a *Authenticator) Authenticate(ctx context.Context, r *http.Request) (Principal, error) {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		if a.keys == nil {
+			return Principal{}, fmt.Errorf("%w: API keys are not accepted", ErrInvalidCredentials)
+		}
+		p, err := a.keys.Lookup(ctx, HashKey(key))
+		if err != nil {
+			return Principal{}, err
+		}
+		p.Method = MethodAPIKey
+		return p, nil
+	}
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return Principal{}, ErrMissingCredentials
+	}
+	if a.jwt == nil {
+		return Principal{}, fmt.Errorf("%w: bearer tokens are not accepted", ErrInvalidCredentials)
+	}
+	return a.jwt.Verify(strings.TrimSpace(token))
+}
+
+// Middleware puts the principal of the request in its context, answering
+// 401 with an unauthenticated problem when it has no valid credentials and
+// 503 when its API key cannot be checked.
+func (a *Authenticator) Middleware(c *gin.Context) {
+	ctx := c.Request.Context()
+	p, err := a.Authenticate(ctx, c.Request)
+	method := credentialMethod(c.Request)
+	switch {
+	case errors.Is(err, ErrMissingCredentials), errors.Is(err, ErrInvalidCredentials):
+		result := "invalid"
+		if errors.Is(err, ErrMissingCredentials) {
+			result = "missing"
+		}
+		metrics.AuthRequests.WithLabelValues(method, result).Inc()
+		c.Header("WWW-Authenticate", `Bearer realm="order"`)
+		problem.Abort(c, problem.New(http.StatusUnauthorized, problem.Unauthenticated, detail(err)))
+		return
+	case err != nil:
+		metrics.AuthRequests.WithLabelValues(method, "error").Inc()
+		slog.ErrorContext(ctx, "api key lookup failed", "error", err)
+		problem.Abort(c, problem.New(http.StatusServiceUnavailable, problem.Unavailable, "credentials could not be checked"))
+		return
+	}
+	metrics.AuthRequests.WithLabelValues(method, "ok").Inc()
+	c.Request = c.Request.WithContext(NewContext(ctx, p))
+	c.Next()
+}
+
+// credentialMethod labels the kind of credential r carries.
+func credentialMethod(r *http.Request) string {
+	switch {
+	case r.Header.Get(APIKeyHeader) != "":
+		return MethodAPIKey
+	case r.Header.Get("Authorization") != "":
+		return MethodJWT
+	}
+	return "none"
+}
+
+// detail is why the credentials of a request were refused.
+func detail(err error) string {
+	if errors.Is(err, ErrMissingCredentials) {
+		return "send an API key in " + APIKeyHeader + " or a bearer token in Authorization"
+	}
+	return err.Error()
+}
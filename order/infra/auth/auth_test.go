@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+type failingStore struct{}
+
+func (failingStore) Lookup(context.Context, string) (Principal, error) {
+	return Principal{}, errors.New("connection refused")
+}
+
+// serve runs a request with headers through the middleware of a, answering
+// with the customer it authenticated.
+func serve(a *Authenticator, headers map[string]string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", a.Middleware, func(c *gin.Context) {
+		p := FromContext(c.Request.Context())
+		c.String(http.StatusOK, p.TenantID+"/"+p.CustomerID+" "+p.Method)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddleware(t *testing.T) {
+	keys := NewMemoryKeyStore()
+	keys.Add("key-1", Principal{CustomerID: "customer-1", TenantID: "tenant-1"})
+	v, err := NewJWTVerifier(testJWKS(t), JWTConfig{})
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+	a := NewAuthenticator(keys, v)
+
+	cases := []struct {
+		name     string
+		auth     *Authenticator
+		headers  map[string]string
+		wantCode int
+		wantBody string
+	}{
+		{"api key", a, map[string]string{APIKeyHeader: "key-1"}, http.StatusOK, "tenant-1/customer-1 api_key"},
+		{"bearer token", a, map[string]string{"Authorization": "Bearer " + signToken(t, "RS256", "rsa-1", validClaims())}, http.StatusOK, "tenant-1/customer-1 jwt"},
+		{"no credentials", a, nil, http.StatusUnauthorized, `"code":"unauthenticated"`},
+		{"basic auth", a, map[string]string{"Authorization": "Basic dXNlcjpwYXNz"}, http.StatusUnauthorized, `"code":"unauthenticated"`},
+		{"unknown key", a, map[string]string{APIKeyHeader: "key-2"}, http.StatusUnauthorized, "unknown API key"},
+		{"keys not accepted", NewAuthenticator(nil, v), map[string]string{APIKeyHeader: "key-1"}, http.StatusUnauthorized, "API keys are not accepted"},
+		{"tokens not accepted", NewAuthenticator(keys, nil), map[string]string{"Authorization": "Bearer x.y.z"}, http.StatusUnauthorized, "bearer tokens are not accepted"},
+		{"store down", NewAuthenticator(failingStore{}, nil), map[string]string{APIKeyHeader: "key-1"}, http.StatusServiceUnavailable, `"code":"unavailable"`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serve(tc.auth, tc.headers)
+			if w.Code != tc.wantCode || !strings.Contains(w.Body.String(), tc.wantBody) {
+				t.Fatalf("got %d %s, want %d with %q", w.Code, w.Body, tc.wantCode, tc.wantBody)
+			}
+			if tc.wantCode == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+}
+
+func TestRedisKeyStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := NewRedisKeyStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	mr.HSet(RedisKey(HashKey("key-1")), "customer_id", "customer-1", "tenant_id", "tenant-1")
+	mr.HSet(RedisKey(HashKey("key-2")), "customer_id", "customer-2", "revoked", "true")
+
+	got, err := store.Lookup(context.Background(), HashKey("key-1"))
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if want := (Principal{CustomerID: "customer-1", TenantID: "tenant-1"}); got != want {
+		t.Errorf("Lookup = %+v, want %+v", got, want)
+	}
+	for _, key := range []string{"key-2", "key-3"} {
+		if _, err := store.Lookup(context.Background(), HashKey(key)); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Lookup(%s) = %v, want %v", key, err, ErrInvalidCredentials)
+		}
+	}
+	mr.Close()
+	if _, err := store.Lookup(context.Background(), HashKey("key-1")); err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Lookup with Redis down = %v, want a store error", err)
+	}
+}
+
+func TestPrincipal_ScopeKey(t *testing.T) {
+	if got := (Principal{}).ScopeKey("k"); got != "k" {
+		t.Errorf("anonymous ScopeKey = %q, want k", got)
+	}
+	a := Principal{CustomerID: "b/c", TenantID: "a"}.ScopeKey("k")
+	b := Principal{CustomerID: "c", TenantID: "a/b"}.ScopeKey("k")
+	if a == b {
+		t.Errorf("different principals share the scoped key %q", a)
+	}
+}
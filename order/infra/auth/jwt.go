@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// clockSkew is how far the clocks of the token issuer and Order may drift
+// apart before exp and nbf are enforced.
+const clockSkew = time.Minute
+
+// JWTConfig is what a token must carry to be accepted.
+type JWTConfig struct {
+	// Issuer and Audience must match the iss and aud claims, when set.
+	Issuer   string
+	Audience string
+	// TenantClaim names the claim holding the tenant id; sub is the customer.
+	TenantClaim string
+}
+
+// JWTVerifier verifies RS256 and ES256 tokens against the keys of a JWKS
+// file, read once at startup.
+type JWTVerifier struct {
+	cfg  JWTConfig
+	keys map[string]jwk
+	now  func() time.Time
+}
+
+// jwk is a signing key of a JWKS: an RSA key for RS256 or a P-256 key for
+// ES256.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+
+	key crypto.PublicKey
+}
+
+// LoadJWTVerifier reads the JWKS file at path.
+func LoadJWTVerifier(path string, cfg JWTConfig) (*JWTVerifier, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read jwks: %w", err)
+	}
+	v, err := NewJWTVerifier(raw, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return v, nil
+}
+
+// NewJWTVerifier verifies tokens against the keys of the JWKS document
+// jwks. Keys it cannot use, such as encryption keys, are skipped; a
+// document without any signing key is an error.
+func NewJWTVerifier(jwks []byte, cfg JWTConfig) (*JWTVerifier, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(jwks, &set); err != nil {
+		return nil, fmt.Errorf("parse jwks: %w", err)
+	}
+	if cfg.TenantClaim == "" {
+		cfg.TenantClaim = "tenant_id"
+	}
+	v := &JWTVerifier{cfg: cfg, keys: make(map[string]jwk), now: time.Now}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, alg, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("jwks key %q: %w", k.Kid, err)
+		}
+		if key == nil || (k.Alg != "" && k.Alg != alg) {
+			continue
+		}
+		k.Alg, k.key = alg, key
+		v.keys[k.Kid] = k
+	}
+	if len(v.keys) == 0 {
+		return nil, errors.New("jwks has no RS256 or ES256 signing key")
+	}
+	return v, nil
+}
+
+// publicKey decodes k, returning a nil key for a type it does not support.
+func (k jwk) publicKey() (crypto.PublicKey, string, error) {
+	switch {
+	case k.Kty == "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, "", fmt.Errorf("n: %w", err)
+		}
+		e, err := decodeInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31 {
+			return nil, "", errors.New("invalid e")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, "RS256", nil
+	case k.Kty == "EC" && k.Crv == "P-256":
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, "", fmt.Errorf("x: %w", err)
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, "", fmt.Errorf("y: %w", err)
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, "", errors.New("point is not on P-256")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, "ES256", nil
+	}
+	return nil, "", nil
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("not a base64url integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Verify checks the signature, lifetime, issuer and audience of token and
+// returns the principal it names. Failures are ErrInvalidCredentials.
+func (v *JWTVerifier) Verify(token string) (Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Principal{}, invalidToken("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Principal{}, invalidToken("malformed header")
+	}
+	key, err := v.key(header.Kid, header.Alg)
+	if err != nil {
+		return Principal{}, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Principal{}, invalidToken("malformed signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !verifySignature(key, digest[:], signature) {
+		return Principal{}, invalidToken("bad signature")
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Principal{}, invalidToken("malformed claims")
+	}
+	now := v.now()
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return Principal{}, invalidToken("missing exp")
+	}
+	if now.After(exp.Add(clockSkew)) {
+		return Principal{}, invalidToken("token expired")
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(clockSkew).Before(nbf) {
+		return Principal{}, invalidToken("token not valid yet")
+	}
+	if v.cfg.Issuer != "" && claims["iss"] != v.cfg.Issuer {
+		return Principal{}, invalidToken("wrong issuer")
+	}
+	if v.cfg.Audience != "" && !hasAudience(claims["aud"], v.cfg.Audience) {
+		return Principal{}, invalidToken("wrong audience")
+	}
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return Principal{}, invalidToken("missing sub")
+	}
+	tenant, _ := claims[v.cfg.TenantClaim].(string)
+	return Principal{CustomerID: sub, TenantID: tenant, Method: MethodJWT}, nil
+}
+
+// key picks the key a token is verified with: the one named by kid, or the
+// only one when the token names none. The token's alg must be the key's, so
+// a token cannot choose a weaker algorithm, or none.
+func (v *JWTVerifier) key(kid, alg string) (jwk, error) {
+	k, ok := v.keys[kid]
+	if !ok && kid == "" && len(v.keys) == 1 {
+		for _, only := range v.keys {
+			k, ok = only, true
+		}
+	}
+	if !ok {
+		return jwk{}, invalidToken("unknown key")
+	}
+	if alg != k.Alg {
+		return jwk{}, invalidToken("unexpected alg " + alg)
+	}
+	return k, nil
+}
+
+func verifySignature(k jwk, digest, signature []byte) bool {
+	switch key := k.key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		// ES256 signatures are r and s, 32 bytes each.
+		if len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(key, digest, r, s)
+	}
+	return false
+}
+
+func decodeSegment(segment string, dst any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	return dec.Decode(dst)
+}
+
+// numericDate reads a NumericDate claim, seconds since the epoch.
+func numericDate(v any) (time.Time, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
+
+// hasAudience reports whether the aud claim, a string or a list of them,
+// names audience.
+func hasAudience(aud any, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []any:
+		return slices.Contains(aud, any(audience))
+	}
+	return false
+}
+
+func invalidToken(reason string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidCredentials, reason)
+}
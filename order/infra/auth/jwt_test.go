@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+var (
+	rsaKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _  = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+)
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+// testJWKS publishes rsaKey as "rsa-1" and ecKey as "ec-1".
+func testJWKS(t *testing.T) []byte {
+	t.Helper()
+	jwks, err := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "oct", "kid": "hmac-1", "k": b64([]byte("secret"))},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jwks
+}
+
+// signToken signs claims with alg: RS256 with rsaKey, ES256 with ecKey, and
+// anything else with no signature at all.
+func signToken(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var signature []byte
+	switch alg {
+	case "RS256":
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + b64(signature)
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"sub":       "customer-1",
+		"tenant_id": "tenant-1",
+		"iss":       "https://auth.example.com",
+		"aud":       []string{"order", "other"},
+		"exp":       time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestJWTVerifier_AcceptsSignedTokens(t *testing.T) {
+	v, err := NewJWTVerifier(testJWKS(t), JWTConfig{Issuer: "https://auth.example.com", Audience: "order"})
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+	want := Principal{CustomerID: "customer-1", TenantID: "tenant-1", Method: MethodJWT}
+	for _, tc := range []struct{ alg, kid string }{{"RS256", "rsa-1"}, {"ES256", "ec-1"}} {
+		got, err := v.Verify(signToken(t, tc.alg, tc.kid, validClaims()))
+		if err != nil {
+			t.Fatalf("%s: Verify: %v", tc.alg, err)
+		}
+		if got != want {
+			t.Errorf("%s: principal = %+v, want %+v", tc.alg, got, want)
+		}
+	}
+}
+
+func TestJWTVerifier_RejectsBadTokens(t *testing.T) {
+	v, err := NewJWTVerifier(testJWKS(t), JWTConfig{Issuer: "https://auth.example.com", Audience: "order"})
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+	with := func(key string, value any) map[string]any {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+	tampered := signToken(t, "RS256", "rsa-1", validClaims())
+	tampered = tampered[:len(tampered)-4] + "AAAA"
+	cases := map[string]string{
+		"expired":         signToken(t, "RS256", "rsa-1", with("exp", time.Now().Add(-2*time.Minute).Unix())),
+		"no exp":          signToken(t, "RS256", "rsa-1", with("exp", nil)),
+		"not yet valid":   signToken(t, "RS256", "rsa-1", with("nbf", time.Now().Add(time.Hour).Unix())),
+		"wrong issuer":    signToken(t, "RS256", "rsa-1", with("iss", "https://evil.example.com")),
+		"wrong audience":  signToken(t, "RS256", "rsa-1", with("aud", "billing")),
+		"no subject":      signToken(t, "RS256", "rsa-1", with("sub", nil)),
+		"unknown key":     signToken(t, "RS256", "rsa-2", validClaims()),
+		"alg none":        signToken(t, "none", "rsa-1", validClaims()),
+		"alg swapped":     signToken(t, "ES256", "rsa-1", validClaims()),
+		"bad signature":   tampered,
+		"not a jwt":       "not-a-token",
+		"symmetric key":   signToken(t, "HS256", "hmac-1", validClaims()),
+		"malformed claim": "e30." + b64([]byte("{")) + ".",
+	}
+	for name, token := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := v.Verify(token); !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("Verify = %v, want %v", err, ErrInvalidCredentials)
+			}
+		})
+	}
+}
+
+func TestJWTVerifier_AllowsClockSkew(t *testing.T) {
+	v, err := NewJWTVerifier(testJWKS(t), JWTConfig{TenantClaim: "org"})
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+	claims := validClaims()
+	claims["exp"] = time.Now().Add(-30 * time.Second).Unix()
+	claims["org"] = "org-9"
+	got, err := v.Verify(signToken(t, "ES256", "ec-1", claims))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if got.TenantID != "org-9" {
+		t.Errorf("tenant = %q, want the org claim", got.TenantID)
+	}
+}
+
+func TestNewJWTVerifier_NeedsASigningKey(t *testing.T) {
+	if _, err := NewJWTVerifier([]byte(`{"keys":[{"kty":"oct","k":"c2VjcmV0"}]}`), JWTConfig{}); err == nil {
+		t.Error("NewJWTVerifier accepted a JWKS without RS256 or ES256 keys")
+	}
+}
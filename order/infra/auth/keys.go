@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// KeyStore finds the principal an API key was issued to by the key's hash;
+// the keys themselves are never stored. An unknown or revoked key is
+// ErrInvalidCredentials; any other error means the store is unreachable.
+type KeyStore interface {
+	Lookup(ctx context.Context, hash string) (Principal, error)
+}
+
+// HashKey is the hex SHA-256 of an API key, which key stores are indexed by.
+// API keys are random, so a fast unsalted hash is enough to keep a leaked
+// store from revealing them.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// keyRecord is an API key as the stores keep it.
+type keyRecord struct {
+	CustomerID string `bson:"customer_id"`
+	TenantID   string `bson:"tenant_id"`
+	Revoked    bool   `bson:"revoked"`
+}
+
+func (r keyRecord) principal() (Principal, error) {
+	if r.Revoked {
+		return Principal{}, fmt.Errorf("%w: API key revoked", ErrInvalidCredentials)
+	}
+	if r.CustomerID == "" {
+		return Principal{}, fmt.Errorf("%w: API key has no customer", ErrInvalidCredentials)
+	}
+	return Principal{CustomerID: r.CustomerID, TenantID: r.TenantID}, nil
+}
+
+var errUnknownKey = fmt.Errorf("%w: unknown API key", ErrInvalidCredentials)
+
+// MemoryKeyStore keeps API keys in process, for tests.
+type MemoryKeyStore struct {
+	mu   sync.Mutex
+	keys map[string]Principal
+}
+
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{keys: make(map[string]Principal)}
+}
+
+// Add issues key to p.
+func (s *MemoryKeyStore) Add(key string, p Principal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[HashKey(key)] = p
+}
+
+func (s *MemoryKeyStore) Lookup(ctx context.Context, hash string) (Principal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.keys[hash]
+	if !ok {
+		return Principal{}, errUnknownKey
+	}
+	return p, nil
+}
+
+// RedisKeyStore reads API keys from hashes at order:api_key:<hash>, with
+// the fields customer_id, tenant_id and revoked.
+type RedisKeyStore struct {
+	rdb *redis.Client
+}
+
+func NewRedisKeyStore(rdb *redis.Client) *RedisKeyStore {
+	return &RedisKeyStore{rdb: rdb}
+}
+
+// RedisKey is where the API key with hash is kept.
+func RedisKey(hash string) string {
+	return "order:api_key:" + hash
+}
+
+func (s *RedisKeyStore) Lookup(ctx context.Context, hash string) (Principal, error) {
+	fields, err := s.rdb.HGetAll(ctx, RedisKey(hash)).Result()
+	if err != nil {
+		return Principal{}, fmt.Errorf("read api key: %w", err)
+	}
+	if len(fields) == 0 {
+		return Principal{}, errUnknownKey
+	}
+	revoked, _ := strconv.ParseBool(fields["revoked"])
+	return keyRecord{CustomerID: fields["customer_id"], TenantID: fields["tenant_id"], Revoked: revoked}.principal()
+}
+
+// MongoKeyStore reads API keys from the order.api_keys collection, whose
+// documents have the hash as _id.
+type MongoKeyStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoKeyStore(client *mongo.Client) *MongoKeyStore {
+	return &MongoKeyStore{collection: client.Database("order").Collection("api_keys")}
+}
+
+func (s *MongoKeyStore) Lookup(ctx context.Context, hash string) (Principal, error) {
+	var record keyRecord
+	err := s.collection.FindOne(ctx, bson.M{"_id": hash}).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Principal{}, errUnknownKey
+	}
+	if err != nil {
+		return Principal{}, fmt.Errorf("read api key: %w", err)
+	}
+	return record.principal()
+}
@@ -0,0 +1,219 @@
+// Package backends tracks whether the backends the service depends on are
+// reachable, reports it on the probe endpoints and holds requests back while
+// they are not.
+package backends
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giovaniif/e-commerce/order/infra/problem"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const defaultProbeTimeout = 2 * time.Second
+
+// Check probes one backend. Probe returns nil when the backend is usable and
+// is cut off after Timeout (default 2s). An Optional check is reported but
+// does not make the service unready, for backends it can work without.
+type Check struct {
+	Name     string
+	Probe    func(ctx context.Context) error
+	Timeout  time.Duration
+	Optional bool
+}
+
+// HTTPCheck probes a downstream service with GET url, passing on any status
+// below 500.
+func HTTPCheck(name string, client *http.Client, url string) Check {
+	return Check{Name: name, Optional: true, Probe: func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return nil
+	}}
+}
+
+// GRPCCheck probes a downstream service through the standard gRPC health
+// service of conn, passing while it serves.
+func GRPCCheck(name string, conn grpc.ClientConnInterface) Check {
+	client := healthpb.NewHealthClient(conn)
+	return Check{Name: name, Optional: true, Probe: func(ctx context.Context) error {
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		if err != nil {
+			return err
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("status %s", resp.GetStatus())
+		}
+		return nil
+	}}
+}
+
+// Result is the outcome of a check's last probe.
+type Result struct {
+	Status    string    `json:"status"`
+	Optional  bool      `json:"optional,omitempty"`
+	LatencyMs float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report is the JSON body of /readyz: "ready" or "not_ready", and the result
+// of every check.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Monitor probes its checks in the background and caches the results, so the
+// probe endpoints never wait on a backend. It is ready while every required
+// check passes; the clients behind the checks reconnect on their own, so a
+// backend coming back makes the service ready again.
+type Monitor struct {
+	checks  []Check
+	ready   atomic.Bool
+	mu      sync.RWMutex
+	results map[string]Result
+}
+
+func NewMonitor(checks ...Check) *Monitor {
+	m := &Monitor{checks: checks, results: make(map[string]Result, len(checks))}
+	for _, check := range checks {
+		m.results[check.Name] = Result{Status: "down", Optional: check.Optional, Error: "not probed yet"}
+	}
+	m.ready.Store(m.allPass(m.results))
+	return m
+}
+
+// Run probes every check now and then every interval until ctx is done.
+func (m *Monitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		m.Probe(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Probe runs every check once, concurrently, and returns whether the service
+// is ready.
+func (m *Monitor) Probe(ctx context.Context) bool {
+	results := make(map[string]Result, len(m.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range m.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := probe(ctx, check)
+			mu.Lock()
+			results[check.Name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	ready := m.allPass(results)
+	m.mu.Lock()
+	m.results = results
+	m.mu.Unlock()
+	m.ready.Store(ready)
+	return ready
+}
+
+func probe(ctx context.Context, check Check) Result {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	began := time.Now()
+	err := check.Probe(ctx)
+	result := Result{
+		Status:    "up",
+		Optional:  check.Optional,
+		LatencyMs: float64(time.Since(began).Microseconds()) / 1000,
+		CheckedAt: began.UTC(),
+	}
+	if err != nil {
+		result.Status = "down"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (m *Monitor) allPass(results map[string]Result) bool {
+	for _, check := range m.checks {
+		if !check.Optional && results[check.Name].Status != "up" {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Monitor) Ready() bool {
+	return m.ready.Load()
+}
+
+// Report returns the results of the last probe.
+func (m *Monitor) Report() Report {
+	m.mu.RLock()
+	checks := make(map[string]Result, len(m.results))
+	for name, result := range m.results {
+		checks[name] = result
+	}
+	m.mu.RUnlock()
+	status := "ready"
+	if !m.Ready() {
+		status = "not_ready"
+	}
+	return Report{Status: status, Checks: checks}
+}
+
+// Livez answers whether the process is up and serving. It never looks at the
+// backends: restarting the service does not bring them back.
+func (m *Monitor) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "alive"})
+}
+
+// Readyz answers 200 with the report while ready and 503 otherwise.
+func (m *Monitor) Readyz(c *gin.Context) {
+	report := m.Report()
+	code := http.StatusOK
+	if report.Status != "ready" {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, report)
+}
+
+// Gate rejects requests with 503 while the monitor is not ready.
+func (m *Monitor) Gate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !m.Ready() {
+			c.Header("Retry-After", "1")
+			problem.Abort(c, problem.New(http.StatusServiceUnavailable, problem.Unavailable, "service not ready, see /readyz"))
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,298 @@
+// Package config loads the Order service configuration. Every setting has a
+// default, can be set in the YAML file named by CONFIG_FILE, and is
+// overridden by its environment variable, read from the process environment
+// or from a .env file (ENV_FILE, default .env). Load validates the result and
+// reports every problem at once.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/giovaniif/e-commerce/order/infra/faults"
+)
+
+type Config struct {
+	// Env is the deployment profile (APP_ENV); "production" turns on strict
+	// startup by default.
+	Env string `yaml:"env"`
+	// StartupMode is "strict" or "lenient" (STARTUP_MODE): strict refuses
+	// in-process substitutes for unreachable backends.
+	StartupMode     string        `yaml:"startup_mode"`
+	Port            int           `yaml:"port"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// AdminEnabled serves GET /admin/config (ADMIN_ENABLED).
+	AdminEnabled bool `yaml:"admin_enabled"`
+	// AdminToken is the bearer token the /admin routes require
+	// (ADMIN_TOKEN); without one they refuse every call.
+	AdminToken string `yaml:"admin_token"`
+	// Faults injects failures for chaos tests; never in production.
+	Faults FaultsConfig `yaml:"faults"`
+	// Auth guards the checkout with API keys and JWTs.
+	Auth AuthConfig `yaml:"auth"`
+	// ServiceAuth signs the calls to Stock and Payment.
+	ServiceAuth ServiceAuthConfig `yaml:"service_auth"`
+
+	// Transport is how the gateways call Stock and Payment
+	// (DOWNSTREAM_TRANSPORT): "http" through the base URLs, or "grpc"
+	// through the gRPC addresses.
+	Transport       string           `yaml:"transport"`
+	StockBaseURL    string           `yaml:"stock_base_url"`
+	PaymentBaseURL  string           `yaml:"payment_base_url"`
+	StockGRPCAddr   string           `yaml:"stock_grpc_addr"`
+	PaymentGRPCAddr string           `yaml:"payment_grpc_addr"`
+	HTTPClient      HTTPClientConfig `yaml:"http_client"`
+
+	Checkout    CheckoutConfig    `yaml:"checkout"`
+	RedisAddr   string            `yaml:"redis_addr"`
+	MongoURL    string            `yaml:"mongo_url"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+
+	LokiURL      string `yaml:"loki_url"`
+	OTLPEndpoint string `yaml:"otlp_endpoint"`
+}
+
+// HTTPClientConfig sizes the connection pool shared by the Stock and Payment
+// gateways.
+type HTTPClientConfig struct {
+	MaxIdleConns        int           `yaml:"max_idle_conns"`
+	MaxIdleConnsPerHost int           `yaml:"max_idle_conns_per_host"`
+	IdleConnTimeout     time.Duration `yaml:"idle_conn_timeout"`
+}
+
+// CheckoutConfig bounds one checkout: its whole timeout, and how often and
+// how far apart its Stock calls are retried. BackorderInterval is how often
+// backordered orders are checked for a restock that lets them complete.
+type CheckoutConfig struct {
+	Timeout           time.Duration `yaml:"timeout"`
+	MaxRetries        int           `yaml:"max_retries"`
+	RetryBaseDelay    time.Duration `yaml:"retry_base_delay"`
+	BackorderInterval time.Duration `yaml:"backorder_interval"`
+}
+
+// IdempotencyConfig picks the store behind the checkout idempotency keys:
+// "postgres", "redis" or "memory". Empty means Redis when RedisAddr is set.
+type IdempotencyConfig struct {
+	Store         string        `yaml:"store"`
+	PostgresURL   string        `yaml:"postgres_url"`
+	PurgeInterval time.Duration `yaml:"purge_interval"`
+}
+
+// AuthConfig requires checkouts to authenticate (AUTH_ENABLED), with an API
+// key looked up in APIKeyStore, "redis", "mongo" or "none", or a JWT signed
+// by a key of the JWKS file. Empty APIKeyStore means Redis when RedisAddr is
+// set, MongoDB when MongoURL is, none otherwise.
+type AuthConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	APIKeyStore string `yaml:"api_key_store"`
+	JWKSFile    string `yaml:"jwks_file"`
+	Issuer      string `yaml:"jwt_issuer"`
+	Audience    string `yaml:"jwt_audience"`
+	TenantClaim string `yaml:"jwt_tenant_claim"`
+}
+
+// ServiceAuthConfig signs every call to Stock and Payment with HMAC
+// (SERVICE_AUTH_ENABLED), using the first of Keys (SERVICE_AUTH_KEYS,
+// "id:secret,..."). Stock and Payment must know the same key.
+type ServiceAuthConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Keys    string `yaml:"keys"`
+}
+
+// FaultsConfig turns fault injection on (FAULTS_ENABLED) and sets the rules
+// it starts with (FAULTS, a JSON list); PUT /admin/faults replaces them at
+// run time.
+type FaultsConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Rules   []faults.Rule `yaml:"rules"`
+}
+
+// minAdminTokenLength is the shortest ADMIN_TOKEN accepted, the same as a
+// service key's secret.
+const minAdminTokenLength = 32
+
+func defaults() Config {
+	return Config{
+		Port:            3131,
+		ShutdownTimeout: 10 * time.Second,
+		Transport:       "http",
+		StockBaseURL:    "http://localhost:3133",
+		PaymentBaseURL:  "http://localhost:3132",
+		StockGRPCAddr:   "localhost:4133",
+		PaymentGRPCAddr: "localhost:4132",
+		HTTPClient: HTTPClientConfig{
+			MaxIdleConns:        2000,
+			MaxIdleConnsPerHost: 1000,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		Checkout: CheckoutConfig{
+			Timeout:           30 * time.Second,
+			MaxRetries:        2,
+			RetryBaseDelay:    100 * time.Millisecond,
+			BackorderInterval: 5 * time.Second,
+		},
+		Idempotency: IdempotencyConfig{PurgeInterval: 5 * time.Minute},
+		Auth:        AuthConfig{TenantClaim: "tenant_id"},
+	}
+}
+
+// Load builds the configuration from defaults, the YAML file, .env and the
+// environment, and validates it.
+func Load() (Config, error) {
+	cfg := defaults()
+	if err := readYAML(&cfg); err != nil {
+		return Config{}, err
+	}
+	env, err := newSource()
+	if err != nil {
+		return Config{}, err
+	}
+	env.String("APP_ENV", &cfg.Env)
+	env.String("STARTUP_MODE", &cfg.StartupMode)
+	env.Int("PORT", &cfg.Port)
+	env.Count("SHUTDOWN_TIMEOUT_SECONDS", time.Second, &cfg.ShutdownTimeout)
+	env.Bool("ADMIN_ENABLED", &cfg.AdminEnabled)
+	env.String("ADMIN_TOKEN", &cfg.AdminToken)
+	env.Bool("FAULTS_ENABLED", &cfg.Faults.Enabled)
+	if v, ok := env.lookup("FAULTS"); ok && v != "" {
+		rules, err := faults.ParseRules([]byte(v))
+		if err != nil {
+			env.fail("FAULTS", v, err)
+		}
+		cfg.Faults.Rules = rules
+	}
+	env.Bool("AUTH_ENABLED", &cfg.Auth.Enabled)
+	env.String("AUTH_API_KEY_STORE", &cfg.Auth.APIKeyStore)
+	env.String("AUTH_JWKS_FILE", &cfg.Auth.JWKSFile)
+	env.String("AUTH_JWT_ISSUER", &cfg.Auth.Issuer)
+	env.String("AUTH_JWT_AUDIENCE", &cfg.Auth.Audience)
+	env.String("AUTH_JWT_TENANT_CLAIM", &cfg.Auth.TenantClaim)
+	env.Bool("SERVICE_AUTH_ENABLED", &cfg.ServiceAuth.Enabled)
+	env.String("SERVICE_AUTH_KEYS", &cfg.ServiceAuth.Keys)
+	env.String("STOCK_BASE_URL", &cfg.StockBaseURL)
+	env.String("PAYMENT_BASE_URL", &cfg.PaymentBaseURL)
+	env.String("DOWNSTREAM_TRANSPORT", &cfg.Transport)
+	env.String("STOCK_GRPC_ADDR", &cfg.StockGRPCAddr)
+	env.String("PAYMENT_GRPC_ADDR", &cfg.PaymentGRPCAddr)
+	env.Int("HTTP_CLIENT_MAX_IDLE_CONNS", &cfg.HTTPClient.MaxIdleConns)
+	env.Int("HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST", &cfg.HTTPClient.MaxIdleConnsPerHost)
+	env.Count("HTTP_CLIENT_IDLE_CONN_TIMEOUT_SECONDS", time.Second, &cfg.HTTPClient.IdleConnTimeout)
+	env.Count("CHECKOUT_TIMEOUT_SECONDS", time.Second, &cfg.Checkout.Timeout)
+	env.Int("CHECKOUT_MAX_RETRIES", &cfg.Checkout.MaxRetries)
+	env.Count("CHECKOUT_RETRY_BASE_DELAY_MS", time.Millisecond, &cfg.Checkout.RetryBaseDelay)
+	env.Count("CHECKOUT_BACKORDER_INTERVAL_SECONDS", time.Second, &cfg.Checkout.BackorderInterval)
+	env.String("REDIS_ADDR", &cfg.RedisAddr)
+	env.String("MONGO_URL", &cfg.MongoURL)
+	env.String("IDEMPOTENCY_STORE", &cfg.Idempotency.Store)
+	env.String("IDEMPOTENCY_POSTGRES_URL", &cfg.Idempotency.PostgresURL)
+	env.Count("IDEMPOTENCY_PURGE_INTERVAL_SECONDS", time.Second, &cfg.Idempotency.PurgeInterval)
+	env.String("LOKI_URL", &cfg.LokiURL)
+	env.String("OTEL_EXPORTER_OTLP_ENDPOINT", &cfg.OTLPEndpoint)
+	if err := env.err(); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.StartupMode == "" {
+		cfg.StartupMode = "lenient"
+		if cfg.Env == "production" {
+			cfg.StartupMode = "strict"
+		}
+	}
+	if cfg.Idempotency.Store == "" {
+		cfg.Idempotency.Store = "memory"
+		if cfg.RedisAddr != "" {
+			cfg.Idempotency.Store = "redis"
+		}
+	}
+	if cfg.Auth.APIKeyStore == "" {
+		switch {
+		case cfg.RedisAddr != "":
+			cfg.Auth.APIKeyStore = "redis"
+		case cfg.MongoURL != "":
+			cfg.Auth.APIKeyStore = "mongo"
+		default:
+			cfg.Auth.APIKeyStore = "none"
+		}
+	}
+	return cfg, cfg.validate()
+}
+
+func (cfg Config) validate() error {
+	var c checks
+	c.oneOf("STARTUP_MODE", cfg.StartupMode, "strict", "lenient")
+	c.port("PORT", cfg.Port)
+	c.duration("SHUTDOWN_TIMEOUT_SECONDS", cfg.ShutdownTimeout)
+	c.oneOf("DOWNSTREAM_TRANSPORT", cfg.Transport, "http", "grpc")
+	c.url("STOCK_BASE_URL", cfg.StockBaseURL, true)
+	c.url("PAYMENT_BASE_URL", cfg.PaymentBaseURL, true)
+	if cfg.Transport == "grpc" {
+		c.hostPort("STOCK_GRPC_ADDR", cfg.StockGRPCAddr)
+		c.hostPort("PAYMENT_GRPC_ADDR", cfg.PaymentGRPCAddr)
+	}
+	c.positive("HTTP_CLIENT_MAX_IDLE_CONNS", cfg.HTTPClient.MaxIdleConns)
+	c.positive("HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST", cfg.HTTPClient.MaxIdleConnsPerHost)
+	c.duration("HTTP_CLIENT_IDLE_CONN_TIMEOUT_SECONDS", cfg.HTTPClient.IdleConnTimeout)
+	c.duration("CHECKOUT_TIMEOUT_SECONDS", cfg.Checkout.Timeout)
+	c.positive("CHECKOUT_MAX_RETRIES", cfg.Checkout.MaxRetries)
+	c.duration("CHECKOUT_RETRY_BASE_DELAY_MS", cfg.Checkout.RetryBaseDelay)
+	c.duration("CHECKOUT_BACKORDER_INTERVAL_SECONDS", cfg.Checkout.BackorderInterval)
+	c.url("MONGO_URL", cfg.MongoURL, cfg.Strict())
+	c.oneOf("IDEMPOTENCY_STORE", cfg.Idempotency.Store, "postgres", "redis", "memory")
+	switch cfg.Idempotency.Store {
+	case "postgres":
+		c.url("IDEMPOTENCY_POSTGRES_URL", cfg.Idempotency.PostgresURL, true)
+		c.duration("IDEMPOTENCY_PURGE_INTERVAL_SECONDS", cfg.Idempotency.PurgeInterval)
+	case "redis":
+		c.add(cfg.RedisAddr != "", "REDIS_ADDR is required for the redis idempotency store")
+	case "memory":
+		c.add(!cfg.Strict(), "the memory idempotency store is not allowed in strict mode: set IDEMPOTENCY_STORE or REDIS_ADDR")
+	}
+	c.oneOf("AUTH_API_KEY_STORE", cfg.Auth.APIKeyStore, "redis", "mongo", "none")
+	if cfg.Auth.Enabled {
+		c.add(cfg.Auth.APIKeyStore != "none" || cfg.Auth.JWKSFile != "", "AUTH_ENABLED needs an API key store or AUTH_JWKS_FILE")
+		c.add(cfg.Auth.APIKeyStore != "redis" || cfg.RedisAddr != "", "REDIS_ADDR is required for the redis API key store")
+		c.add(cfg.Auth.APIKeyStore != "mongo" || cfg.MongoURL != "", "MONGO_URL is required for the mongo API key store")
+		c.add(cfg.Auth.TenantClaim != "", "AUTH_JWT_TENANT_CLAIM must not be empty")
+	} else {
+		c.add(cfg.Env != "production", "AUTH_ENABLED is required with APP_ENV=production")
+	}
+	if cfg.ServiceAuth.Enabled {
+		c.serviceKeys("SERVICE_AUTH_KEYS", cfg.ServiceAuth.Keys)
+	} else {
+		c.add(cfg.Env != "production", "SERVICE_AUTH_ENABLED is required with APP_ENV=production")
+	}
+	c.url("LOKI_URL", cfg.LokiURL, false)
+	c.add(!cfg.AdminEnabled || cfg.AdminToken != "", "ADMIN_ENABLED needs ADMIN_TOKEN")
+	c.add(cfg.AdminToken == "" || len(cfg.AdminToken) >= minAdminTokenLength, "ADMIN_TOKEN must be at least %d characters", minAdminTokenLength)
+	if cfg.Faults.Enabled {
+		c.add(cfg.Env != "production", "FAULTS_ENABLED is not allowed with APP_ENV=production")
+		for _, r := range cfg.Faults.Rules {
+			if err := r.Validate(); err != nil {
+				c = append(c, fmt.Errorf("FAULTS: %w", err))
+			}
+		}
+	} else {
+		c.add(len(cfg.Faults.Rules) == 0, "FAULTS needs FAULTS_ENABLED=true")
+	}
+	return errors.Join(c...)
+}
+
+// Strict reports whether the service must fail closed instead of falling
+// back to in-process substitutes for unreachable backends.
+func (cfg Config) Strict() bool {
+	return cfg.StartupMode == "strict"
+}
+
+// Effective returns the configuration for display, with credentials in
+// connection URLs and service keys redacted.
+func (cfg Config) Effective() (map[string]any, error) {
+	cfg.ServiceAuth.Keys = redactKeys(cfg.ServiceAuth.Keys)
+	if cfg.AdminToken != "" {
+		cfg.AdminToken = "xxxxx"
+	}
+	cfg.MongoURL = redactURL(cfg.MongoURL)
+	cfg.Idempotency.PostgresURL = redactURL(cfg.Idempotency.PostgresURL)
+	cfg.LokiURL = redactURL(cfg.LokiURL)
+	return effective(cfg)
+}
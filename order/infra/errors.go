@@ -6,8 +6,24 @@ import (
 )
 
 var (
-	ErrTimeout  = errors.New("timeout error")
-	ErrNetwork  = errors.New("network error")
+	ErrTimeout    = errors.New("timeout error")
+	ErrNetwork    = errors.New("network error")
+	ErrInProgress = errors.New("in progress")
+)
+
+// Refusals Stock and Payment answer with a problem code. Retrying them gets
+// the same answer, so none is retriable.
+var (
+	ErrItemNotFound          = errors.New("item not found")
+	ErrInsufficientStock     = errors.New("insufficient stock")
+	ErrPurchaseLimitExceeded = errors.New("purchase limit exceeded")
+	ErrPaymentDeclined       = errors.New("payment declined")
+	// ErrReservationBackordered is Stock refusing to complete a reservation
+	// that is still waiting for a restock.
+	ErrReservationBackordered = errors.New("reservation backordered")
+	// ErrReservationClosed is Stock refusing to complete a reservation that
+	// was released.
+	ErrReservationClosed = errors.New("reservation closed")
 )
 
 func NewTimeoutError(details string) error {
@@ -18,7 +34,13 @@ func NewNetworkError(details string) error {
 	return fmt.Errorf("%w: %s", ErrNetwork, details)
 }
 
-// IsRetriable returns true if the error is timeout or network (5xx), so retry makes sense.
+// NewInProgressError reports that a duplicate of the request is still being
+// processed downstream; retrying later gets its result.
+func NewInProgressError(details string) error {
+	return fmt.Errorf("%w: %s", ErrInProgress, details)
+}
+
+// IsRetriable returns true if the error is timeout, network (5xx) or in progress, so retry makes sense.
 func IsRetriable(err error) bool {
-	return err != nil && (errors.Is(err, ErrTimeout) || errors.Is(err, ErrNetwork))
+	return err != nil && (errors.Is(err, ErrTimeout) || errors.Is(err, ErrNetwork) || errors.Is(err, ErrInProgress))
 }
@@ -0,0 +1,246 @@
+// Package faults fails Order's calls to Stock and Payment on purpose so chaos
+// tests can check the checkout's retries, timeouts and compensation: added
+// latency, 5xx answers and dropped connections, each on a share of the calls
+// to a gateway method. It is off unless FAULTS_ENABLED is set.
+package faults
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giovaniif/e-commerce/order/infra"
+	"github.com/giovaniif/e-commerce/order/infra/metrics"
+	"github.com/giovaniif/e-commerce/order/infra/problem"
+	"github.com/giovaniif/e-commerce/order/protocols"
+)
+
+// Targets are the gateway methods a rule can name.
+var Targets = []string{"payment.Charge", "stock.Complete", "stock.Release", "stock.Reserve"}
+
+// Rule is a fault on one gateway method. A matching call waits LatencyMs,
+// then fails as if Stock or Payment had answered Status or dropped the
+// connection; a rule with latency alone lets the call through afterwards.
+// Percent is the share of calls the rule fires on, all of them when zero.
+type Rule struct {
+	Target    string  `json:"target" yaml:"target"`
+	LatencyMs int     `json:"latencyMs,omitempty" yaml:"latency_ms"`
+	Status    int     `json:"status,omitempty" yaml:"status"`
+	Drop      bool    `json:"drop,omitempty" yaml:"drop"`
+	Percent   float64 `json:"percent,omitempty" yaml:"percent"`
+}
+
+func (r Rule) Validate() error {
+	switch {
+	case !slices.Contains(Targets, r.Target):
+		return fmt.Errorf("target %q is not one of %s", r.Target, strings.Join(Targets, ", "))
+	case r.LatencyMs < 0:
+		return fmt.Errorf("%s: latencyMs must not be negative", r.Target)
+	case r.Status != 0 && (r.Status < 500 || r.Status > 599):
+		return fmt.Errorf("%s: status %d is not a 5xx", r.Target, r.Status)
+	case r.Drop && r.Status != 0:
+		return fmt.Errorf("%s: drop and status are exclusive", r.Target)
+	case r.Percent < 0 || r.Percent > 100:
+		return fmt.Errorf("%s: percent must be between 0 and 100", r.Target)
+	case r.LatencyMs == 0 && r.Status == 0 && !r.Drop:
+		return fmt.Errorf("%s: no fault: set latencyMs, status or drop", r.Target)
+	}
+	return nil
+}
+
+// kind labels what the rule does to a call in the metrics.
+func (r Rule) kind() string {
+	switch {
+	case r.Drop:
+		return "drop"
+	case r.Status != 0:
+		return "status"
+	}
+	return "latency"
+}
+
+// err is the error the HTTP gateways return for the rule's failure: a 504
+// is a timeout, any other 5xx or a dropped connection a network error, both
+// retried by the checkout.
+func (r Rule) err() error {
+	switch {
+	case r.Drop:
+		return infra.NewNetworkError(fmt.Sprintf("injected connection drop on %s", r.Target))
+	case r.Status == http.StatusGatewayTimeout:
+		return infra.NewTimeoutError(fmt.Sprintf("injected %d on %s", r.Status, r.Target))
+	case r.Status != 0:
+		return infra.NewNetworkError(fmt.Sprintf("injected %d on %s", r.Status, r.Target))
+	}
+	return nil
+}
+
+// ParseRules reads a JSON list of rules, as FAULTS and PUT /admin/faults
+// take them.
+func ParseRules(raw []byte) ([]Rule, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	var rules []Rule
+	if err := dec.Decode(&rules); err != nil {
+		return nil, err
+	}
+	if err := validate(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func validate(rules []Rule) error {
+	seen := make(map[string]bool, len(rules))
+	var errs []error
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			errs = append(errs, err)
+		} else if seen[r.Target] {
+			errs = append(errs, fmt.Errorf("%s: more than one rule", r.Target))
+		}
+		seen[r.Target] = true
+	}
+	return errors.Join(errs...)
+}
+
+// Injector holds the active rules, at most one per gateway method, and
+// applies them through the gateways Stock and Payment wrap.
+type Injector struct {
+	mu    sync.RWMutex
+	rules map[string]Rule
+}
+
+// NewInjector starts with rules, which are expected to be valid.
+func NewInjector(rules []Rule) *Injector {
+	i := &Injector{}
+	i.replace(rules)
+	return i
+}
+
+// Rules returns the active rules ordered by target.
+func (i *Injector) Rules() []Rule {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	rules := make([]Rule, 0, len(i.rules))
+	for _, r := range i.rules {
+		rules = append(rules, r)
+	}
+	slices.SortFunc(rules, func(a, b Rule) int { return strings.Compare(a.Target, b.Target) })
+	return rules
+}
+
+func (i *Injector) replace(rules []Rule) {
+	byTarget := make(map[string]Rule, len(rules))
+	for _, r := range rules {
+		byTarget[r.Target] = r
+	}
+	i.mu.Lock()
+	i.rules = byTarget
+	i.mu.Unlock()
+}
+
+// inject applies the rule for target when it fires on this call, returning
+// the error the call fails with instead of reaching the gateway.
+func (i *Injector) inject(ctx context.Context, target string) error {
+	i.mu.RLock()
+	r, ok := i.rules[target]
+	i.mu.RUnlock()
+	if !ok || (r.Percent > 0 && rand.Float64()*100 >= r.Percent) {
+		return nil
+	}
+	metrics.FaultsInjected.WithLabelValues(r.Target, r.kind()).Inc()
+	if r.LatencyMs > 0 {
+		select {
+		case <-time.After(time.Duration(r.LatencyMs) * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return r.err()
+}
+
+// Stock wraps gateway so its calls go through the stock.* rules first.
+func (i *Injector) Stock(gateway protocols.StockGateway) protocols.StockGateway {
+	return &stockGateway{injector: i, next: gateway}
+}
+
+// Payment wraps gateway so its calls go through the payment.Charge rule
+// first.
+func (i *Injector) Payment(gateway protocols.PaymentGateway) protocols.PaymentGateway {
+	return &paymentGateway{injector: i, next: gateway}
+}
+
+type stockGateway struct {
+	injector *Injector
+	next     protocols.StockGateway
+}
+
+func (g *stockGateway) Reserve(ctx context.Context, itemId int32, quantity int32, tenantId string, customerId string, idempotencyKey string) (*protocols.Reservation, error) {
+	if err := g.injector.inject(ctx, "stock.Reserve"); err != nil {
+		return nil, err
+	}
+	return g.next.Reserve(ctx, itemId, quantity, tenantId, customerId, idempotencyKey)
+}
+
+func (g *stockGateway) Release(ctx context.Context, reservationId int32) error {
+	if err := g.injector.inject(ctx, "stock.Release"); err != nil {
+		return err
+	}
+	return g.next.Release(ctx, reservationId)
+}
+
+func (g *stockGateway) Complete(ctx context.Context, reservationId int32) error {
+	if err := g.injector.inject(ctx, "stock.Complete"); err != nil {
+		return err
+	}
+	return g.next.Complete(ctx, reservationId)
+}
+
+type paymentGateway struct {
+	injector *Injector
+	next     protocols.PaymentGateway
+}
+
+func (g *paymentGateway) Charge(ctx context.Context, amount float64, idempotencyKey string) error {
+	if err := g.injector.inject(ctx, "payment.Charge"); err != nil {
+		return err
+	}
+	return g.next.Charge(ctx, amount, idempotencyKey)
+}
+
+// List answers GET /admin/faults with the active rules.
+func (i *Injector) List(c *gin.Context) {
+	c.JSON(http.StatusOK, i.Rules())
+}
+
+// Replace answers PUT /admin/faults: the JSON list in the body becomes the
+// whole set of rules.
+func (i *Injector) Replace(c *gin.Context) {
+	raw, err := c.GetRawData()
+	if err != nil {
+		problem.Abort(c, problem.New(http.StatusBadRequest, problem.InvalidRequest, err.Error()))
+		return
+	}
+	rules, err := ParseRules(raw)
+	if err != nil {
+		problem.Abort(c, problem.New(http.StatusBadRequest, problem.InvalidRequest, err.Error()))
+		return
+	}
+	i.replace(rules)
+	c.JSON(http.StatusOK, i.Rules())
+}
+
+// Clear answers DELETE /admin/faults by removing every rule.
+func (i *Injector) Clear(c *gin.Context) {
+	i.replace(nil)
+	c.Status(http.StatusNoContent)
+}
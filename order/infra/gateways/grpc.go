@@ -0,0 +1,84 @@
+package gateways
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	infra "github.com/giovaniif/e-commerce/order/infra"
+	"github.com/giovaniif/e-commerce/order/infra/problem"
+	"github.com/giovaniif/e-commerce/order/infra/requestid"
+	"github.com/giovaniif/e-commerce/order/infra/tracing"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// idempotencyKeyMetadata is the gRPC counterpart of the Idempotency-Key
+// header.
+const idempotencyKeyMetadata = "idempotency-key"
+
+// DialGRPC opens a connection to the gRPC API of Stock or Payment at addr.
+// It connects lazily, and reconnects on its own, so a service that is down
+// only fails the calls made while it is. Calls are spread over every
+// address addr resolves to, one per replica behind a DNS name. interceptors
+// run on every call after the request id and trace context are attached.
+func DialGRPC(addr string, interceptors ...grpc.UnaryClientInterceptor) (*grpc.ClientConn, error) {
+	return grpc.NewClient(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig":[{"round_robin":{}}]}`),
+		grpc.WithChainUnaryInterceptor(append([]grpc.UnaryClientInterceptor{propagateMetadata}, interceptors...)...),
+	)
+}
+
+// propagateMetadata is propagate for gRPC: it carries the request id and
+// trace context of ctx in the call's metadata. The deadline of ctx travels
+// with the call on its own.
+func propagateMetadata(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	var pairs []string
+	if id := requestid.FromContext(ctx); id != "" {
+		pairs = append(pairs, "x-request-id", id)
+	}
+	header := http.Header{}
+	tracing.Inject(ctx, header)
+	for key, values := range header {
+		for _, v := range values {
+			pairs = append(pairs, strings.ToLower(key), v)
+		}
+	}
+	return invoker(metadata.AppendToOutgoingContext(ctx, pairs...), method, req, reply, cc, opts...)
+}
+
+// statusError classifies a failed gRPC call to Stock or Payment the way
+// problemError does an HTTP one: by the problem code in the ErrorInfo of
+// its status, falling back to its gRPC code. A call cut short by ctx
+// reports the context error, as the HTTP gateways do.
+func statusError(ctx context.Context, call string, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s request failed: %w", call, ctx.Err())
+	}
+	st := status.Convert(err)
+	var reason string
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok && info.GetDomain() == problem.Domain {
+			reason = info.GetReason()
+		}
+	}
+	details := fmt.Sprintf("%s: %s %s", call, st.Code(), reason)
+	if err := codeError(reason, details); err != nil {
+		return err
+	}
+	if reason == "" {
+		switch st.Code() {
+		case codes.DeadlineExceeded:
+			return infra.NewTimeoutError(details)
+		case codes.Unavailable, codes.Internal, codes.Unknown:
+			return infra.NewNetworkError(details)
+		}
+	}
+	return fmt.Errorf("%s failed: %s %s: %s", call, st.Code(), reason, st.Message())
+}
@@ -0,0 +1,180 @@
+package gateways
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	infra "github.com/giovaniif/e-commerce/order/infra"
+	"github.com/giovaniif/e-commerce/order/infra/problem"
+	"github.com/giovaniif/e-commerce/order/infra/requestid"
+	"github.com/giovaniif/e-commerce/order/protocols"
+	paymentv1 "github.com/giovaniif/e-commerce/proto/payment/v1"
+	stockv1 "github.com/giovaniif/e-commerce/proto/stock/v1"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeStock answers Reserve with reservation or err after delay, keeping
+// what the call carried.
+type fakeStock struct {
+	stockv1.UnimplementedStockServiceServer
+	reservation *stockv1.ReserveResponse
+	err         error
+	delay       time.Duration
+	md          metadata.MD
+	deadline    time.Time
+	customerId  string
+	tenantId    string
+}
+
+func (f *fakeStock) Reserve(ctx context.Context, req *stockv1.ReserveRequest) (*stockv1.ReserveResponse, error) {
+	f.md, _ = metadata.FromIncomingContext(ctx)
+	f.deadline, _ = ctx.Deadline()
+	f.customerId = req.GetCustomerId()
+	f.tenantId = req.GetTenantId()
+	select {
+	case <-time.After(f.delay):
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	return f.reservation, f.err
+}
+
+type fakePayment struct {
+	paymentv1.UnimplementedPaymentServiceServer
+	err     error
+	charged int64
+}
+
+func (f *fakePayment) Charge(ctx context.Context, req *paymentv1.ChargeRequest) (*paymentv1.ChargeResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.charged = req.GetAmountCents()
+	return &paymentv1.ChargeResponse{AmountCents: req.GetAmountCents()}, nil
+}
+
+// serveGRPC serves stock and payment on a local port and dials it.
+func serveGRPC(t *testing.T, stock *fakeStock, payment *fakePayment) *grpc.ClientConn {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := grpc.NewServer()
+	stockv1.RegisterStockServiceServer(srv, stock)
+	paymentv1.RegisterPaymentServiceServer(srv, payment)
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+	conn, err := DialGRPC(listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func problemStatus(code codes.Code, reason string) error {
+	st, _ := status.New(code, reason).WithDetails(&errdetails.ErrorInfo{Reason: reason, Domain: problem.Domain})
+	return st.Err()
+}
+
+func TestStockGatewayGrpc_PropagatesMetadataAndDeadline(t *testing.T) {
+	stock := &fakeStock{reservation: &stockv1.ReserveResponse{
+		ReservationId: 7,
+		TotalFee:      20,
+		Status:        stockv1.ReservationStatus_RESERVATION_STATUS_BACKORDERED,
+	}}
+	gateway := NewStockGatewayGrpc(serveGRPC(t, stock, &fakePayment{}))
+
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(requestid.NewContext(context.Background(), "req-1"), spanContext)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	got, err := gateway.Reserve(ctx, 1, 2, "tenant-1", "customer-1", "key-1")
+	if err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if stock.customerId != "customer-1" || stock.tenantId != "tenant-1" {
+		t.Errorf("customer = %q in tenant %q, want customer-1 in tenant-1", stock.customerId, stock.tenantId)
+	}
+	if want := (protocols.Reservation{Id: 7, TotalFee: 20, Backordered: true}); *got != want {
+		t.Errorf("Reserve = %+v, want %+v", *got, want)
+	}
+	for key, want := range map[string]string{
+		"idempotency-key": "key-1",
+		"x-request-id":    "req-1",
+		"traceparent":     "00-01000000000000000000000000000000-0200000000000000-01",
+	} {
+		if values := stock.md.Get(key); len(values) != 1 || values[0] != want {
+			t.Errorf("metadata %s = %v, want %q", key, values, want)
+		}
+	}
+	// The deadline travels as a timeout, so it arrives off by the call's latency.
+	if wantDeadline, _ := ctx.Deadline(); stock.deadline.IsZero() || stock.deadline.Sub(wantDeadline).Abs() > 100*time.Millisecond {
+		t.Errorf("deadline = %v, want about %v", stock.deadline, wantDeadline)
+	}
+}
+
+func TestGrpcGateways_ClassifyStatuses(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"insufficient stock", problemStatus(codes.FailedPrecondition, problem.InsufficientStock), infra.ErrInsufficientStock},
+		{"reservation closed", problemStatus(codes.FailedPrecondition, problem.ReservationClosed), infra.ErrReservationClosed},
+		{"in progress", problemStatus(codes.Aborted, problem.IdempotencyInProgress), infra.ErrInProgress},
+		{"timeout problem", problemStatus(codes.DeadlineExceeded, problem.Timeout), infra.ErrTimeout},
+		{"bare unavailable", status.Error(codes.Unavailable, "connection refused"), infra.ErrNetwork},
+		{"bare deadline", status.Error(codes.DeadlineExceeded, "too slow"), infra.ErrTimeout},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gateway := NewStockGatewayGrpc(serveGRPC(t, &fakeStock{err: tc.err}, &fakePayment{}))
+			_, err := gateway.Reserve(context.Background(), 1, 2, "", "", "key-1")
+			if !errors.Is(err, tc.want) {
+				t.Errorf("Reserve error = %v, want %v", err, tc.want)
+			}
+		})
+	}
+
+	t.Run("payment declined", func(t *testing.T) {
+		payment := &fakePayment{err: problemStatus(codes.FailedPrecondition, problem.PaymentDeclined)}
+		err := NewPaymentGatewayGrpc(serveGRPC(t, &fakeStock{}, payment)).Charge(context.Background(), 42.5, "key-1")
+		if !errors.Is(err, infra.ErrPaymentDeclined) {
+			t.Errorf("Charge error = %v, want %v", err, infra.ErrPaymentDeclined)
+		}
+	})
+
+	t.Run("caller deadline", func(t *testing.T) {
+		gateway := NewStockGatewayGrpc(serveGRPC(t, &fakeStock{delay: time.Second}, &fakePayment{}))
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := gateway.Reserve(ctx, 1, 2, "", "", "key-1")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Reserve error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
+
+func TestPaymentGatewayGrpc_ChargesCents(t *testing.T) {
+	payment := &fakePayment{}
+	if err := NewPaymentGatewayGrpc(serveGRPC(t, &fakeStock{}, payment)).Charge(context.Background(), 42.5, "key-1"); err != nil {
+		t.Fatalf("Charge: %v", err)
+	}
+	if payment.charged != 4250 {
+		t.Errorf("charged %d cents, want 4250", payment.charged)
+	}
+}
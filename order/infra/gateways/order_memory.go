@@ -0,0 +1,67 @@
+package gateways
+
+import (
+	"context"
+	"sync"
+
+	protocols "github.com/giovaniif/e-commerce/order/protocols"
+)
+
+// OrderGatewayMemory keeps orders in process, standing in for MongoDB where
+// the records have to be read back, as in the integration tests.
+type OrderGatewayMemory struct {
+	mu     sync.Mutex
+	orders []protocols.Order
+}
+
+func NewOrderGatewayMemory() *OrderGatewayMemory {
+	return &OrderGatewayMemory{}
+}
+
+func (g *OrderGatewayMemory) SaveOrder(ctx context.Context, order protocols.Order) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.orders = append(g.orders, order)
+	return nil
+}
+
+func (g *OrderGatewayMemory) FindOrderStatus(ctx context.Context, idempotencyKey string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, o := range g.orders {
+		if o.IdempotencyKey == idempotencyKey {
+			return o.Status, nil
+		}
+	}
+	return "", nil
+}
+
+func (g *OrderGatewayMemory) FindBackorderedOrders(ctx context.Context) ([]protocols.Order, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var orders []protocols.Order
+	for _, o := range g.orders {
+		if o.Status == protocols.OrderStatusBackordered {
+			orders = append(orders, o)
+		}
+	}
+	return orders, nil
+}
+
+func (g *OrderGatewayMemory) UpdateOrderStatus(ctx context.Context, idempotencyKey string, status string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i := range g.orders {
+		if g.orders[i].IdempotencyKey == idempotencyKey {
+			g.orders[i].Status = status
+		}
+	}
+	return nil
+}
+
+// Orders returns the orders saved so far, oldest first.
+func (g *OrderGatewayMemory) Orders() []protocols.Order {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]protocols.Order(nil), g.orders...)
+}
@@ -2,15 +2,23 @@ package gateways
 
 import (
 	"context"
+	"errors"
 	"time"
 
+	protocols "github.com/giovaniif/e-commerce/order/protocols"
+	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 type orderRecord struct {
 	IdempotencyKey string    `bson:"idempotency_key"`
+	CustomerId     string    `bson:"customer_id,omitempty"`
+	TenantId       string    `bson:"tenant_id,omitempty"`
 	ItemId         int32     `bson:"item_id"`
 	Quantity       int32     `bson:"quantity"`
+	ReservationId  int32     `bson:"reservation_id,omitempty"`
+	Status         string    `bson:"status"`
 	CreatedAt      time.Time `bson:"created_at"`
 }
 
@@ -23,14 +31,61 @@ func NewOrderGatewayMongo(client *mongo.Client) *OrderGatewayMongo {
 	return &OrderGatewayMongo{collection: col}
 }
 
-func (g *OrderGatewayMongo) SaveOrder(ctx context.Context, idempotencyKey string, itemId int32, quantity int32) error {
-	go func() {
-		g.collection.InsertOne(context.Background(), orderRecord{
-			IdempotencyKey: idempotencyKey,
-			ItemId:         itemId,
-			Quantity:       quantity,
-			CreatedAt:      time.Now(),
-		})
-	}()
-	return nil
+// SaveOrder writes the order before the checkout answers, so a checkout
+// taken over after a crash finds it. The write outlives a client that has
+// already gone away.
+func (g *OrderGatewayMongo) SaveOrder(ctx context.Context, order protocols.Order) error {
+	_, err := g.collection.InsertOne(context.WithoutCancel(ctx), orderRecord{
+		IdempotencyKey: order.IdempotencyKey,
+		CustomerId:     order.CustomerId,
+		TenantId:       order.TenantId,
+		ItemId:         order.ItemId,
+		Quantity:       order.Quantity,
+		ReservationId:  order.ReservationId,
+		Status:         order.Status,
+		CreatedAt:      time.Now(),
+	})
+	return err
+}
+
+func (g *OrderGatewayMongo) FindOrderStatus(ctx context.Context, idempotencyKey string) (string, error) {
+	var record orderRecord
+	err := g.collection.FindOne(ctx, bson.M{"idempotency_key": idempotencyKey}).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return record.Status, nil
+}
+
+func (g *OrderGatewayMongo) FindBackorderedOrders(ctx context.Context) ([]protocols.Order, error) {
+	cursor, err := g.collection.Find(ctx, bson.M{"status": protocols.OrderStatusBackordered},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var records []orderRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	orders := make([]protocols.Order, len(records))
+	for i, r := range records {
+		orders[i] = protocols.Order{
+			IdempotencyKey: r.IdempotencyKey,
+			CustomerId:     r.CustomerId,
+			TenantId:       r.TenantId,
+			ItemId:         r.ItemId,
+			Quantity:       r.Quantity,
+			ReservationId:  r.ReservationId,
+			Status:         r.Status,
+		}
+	}
+	return orders, nil
+}
+
+func (g *OrderGatewayMongo) UpdateOrderStatus(ctx context.Context, idempotencyKey string, status string) error {
+	_, err := g.collection.UpdateOne(ctx, bson.M{"idempotency_key": idempotencyKey}, bson.M{"$set": bson.M{"status": status}})
+	return err
 }
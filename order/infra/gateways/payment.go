@@ -1,68 +1,44 @@
 package gateways
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
+	"math"
 	"net/http"
-	"net/url"
 
-	"github.com/giovaniif/e-commerce/order/infra/requestid"
-	"github.com/giovaniif/e-commerce/order/infra/tracing"
+	"github.com/giovaniif/e-commerce/order/infra/gateways/paymentclient"
 )
 
 type PaymentGatewayHttp struct {
-	httpClient *http.Client
-	baseURL    string
+	client *paymentclient.ClientWithResponses
 }
 
 func NewPaymentGatewayHttp(httpClient *http.Client, baseURL string) *PaymentGatewayHttp {
+	// NewClientWithResponses only fails when an option does.
+	client, _ := paymentclient.NewClientWithResponses(baseURL,
+		paymentclient.WithHTTPClient(httpClient),
+		paymentclient.WithRequestEditorFn(propagate),
+	)
 	return &PaymentGatewayHttp{
-		httpClient: httpClient,
-		baseURL:    baseURL,
+		client: client,
 	}
 }
 
-type ChargeRequest struct {
-	Amount float64 `json:"amount"`
-}
-
 func (p *PaymentGatewayHttp) Charge(ctx context.Context, amount float64, idempotencyKey string) error {
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
 
-	payload := ChargeRequest{
-		Amount: amount,
-	}
-	payloadBytes, err := json.Marshal(payload)
-	if err != nil {
-		fmt.Println("failed to marshal payload")
-		return err
-	}
-
-	reqURL, _ := url.JoinPath(p.baseURL, "charge")
-	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewBuffer(payloadBytes))
-	if err != nil {
-		fmt.Println("failed to create request")
-		return err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Idempotency-Key", idempotencyKey)
-	if id := requestid.FromContext(ctx); id != "" {
-		req.Header.Set("X-Request-ID", id)
-	}
-	tracing.Inject(ctx, req.Header)
-	resp, err := p.httpClient.Do(req)
+	// Payment v2 takes the amount in cents.
+	resp, err := p.client.ChargeWithResponse(ctx,
+		&paymentclient.ChargeParams{IdempotencyKey: idempotencyKey},
+		paymentclient.ChargeRequestV2{AmountCents: int64(math.Round(amount * 100))},
+	)
 	if err != nil {
-		fmt.Println("failed to do request")
-		return err
+		return fmt.Errorf("charge request failed: %w", err)
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return errors.New("failed to charge")
+	if resp.StatusCode() != http.StatusOK {
+		return problemError("charge", resp.StatusCode(), resp.Body)
 	}
 	return nil
 }
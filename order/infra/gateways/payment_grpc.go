@@ -0,0 +1,35 @@
+package gateways
+
+import (
+	"context"
+	"math"
+
+	paymentv1 "github.com/giovaniif/e-commerce/proto/payment/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// PaymentGatewayGrpc calls the gRPC API of Payment, which charges like its
+// /v2 route.
+type PaymentGatewayGrpc struct {
+	client paymentv1.PaymentServiceClient
+}
+
+func NewPaymentGatewayGrpc(conn grpc.ClientConnInterface) *PaymentGatewayGrpc {
+	return &PaymentGatewayGrpc{
+		client: paymentv1.NewPaymentServiceClient(conn),
+	}
+}
+
+func (p *PaymentGatewayGrpc) Charge(ctx context.Context, amount float64, idempotencyKey string) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	callCtx := metadata.AppendToOutgoingContext(ctx, idempotencyKeyMetadata, idempotencyKey)
+	_, err := p.client.Charge(callCtx, &paymentv1.ChargeRequest{AmountCents: int64(math.Round(amount * 100))})
+	if err != nil {
+		return statusError(ctx, "charge", err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package gateways
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/giovaniif/e-commerce/contracts"
+	infra "github.com/giovaniif/e-commerce/order/infra"
+)
+
+// The Payment provider tests replay these interactions from
+// contracts/pacts/order-payment.json.
+func TestPaymentGatewayHttp_Contract(t *testing.T) {
+	payment := contracts.NewConsumer(t, "order", "payment")
+	charge := func(key string) contracts.Request {
+		return contracts.Request{
+			Method:  http.MethodPost,
+			Path:    "/v2/charge",
+			Headers: map[string]string{"Content-Type": "application/json", "Idempotency-Key": key},
+			Body:    json.RawMessage(`{"amountCents":2000}`),
+		}
+	}
+
+	t.Run("charge", func(t *testing.T) {
+		url := payment.Serve(t, contracts.Interaction{
+			Description: "an accepted charge",
+			Request:     charge("contract-charge"),
+			Response: contracts.Response{
+				Status: http.StatusOK,
+				Body:   json.RawMessage(`{"status":"charged","amountCents":2000}`),
+				Exact:  []string{"status"},
+			},
+		})
+		if err := NewPaymentGatewayHttp(http.DefaultClient, url).Charge(context.Background(), 20, "contract-charge"); err != nil {
+			t.Fatalf("Charge: %v", err)
+		}
+	})
+
+	t.Run("charge declined", func(t *testing.T) {
+		url := payment.Serve(t, contracts.Interaction{
+			Description: "a declined charge",
+			State:       "charges are declined",
+			Request:     charge("contract-decline"),
+			Response: contracts.Response{
+				Status:  http.StatusPaymentRequired,
+				Headers: map[string]string{"Content-Type": "application/problem+json"},
+				Body:    json.RawMessage(`{"type":"urn:e-commerce:problem:payment_declined","title":"Payment declined","status":402,"code":"payment_declined"}`),
+				Exact:   []string{"code"},
+			},
+		})
+		err := NewPaymentGatewayHttp(http.DefaultClient, url).Charge(context.Background(), 20, "contract-decline")
+		if !errors.Is(err, infra.ErrPaymentDeclined) {
+			t.Fatalf("Charge error = %v, want a declined payment", err)
+		}
+	})
+}
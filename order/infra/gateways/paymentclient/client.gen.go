@@ -0,0 +1,1043 @@
+// Package paymentclient provides primitives to interact with the openapi HTTP API.
+//
+// Code generated by github.com/oapi-codegen/oapi-codegen/v2 version v2.8.0 DO NOT EDIT.
+package paymentclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/oapi-codegen/runtime"
+)
+
+// Defines values for ChargeStatus.
+const (
+	Charged ChargeStatus = "charged"
+)
+
+// Valid indicates whether the value is a known member of the ChargeStatus enum.
+func (e ChargeStatus) Valid() bool {
+	switch e {
+	case Charged:
+		return true
+	default:
+		return false
+	}
+}
+
+// Charge defines model for Charge.
+type Charge struct {
+	AmountCents int64        `json:"amountCents"`
+	Status      ChargeStatus `json:"status"`
+}
+
+// ChargeStatus defines model for Charge.Status.
+type ChargeStatus string
+
+// ChargeRequest defines model for ChargeRequest.
+type ChargeRequest struct {
+	Amount float64 `json:"amount"`
+}
+
+// ChargeRequestV2 defines model for ChargeRequestV2.
+type ChargeRequestV2 struct {
+	AmountCents int64 `json:"amountCents"`
+}
+
+// Problem An RFC 7807 problem, sent as application/problem+json. Clients branch
+// on code, which never changes meaning; detail is for humans.
+type Problem struct {
+	// Code One of invalid_request, unauthenticated, item_not_found,
+	// warehouse_not_found, reservation_not_found, insufficient_stock,
+	// purchase_limit_exceeded, reservation_backordered,
+	// reservation_closed, idempotency_in_progress,
+	// idempotency_key_reused, payment_declined, timeout, unavailable,
+	// internal.
+	Code     string  `json:"code"`
+	Detail   *string `json:"detail,omitempty"`
+	Instance *string `json:"instance,omitempty"`
+	Status   int     `json:"status"`
+	Title    string  `json:"title"`
+
+	// Type Example: urn:e-commerce:problem:insufficient_stock
+	Type string `json:"type"`
+}
+
+// Unauthenticated An RFC 7807 problem, sent as application/problem+json. Clients branch
+// on code, which never changes meaning; detail is for humans.
+type Unauthenticated = Problem
+
+// Unavailable An RFC 7807 problem, sent as application/problem+json. Clients branch
+// on code, which never changes meaning; detail is for humans.
+type Unavailable = Problem
+
+// ChargeV1Params defines parameters for ChargeV1.
+type ChargeV1Params struct {
+	IdempotencyKey string `json:"Idempotency-Key"`
+}
+
+// ChargeParams defines parameters for Charge.
+type ChargeParams struct {
+	IdempotencyKey string `json:"Idempotency-Key"`
+}
+
+// ChargeV1JSONRequestBody defines body for ChargeV1 for application/json ContentType.
+//
+// Deprecated: this type has been marked as deprecated upstream, but no `x-deprecated-reason` was set
+type ChargeV1JSONRequestBody = ChargeRequest
+
+// ChargeJSONRequestBody defines body for Charge for application/json ContentType.
+type ChargeJSONRequestBody = ChargeRequestV2
+
+// RequestEditorFn is the function signature for the RequestEditor callback function
+type RequestEditorFn func(ctx context.Context, req *http.Request) error
+
+// Doer performs HTTP requests.
+//
+// The standard http.Client implements this interface.
+type HttpRequestDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client which conforms to the OpenAPI3 specification for this service.
+type Client struct {
+	// The endpoint of the server conforming to this interface, with scheme,
+	// https://api.deepmap.com for example. This can contain a path relative
+	// to the server, such as https://api.deepmap.com/dev-test, and all the
+	// paths in the swagger spec will be appended to the server.
+	Server string
+
+	// Doer for performing requests, typically a *http.Client with any
+	// customized settings, such as certificate chains.
+	Client HttpRequestDoer
+
+	// A list of callbacks for modifying requests which are generated before sending over
+	// the network.
+	RequestEditors []RequestEditorFn
+}
+
+// ClientOption allows setting custom parameters during construction
+type ClientOption func(*Client) error
+
+// Creates a new Client, with reasonable defaults
+func NewClient(server string, opts ...ClientOption) (*Client, error) {
+	// create a client with sane default values
+	client := Client{
+		Server: server,
+	}
+	// mutate client and add all optional params
+	for _, o := range opts {
+		if err := o(&client); err != nil {
+			return nil, err
+		}
+	}
+	// ensure the server URL always has a trailing slash
+	if !strings.HasSuffix(client.Server, "/") {
+		client.Server += "/"
+	}
+	// create httpClient, if not already present
+	if client.Client == nil {
+		client.Client = &http.Client{}
+	}
+	return &client, nil
+}
+
+// WithHTTPClient allows overriding the default Doer, which is
+// automatically created using http.Client. This is useful for tests.
+func WithHTTPClient(doer HttpRequestDoer) ClientOption {
+	return func(c *Client) error {
+		c.Client = doer
+		return nil
+	}
+}
+
+// WithRequestEditorFn allows setting up a callback function, which will be
+// called right before sending the request. This can be used to mutate the request.
+func WithRequestEditorFn(fn RequestEditorFn) ClientOption {
+	return func(c *Client) error {
+		c.RequestEditors = append(c.RequestEditors, fn)
+		return nil
+	}
+}
+
+// The interface specification for the client above.
+type ClientInterface interface {
+
+	// ChargeV1WithBody Charge an amount
+	//
+	// Every charge needs an Idempotency-Key: a retry with the same key gets
+	// the first response back instead of charging again.
+	//
+	// Deprecated in favour of /v2/charge, which takes the amount in cents;
+	// responses carry the Deprecation, Sunset and Link headers. /charge is
+	// served as this operation until its own, earlier, sunset.
+	//
+	// Takes any type of body and a specified content type.
+	//
+	// Corresponds with POST /v1/charge (the `ChargeV1` operationId).
+	//
+	// Deprecated: this operation has been marked as deprecated upstream, but no `x-deprecated-reason` was set
+	ChargeV1WithBody(ctx context.Context, params *ChargeV1Params, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// ChargeV1 Charge an amount
+	//
+	// Every charge needs an Idempotency-Key: a retry with the same key gets
+	// the first response back instead of charging again.
+	//
+	// Deprecated in favour of /v2/charge, which takes the amount in cents;
+	// responses carry the Deprecation, Sunset and Link headers. /charge is
+	// served as this operation until its own, earlier, sunset.
+	//
+	// Takes a body of the `application/json` content type.
+	//
+	// Corresponds with POST /v1/charge (the `ChargeV1` operationId).
+	//
+	// Deprecated: this operation has been marked as deprecated upstream, but no `x-deprecated-reason` was set
+	ChargeV1(ctx context.Context, params *ChargeV1Params, body ChargeV1JSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// ChargeWithBody Charge an amount
+	//
+	// Every charge needs an Idempotency-Key: a retry with the same key gets
+	// the first response back instead of charging again.
+	//
+	// Takes any type of body and a specified content type.
+	//
+	// Corresponds with POST /v2/charge (the `Charge` operationId).
+	ChargeWithBody(ctx context.Context, params *ChargeParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// Charge Charge an amount
+	//
+	// Every charge needs an Idempotency-Key: a retry with the same key gets
+	// the first response back instead of charging again.
+	//
+	// Takes a body of the `application/json` content type.
+	//
+	// Corresponds with POST /v2/charge (the `Charge` operationId).
+	Charge(ctx context.Context, params *ChargeParams, body ChargeJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error)
+}
+
+// ChargeV1WithBody Charge an amount
+//
+// Every charge needs an Idempotency-Key: a retry with the same key gets
+// the first response back instead of charging again.
+//
+// Deprecated in favour of /v2/charge, which takes the amount in cents;
+// responses carry the Deprecation, Sunset and Link headers. /charge is
+// served as this operation until its own, earlier, sunset.
+//
+// Takes any type of body and a specified content type.
+//
+// Corresponds with POST /v1/charge (the `ChargeV1` operationId).
+// Deprecated: this operation has been marked as deprecated upstream, but no `x-deprecated-reason` was set
+func (c *Client) ChargeV1WithBody(ctx context.Context, params *ChargeV1Params, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewChargeV1RequestWithBody(c.Server, params, contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+// ChargeV1 Charge an amount
+//
+// Every charge needs an Idempotency-Key: a retry with the same key gets
+// the first response back instead of charging again.
+//
+// Deprecated in favour of /v2/charge, which takes the amount in cents;
+// responses carry the Deprecation, Sunset and Link headers. /charge is
+// served as this operation until its own, earlier, sunset.
+//
+// Takes a body of the `application/json` content type.
+//
+// Corresponds with POST /v1/charge (the `ChargeV1` operationId).
+// Deprecated: this operation has been marked as deprecated upstream, but no `x-deprecated-reason` was set
+func (c *Client) ChargeV1(ctx context.Context, params *ChargeV1Params, body ChargeV1JSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewChargeV1Request(c.Server, params, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+// ChargeWithBody Charge an amount
+//
+// Every charge needs an Idempotency-Key: a retry with the same key gets
+// the first response back instead of charging again.
+//
+// Takes any type of body and a specified content type.
+//
+// Corresponds with POST /v2/charge (the `Charge` operationId).
+func (c *Client) ChargeWithBody(ctx context.Context, params *ChargeParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewChargeRequestWithBody(c.Server, params, contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+// Charge Charge an amount
+//
+// Every charge needs an Idempotency-Key: a retry with the same key gets
+// the first response back instead of charging again.
+//
+// Takes a body of the `application/json` content type.
+//
+// Corresponds with POST /v2/charge (the `Charge` operationId).
+func (c *Client) Charge(ctx context.Context, params *ChargeParams, body ChargeJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewChargeRequest(c.Server, params, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+// NewChargeV1Request calls the generic ChargeV1 builder with application/json body
+func NewChargeV1Request(server string, params *ChargeV1Params, body ChargeV1JSONRequestBody) (*http.Request, error) {
+	var bodyReader io.Reader
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	bodyReader = bytes.NewReader(buf)
+	return NewChargeV1RequestWithBody(server, params, "application/json", bodyReader)
+}
+
+// NewChargeV1RequestWithBody constructs an http.Request for the ChargeV1 method, with any body, and a specified content type
+func NewChargeV1RequestWithBody(server string, params *ChargeV1Params, contentType string, body io.Reader) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/v1/charge")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, queryURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Content-Type", contentType)
+
+	if params != nil {
+
+		var headerParam0 string
+
+		headerParam0, err = runtime.StyleParamWithOptions("simple", false, "Idempotency-Key", params.IdempotencyKey, runtime.StyleParamOptions{ParamLocation: runtime.ParamLocationHeader, Type: "string", Format: ""})
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Idempotency-Key", headerParam0)
+
+	}
+
+	return req, nil
+}
+
+// NewChargeRequest calls the generic Charge builder with application/json body
+func NewChargeRequest(server string, params *ChargeParams, body ChargeJSONRequestBody) (*http.Request, error) {
+	var bodyReader io.Reader
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	bodyReader = bytes.NewReader(buf)
+	return NewChargeRequestWithBody(server, params, "application/json", bodyReader)
+}
+
+// NewChargeRequestWithBody constructs an http.Request for the Charge method, with any body, and a specified content type
+func NewChargeRequestWithBody(server string, params *ChargeParams, contentType string, body io.Reader) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/v2/charge")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, queryURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Content-Type", contentType)
+
+	if params != nil {
+
+		var headerParam0 string
+
+		headerParam0, err = runtime.StyleParamWithOptions("simple", false, "Idempotency-Key", params.IdempotencyKey, runtime.StyleParamOptions{ParamLocation: runtime.ParamLocationHeader, Type: "string", Format: ""})
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Idempotency-Key", headerParam0)
+
+	}
+
+	return req, nil
+}
+
+func (c *Client) applyEditors(ctx context.Context, req *http.Request, additionalEditors []RequestEditorFn) error {
+	for _, r := range c.RequestEditors {
+		if err := r(ctx, req); err != nil {
+			return err
+		}
+	}
+	for _, r := range additionalEditors {
+		if err := r(ctx, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClientWithResponses builds on ClientInterface to offer response payloads
+type ClientWithResponses struct {
+	ClientInterface
+}
+
+// NewClientWithResponses creates a new ClientWithResponses, which wraps
+// Client with return type handling
+func NewClientWithResponses(server string, opts ...ClientOption) (*ClientWithResponses, error) {
+	client, err := NewClient(server, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientWithResponses{client}, nil
+}
+
+// WithBaseURL overrides the baseURL.
+func WithBaseURL(baseURL string) ClientOption {
+	return func(c *Client) error {
+		newBaseURL, err := url.Parse(baseURL)
+		if err != nil {
+			return err
+		}
+		c.Server = newBaseURL.String()
+		return nil
+	}
+}
+
+// ClientWithResponsesInterface is the interface specification for the client with responses above.
+type ClientWithResponsesInterface interface {
+
+	// ChargeV1WithBodyWithResponse Charge an amount
+	//
+	// Every charge needs an Idempotency-Key: a retry with the same key gets
+	// the first response back instead of charging again.
+	//
+	// Deprecated in favour of /v2/charge, which takes the amount in cents;
+	// responses carry the Deprecation, Sunset and Link headers. /charge is
+	// served as this operation until its own, earlier, sunset.
+	//
+	// Takes any type of body and a specified content type, and returns a wrapper object for the known response body format(s).
+	//
+	// Corresponds with POST /v1/charge (the `ChargeV1` operationId).
+	//
+	// Deprecated: this operation has been marked as deprecated upstream, but no `x-deprecated-reason` was set
+	ChargeV1WithBodyWithResponse(ctx context.Context, params *ChargeV1Params, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*ChargeV1Response, error)
+
+	// ChargeV1WithResponse Charge an amount
+	//
+	// Every charge needs an Idempotency-Key: a retry with the same key gets
+	// the first response back instead of charging again.
+	//
+	// Deprecated in favour of /v2/charge, which takes the amount in cents;
+	// responses carry the Deprecation, Sunset and Link headers. /charge is
+	// served as this operation until its own, earlier, sunset.
+	//
+	// Takes a body of the `application/json` content type, and returns a wrapper object for the known response body format(s).
+	//
+	// Corresponds with POST /v1/charge (the `ChargeV1` operationId).
+	//
+	// Deprecated: this operation has been marked as deprecated upstream, but no `x-deprecated-reason` was set
+	ChargeV1WithResponse(ctx context.Context, params *ChargeV1Params, body ChargeV1JSONRequestBody, reqEditors ...RequestEditorFn) (*ChargeV1Response, error)
+
+	// ChargeWithBodyWithResponse Charge an amount
+	//
+	// Every charge needs an Idempotency-Key: a retry with the same key gets
+	// the first response back instead of charging again.
+	//
+	// Takes any type of body and a specified content type, and returns a wrapper object for the known response body format(s).
+	//
+	// Corresponds with POST /v2/charge (the `Charge` operationId).
+	ChargeWithBodyWithResponse(ctx context.Context, params *ChargeParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*ChargeResponse, error)
+
+	// ChargeWithResponse Charge an amount
+	//
+	// Every charge needs an Idempotency-Key: a retry with the same key gets
+	// the first response back instead of charging again.
+	//
+	// Takes a body of the `application/json` content type, and returns a wrapper object for the known response body format(s).
+	//
+	// Corresponds with POST /v2/charge (the `Charge` operationId).
+	ChargeWithResponse(ctx context.Context, params *ChargeParams, body ChargeJSONRequestBody, reqEditors ...RequestEditorFn) (*ChargeResponse, error)
+}
+
+// ChargeV1Response401Headers the declared response headers of an HTTP 401 response for ChargeV1
+type ChargeV1Response401Headers struct {
+	WWWAuthenticate *string
+}
+
+// ChargeV1Response409Headers the declared response headers of an HTTP 409 response for ChargeV1
+type ChargeV1Response409Headers struct {
+	RetryAfter *int
+}
+
+// ChargeV1Response503Headers the declared response headers of an HTTP 503 response for ChargeV1
+type ChargeV1Response503Headers struct {
+	RetryAfter *int
+}
+
+type ChargeV1Response struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	// ApplicationproblemJSON400 the response for an HTTP 400 `application/problem+json` response
+	ApplicationproblemJSON400 *Problem
+	// ApplicationproblemJSON401 the response for an HTTP 401 `application/problem+json` response
+	ApplicationproblemJSON401 *Unauthenticated
+	// ApplicationproblemJSON402 the response for an HTTP 402 `application/problem+json` response
+	ApplicationproblemJSON402 *Problem
+	// ApplicationproblemJSON409 the response for an HTTP 409 `application/problem+json` response
+	ApplicationproblemJSON409 *Problem
+	// ApplicationproblemJSON422 the response for an HTTP 422 `application/problem+json` response
+	ApplicationproblemJSON422 *Problem
+	// ApplicationproblemJSON500 the response for an HTTP 500 `application/problem+json` response
+	ApplicationproblemJSON500 *Problem
+	// ApplicationproblemJSON503 the response for an HTTP 503 `application/problem+json` response
+	ApplicationproblemJSON503 *Unavailable
+	// ApplicationproblemJSON504 the response for an HTTP 504 `application/problem+json` response
+	ApplicationproblemJSON504 *Problem
+	// Headers401 the parsed response headers for an HTTP 401 response
+	Headers401 *ChargeV1Response401Headers
+	// Headers409 the parsed response headers for an HTTP 409 response
+	Headers409 *ChargeV1Response409Headers
+	// Headers503 the parsed response headers for an HTTP 503 response
+	Headers503 *ChargeV1Response503Headers
+}
+
+// GetApplicationproblemJSON400 returns the response for an HTTP 400 `application/problem+json` response
+func (r ChargeV1Response) GetApplicationproblemJSON400() *Problem {
+	return r.ApplicationproblemJSON400
+}
+
+// GetApplicationproblemJSON401 returns the response for an HTTP 401 `application/problem+json` response
+func (r ChargeV1Response) GetApplicationproblemJSON401() *Unauthenticated {
+	return r.ApplicationproblemJSON401
+}
+
+// GetApplicationproblemJSON402 returns the response for an HTTP 402 `application/problem+json` response
+func (r ChargeV1Response) GetApplicationproblemJSON402() *Problem {
+	return r.ApplicationproblemJSON402
+}
+
+// GetApplicationproblemJSON409 returns the response for an HTTP 409 `application/problem+json` response
+func (r ChargeV1Response) GetApplicationproblemJSON409() *Problem {
+	return r.ApplicationproblemJSON409
+}
+
+// GetApplicationproblemJSON422 returns the response for an HTTP 422 `application/problem+json` response
+func (r ChargeV1Response) GetApplicationproblemJSON422() *Problem {
+	return r.ApplicationproblemJSON422
+}
+
+// GetApplicationproblemJSON500 returns the response for an HTTP 500 `application/problem+json` response
+func (r ChargeV1Response) GetApplicationproblemJSON500() *Problem {
+	return r.ApplicationproblemJSON500
+}
+
+// GetApplicationproblemJSON503 returns the response for an HTTP 503 `application/problem+json` response
+func (r ChargeV1Response) GetApplicationproblemJSON503() *Unavailable {
+	return r.ApplicationproblemJSON503
+}
+
+// GetApplicationproblemJSON504 returns the response for an HTTP 504 `application/problem+json` response
+func (r ChargeV1Response) GetApplicationproblemJSON504() *Problem {
+	return r.ApplicationproblemJSON504
+}
+
+// GetBody returns the raw response body bytes
+func (r ChargeV1Response) GetBody() []byte {
+	return r.Body
+}
+
+// Status returns HTTPResponse.Status
+func (r ChargeV1Response) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r ChargeV1Response) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+// ContentType is a convenience method to retrieve the Content-Type value from the HTTP response headers
+func (r ChargeV1Response) ContentType() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Header.Get("Content-Type")
+	}
+	return ""
+}
+
+// ChargeResponse401Headers the declared response headers of an HTTP 401 response for Charge
+type ChargeResponse401Headers struct {
+	WWWAuthenticate *string
+}
+
+// ChargeResponse409Headers the declared response headers of an HTTP 409 response for Charge
+type ChargeResponse409Headers struct {
+	RetryAfter *int
+}
+
+// ChargeResponse503Headers the declared response headers of an HTTP 503 response for Charge
+type ChargeResponse503Headers struct {
+	RetryAfter *int
+}
+
+type ChargeResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	// JSON200 the response for an HTTP 200 `application/json` response
+	JSON200 *Charge
+	// ApplicationproblemJSON400 the response for an HTTP 400 `application/problem+json` response
+	ApplicationproblemJSON400 *Problem
+	// ApplicationproblemJSON401 the response for an HTTP 401 `application/problem+json` response
+	ApplicationproblemJSON401 *Unauthenticated
+	// ApplicationproblemJSON402 the response for an HTTP 402 `application/problem+json` response
+	ApplicationproblemJSON402 *Problem
+	// ApplicationproblemJSON409 the response for an HTTP 409 `application/problem+json` response
+	ApplicationproblemJSON409 *Problem
+	// ApplicationproblemJSON422 the response for an HTTP 422 `application/problem+json` response
+	ApplicationproblemJSON422 *Problem
+	// ApplicationproblemJSON500 the response for an HTTP 500 `application/problem+json` response
+	ApplicationproblemJSON500 *Problem
+	// ApplicationproblemJSON503 the response for an HTTP 503 `application/problem+json` response
+	ApplicationproblemJSON503 *Unavailable
+	// ApplicationproblemJSON504 the response for an HTTP 504 `application/problem+json` response
+	ApplicationproblemJSON504 *Problem
+	// Headers401 the parsed response headers for an HTTP 401 response
+	Headers401 *ChargeResponse401Headers
+	// Headers409 the parsed response headers for an HTTP 409 response
+	Headers409 *ChargeResponse409Headers
+	// Headers503 the parsed response headers for an HTTP 503 response
+	Headers503 *ChargeResponse503Headers
+}
+
+// GetJSON200 returns the response for an HTTP 200 `application/json` response
+func (r ChargeResponse) GetJSON200() *Charge {
+	return r.JSON200
+}
+
+// GetApplicationproblemJSON400 returns the response for an HTTP 400 `application/problem+json` response
+func (r ChargeResponse) GetApplicationproblemJSON400() *Problem {
+	return r.ApplicationproblemJSON400
+}
+
+// GetApplicationproblemJSON401 returns the response for an HTTP 401 `application/problem+json` response
+func (r ChargeResponse) GetApplicationproblemJSON401() *Unauthenticated {
+	return r.ApplicationproblemJSON401
+}
+
+// GetApplicationproblemJSON402 returns the response for an HTTP 402 `application/problem+json` response
+func (r ChargeResponse) GetApplicationproblemJSON402() *Problem {
+	return r.ApplicationproblemJSON402
+}
+
+// GetApplicationproblemJSON409 returns the response for an HTTP 409 `application/problem+json` response
+func (r ChargeResponse) GetApplicationproblemJSON409() *Problem {
+	return r.ApplicationproblemJSON409
+}
+
+// GetApplicationproblemJSON422 returns the response for an HTTP 422 `application/problem+json` response
+func (r ChargeResponse) GetApplicationproblemJSON422() *Problem {
+	return r.ApplicationproblemJSON422
+}
+
+// GetApplicationproblemJSON500 returns the response for an HTTP 500 `application/problem+json` response
+func (r ChargeResponse) GetApplicationproblemJSON500() *Problem {
+	return r.ApplicationproblemJSON500
+}
+
+// GetApplicationproblemJSON503 returns the response for an HTTP 503 `application/problem+json` response
+func (r ChargeResponse) GetApplicationproblemJSON503() *Unavailable {
+	return r.ApplicationproblemJSON503
+}
+
+// GetApplicationproblemJSON504 returns the response for an HTTP 504 `application/problem+json` response
+func (r ChargeResponse) GetApplicationproblemJSON504() *Problem {
+	return r.ApplicationproblemJSON504
+}
+
+// GetBody returns the raw response body bytes
+func (r ChargeResponse) GetBody() []byte {
+	return r.Body
+}
+
+// Status returns HTTPResponse.Status
+func (r ChargeResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r ChargeResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+// ContentType is a convenience method to retrieve the Content-Type value from the HTTP response headers
+func (r ChargeResponse) ContentType() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Header.Get("Content-Type")
+	}
+	return ""
+}
+
+// ChargeV1WithBodyWithResponse Charge an amount
+//
+// Every charge needs an Idempotency-Key: a retry with the same key gets
+// the first response back instead of charging again.
+//
+// Deprecated in favour of /v2/charge, which takes the amount in cents;
+// responses carry the Deprecation, Sunset and Link headers. /charge is
+// served as this operation until its own, earlier, sunset.
+//
+// Takes any type of body and a specified content type, and returns a wrapper object for the known response body format(s).
+//
+// Corresponds with POST /v1/charge (the `ChargeV1` operationId).
+//
+// Deprecated: this operation has been marked as deprecated upstream, but no `x-deprecated-reason` was set
+func (c *ClientWithResponses) ChargeV1WithBodyWithResponse(ctx context.Context, params *ChargeV1Params, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*ChargeV1Response, error) {
+	rsp, err := c.ChargeV1WithBody(ctx, params, contentType, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseChargeV1Response(rsp)
+}
+
+// ChargeV1WithResponse Charge an amount
+//
+// Every charge needs an Idempotency-Key: a retry with the same key gets
+// the first response back instead of charging again.
+//
+// Deprecated in favour of /v2/charge, which takes the amount in cents;
+// responses carry the Deprecation, Sunset and Link headers. /charge is
+// served as this operation until its own, earlier, sunset.
+//
+// Takes a body of the `application/json` content type, and returns a wrapper object for the known response body format(s).
+//
+// Corresponds with POST /v1/charge (the `ChargeV1` operationId).
+// Deprecated: this operation has been marked as deprecated upstream, but no `x-deprecated-reason` was set
+func (c *ClientWithResponses) ChargeV1WithResponse(ctx context.Context, params *ChargeV1Params, body ChargeV1JSONRequestBody, reqEditors ...RequestEditorFn) (*ChargeV1Response, error) {
+	rsp, err := c.ChargeV1(ctx, params, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseChargeV1Response(rsp)
+}
+
+// ChargeWithBodyWithResponse Charge an amount
+//
+// Every charge needs an Idempotency-Key: a retry with the same key gets
+// the first response back instead of charging again.
+//
+// Takes any type of body and a specified content type, and returns a wrapper object for the known response body format(s).
+//
+// Corresponds with POST /v2/charge (the `Charge` operationId).
+func (c *ClientWithResponses) ChargeWithBodyWithResponse(ctx context.Context, params *ChargeParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*ChargeResponse, error) {
+	rsp, err := c.ChargeWithBody(ctx, params, contentType, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseChargeResponse(rsp)
+}
+
+// ChargeWithResponse Charge an amount
+//
+// Every charge needs an Idempotency-Key: a retry with the same key gets
+// the first response back instead of charging again.
+//
+// Takes a body of the `application/json` content type, and returns a wrapper object for the known response body format(s).
+//
+// Corresponds with POST /v2/charge (the `Charge` operationId).
+func (c *ClientWithResponses) ChargeWithResponse(ctx context.Context, params *ChargeParams, body ChargeJSONRequestBody, reqEditors ...RequestEditorFn) (*ChargeResponse, error) {
+	rsp, err := c.Charge(ctx, params, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseChargeResponse(rsp)
+}
+
+// ParseChargeV1Response parses an HTTP response from a ChargeV1WithResponse call
+func ParseChargeV1Response(rsp *http.Response) (*ChargeV1Response, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ChargeV1Response{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 400:
+		var dest Problem
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.ApplicationproblemJSON400 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 401:
+		var dest Unauthenticated
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.ApplicationproblemJSON401 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 402:
+		var dest Problem
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.ApplicationproblemJSON402 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 409:
+		var dest Problem
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.ApplicationproblemJSON409 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 422:
+		var dest Problem
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.ApplicationproblemJSON422 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 500:
+		var dest Problem
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.ApplicationproblemJSON500 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 503:
+		var dest Unavailable
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.ApplicationproblemJSON503 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 504:
+		var dest Problem
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.ApplicationproblemJSON504 = &dest
+
+	}
+
+	switch {
+	case rsp.StatusCode == 401:
+		var headers ChargeV1Response401Headers
+		if values := rsp.Header.Values("WWW-Authenticate"); len(values) > 0 {
+			var value string
+			if err := runtime.BindStyledParameterWithOptions("simple", "WWW-Authenticate", values[0], &value, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false, Type: "string", Format: ""}); err != nil {
+				return nil, err
+			}
+			headers.WWWAuthenticate = &value
+		}
+		response.Headers401 = &headers
+	case rsp.StatusCode == 409:
+		var headers ChargeV1Response409Headers
+		if values := rsp.Header.Values("Retry-After"); len(values) > 0 {
+			var value int
+			if err := runtime.BindStyledParameterWithOptions("simple", "Retry-After", values[0], &value, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false, Type: "integer", Format: ""}); err != nil {
+				return nil, err
+			}
+			headers.RetryAfter = &value
+		}
+		response.Headers409 = &headers
+	case rsp.StatusCode == 503:
+		var headers ChargeV1Response503Headers
+		if values := rsp.Header.Values("Retry-After"); len(values) > 0 {
+			var value int
+			if err := runtime.BindStyledParameterWithOptions("simple", "Retry-After", values[0], &value, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false, Type: "integer", Format: ""}); err != nil {
+				return nil, err
+			}
+			headers.RetryAfter = &value
+		}
+		response.Headers503 = &headers
+	}
+
+	return response, nil
+}
+
+// ParseChargeResponse parses an HTTP response from a ChargeWithResponse call
+func ParseChargeResponse(rsp *http.Response) (*ChargeResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ChargeResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Charge
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 400:
+		var dest Problem
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.ApplicationproblemJSON400 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 401:
+		var dest Unauthenticated
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.ApplicationproblemJSON401 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 402:
+		var dest Problem
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.ApplicationproblemJSON402 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 409:
+		var dest Problem
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.ApplicationproblemJSON409 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 422:
+		var dest Problem
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.ApplicationproblemJSON422 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 500:
+		var dest Problem
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.ApplicationproblemJSON500 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 503:
+		var dest Unavailable
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.ApplicationproblemJSON503 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 504:
+		var dest Problem
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.ApplicationproblemJSON504 = &dest
+
+	}
+
+	switch {
+	case rsp.StatusCode == 401:
+		var headers ChargeResponse401Headers
+		if values := rsp.Header.Values("WWW-Authenticate"); len(values) > 0 {
+			var value string
+			if err := runtime.BindStyledParameterWithOptions("simple", "WWW-Authenticate", values[0], &value, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false, Type: "string", Format: ""}); err != nil {
+				return nil, err
+			}
+			headers.WWWAuthenticate = &value
+		}
+		response.Headers401 = &headers
+	case rsp.StatusCode == 409:
+		var headers ChargeResponse409Headers
+		if values := rsp.Header.Values("Retry-After"); len(values) > 0 {
+			var value int
+			if err := runtime.BindStyledParameterWithOptions("simple", "Retry-After", values[0], &value, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false, Type: "integer", Format: ""}); err != nil {
+				return nil, err
+			}
+			headers.RetryAfter = &value
+		}
+		response.Headers409 = &headers
+	case rsp.StatusCode == 503:
+		var headers ChargeResponse503Headers
+		if values := rsp.Header.Values("Retry-After"); len(values) > 0 {
+			var value int
+			if err := runtime.BindStyledParameterWithOptions("simple", "Retry-After", values[0], &value, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false, Type: "integer", Format: ""}); err != nil {
+				return nil, err
+			}
+			headers.RetryAfter = &value
+		}
+		response.Headers503 = &headers
+	}
+
+	return response, nil
+}
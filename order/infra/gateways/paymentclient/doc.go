@@ -0,0 +1,6 @@
+// Package paymentclient is the Payment API client generated from
+// payment/infra/openapi/openapi.yaml. Regenerate it with go generate after
+// changing the description.
+package paymentclient
+
+//go:generate go run github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen@v2.8.0 -config config.yaml ../../../../payment/infra/openapi/openapi.yaml
@@ -0,0 +1,61 @@
+package gateways
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	infra "github.com/giovaniif/e-commerce/order/infra"
+	"github.com/giovaniif/e-commerce/order/infra/problem"
+)
+
+// problemError classifies a failed call to Stock or Payment by the code of
+// the problem it answered with. An answer without one, such as the error page
+// of a proxy in front of the service, falls back to its status.
+func problemError(call string, status int, body []byte) error {
+	var p struct {
+		Code string `json:"code"`
+	}
+	_ = json.Unmarshal(body, &p)
+	details := fmt.Sprintf("%s: status %d %s", call, status, p.Code)
+	if err := codeError(p.Code, details); err != nil {
+		return err
+	}
+	if p.Code == "" {
+		switch {
+		case status == http.StatusGatewayTimeout:
+			return infra.NewTimeoutError(details)
+		case status >= 500:
+			return infra.NewNetworkError(details)
+		}
+	}
+	return fmt.Errorf("%s failed: status %d %s", call, status, p.Code)
+}
+
+// codeError is the error for a problem code of Stock or Payment, or nil for
+// a code Order has no error of its own for. unauthenticated is one: Stock
+// and Payment only answer it when Order's service key is wrong, which is no
+// fault of the customer.
+func codeError(code, details string) error {
+	switch code {
+	case problem.Timeout:
+		return infra.NewTimeoutError(details)
+	case problem.Unavailable, problem.Internal:
+		return infra.NewNetworkError(details)
+	case problem.IdempotencyInProgress:
+		return infra.NewInProgressError(details)
+	case problem.ItemNotFound:
+		return fmt.Errorf("%w: %s", infra.ErrItemNotFound, details)
+	case problem.InsufficientStock:
+		return fmt.Errorf("%w: %s", infra.ErrInsufficientStock, details)
+	case problem.PurchaseLimitExceeded:
+		return fmt.Errorf("%w: %s", infra.ErrPurchaseLimitExceeded, details)
+	case problem.PaymentDeclined:
+		return fmt.Errorf("%w: %s", infra.ErrPaymentDeclined, details)
+	case problem.ReservationBackordered:
+		return fmt.Errorf("%w: %s", infra.ErrReservationBackordered, details)
+	case problem.ReservationClosed:
+		return fmt.Errorf("%w: %s", infra.ErrReservationClosed, details)
+	}
+	return nil
+}
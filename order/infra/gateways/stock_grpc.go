@@ -0,0 +1,61 @@
+package gateways
+
+import (
+	"context"
+
+	protocols "github.com/giovaniif/e-commerce/order/protocols"
+	stockv1 "github.com/giovaniif/e-commerce/proto/stock/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// StockGatewayGrpc calls the gRPC API of Stock, which runs the same use
+// cases as its /v1 routes.
+type StockGatewayGrpc struct {
+	client stockv1.StockServiceClient
+}
+
+func NewStockGatewayGrpc(conn grpc.ClientConnInterface) *StockGatewayGrpc {
+	return &StockGatewayGrpc{
+		client: stockv1.NewStockServiceClient(conn),
+	}
+}
+
+func (s *StockGatewayGrpc) Reserve(ctx context.Context, itemId int32, quantity int32, tenantId string, customerId string, idempotencyKey string) (*protocols.Reservation, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	callCtx := metadata.AppendToOutgoingContext(ctx, idempotencyKeyMetadata, idempotencyKey)
+	reservation, err := s.client.Reserve(callCtx, &stockv1.ReserveRequest{ItemId: itemId, Quantity: quantity, CustomerId: customerId, TenantId: tenantId})
+	if err != nil {
+		return nil, statusError(ctx, "reserve stock", err)
+	}
+	return &protocols.Reservation{
+		Id:          reservation.GetReservationId(),
+		TotalFee:    reservation.GetTotalFee(),
+		Backordered: reservation.GetStatus() == stockv1.ReservationStatus_RESERVATION_STATUS_BACKORDERED,
+	}, nil
+}
+
+func (s *StockGatewayGrpc) Release(ctx context.Context, reservationId int32) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if _, err := s.client.Release(ctx, &stockv1.ReleaseRequest{ReservationId: reservationId}); err != nil {
+		return statusError(ctx, "release stock", err)
+	}
+	return nil
+}
+
+func (s *StockGatewayGrpc) Complete(ctx context.Context, reservationId int32) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if _, err := s.client.Complete(ctx, &stockv1.CompleteRequest{ReservationId: reservationId}); err != nil {
+		return statusError(ctx, "complete stock", err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package gateways
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/giovaniif/e-commerce/contracts"
+	infra "github.com/giovaniif/e-commerce/order/infra"
+	"github.com/giovaniif/e-commerce/order/protocols"
+)
+
+// The Stock provider tests replay these interactions from
+// contracts/pacts/order-stock.json.
+func TestStockGatewayHttp_Contract(t *testing.T) {
+	stock := contracts.NewConsumer(t, "order", "stock")
+	reserve := func(key string) contracts.Request {
+		return contracts.Request{
+			Method:  http.MethodPost,
+			Path:    "/v1/reserve",
+			Headers: map[string]string{"Content-Type": "application/json", "Idempotency-Key": key},
+			Body:    json.RawMessage(`{"itemId":1,"quantity":2}`),
+		}
+	}
+
+	t.Run("reserve", func(t *testing.T) {
+		url := stock.Serve(t, contracts.Interaction{
+			Description: "a reserve of an item in stock",
+			State:       "the item is in stock",
+			Request:     reserve("contract-reserve"),
+			Response: contracts.Response{
+				Status: http.StatusOK,
+				Body:   json.RawMessage(`{"reservationId":1,"totalFee":20,"status":"reserved"}`),
+				Exact:  []string{"status"},
+			},
+		})
+		got, err := NewStockGatewayHttp(http.DefaultClient, url).Reserve(context.Background(), 1, 2, "", "", "contract-reserve")
+		if err != nil {
+			t.Fatalf("Reserve: %v", err)
+		}
+		if want := (protocols.Reservation{Id: 1, TotalFee: 20}); *got != want {
+			t.Errorf("Reserve = %+v, want %+v", *got, want)
+		}
+	})
+
+	t.Run("reserve backordered", func(t *testing.T) {
+		url := stock.Serve(t, contracts.Interaction{
+			Description: "a reserve of a backorderable item out of stock",
+			State:       "the item is out of stock and backorderable",
+			Request:     reserve("contract-backorder"),
+			Response: contracts.Response{
+				Status: http.StatusAccepted,
+				Body:   json.RawMessage(`{"reservationId":1,"totalFee":20,"status":"backordered"}`),
+				Exact:  []string{"status"},
+			},
+		})
+		got, err := NewStockGatewayHttp(http.DefaultClient, url).Reserve(context.Background(), 1, 2, "", "", "contract-backorder")
+		if err != nil {
+			t.Fatalf("Reserve: %v", err)
+		}
+		if !got.Backordered {
+			t.Errorf("Reserve = %+v, want a backordered reservation", *got)
+		}
+	})
+
+	t.Run("reserve out of stock", func(t *testing.T) {
+		url := stock.Serve(t, contracts.Interaction{
+			Description: "a reserve of an item out of stock",
+			State:       "the item is out of stock",
+			Request:     reserve("contract-stockout"),
+			Response: contracts.Response{
+				Status:  http.StatusConflict,
+				Headers: map[string]string{"Content-Type": "application/problem+json"},
+				Body:    json.RawMessage(`{"type":"urn:e-commerce:problem:insufficient_stock","title":"Not enough stock","status":409,"code":"insufficient_stock"}`),
+				Exact:   []string{"code"},
+			},
+		})
+		_, err := NewStockGatewayHttp(http.DefaultClient, url).Reserve(context.Background(), 1, 2, "", "", "contract-stockout")
+		if !errors.Is(err, infra.ErrInsufficientStock) {
+			t.Fatalf("Reserve error = %v, want insufficient stock", err)
+		}
+	})
+
+	t.Run("release", func(t *testing.T) {
+		url := stock.Serve(t, contracts.Interaction{
+			Description: "a release of an open reservation",
+			State:       "a reservation is open",
+			Request: contracts.Request{
+				Method:  http.MethodPost,
+				Path:    "/v1/release",
+				Headers: map[string]string{"Content-Type": "application/json"},
+				Body:    json.RawMessage(`{"reservationId":1}`),
+			},
+			Response: contracts.Response{Status: http.StatusOK},
+		})
+		if err := NewStockGatewayHttp(http.DefaultClient, url).Release(context.Background(), 1); err != nil {
+			t.Fatalf("Release: %v", err)
+		}
+	})
+
+	t.Run("complete", func(t *testing.T) {
+		url := stock.Serve(t, contracts.Interaction{
+			Description: "a completion of an open reservation",
+			State:       "a reservation is open",
+			Request: contracts.Request{
+				Method:  http.MethodPost,
+				Path:    "/v1/complete",
+				Headers: map[string]string{"Content-Type": "application/json"},
+				Body:    json.RawMessage(`{"reservationId":1}`),
+			},
+			Response: contracts.Response{Status: http.StatusOK},
+		})
+		if err := NewStockGatewayHttp(http.DefaultClient, url).Complete(context.Background(), 1); err != nil {
+			t.Fatalf("Complete: %v", err)
+		}
+	})
+}
@@ -0,0 +1,6 @@
+// Package stockclient is the Stock API client generated from
+// stock/infra/openapi/openapi.yaml. Regenerate it with go generate after
+// changing the description.
+package stockclient
+
+//go:generate go run github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen@v2.8.0 -config config.yaml ../../../../stock/infra/openapi/openapi.yaml
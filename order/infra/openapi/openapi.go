@@ -0,0 +1,123 @@
+// Package openapi holds the OpenAPI 3 description of the Order API, serves it
+// at /openapi.json and checks incoming requests against it before they reach
+// a handler.
+package openapi
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gin-gonic/gin"
+	"github.com/giovaniif/e-commerce/order/infra/problem"
+)
+
+//go:embed openapi.yaml
+var spec []byte
+
+// Spec is the Order API description.
+type Spec struct {
+	doc  *openapi3.T
+	json []byte
+}
+
+// Load parses and validates the embedded description.
+func Load() (*Spec, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	if err != nil {
+		return nil, fmt.Errorf("load openapi spec: %w", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid openapi spec: %w", err)
+	}
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return &Spec{doc: doc, json: raw}, nil
+}
+
+// Serve answers GET /openapi.json.
+func (s *Spec) Serve(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", s.json)
+}
+
+// ginParam matches the :name segments of a gin route.
+var ginParam = regexp.MustCompile(`:(\w+)`)
+
+// Validate rejects with a 400 invalid_request problem a request whose
+// parameters, headers or body do not match its operation. Routes the
+// description leaves out, such as the probes and /metrics, pass unchecked.
+func (s *Spec) Validate(c *gin.Context) {
+	path := ginParam.ReplaceAllString(c.FullPath(), "{$1}")
+	item := s.doc.Paths.Value(path)
+	if item == nil || item.GetOperation(c.Request.Method) == nil {
+		c.Next()
+		return
+	}
+	params := make(map[string]string, len(c.Params))
+	for _, p := range c.Params {
+		params[p.Key] = p.Value
+	}
+	input := &openapi3filter.RequestValidationInput{
+		Request:    c.Request,
+		PathParams: params,
+		Route: &routers.Route{
+			Spec:      s.doc,
+			Path:      path,
+			PathItem:  item,
+			Method:    c.Request.Method,
+			Operation: item.GetOperation(c.Request.Method),
+		},
+		// Credentials are checked by the auth middleware, which knows
+		// whether authentication is on.
+		Options: &openapi3filter.Options{MultiError: true, AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+	}
+	if err := openapi3filter.ValidateRequest(c.Request.Context(), input); err != nil {
+		problem.Abort(c, problem.New(http.StatusBadRequest, problem.InvalidRequest, describe("body", err)))
+		return
+	}
+	c.Next()
+}
+
+// describe flattens a validation error into one line per problem, each
+// naming the part of the request at fault, without the schema dumps
+// kin-openapi appends.
+func describe(where string, err error) string {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		problems := make([]string, len(e))
+		for i, inner := range e {
+			problems[i] = describe(where, inner)
+		}
+		return strings.Join(problems, "; ")
+	case *openapi3filter.RequestError:
+		if e.Parameter != nil {
+			where = fmt.Sprintf("%s %q", e.Parameter.In, e.Parameter.Name)
+		}
+		var schemaErr *openapi3.SchemaError
+		switch {
+		case e.Err == nil:
+			return e.Reason
+		case errors.As(e.Err, &schemaErr):
+			return describe(where, e.Err)
+		case e.Reason == "" || e.Reason == e.Err.Error():
+			return fmt.Sprintf("%s: %v", where, e.Err)
+		}
+		return fmt.Sprintf("%s: %s: %v", where, e.Reason, e.Err)
+	case *openapi3.SchemaError:
+		for _, p := range e.JSONPointer() {
+			where += "." + p
+		}
+		return fmt.Sprintf("%s: %s", where, e.Reason)
+	}
+	return fmt.Sprintf("%s: %v", where, err)
+}
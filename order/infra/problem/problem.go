@@ -0,0 +1,111 @@
+// Package problem answers errors as RFC 7807 problem details
+// (application/problem+json) carrying a stable code clients can branch on,
+// so the text of internal errors never reaches them.
+package problem
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentType is the media type of every error response.
+const ContentType = "application/problem+json"
+
+// Codes shared by the services. A code never changes meaning once a client
+// may depend on it.
+const (
+	InvalidRequest         = "invalid_request"
+	Unauthenticated        = "unauthenticated"
+	ItemNotFound           = "item_not_found"
+	WarehouseNotFound      = "warehouse_not_found"
+	ReservationNotFound    = "reservation_not_found"
+	InsufficientStock      = "insufficient_stock"
+	PurchaseLimitExceeded  = "purchase_limit_exceeded"
+	ReservationBackordered = "reservation_backordered"
+	ReservationClosed      = "reservation_closed"
+	IdempotencyInProgress  = "idempotency_in_progress"
+	IdempotencyKeyReused   = "idempotency_key_reused"
+	PaymentDeclined        = "payment_declined"
+	Timeout                = "timeout"
+	Unavailable            = "unavailable"
+	Internal               = "internal"
+)
+
+// Details is a problem details object. Type is a URN built from Code; Title
+// is the same for every problem with the code, Detail describes this one.
+type Details struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+}
+
+var titles = map[string]string{
+	InvalidRequest:         "The request is invalid",
+	Unauthenticated:        "Authentication required",
+	ItemNotFound:           "Item not found",
+	WarehouseNotFound:      "Warehouse not found",
+	ReservationNotFound:    "Reservation not found",
+	InsufficientStock:      "Not enough stock",
+	PurchaseLimitExceeded:  "Purchase limit exceeded",
+	ReservationBackordered: "The reservation is waiting for a restock",
+	ReservationClosed:      "The reservation was released",
+	IdempotencyInProgress:  "A request with the same Idempotency-Key is in progress",
+	IdempotencyKeyReused:   "The Idempotency-Key was used with a different request",
+	PaymentDeclined:        "Payment declined",
+	Timeout:                "The request timed out",
+	Unavailable:            "The service is unavailable",
+	Internal:               "Internal error",
+}
+
+// New builds the problem for code.
+func New(status int, code, detail string) Details {
+	return Details{
+		Type:   "urn:e-commerce:problem:" + code,
+		Title:  titles[code],
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Abort answers the request with p and stops the handler chain.
+func Abort(c *gin.Context, p Details) {
+	p.Instance = c.Request.URL.Path
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+// Rule maps a domain error to the status and code it is answered with.
+type Rule struct {
+	Err    error
+	Status int
+	Code   string
+}
+
+// Mapper turns errors into problems by the first rule whose error they wrap.
+type Mapper []Rule
+
+// For returns the problem for err. A client-side problem carries the error's
+// text; an error no rule matches becomes a 500 that does not.
+func (m Mapper) For(err error) Details {
+	for _, rule := range m {
+		if errors.Is(err, rule.Err) {
+			detail := err.Error()
+			if rule.Status >= http.StatusInternalServerError {
+				detail = ""
+			}
+			return New(rule.Status, rule.Code, detail)
+		}
+	}
+	return New(http.StatusInternalServerError, Internal, "")
+}
+
+// Abort answers the request with the problem for err.
+func (m Mapper) Abort(c *gin.Context, err error) {
+	Abort(c, m.For(err))
+}
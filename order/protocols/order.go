@@ -2,6 +2,35 @@ package protocols
 
 import "context"
 
+const (
+	OrderStatusCompleted   = "completed"
+	OrderStatusBackordered = "backordered"
+)
+
+// Order is the record of a checkout: what was bought, by whom and how it
+// ended. CustomerId and TenantId are empty for anonymous checkouts.
+// ReservationId is the Stock reservation, which a backordered order is
+// completed against once a restock allocates it.
+type Order struct {
+	IdempotencyKey string
+	CustomerId     string
+	TenantId       string
+	ItemId         int32
+	Quantity       int32
+	ReservationId  int32
+	Status         string
+}
+
 type OrderGateway interface {
-	SaveOrder(ctx context.Context, idempotencyKey string, itemId int32, quantity int32) error
+	SaveOrder(ctx context.Context, order Order) error
+	// FindOrderStatus returns the status of the order saved for the
+	// checkout key, or "" when there is none.
+	FindOrderStatus(ctx context.Context, idempotencyKey string) (string, error)
+	// FindBackorderedOrders returns the orders still waiting on a restock,
+	// oldest first. Stock caps the backorders of every item, so there are
+	// never many.
+	FindBackorderedOrders(ctx context.Context) ([]Order, error)
+	// UpdateOrderStatus sets the status of the order saved for the checkout
+	// key.
+	UpdateOrderStatus(ctx context.Context, idempotencyKey string, status string) error
 }
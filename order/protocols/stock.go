@@ -5,10 +5,17 @@ import "context"
 type Reservation struct {
 	Id       int32
 	TotalFee float64
+	// Backordered reservations wait for a restock: the stock is promised but
+	// cannot be completed yet.
+	Backordered bool
 }
 
 type StockGateway interface {
-	Reserve(ctx context.Context, itemId int32, quantity int32) (*Reservation, error)
+	// Reserve sends idempotencyKey along so a retried reserve returns the
+	// first reservation instead of taking stock twice. The reservation
+	// counts against the purchase limits of customerId within tenantId,
+	// unless customerId is empty.
+	Reserve(ctx context.Context, itemId int32, quantity int32, tenantId string, customerId string, idempotencyKey string) (*Reservation, error)
 	Release(ctx context.Context, reservationId int32) error
 	Complete(ctx context.Context, reservationId int32) error
 }
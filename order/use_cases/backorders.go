@@ -0,0 +1,62 @@
+package checkout
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/giovaniif/e-commerce/order/infra"
+	protocols "github.com/giovaniif/e-commerce/order/protocols"
+)
+
+// CompleteBackorders completes the stock of the backordered orders a restock
+// has allocated and marks them completed. Their payment was taken at
+// checkout, so completing is all that is left; Stock refuses it with
+// ErrReservationBackordered while an order is still waiting, and the order
+// is tried again on the next pass. It returns how many orders it completed.
+func (c *Checkout) CompleteBackorders(ctx context.Context) (int, error) {
+	orders, err := c.orderGateway.FindBackorderedOrders(ctx)
+	if err != nil {
+		return 0, err
+	}
+	completed := 0
+	for _, order := range orders {
+		if ctx.Err() != nil {
+			return completed, ctx.Err()
+		}
+		if err := c.stockGateway.Complete(ctx, order.ReservationId); err != nil {
+			if !errors.Is(err, infra.ErrReservationBackordered) {
+				slog.WarnContext(ctx, "backorder completion failed", "reservation_id", order.ReservationId, "error", err)
+			}
+			continue
+		}
+		if err := c.orderGateway.UpdateOrderStatus(ctx, order.IdempotencyKey, protocols.OrderStatusCompleted); err != nil {
+			return completed, err
+		}
+		completed++
+	}
+	return completed, nil
+}
+
+// RunBackorders calls CompleteBackorders every interval until ctx is done.
+// Every replica may run it: completing a reservation twice is a no-op in
+// Stock, and so is marking an order completed twice.
+func (c *Checkout) RunBackorders(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := c.CompleteBackorders(ctx)
+			if err != nil && ctx.Err() == nil {
+				slog.ErrorContext(ctx, "complete backorders", "error", err)
+			}
+			if n > 0 {
+				slog.InfoContext(ctx, "backorders completed", "orders", n)
+			}
+		}
+	}
+}
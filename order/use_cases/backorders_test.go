@@ -0,0 +1,46 @@
+package checkout
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/giovaniif/e-commerce/order/infra"
+	protocols "github.com/giovaniif/e-commerce/order/protocols"
+)
+
+func TestCompleteBackordersWaitsForTheRestock(t *testing.T) {
+	stock := &mockStockGateway{reserveResult: &protocols.Reservation{Id: 12, TotalFee: 80, Backordered: true}}
+	orders := &mockOrderGateway{}
+	uc := NewCheckout(stock, &mockPaymentGateway{}, &MockSleeper{}, orders)
+	if _, err := uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 2, IdempotencyKey: "backorder-1"}); err != nil {
+		t.Fatalf("checkout: %v", err)
+	}
+	if orders.orders[0].ReservationId != 12 {
+		t.Fatalf("expected the order to keep reservation 12, got %d", orders.orders[0].ReservationId)
+	}
+
+	stock.completeErr = fmt.Errorf("%w: complete stock: status 409", infra.ErrReservationBackordered)
+	n, err := uc.CompleteBackorders(context.Background())
+	if err != nil || n != 0 {
+		t.Fatalf("expected nothing completed before the restock, got %d, %v", n, err)
+	}
+	if orders.orders[0].Status != protocols.OrderStatusBackordered {
+		t.Fatalf("expected the order to stay backordered, got %q", orders.orders[0].Status)
+	}
+
+	stock.completeErr = nil
+	n, err = uc.CompleteBackorders(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("expected one order completed after the restock, got %d, %v", n, err)
+	}
+	if orders.orders[0].Status != protocols.OrderStatusCompleted {
+		t.Fatalf("expected the order completed, got %q", orders.orders[0].Status)
+	}
+	if want := []int32{12, 12}; fmt.Sprint(stock.completedIds) != fmt.Sprint(want) {
+		t.Fatalf("expected Complete called with %v, got %v", want, stock.completedIds)
+	}
+	if n, _ := uc.CompleteBackorders(context.Background()); n != 0 {
+		t.Fatalf("expected a completed order not to be picked up again, got %d", n)
+	}
+}
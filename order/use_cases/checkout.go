@@ -16,53 +16,46 @@ var (
 	BASE_DELAY  = 100 * time.Millisecond
 )
 
-func NewCheckout(stockGateway protocols.StockGateway, paymentGateway protocols.PaymentGateway, checkoutGateway protocols.CheckoutGateway, sleeper protocols.Sleeper, orderGateway protocols.OrderGateway) *Checkout {
+func NewCheckout(stockGateway protocols.StockGateway, paymentGateway protocols.PaymentGateway, sleeper protocols.Sleeper, orderGateway protocols.OrderGateway) *Checkout {
 	return &Checkout{
-		stockGateway:    stockGateway,
-		paymentGateway:  paymentGateway,
-		checkoutGateway: checkoutGateway,
-		sleeper:         sleeper,
-		orderGateway:    orderGateway,
+		stockGateway:   stockGateway,
+		paymentGateway: paymentGateway,
+		sleeper:        sleeper,
+		orderGateway:   orderGateway,
 	}
 }
 
-func (c *Checkout) Checkout(ctx context.Context, input Input) error {
+// Checkout reserves, charges and completes. When the item is out of stock but
+// backorderable the reservation comes back backordered: the customer is still
+// charged but the stock cannot be completed until a restock, so the order is
+// recorded as backordered and the checkout succeeds with that status;
+// CompleteBackorders finishes it once the restock came.
+// Retries with the same idempotency key never get here: the HTTP layer
+// answers them with the first checkout's response.
+func (c *Checkout) Checkout(ctx context.Context, input Input) (Output, error) {
 	if ctx.Err() != nil {
-		return ctx.Err()
+		return Output{}, ctx.Err()
 	}
 
-	result, err := c.checkoutGateway.ReserveIdempotencyKey(ctx, input.IdempotencyKey)
-	if err != nil {
-		return err
-	}
-	keyBeingProcessed := result != nil
-	if keyBeingProcessed {
-		return nil
-	}
-
-	success := false
-	defer func() {
-		if success {
-			c.checkoutGateway.MarkSuccess(ctx, input.IdempotencyKey)
-		} else {
-			c.checkoutGateway.MarkFailure(ctx, input.IdempotencyKey)
-		}
-	}()
-
 	reservationOperation := func() (*protocols.Reservation, error) {
-		reservation, reservationError := c.stockGateway.Reserve(ctx, input.ItemId, input.Quantity)
+		reservation, reservationError := c.stockGateway.Reserve(ctx, input.ItemId, input.Quantity, input.TenantId, input.CustomerId, ReserveIdempotencyKey(input.IdempotencyKey))
 		return reservation, reservationError
 	}
 	wrappedOperation := RetryWithBackoff(ctx, reservationOperation, c.sleeper)
 	reservation, err := wrappedOperation()
 	if err != nil {
-		return err
+		return Output{}, err
 	}
 
 	err = c.paymentGateway.Charge(ctx, reservation.TotalFee, input.IdempotencyKey)
 	if err != nil {
 		c.stockGateway.Release(ctx, reservation.Id)
-		return err
+		return Output{}, err
+	}
+
+	if reservation.Backordered {
+		c.saveOrder(ctx, input, reservation.Id, protocols.OrderStatusBackordered)
+		return Output{Status: protocols.OrderStatusBackordered}, nil
 	}
 
 	completeStockOperation := RetryWithBackoff(ctx, func() (*protocols.Reservation, error) {
@@ -79,16 +72,46 @@ func (c *Checkout) Checkout(ctx context.Context, input Input) error {
 		_, releaseStockError := releaseStockOperation()
 		if releaseStockError != nil {
 			fmt.Printf("Failed to release stock for reservation after complete error %d: %v\n", reservation.Id, releaseStockError)
-			return releaseStockError
+			return Output{}, releaseStockError
 		}
-		return err
+		return Output{}, err
+	}
+
+	c.saveOrder(ctx, input, reservation.Id, protocols.OrderStatusCompleted)
+	return Output{Status: protocols.OrderStatusCompleted}, nil
+}
+
+// Recover looks up how far an earlier checkout with the same key got before
+// its replica died. found is true when that checkout finished and saved its
+// order; otherwise nothing was recorded and the checkout can run again, since
+// every downstream call is idempotent on keys derived from the same one.
+func (c *Checkout) Recover(ctx context.Context, idempotencyKey string) (output Output, found bool, err error) {
+	status, err := c.orderGateway.FindOrderStatus(ctx, idempotencyKey)
+	if err != nil || status == "" {
+		return Output{}, false, err
 	}
+	return Output{Status: status}, true, nil
+}
 
-	success = true
-	if err := c.orderGateway.SaveOrder(ctx, input.IdempotencyKey, input.ItemId, input.Quantity); err != nil {
+// ReserveIdempotencyKey scopes the checkout key to the reserve step, so it
+// never collides with the keys other steps send downstream.
+func ReserveIdempotencyKey(checkoutKey string) string {
+	return checkoutKey + ":reserve"
+}
+
+func (c *Checkout) saveOrder(ctx context.Context, input Input, reservationId int32, status string) {
+	err := c.orderGateway.SaveOrder(ctx, protocols.Order{
+		IdempotencyKey: input.IdempotencyKey,
+		CustomerId:     input.CustomerId,
+		TenantId:       input.TenantId,
+		ItemId:         input.ItemId,
+		Quantity:       input.Quantity,
+		ReservationId:  reservationId,
+		Status:         status,
+	})
+	if err != nil {
 		slog.ErrorContext(ctx, "failed to save order", "error", err)
 	}
-	return nil
 }
 
 type RetryFunc func() (*protocols.Reservation, error)
@@ -125,16 +148,25 @@ func RetryWithBackoff(ctx context.Context, operation RetryFunc, sleeper protocol
 	}
 }
 
+// Input is one checkout. CustomerId and TenantId name who checks out, when
+// the caller authenticated; the customer's purchase limits apply in Stock.
 type Input struct {
 	ItemId         int32
 	Quantity       int32
 	IdempotencyKey string
+	CustomerId     string
+	TenantId       string
+}
+
+// Output carries the order status; it is empty when the idempotency key was
+// already processed.
+type Output struct {
+	Status string
 }
 
 type Checkout struct {
-	stockGateway    protocols.StockGateway
-	paymentGateway  protocols.PaymentGateway
-	checkoutGateway protocols.CheckoutGateway
-	sleeper         protocols.Sleeper
-	orderGateway    protocols.OrderGateway
+	stockGateway   protocols.StockGateway
+	paymentGateway protocols.PaymentGateway
+	sleeper        protocols.Sleeper
+	orderGateway   protocols.OrderGateway
 }
@@ -6,11 +6,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/giovaniif/e-commerce/order/infra"
 	protocols "github.com/giovaniif/e-commerce/order/protocols"
 )
 
 type mockStockGateway struct {
 	reservedInputs []struct{ itemId, quantity int32 }
+	reservedKeys   []string
+	customerIds    []string
+	tenantIds      []string
 	reserveResult  *protocols.Reservation
 	reserveErr     error
 	releasedIds    []int32
@@ -19,8 +23,11 @@ type mockStockGateway struct {
 	completeErr    error
 }
 
-func (m *mockStockGateway) Reserve(ctx context.Context, itemId int32, quantity int32) (*protocols.Reservation, error) {
+func (m *mockStockGateway) Reserve(ctx context.Context, itemId int32, quantity int32, tenantId string, customerId string, idempotencyKey string) (*protocols.Reservation, error) {
 	m.reservedInputs = append(m.reservedInputs, struct{ itemId, quantity int32 }{itemId, quantity})
+	m.customerIds = append(m.customerIds, customerId)
+	m.tenantIds = append(m.tenantIds, tenantId)
+	m.reservedKeys = append(m.reservedKeys, idempotencyKey)
 	return m.reserveResult, m.reserveErr
 }
 
@@ -44,28 +51,39 @@ func (m *mockPaymentGateway) Charge(ctx context.Context, amount float64, idempot
 	return m.chargeErr
 }
 
-type mockCheckoutGateway struct {
-	reserveIdempotencyKeyResult *protocols.CheckoutIdempotencyKeyResult
-	reserveIdempotencyKeyErr    error
-	markSuccessCalled           bool
-	markFailureCalled           bool
-	markSuccessKey              string
-	markFailureKey              string
+type mockOrderGateway struct {
+	saved   []string
+	orders  []protocols.Order
+	found   map[string]string
+	findErr error
 }
 
-func (m *mockCheckoutGateway) ReserveIdempotencyKey(ctx context.Context, idempotencyKey string) (*protocols.CheckoutIdempotencyKeyResult, error) {
-	return m.reserveIdempotencyKeyResult, m.reserveIdempotencyKeyErr
+func (m *mockOrderGateway) SaveOrder(ctx context.Context, order protocols.Order) error {
+	m.saved = append(m.saved, order.Status)
+	m.orders = append(m.orders, order)
+	return nil
 }
 
-func (m *mockCheckoutGateway) MarkSuccess(ctx context.Context, idempotencyKey string) error {
-	m.markSuccessCalled = true
-	m.markSuccessKey = idempotencyKey
-	return nil
+func (m *mockOrderGateway) FindOrderStatus(ctx context.Context, idempotencyKey string) (string, error) {
+	return m.found[idempotencyKey], m.findErr
+}
+
+func (m *mockOrderGateway) FindBackorderedOrders(ctx context.Context) ([]protocols.Order, error) {
+	var orders []protocols.Order
+	for _, o := range m.orders {
+		if o.Status == protocols.OrderStatusBackordered {
+			orders = append(orders, o)
+		}
+	}
+	return orders, m.findErr
 }
 
-func (m *mockCheckoutGateway) MarkFailure(ctx context.Context, idempotencyKey string) error {
-	m.markFailureCalled = true
-	m.markFailureKey = idempotencyKey
+func (m *mockOrderGateway) UpdateOrderStatus(ctx context.Context, idempotencyKey string, status string) error {
+	for i := range m.orders {
+		if m.orders[i].IdempotencyKey == idempotencyKey {
+			m.orders[i].Status = status
+		}
+	}
 	return nil
 }
 
@@ -78,33 +96,25 @@ func (m *MockSleeper) Sleep(duration time.Duration) {
 func TestCheckoutReserveError(t *testing.T) {
 	stock := &mockStockGateway{reserveErr: errors.New("reserve error")}
 	payment := &mockPaymentGateway{}
-	checkoutGateway := &mockCheckoutGateway{}
 	sleeper := &MockSleeper{}
-	uc := NewCheckout(stock, payment, checkoutGateway, sleeper)
+	uc := NewCheckout(stock, payment, sleeper, &mockOrderGateway{})
 
-	err := uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 2, IdempotencyKey: "123"})
+	_, err := uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 2, IdempotencyKey: "123"})
 	if err == nil {
 		t.Fatalf("expected error, got nil")
 	}
 	if len(stock.reservedInputs) != 1 {
 		t.Fatalf("expected Reserve to be called once (no retry on non-retriable error), got %d", len(stock.reservedInputs))
 	}
-	if !checkoutGateway.markFailureCalled {
-		t.Fatalf("expected MarkFailure to be called")
-	}
-	if checkoutGateway.markFailureKey != "123" {
-		t.Fatalf("expected MarkFailure called with key '123', got %s", checkoutGateway.markFailureKey)
-	}
 }
 
 func TestCheckoutChargeWithTotalFee(t *testing.T) {
 	stock := &mockStockGateway{reserveResult: &protocols.Reservation{Id: 1, TotalFee: 123.45}}
 	payment := &mockPaymentGateway{}
-	checkoutGateway := &mockCheckoutGateway{}
 	sleeper := &MockSleeper{}
-	uc := NewCheckout(stock, payment, checkoutGateway, sleeper)
+	uc := NewCheckout(stock, payment, sleeper, &mockOrderGateway{})
 
-	_ = uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 2, IdempotencyKey: "123"})
+	_, _ = uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 2, IdempotencyKey: "123"})
 	if len(payment.charged) != 1 {
 		t.Fatalf("expected Charge to be called once, got %d", len(payment.charged))
 	}
@@ -116,11 +126,10 @@ func TestCheckoutChargeWithTotalFee(t *testing.T) {
 func TestCheckoutReleaseOnChargeFail(t *testing.T) {
 	stock := &mockStockGateway{reserveResult: &protocols.Reservation{Id: 2, TotalFee: 50}}
 	payment := &mockPaymentGateway{chargeErr: errors.New("charge error")}
-	checkoutGateway := &mockCheckoutGateway{}
 	sleeper := &MockSleeper{}
-	uc := NewCheckout(stock, payment, checkoutGateway, sleeper)
+	uc := NewCheckout(stock, payment, sleeper, &mockOrderGateway{})
 
-	err := uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 2, IdempotencyKey: "123"})
+	_, err := uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 2, IdempotencyKey: "123"})
 	if err == nil {
 		t.Fatalf("expected error, got nil")
 	}
@@ -132,11 +141,10 @@ func TestCheckoutReleaseOnChargeFail(t *testing.T) {
 func TestCheckoutCompleteCalled(t *testing.T) {
 	stock := &mockStockGateway{reserveResult: &protocols.Reservation{Id: 3, TotalFee: 10}}
 	payment := &mockPaymentGateway{}
-	checkoutGateway := &mockCheckoutGateway{}
 	sleeper := &MockSleeper{}
-	uc := NewCheckout(stock, payment, checkoutGateway, sleeper)
+	uc := NewCheckout(stock, payment, sleeper, &mockOrderGateway{})
 
-	_ = uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 1, IdempotencyKey: "123"})
+	_, _ = uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 1, IdempotencyKey: "123"})
 	if len(stock.completedIds) != 1 || stock.completedIds[0] != 3 {
 		t.Fatalf("expected Complete called with res-3, got %v", stock.completedIds)
 	}
@@ -145,11 +153,10 @@ func TestCheckoutCompleteCalled(t *testing.T) {
 func TestCheckoutReleaseOnCompleteFail(t *testing.T) {
 	stock := &mockStockGateway{reserveResult: &protocols.Reservation{Id: 4, TotalFee: 10}, completeErr: errors.New("complete error")}
 	payment := &mockPaymentGateway{}
-	checkoutGateway := &mockCheckoutGateway{}
 	sleeper := &MockSleeper{}
-	uc := NewCheckout(stock, payment, checkoutGateway, sleeper)
+	uc := NewCheckout(stock, payment, sleeper, &mockOrderGateway{})
 
-	err := uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 1, IdempotencyKey: "123"})
+	_, err := uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 1, IdempotencyKey: "123"})
 	if err == nil {
 		t.Fatalf("expected error, got nil")
 	}
@@ -161,11 +168,10 @@ func TestCheckoutReleaseOnCompleteFail(t *testing.T) {
 func TestCheckoutSuccess(t *testing.T) {
 	stock := &mockStockGateway{reserveResult: &protocols.Reservation{Id: 5, TotalFee: 20}}
 	payment := &mockPaymentGateway{}
-	checkoutGateway := &mockCheckoutGateway{}
 	sleeper := &MockSleeper{}
-	uc := NewCheckout(stock, payment, checkoutGateway, sleeper)
+	uc := NewCheckout(stock, payment, sleeper, &mockOrderGateway{})
 
-	err := uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 2, IdempotencyKey: "123"})
+	_, err := uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 2, IdempotencyKey: "123"})
 	if err != nil {
 		t.Fatalf("expected nil, got %v", err)
 	}
@@ -175,195 +181,161 @@ func TestCheckoutSuccess(t *testing.T) {
 	if len(stock.completedIds) != 1 || stock.completedIds[0] != 5 {
 		t.Fatalf("expected Complete called with res-5, got %v", stock.completedIds)
 	}
-	if !checkoutGateway.markSuccessCalled {
-		t.Fatalf("expected MarkSuccess to be called")
-	}
-	if checkoutGateway.markSuccessKey != "123" {
-		t.Fatalf("expected MarkSuccess called with key '123', got %s", checkoutGateway.markSuccessKey)
-	}
 }
 
-func TestCheckoutWithExistingIdempotencyKey(t *testing.T) {
-	stock := &mockStockGateway{reserveResult: &protocols.Reservation{Id: 6, TotalFee: 20}}
+func TestCheckoutContextError(t *testing.T) {
+	stock := &mockStockGateway{}
 	payment := &mockPaymentGateway{}
-	checkoutGateway := &mockCheckoutGateway{
-		reserveIdempotencyKeyErr: errors.New("idempotency key is already being processed"),
-	}
 	sleeper := &MockSleeper{}
-	uc := NewCheckout(stock, payment, checkoutGateway, sleeper)
+	uc := NewCheckout(stock, payment, sleeper, &mockOrderGateway{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Nanosecond)
+	defer cancel()
 
-	err := uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 2, IdempotencyKey: "123"})
+	_, err := uc.Checkout(ctx, Input{ItemId: 1, Quantity: 2, IdempotencyKey: "context-error"})
 	if err == nil {
 		t.Fatalf("expected error, got nil")
 	}
+
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+
 	if len(stock.reservedInputs) != 0 {
-		t.Fatalf("expected Reserve not to be called when idempotency key error, got %d calls", len(stock.reservedInputs))
+		t.Fatalf("expected Reserve not to be called when context expired, got %d calls", len(stock.reservedInputs))
 	}
+
 }
 
-func TestCheckoutWithSuccessfulIdempotencyKey(t *testing.T) {
-	stock := &mockStockGateway{reserveResult: &protocols.Reservation{Id: 7, TotalFee: 30}}
+func TestCheckoutBackordered(t *testing.T) {
+	stock := &mockStockGateway{reserveResult: &protocols.Reservation{Id: 12, TotalFee: 80, Backordered: true}}
 	payment := &mockPaymentGateway{}
-	checkoutGateway := &mockCheckoutGateway{
-		reserveIdempotencyKeyResult: &protocols.CheckoutIdempotencyKeyResult{
-			Success: true,
-			Error:   nil,
-		},
-	}
-	sleeper := &MockSleeper{}
-	uc := NewCheckout(stock, payment, checkoutGateway, sleeper)
+	orders := &mockOrderGateway{}
+	uc := NewCheckout(stock, payment, &MockSleeper{}, orders)
 
-	err := uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 2, IdempotencyKey: "abc-123"})
+	out, err := uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 2, IdempotencyKey: "backorder-1"})
 	if err != nil {
-		t.Fatalf("expected nil error when idempotency key already succeeded, got %v", err)
+		t.Fatalf("expected nil error, got %v", err)
 	}
-	if len(stock.reservedInputs) != 0 {
-		t.Fatalf("expected Reserve not to be called when idempotency key already succeeded, got %d calls", len(stock.reservedInputs))
+	if out.Status != protocols.OrderStatusBackordered {
+		t.Fatalf("expected status %q, got %q", protocols.OrderStatusBackordered, out.Status)
 	}
-	if len(payment.charged) != 0 {
-		t.Fatalf("expected Charge not to be called when idempotency key already succeeded, got %d calls", len(payment.charged))
+	if len(payment.charged) != 1 || payment.charged[0] != 80 {
+		t.Fatalf("expected Charge called with 80, got %v", payment.charged)
 	}
 	if len(stock.completedIds) != 0 {
-		t.Fatalf("expected Complete not to be called when idempotency key already succeeded, got %d calls", len(stock.completedIds))
-	}
-	if checkoutGateway.markSuccessCalled {
-		t.Fatalf("expected MarkSuccess not to be called when idempotency key already succeeded")
+		t.Fatalf("expected Complete not to be called for a backordered reservation, got %v", stock.completedIds)
 	}
-	if checkoutGateway.markFailureCalled {
-		t.Fatalf("expected MarkFailure not to be called when idempotency key already succeeded")
+	if len(orders.saved) != 1 || orders.saved[0] != protocols.OrderStatusBackordered {
+		t.Fatalf("expected order saved as backordered, got %v", orders.saved)
 	}
 }
 
-func TestCheckoutWithProcessingIdempotencyKey(t *testing.T) {
-	stock := &mockStockGateway{reserveResult: &protocols.Reservation{Id: 8, TotalFee: 40}}
-	payment := &mockPaymentGateway{}
-	checkoutGateway := &mockCheckoutGateway{
-		reserveIdempotencyKeyErr: errors.New("idempotency key is already being processed"),
-	}
-	sleeper := &MockSleeper{}
-	uc := NewCheckout(stock, payment, checkoutGateway, sleeper)
+func TestCheckoutBackorderedReleasedOnChargeFail(t *testing.T) {
+	stock := &mockStockGateway{reserveResult: &protocols.Reservation{Id: 13, TotalFee: 80, Backordered: true}}
+	payment := &mockPaymentGateway{chargeErr: errors.New("charge error")}
+	orders := &mockOrderGateway{}
+	uc := NewCheckout(stock, payment, &MockSleeper{}, orders)
 
-	err := uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 2, IdempotencyKey: "xyz-456"})
+	_, err := uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 2, IdempotencyKey: "backorder-2"})
 	if err == nil {
-		t.Fatalf("expected error when idempotency key is processing, got nil")
-	}
-	if err.Error() != "idempotency key is already being processed" {
-		t.Fatalf("expected error message 'idempotency key is already being processed', got %v", err)
+		t.Fatalf("expected error, got nil")
 	}
-	if len(stock.reservedInputs) != 0 {
-		t.Fatalf("expected Reserve not to be called when idempotency key is processing, got %d calls", len(stock.reservedInputs))
+	if len(stock.releasedIds) != 1 || stock.releasedIds[0] != 13 {
+		t.Fatalf("expected Release called with res-13, got %v", stock.releasedIds)
 	}
-	if len(payment.charged) != 0 {
-		t.Fatalf("expected Charge not to be called when idempotency key is processing, got %d calls", len(payment.charged))
+	if len(orders.saved) != 0 {
+		t.Fatalf("expected no order saved, got %v", orders.saved)
 	}
 }
 
-func TestCheckoutMarkFailureOnReserveError(t *testing.T) {
-	stock := &mockStockGateway{reserveErr: errors.New("reserve error")}
-	payment := &mockPaymentGateway{}
-	checkoutGateway := &mockCheckoutGateway{}
-	sleeper := &MockSleeper{}
-	uc := NewCheckout(stock, payment, checkoutGateway, sleeper)
+func TestCheckoutSavesCompletedOrder(t *testing.T) {
+	stock := &mockStockGateway{reserveResult: &protocols.Reservation{Id: 14, TotalFee: 10}}
+	orders := &mockOrderGateway{}
+	uc := NewCheckout(stock, &mockPaymentGateway{}, &MockSleeper{}, orders)
 
-	err := uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 2, IdempotencyKey: "fail-1"})
-	if err == nil {
-		t.Fatalf("expected error, got nil")
+	out, err := uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 1, IdempotencyKey: "completed-1"})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
 	}
-	if !checkoutGateway.markFailureCalled {
-		t.Fatalf("expected MarkFailure to be called on reserve error")
+	if out.Status != protocols.OrderStatusCompleted {
+		t.Fatalf("expected status %q, got %q", protocols.OrderStatusCompleted, out.Status)
 	}
-	if checkoutGateway.markFailureKey != "fail-1" {
-		t.Fatalf("expected MarkFailure called with key 'fail-1', got %s", checkoutGateway.markFailureKey)
+	if len(orders.saved) != 1 || orders.saved[0] != protocols.OrderStatusCompleted {
+		t.Fatalf("expected order saved as completed, got %v", orders.saved)
 	}
 }
 
-func TestCheckoutMarkFailureOnChargeError(t *testing.T) {
-	stock := &mockStockGateway{reserveResult: &protocols.Reservation{Id: 9, TotalFee: 50}}
-	payment := &mockPaymentGateway{chargeErr: errors.New("charge error")}
-	checkoutGateway := &mockCheckoutGateway{}
-	sleeper := &MockSleeper{}
-	uc := NewCheckout(stock, payment, checkoutGateway, sleeper)
+func TestCheckoutRecordsTheCustomer(t *testing.T) {
+	stock := &mockStockGateway{reserveResult: &protocols.Reservation{Id: 14, TotalFee: 10}}
+	orders := &mockOrderGateway{}
+	uc := NewCheckout(stock, &mockPaymentGateway{}, &MockSleeper{}, orders)
 
-	err := uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 2, IdempotencyKey: "fail-2"})
-	if err == nil {
-		t.Fatalf("expected error, got nil")
+	_, err := uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 1, IdempotencyKey: "customer-1", CustomerId: "c-1", TenantId: "t-1"})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(stock.customerIds) != 1 || stock.customerIds[0] != "c-1" {
+		t.Fatalf("expected the reserve to carry customer c-1, got %v", stock.customerIds)
 	}
-	if !checkoutGateway.markFailureCalled {
-		t.Fatalf("expected MarkFailure to be called on charge error")
+	if len(stock.tenantIds) != 1 || stock.tenantIds[0] != "t-1" {
+		t.Fatalf("expected the reserve to carry tenant t-1, got %v", stock.tenantIds)
 	}
-	if checkoutGateway.markFailureKey != "fail-2" {
-		t.Fatalf("expected MarkFailure called with key 'fail-2', got %s", checkoutGateway.markFailureKey)
+	want := protocols.Order{IdempotencyKey: "customer-1", CustomerId: "c-1", TenantId: "t-1", ItemId: 1, Quantity: 1, ReservationId: 14, Status: protocols.OrderStatusCompleted}
+	if len(orders.orders) != 1 || orders.orders[0] != want {
+		t.Fatalf("expected order %+v, got %+v", want, orders.orders)
 	}
 }
 
-func TestCheckoutMarkFailureOnCompleteError(t *testing.T) {
-	stock := &mockStockGateway{
-		reserveResult: &protocols.Reservation{Id: 10, TotalFee: 60},
-		completeErr:   errors.New("complete error"),
-	}
-	payment := &mockPaymentGateway{}
-	checkoutGateway := &mockCheckoutGateway{}
-	sleeper := &MockSleeper{}
-	uc := NewCheckout(stock, payment, checkoutGateway, sleeper)
+func TestCheckoutReserveSendsScopedIdempotencyKey(t *testing.T) {
+	stock := &mockStockGateway{reserveResult: &protocols.Reservation{Id: 7, TotalFee: 20}}
+	uc := NewCheckout(stock, &mockPaymentGateway{}, &MockSleeper{}, &mockOrderGateway{})
 
-	err := uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 2, IdempotencyKey: "fail-3"})
-	if err == nil {
-		t.Fatalf("expected error, got nil")
-	}
-	if !checkoutGateway.markFailureCalled {
-		t.Fatalf("expected MarkFailure to be called on complete error")
+	_, err := uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 2, IdempotencyKey: "123"})
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
 	}
-	if checkoutGateway.markFailureKey != "fail-3" {
-		t.Fatalf("expected MarkFailure called with key 'fail-3', got %s", checkoutGateway.markFailureKey)
+	if len(stock.reservedKeys) != 1 || stock.reservedKeys[0] != "123:reserve" {
+		t.Fatalf("expected Reserve called with key '123:reserve', got %v", stock.reservedKeys)
 	}
 }
 
-func TestCheckoutMarkSuccessOnCompleteSuccess(t *testing.T) {
-	stock := &mockStockGateway{reserveResult: &protocols.Reservation{Id: 11, TotalFee: 70}}
-	payment := &mockPaymentGateway{}
-	checkoutGateway := &mockCheckoutGateway{}
-	sleeper := &MockSleeper{}
-	uc := NewCheckout(stock, payment, checkoutGateway, sleeper)
+func TestCheckoutRetriesReserveInProgress(t *testing.T) {
+	stock := &mockStockGateway{reserveErr: infra.NewInProgressError("reserve already in progress")}
+	uc := NewCheckout(stock, &mockPaymentGateway{}, &MockSleeper{}, &mockOrderGateway{})
 
-	err := uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 2, IdempotencyKey: "success-1"})
-	if err != nil {
-		t.Fatalf("expected nil error, got %v", err)
-	}
-	if !checkoutGateway.markSuccessCalled {
-		t.Fatalf("expected MarkSuccess to be called on successful checkout")
+	_, err := uc.Checkout(context.Background(), Input{ItemId: 1, Quantity: 2, IdempotencyKey: "123"})
+	if !errors.Is(err, infra.ErrInProgress) {
+		t.Fatalf("expected ErrInProgress, got %v", err)
 	}
-	if checkoutGateway.markSuccessKey != "success-1" {
-		t.Fatalf("expected MarkSuccess called with key 'success-1', got %s", checkoutGateway.markSuccessKey)
+	if len(stock.reservedInputs) != MAX_RETRIES {
+		t.Fatalf("expected Reserve to be retried %d times, got %d", MAX_RETRIES, len(stock.reservedInputs))
 	}
-	if checkoutGateway.markFailureCalled {
-		t.Fatalf("expected MarkFailure not to be called on successful checkout")
+	for _, key := range stock.reservedKeys {
+		if key != "123:reserve" {
+			t.Fatalf("expected every attempt to reuse '123:reserve', got %v", stock.reservedKeys)
+		}
 	}
 }
 
-func TestCheckoutContextError(t *testing.T) {
-	stock := &mockStockGateway{}
-	payment := &mockPaymentGateway{}
-	checkoutGateway := &mockCheckoutGateway{}
-	sleeper := &MockSleeper{}
-	uc := NewCheckout(stock, payment, checkoutGateway, sleeper)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Nanosecond)
-	defer cancel()
+func TestCheckoutRecoverFindsSavedOrder(t *testing.T) {
+	orders := &mockOrderGateway{found: map[string]string{"123": protocols.OrderStatusBackordered}}
+	uc := NewCheckout(&mockStockGateway{}, &mockPaymentGateway{}, &MockSleeper{}, orders)
 
-	err := uc.Checkout(ctx, Input{ItemId: 1, Quantity: 2, IdempotencyKey: "context-error"})
-	if err == nil {
-		t.Fatalf("expected error, got nil")
+	out, found, err := uc.Recover(context.Background(), "123")
+	if err != nil || !found {
+		t.Fatalf("expected saved order to be found, got found=%v err=%v", found, err)
 	}
-
-	if err != context.DeadlineExceeded {
-		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	if out.Status != protocols.OrderStatusBackordered {
+		t.Fatalf("expected status %q, got %q", protocols.OrderStatusBackordered, out.Status)
 	}
+}
 
-	if len(stock.reservedInputs) != 0 {
-		t.Fatalf("expected Reserve not to be called when context expired, got %d calls", len(stock.reservedInputs))
-	}
+func TestCheckoutRecoverWithoutOrder(t *testing.T) {
+	uc := NewCheckout(&mockStockGateway{}, &mockPaymentGateway{}, &MockSleeper{}, &mockOrderGateway{})
 
-	if checkoutGateway.markSuccessCalled || checkoutGateway.markFailureCalled {
-		t.Fatalf("expected neither MarkSuccess nor MarkFailure when context expired")
+	_, found, err := uc.Recover(context.Background(), "123")
+	if err != nil || found {
+		t.Fatalf("expected no order, got found=%v err=%v", found, err)
 	}
 }
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/giovaniif/e-commerce/contracts"
+)
+
+// TestServer_HonorsOrderContract replays what Order's payment gateway
+// declared in contracts/pacts/order-payment.json.
+func TestServer_HonorsOrderContract(t *testing.T) {
+	contract, err := contracts.Load("order", "payment")
+	if err != nil {
+		t.Fatalf("load contract: %v", err)
+	}
+	charges := &fakeCharges{}
+	ts := httptest.NewServer(newTestServer(t, charges).Handler())
+	defer ts.Close()
+
+	contracts.Verify(t, ts.URL, contract, contracts.States{
+		"charges are declined": func(t *testing.T) map[string]any {
+			charges.mu.Lock()
+			charges.decline = true
+			charges.mu.Unlock()
+			t.Cleanup(func() {
+				charges.mu.Lock()
+				charges.decline = false
+				charges.mu.Unlock()
+			})
+			return nil
+		},
+	})
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/giovaniif/e-commerce/idempotency"
+	"github.com/giovaniif/e-commerce/payment/infra/metrics"
+	"github.com/giovaniif/e-commerce/payment/infra/problem"
+	"github.com/giovaniif/e-commerce/payment/infra/requestid"
+	"github.com/giovaniif/e-commerce/payment/infra/tracing"
+	charge "github.com/giovaniif/e-commerce/payment/use_cases"
+	paymentv1 "github.com/giovaniif/e-commerce/proto/payment/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDMetadata is the gRPC counterpart of the X-Request-ID header.
+const requestIDMetadata = "x-request-id"
+
+// chargeService is the gRPC API of the charge use case, the same one
+// /v2/charge serves.
+type chargeService struct {
+	paymentv1.UnimplementedPaymentServiceServer
+	charge *charge.Charge
+}
+
+func (s chargeService) Charge(ctx context.Context, req *paymentv1.ChargeRequest) (*paymentv1.ChargeResponse, error) {
+	amount := float64(req.GetAmountCents()) / 100
+	if err := s.charge.Charge(ctx, charge.ChargeInput{Amount: amount}); err != nil {
+		slog.ErrorContext(ctx, "charge failed", "request_id", requestid.FromContext(ctx), "amount", amount, "error", err)
+		return nil, problems.Status(err)
+	}
+	return &paymentv1.ChargeResponse{AmountCents: req.GetAmountCents()}, nil
+}
+
+// grpcServer builds the gRPC API around the charge use case, behind the
+// same request id, tracing, metrics, faults, readiness, service
+// authentication and idempotency the HTTP routes go through, and the
+// standard health service.
+func (s *Server) grpcServer(chargeUseCase *charge.Charge, idempotencyStore idempotency.Store) (*grpc.Server, *health.Server) {
+	interceptors := []grpc.UnaryServerInterceptor{
+		requestIDInterceptor,
+		tracing.UnaryServerInterceptor,
+		metrics.UnaryServerInterceptor,
+	}
+	if s.faults != nil {
+		interceptors = append(interceptors, s.faults.UnaryServerInterceptor)
+	}
+	interceptors = append(interceptors, s.grpcGate)
+	if auth := s.serviceAuthInterceptor(); auth != nil {
+		interceptors = append(interceptors, auth)
+	}
+	interceptors = append(interceptors,
+		idempotency.UnaryServerInterceptor(idempotencyStore, map[string]idempotency.Method{
+			paymentv1.PaymentService_Charge_FullMethodName: {Scope: "payment:charge", Required: true},
+		}),
+	)
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors...))
+	paymentv1.RegisterPaymentServiceServer(srv, chargeService{charge: chargeUseCase})
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(srv, healthServer)
+	return srv, healthServer
+}
+
+// requestIDInterceptor takes the request id from the x-request-id metadata,
+// or generates one, and sends it back in the response header.
+func requestIDInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	id := ""
+	if values := metadata.ValueFromIncomingContext(ctx, requestIDMetadata); len(values) > 0 {
+		id = values[0]
+	}
+	if id == "" {
+		id = requestid.Generate()
+	}
+	ctx = requestid.NewContext(ctx, id)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadata, id))
+	resp, err := handler(ctx, req)
+	if err != nil {
+		slog.Error("request", "request_id", id, "method", info.FullMethod, "code", status.Code(err).String())
+	}
+	return resp, err
+}
+
+// grpcGate is gate for gRPC: in strict mode calls are refused with
+// Unavailable until the required backends are reachable.
+func (s *Server) grpcGate(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if s.cfg.Strict() && !s.monitor.Ready() {
+		return nil, problem.New(http.StatusServiceUnavailable, problem.Unavailable, "service not ready, see /readyz").GRPCStatus().Err()
+	}
+	return handler(ctx, req)
+}
@@ -12,75 +12,102 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/redis/go-redis/v9"
-	"github.com/giovaniif/e-commerce/payment/infra/gateways"
+	"github.com/giovaniif/e-commerce/idempotency"
+	"github.com/giovaniif/e-commerce/payment/infra/config"
 	"github.com/giovaniif/e-commerce/payment/infra/loki"
 	"github.com/giovaniif/e-commerce/payment/infra/metrics"
+	"github.com/giovaniif/e-commerce/payment/infra/problem"
 	"github.com/giovaniif/e-commerce/payment/infra/requestid"
 	"github.com/giovaniif/e-commerce/payment/infra/tracing"
-	"github.com/giovaniif/e-commerce/payment/protocols"
+	"github.com/giovaniif/e-commerce/payment/infra/version"
 	charge "github.com/giovaniif/e-commerce/payment/use_cases"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"go.mongodb.org/mongo-driver/v2/mongo"
-	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const backendProbeInterval = 2 * time.Second
+
+// The unversioned /charge is v1 as it was called before the API moved under
+// /v1; v1 itself gives way to v2, which takes the amount in cents.
+var (
+	unversioned = version.Deprecation{
+		To:     "/v1",
+		Since:  time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+		Sunset: time.Date(2027, 4, 30, 0, 0, 0, 0, time.UTC),
+	}
+	v1Deprecation = version.Deprecation{
+		From:   "/v1",
+		To:     "/v2",
+		Since:  time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+		Sunset: time.Date(2027, 10, 31, 0, 0, 0, 0, time.UTC),
+	}
 )
 
 type ChargeRequest struct {
 	Amount float64 `json:"amount"`
 }
 
+// ChargeRequestV2 carries the amount in cents, so it reaches Payment
+// without the rounding of a float.
+type ChargeRequestV2 struct {
+	AmountCents int64 `json:"amountCents"`
+}
+
+// StartServer runs the Payment service until SIGINT or SIGTERM: it loads
+// the configuration, sets up the process-wide logging and tracing, and
+// serves a Server built from real backends.
 func StartServer() {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Invalid configuration: %v\n", err)
+		os.Exit(1)
+	}
+
 	logOut := io.Writer(os.Stdout)
 	var lokiWriter *loki.Writer
-	if lokiURL := os.Getenv("LOKI_URL"); lokiURL != "" {
-		if lw := loki.NewWriter(lokiURL, "payment"); lw != nil {
+	if cfg.LokiURL != "" {
+		if lw := loki.NewWriter(cfg.LokiURL, "payment"); lw != nil {
 			lokiWriter = lw
 			logOut = io.MultiWriter(os.Stdout, lw)
 		}
 	}
 	slog.SetDefault(slog.New(slog.NewJSONHandler(logOut, &slog.HandlerOptions{Level: slog.LevelInfo})))
-	slog.Info("payment service started", "port", 3132)
+	shutdownTracing := tracing.Init("payment", cfg.OTLPEndpoint)
 
-	shutdownTracing := tracing.Init("payment")
-	if shutdownTracing != nil {
-		defer shutdownTracing()
+	server, err := NewServer(context.Background(), cfg, Deps{})
+	if err != nil {
+		slog.Error("failed to build payment service", "error", err)
+		os.Exit(1)
 	}
-
-	r := gin.Default()
-
-	var chargeGateway protocols.ChargeGateway
-	if mongoURL := os.Getenv("MONGO_URL"); mongoURL != "" {
-		mongoClient, err := mongo.Connect(options.Client().ApplyURI(mongoURL))
-		if err != nil {
-			slog.Warn("failed to connect to MongoDB, using in-memory charge gateway", "error", err)
-			chargeGateway = gateways.NewChargeGatewayMemory()
-		} else if err := mongoClient.Ping(context.Background(), nil); err != nil {
-			slog.Warn("failed to ping MongoDB, using in-memory charge gateway", "error", err)
-			chargeGateway = gateways.NewChargeGatewayMemory()
-		} else {
-			chargeGateway = gateways.NewChargeGatewayMongo(mongoClient)
-			slog.Info("charge gateway: MongoDB")
-		}
-	} else {
-		slog.Warn("MONGO_URL not set, using in-memory charge gateway")
-		chargeGateway = gateways.NewChargeGatewayMemory()
+	if err := server.Start(); err != nil {
+		slog.Error("failed to start payment service", "error", err)
+		os.Exit(1)
 	}
+	slog.Info("payment service started", "port", cfg.Port, "grpc_port", cfg.GRPCPort)
+	fmt.Printf("Payment is running on port %d\n", cfg.Port)
 
-	var idempotencyGateway protocols.IdempotencyGateway
-	if redisAddr := os.Getenv("REDIS_ADDR"); redisAddr != "" {
-		rdb := redis.NewClient(&redis.Options{Addr: redisAddr})
-		if err := rdb.Ping(context.Background()).Err(); err != nil {
-			slog.Warn("failed to ping Redis, using in-memory idempotency gateway", "error", err)
-			idempotencyGateway = gateways.NewIdempotencyGatewayMemory()
-		} else {
-			idempotencyGateway = gateways.NewIdempotencyGatewayRedis(rdb)
-			slog.Info("idempotency gateway: Redis")
-		}
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+	fmt.Println("Payment shutting down...")
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		fmt.Printf("Payment shutdown: %v\n", err)
 	} else {
-		slog.Warn("REDIS_ADDR not set, using in-memory idempotency gateway")
-		idempotencyGateway = gateways.NewIdempotencyGatewayMemory()
+		fmt.Println("Payment stopped")
 	}
+	if shutdownTracing != nil {
+		shutdownTracing()
+	}
+	if lokiWriter != nil {
+		_ = lokiWriter.Close()
+	}
+}
 
+// routes builds the Payment API around the charge use case.
+func (s *Server) routes(chargeUseCase *charge.Charge, idempotencyStore idempotency.Store) http.Handler {
+	cfg, monitor := s.cfg, s.monitor
+	r := gin.Default()
 	r.Use(func(c *gin.Context) {
 		id := c.GetHeader("X-Request-ID")
 		if id == "" {
@@ -95,60 +122,90 @@ func StartServer() {
 	})
 	r.Use(tracing.Middleware("payment"))
 	r.Use(metrics.Middleware)
+	if s.faults != nil {
+		r.Use(s.faults.Middleware)
+	}
+	r.Use(s.spec.Validate)
 
+	r.GET("/openapi.json", s.spec.Serve)
 	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
+		code, status := http.StatusOK, "healthy"
+		if !monitor.Ready() {
+			status = "degraded"
+			if cfg.Strict() {
+				code, status = http.StatusServiceUnavailable, "unavailable"
+			}
+		}
+		c.JSON(code, gin.H{"status": status, "checks": monitor.Report().Checks})
 	})
+	r.GET("/livez", monitor.Livez)
+	r.GET("/readyz", monitor.Readyz)
+	// The admin routes are for operators on the internal network, and only
+	// with the admin token; Nginx does not expose them.
+	admin := r.Group("/admin", s.adminAuth())
+	if cfg.AdminEnabled {
+		admin.GET("/config", func(c *gin.Context) {
+			effective, err := cfg.Effective()
+			if err != nil {
+				problems.Abort(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, effective)
+		})
+	}
+	if s.faults != nil {
+		admin.GET("/faults", s.faults.List)
+		admin.PUT("/faults", s.faults.Replace)
+		admin.DELETE("/faults", s.faults.Clear)
+	}
 
-	r.POST("/charge", func(c *gin.Context) {
-		chargeUseCase := charge.NewCharge(chargeGateway, idempotencyGateway)
-		idempotencyKey := c.GetHeader("Idempotency-Key")
-		if idempotencyKey == "" {
-			c.String(http.StatusBadRequest, "Idempotency-Key header is required")
-			return
-		}
+	chargeIdempotency := idempotency.Middleware(idempotency.Config{
+		Store:    idempotencyStore,
+		Scope:    "payment:charge",
+		Required: true,
+	})
+	// Both versions charge through the same use case under the same
+	// idempotency scope; a key sent to one cannot be reused on the other.
+	// Only Order charges: with service authentication on, serviceAuth turns
+	// away calls it did not sign.
+	v1 := r.Group("/v1", v1Deprecation.Middleware)
+	v1.POST("/charge", s.gate(), s.serviceAuth(), chargeIdempotency, func(c *gin.Context) {
 		var chargeRequest ChargeRequest
 		if err := c.ShouldBindJSON(&chargeRequest); err != nil {
-			c.String(http.StatusBadRequest, err.Error())
+			problem.Abort(c, problem.New(http.StatusBadRequest, problem.InvalidRequest, err.Error()))
 			return
 		}
-		requestID := requestid.FromContext(c.Request.Context())
-		err := chargeUseCase.Charge(charge.ChargeInput{
-			IdempotencyKey: idempotencyKey,
-			Amount:         chargeRequest.Amount,
-		})
-		if err != nil {
-			slog.ErrorContext(c.Request.Context(), "charge failed", "request_id", requestID, "amount", chargeRequest.Amount, "error", err)
-			c.String(http.StatusInternalServerError, err.Error())
-		} else {
+		if chargeAmount(c, chargeUseCase, chargeRequest.Amount) {
 			c.String(http.StatusOK, "Charge successful")
 		}
 	})
 
-	srv := &http.Server{Addr: ":3132", Handler: r}
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			fmt.Printf("Payment server: %v\n", err)
+	v2 := r.Group("/v2")
+	v2.POST("/charge", s.gate(), s.serviceAuth(), chargeIdempotency, func(c *gin.Context) {
+		var chargeRequest ChargeRequestV2
+		if err := c.ShouldBindJSON(&chargeRequest); err != nil {
+			problem.Abort(c, problem.New(http.StatusBadRequest, problem.InvalidRequest, err.Error()))
+			return
 		}
-	}()
-	fmt.Println("Payment is running on port 3132")
+		if chargeAmount(c, chargeUseCase, float64(chargeRequest.AmountCents)/100) {
+			c.JSON(http.StatusOK, gin.H{"status": "charged", "amountCents": chargeRequest.AmountCents})
+		}
+	})
+	return version.Legacy(r, unversioned, "/charge")
+}
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
-	<-quit
-	fmt.Println("Payment shutting down...")
-	if shutdownTracing != nil {
-		shutdownTracing()
-	}
-	if lokiWriter != nil {
-		_ = lokiWriter.Close()
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		fmt.Printf("Payment shutdown: %v\n", err)
-	} else {
-		fmt.Println("Payment stopped")
+// chargeAmount runs the charge, answering the request with a problem when
+// it fails; the caller answers a successful one in its version's format.
+func chargeAmount(c *gin.Context, chargeUseCase *charge.Charge, amount float64) bool {
+	requestID := requestid.FromContext(c.Request.Context())
+	err := chargeUseCase.Charge(c.Request.Context(), charge.ChargeInput{
+		Amount: amount,
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "charge failed", "request_id", requestID, "amount", amount, "error", err)
+		problems.Abort(c, err)
+		return false
 	}
+	return true
 }
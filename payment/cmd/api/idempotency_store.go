@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+
+	"github.com/giovaniif/e-commerce/idempotency"
+	"github.com/giovaniif/e-commerce/payment/infra/backends"
+	_ "github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+)
+
+// newIdempotencyStore builds the store cfg.Idempotency picks. The Postgres
+// store is migrated; purging its expired keys is left to the caller. The
+// client it opens is closed on Shutdown.
+//
+// When strict, a backend that is down is kept, with a check that reports it
+// until it is reachable; otherwise an unreachable backend falls back to
+// memory and its client is closed right away.
+func (s *Server) newIdempotencyStore(ctx context.Context) (idempotency.Store, []backends.Check, error) {
+	cfg := s.cfg
+	switch cfg.Idempotency.Store {
+	case "postgres":
+		db, err := sql.Open("postgres", cfg.Idempotency.PostgresURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("open idempotency postgres: %w", err)
+		}
+		store := idempotency.NewPostgresStore(db)
+		check := backends.Check{Name: "idempotency_postgres", Probe: migrateOnce(store, db)}
+		if err := check.Probe(ctx); err != nil {
+			if !cfg.Strict() {
+				slog.Warn("failed to migrate Postgres, using in-memory idempotency store", "error", err)
+				db.Close()
+				return idempotency.NewMemoryStore(), nil, nil
+			}
+			slog.Warn("idempotency Postgres unavailable, waiting for it", "error", err)
+		}
+		s.closers = append(s.closers, db.Close)
+		slog.Info("idempotency store: Postgres")
+		return store, []backends.Check{check}, nil
+	case "redis":
+		rdb := redis.NewClient(&redis.Options{Addr: cfg.RedisAddr})
+		check := backends.Check{Name: "redis", Probe: func(ctx context.Context) error { return rdb.Ping(ctx).Err() }}
+		if err := check.Probe(ctx); err != nil {
+			if !cfg.Strict() {
+				slog.Warn("failed to ping Redis, using in-memory idempotency store", "error", err)
+				rdb.Close()
+				return idempotency.NewMemoryStore(), nil, nil
+			}
+			slog.Warn("Redis unavailable, waiting for it", "error", err)
+		}
+		s.closers = append(s.closers, rdb.Close)
+		slog.Info("idempotency store: Redis")
+		return idempotency.NewRedisStore(rdb), []backends.Check{check}, nil
+	}
+	slog.Warn("using in-memory idempotency store (set IDEMPOTENCY_STORE or REDIS_ADDR)")
+	return idempotency.NewMemoryStore(), nil, nil
+}
+
+// migrateOnce probes the database, applying the migrations the first time it
+// is reachable.
+func migrateOnce(store *idempotency.PostgresStore, db *sql.DB) func(context.Context) error {
+	var migrated atomic.Bool
+	return func(ctx context.Context) error {
+		if !migrated.Load() {
+			if err := store.Migrate(ctx); err != nil {
+				return err
+			}
+			migrated.Store(true)
+		}
+		return db.PingContext(ctx)
+	}
+}
@@ -0,0 +1,16 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/giovaniif/e-commerce/payment/infra/problem"
+	"github.com/giovaniif/e-commerce/payment/protocols"
+)
+
+// problems maps the errors of the charge use case to the problem each is
+// answered with; anything else is an internal error.
+var problems = problem.Mapper{
+	{Err: protocols.ErrDeclined, Status: http.StatusPaymentRequired, Code: problem.PaymentDeclined},
+	{Err: context.DeadlineExceeded, Status: http.StatusGatewayTimeout, Code: problem.Timeout},
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giovaniif/e-commerce/hmacauth"
+	"github.com/giovaniif/e-commerce/idempotency"
+	"github.com/giovaniif/e-commerce/payment/infra/backends"
+	"github.com/giovaniif/e-commerce/payment/infra/config"
+	"github.com/giovaniif/e-commerce/payment/infra/faults"
+	"github.com/giovaniif/e-commerce/payment/infra/gateways"
+	"github.com/giovaniif/e-commerce/payment/infra/openapi"
+	"github.com/giovaniif/e-commerce/payment/protocols"
+	charge "github.com/giovaniif/e-commerce/payment/use_cases"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+)
+
+// Deps are the collaborators the Payment server is built from. A nil field
+// is built from the configuration, so tests can replace any of them with a
+// fake and keep the rest real.
+type Deps struct {
+	Charges     protocols.ChargeGateway
+	Idempotency idempotency.Store
+}
+
+// Server is a wired Payment service: its HTTP handler, its gRPC server and
+// the background work behind them. Nothing listens or runs in the background until Start.
+type Server struct {
+	cfg        config.Config
+	handler    http.Handler
+	monitor    *backends.Monitor
+	faults     *faults.Injector
+	spec       *openapi.Spec
+	verifier   *hmacauth.Verifier
+	background []func(context.Context)
+	closers    []func() error
+
+	grpcSrv *grpc.Server
+	health  *health.Server
+
+	listener     net.Listener
+	grpcListener net.Listener
+	srv          *http.Server
+	stop         context.CancelFunc
+}
+
+// NewServer builds the Payment service from cfg and deps. ctx bounds the
+// probes made while connecting to backends. In strict mode a backend that
+// cannot be set up is an error; in lenient mode it is replaced in process.
+func NewServer(ctx context.Context, cfg config.Config, deps Deps) (_ *Server, err error) {
+	s := &Server{cfg: cfg}
+	defer func() {
+		if err != nil {
+			s.close()
+		}
+	}()
+	if s.spec, err = openapi.Load(); err != nil {
+		return nil, err
+	}
+
+	var checks []backends.Check
+	idempotencyStore := deps.Idempotency
+	if idempotencyStore == nil {
+		store, storeChecks, err := s.newIdempotencyStore(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("set up idempotency store: %w", err)
+		}
+		if pg, ok := store.(*idempotency.PostgresStore); ok {
+			s.background = append(s.background, func(ctx context.Context) { pg.RunPurge(ctx, cfg.Idempotency.PurgeInterval) })
+		}
+		idempotencyStore = store
+		checks = append(checks, storeChecks...)
+	}
+
+	chargeGateway := deps.Charges
+	if chargeGateway == nil {
+		gateway, check, err := s.newChargeGateway(ctx)
+		if err != nil {
+			return nil, err
+		}
+		chargeGateway = gateway
+		if check != nil {
+			checks = append(checks, *check)
+		}
+	}
+
+	verifier, check, err := s.newServiceVerifier(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.verifier = verifier
+	if check != nil {
+		checks = append(checks, *check)
+	}
+
+	s.monitor = backends.NewMonitor(checks...)
+	s.background = append(s.background, func(ctx context.Context) { s.monitor.Run(ctx, backendProbeInterval) })
+
+	if cfg.Faults.Enabled {
+		s.faults = faults.NewInjector(cfg.Faults.Rules)
+		slog.Warn("fault injection enabled", "rules", len(cfg.Faults.Rules))
+	}
+
+	chargeUseCase := charge.NewCharge(chargeGateway)
+	s.handler = s.routes(chargeUseCase, idempotencyStore)
+	s.grpcSrv, s.health = s.grpcServer(chargeUseCase, idempotencyStore)
+	return s, nil
+}
+
+// newChargeGateway connects to MongoDB when MONGO_URL is set, returning the
+// check that tracks it; the client is closed on Shutdown. In lenient mode an
+// unreachable MongoDB is replaced by the in-memory gateway; in strict mode
+// the client is kept and reconnects on its own.
+func (s *Server) newChargeGateway(ctx context.Context) (protocols.ChargeGateway, *backends.Check, error) {
+	cfg := s.cfg
+	if cfg.MongoURL == "" {
+		slog.Warn("MONGO_URL not set, using in-memory charge gateway")
+		return gateways.NewChargeGatewayMemory(), nil, nil
+	}
+	mongoClient, err := mongo.Connect(options.Client().ApplyURI(cfg.MongoURL))
+	if err != nil {
+		if cfg.Strict() {
+			return nil, nil, fmt.Errorf("connect to MongoDB: %w", err)
+		}
+		slog.Warn("failed to connect to MongoDB, using in-memory charge gateway", "error", err)
+		return gateways.NewChargeGatewayMemory(), nil, nil
+	}
+	if err := mongoClient.Ping(ctx, nil); err != nil {
+		if !cfg.Strict() {
+			slog.Warn("failed to ping MongoDB, using in-memory charge gateway", "error", err)
+			mongoClient.Disconnect(context.Background())
+			return gateways.NewChargeGatewayMemory(), nil, nil
+		}
+		slog.Warn("MongoDB unavailable, waiting for it", "error", err)
+	}
+	s.closers = append(s.closers, func() error { return mongoClient.Disconnect(context.Background()) })
+	slog.Info("charge gateway: MongoDB")
+	check := backends.Check{Name: "mongo", Probe: func(ctx context.Context) error { return mongoClient.Ping(ctx, nil) }}
+	return gateways.NewChargeGatewayMongo(mongoClient), &check, nil
+}
+
+// Handler serves the Payment API. It can be mounted on an httptest.Server
+// without calling Start; the backend checks are then never probed, so only
+// lenient mode lets requests through.
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// Start listens on the configured HTTP and gRPC ports, port 0 picking a
+// free one, and runs the background work until Shutdown.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.cfg.Port))
+	if err != nil {
+		return err
+	}
+	grpcListener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.cfg.GRPCPort))
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	for _, run := range s.background {
+		go run(ctx)
+	}
+	s.listener, s.grpcListener, s.stop = listener, grpcListener, stop
+	s.srv = &http.Server{Handler: s.handler}
+	go func() {
+		if err := s.srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("payment server failed", "error", err)
+		}
+	}()
+	go func() {
+		if err := s.grpcSrv.Serve(grpcListener); err != nil {
+			slog.Error("payment gRPC server failed", "error", err)
+		}
+	}()
+	return nil
+}
+
+// Addr is the address Start listens on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// GRPCAddr is the address Start serves gRPC on.
+func (s *Server) GRPCAddr() string {
+	return s.grpcListener.Addr().String()
+}
+
+// Shutdown stops the background work and waits for in-flight requests and
+// calls until ctx is done, then drops the calls still running and closes the
+// clients the server opened.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.srv == nil {
+		return s.close()
+	}
+	s.stop()
+	s.health.Shutdown()
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcSrv.GracefulStop()
+		close(stopped)
+	}()
+	err := s.srv.Shutdown(ctx)
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.grpcSrv.Stop()
+	}
+	return errors.Join(err, s.close())
+}
+
+func (s *Server) close() error {
+	var err error
+	for _, closeClient := range s.closers {
+		err = errors.Join(err, closeClient())
+	}
+	s.closers = nil
+	return err
+}
+
+// gate holds requests back in strict mode until the required backends are
+// reachable; lenient mode already fell back for whatever was down at boot
+// and just reports it.
+func (s *Server) gate() gin.HandlerFunc {
+	if s.cfg.Strict() {
+		return s.monitor.Gate()
+	}
+	return func(c *gin.Context) { c.Next() }
+}
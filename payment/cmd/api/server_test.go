@@ -0,0 +1,357 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/giovaniif/e-commerce/hmacauth"
+	"github.com/giovaniif/e-commerce/payment/infra/config"
+	"github.com/giovaniif/e-commerce/payment/protocols"
+	paymentv1 "github.com/giovaniif/e-commerce/proto/payment/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// adminToken guards the /admin routes of the tests that set ADMIN_TOKEN.
+const adminToken = "admin-0123456789abcdef0123456789abcdef"
+
+type fakeCharges struct {
+	mu      sync.Mutex
+	charged []float64
+	decline bool
+}
+
+func (f *fakeCharges) Charge(ctx context.Context, amount float64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.decline {
+		return fmt.Errorf("card declined: %w", protocols.ErrDeclined)
+	}
+	f.charged = append(f.charged, amount)
+	return nil
+}
+
+func newTestServer(t *testing.T, charges *fakeCharges) *Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("ENV_FILE", "")
+	t.Setenv("STARTUP_MODE", "lenient")
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config: %v", err)
+	}
+	cfg.Port, cfg.GRPCPort = 0, 0
+	server, err := NewServer(context.Background(), cfg, Deps{Charges: charges})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	return server
+}
+
+func postCharge(t *testing.T, url, key string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url+"/charge", strings.NewReader(`{"amount":42.5}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("charge: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestServer_ChargeIsRecordedOncePerKey(t *testing.T) {
+	charges := &fakeCharges{}
+	ts := httptest.NewServer(newTestServer(t, charges).Handler())
+	defer ts.Close()
+
+	for range 2 {
+		code, body := postCharge(t, ts.URL, "charge-1")
+		if code != http.StatusOK || body != "Charge successful" {
+			t.Fatalf("charge = %d %q", code, body)
+		}
+	}
+	if len(charges.charged) != 1 || charges.charged[0] != 42.5 {
+		t.Errorf("charged = %v, want [42.5]", charges.charged)
+	}
+}
+
+func TestServer_StartServesUntilShutdown(t *testing.T) {
+	server := newTestServer(t, &fakeCharges{})
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	code, _ := postCharge(t, "http://"+server.Addr(), "charge-2")
+	if code != http.StatusOK {
+		t.Errorf("charge status = %d, want 200", code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if _, err := http.Get("http://" + server.Addr() + "/livez"); err == nil {
+		t.Error("server still answering after Shutdown")
+	}
+}
+
+func TestServer_ClosesTheClientsItOpened(t *testing.T) {
+	mr := miniredis.RunT(t)
+	t.Setenv("REDIS_ADDR", mr.Addr())
+	t.Setenv("SERVICE_AUTH_ENABLED", "true")
+	t.Setenv("SERVICE_AUTH_KEYS", "order:0123456789abcdef0123456789abcdef")
+	closed := func(when string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for mr.CurrentConnectionCount() > 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("%d Redis connection(s) still open %s", mr.CurrentConnectionCount(), when)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Idempotency keys and service authentication nonces both live in Redis.
+	server := newTestServer(t, &fakeCharges{})
+	if mr.CurrentConnectionCount() < 2 {
+		t.Fatalf("%d Redis connection(s) open, want the idempotency and nonce clients", mr.CurrentConnectionCount())
+	}
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	closed("after Shutdown")
+
+	// A server that fails to build closes what it opened before failing.
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config: %v", err)
+	}
+	cfg.ServiceAuth.Keys = "order:short"
+	if _, err := NewServer(context.Background(), cfg, Deps{Charges: &fakeCharges{}}); err == nil {
+		t.Fatal("NewServer accepted a short service key")
+	}
+	closed("after NewServer failed")
+}
+
+func TestServer_InjectedFaultAnswersWithoutCharging(t *testing.T) {
+	t.Setenv("FAULTS_ENABLED", "true")
+	t.Setenv("ADMIN_TOKEN", adminToken)
+	charges := &fakeCharges{}
+	ts := httptest.NewServer(newTestServer(t, charges).Handler())
+	defer ts.Close()
+
+	setFaults := func(token string) int {
+		req, _ := http.NewRequest(http.MethodPut, ts.URL+"/admin/faults", strings.NewReader(`[{"target":"POST /v1/charge","status":503}]`))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("set faults: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for _, token := range []string{"", "not-the-admin-token"} {
+		if code := setFaults(token); code != http.StatusUnauthorized {
+			t.Fatalf("set faults with token %q = %d, want 401", token, code)
+		}
+	}
+	if code := setFaults(adminToken); code != http.StatusOK {
+		t.Fatalf("set faults status = %d, want 200", code)
+	}
+
+	if code, body := postCharge(t, ts.URL, "charge-3"); code != http.StatusServiceUnavailable {
+		t.Fatalf("charge = %d %q, want 503", code, body)
+	}
+	if len(charges.charged) != 0 {
+		t.Errorf("charged = %v, want nothing", charges.charged)
+	}
+}
+
+func TestServer_RejectsChargesTheSpecForbids(t *testing.T) {
+	charges := &fakeCharges{}
+	ts := httptest.NewServer(newTestServer(t, charges).Handler())
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/charge", strings.NewReader(`{"amount":42.5}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("charge: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), `header \"Idempotency-Key\": value is required but missing"`) {
+		t.Fatalf("charge without a key = %d %s, want a 400 naming Idempotency-Key", resp.StatusCode, body)
+	}
+	if len(charges.charged) != 0 {
+		t.Errorf("charged = %v, want nothing", charges.charged)
+	}
+}
+
+func TestServer_ServesChargeVersionsSideBySide(t *testing.T) {
+	charges := &fakeCharges{}
+	ts := httptest.NewServer(newTestServer(t, charges).Handler())
+	defer ts.Close()
+
+	cases := []struct {
+		path, body, key string
+		deprecated      bool
+		sunset, link    string
+	}{
+		{"/charge", `{"amount":42.5}`, "legacy", true, "Fri, 30 Apr 2027 00:00:00 GMT", `</v1/charge>; rel="successor-version"`},
+		{"/v1/charge", `{"amount":42.5}`, "v1", true, "Sun, 31 Oct 2027 00:00:00 GMT", `</v2/charge>; rel="successor-version"`},
+		{"/v2/charge", `{"amountCents":4250}`, "v2", false, "", ""},
+	}
+	for _, tc := range cases {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", tc.key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s = %d, want 200", tc.path, resp.StatusCode)
+		}
+		if got := resp.Header.Get("Deprecation") != ""; got != tc.deprecated {
+			t.Errorf("%s: deprecated = %v, want %v", tc.path, got, tc.deprecated)
+		}
+		if got := resp.Header.Get("Sunset"); got != tc.sunset {
+			t.Errorf("%s: Sunset = %q, want %q", tc.path, got, tc.sunset)
+		}
+		if got := resp.Header.Get("Link"); got != tc.link {
+			t.Errorf("%s: Link = %q, want %q", tc.path, got, tc.link)
+		}
+	}
+	if len(charges.charged) != 3 || charges.charged[2] != 42.5 {
+		t.Errorf("charged = %v, want 42.5 three times", charges.charged)
+	}
+}
+
+func TestServer_ChargesOverGRPC(t *testing.T) {
+	charges := &fakeCharges{}
+	server := newTestServer(t, charges)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer server.Shutdown(context.Background())
+	conn, err := grpc.NewClient(server.GRPCAddr(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	client := paymentv1.NewPaymentServiceClient(conn)
+
+	charge := func(key string) (*paymentv1.ChargeResponse, metadata.MD, error) {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "idempotency-key", key, "x-request-id", "req-"+key)
+		var header metadata.MD
+		resp, err := client.Charge(ctx, &paymentv1.ChargeRequest{AmountCents: 4250}, grpc.Header(&header))
+		return resp, header, err
+	}
+	for range 2 {
+		resp, header, err := charge("grpc-1")
+		if err != nil {
+			t.Fatalf("charge: %v", err)
+		}
+		if resp.GetAmountCents() != 4250 {
+			t.Errorf("amountCents = %d, want 4250", resp.GetAmountCents())
+		}
+		if got := header.Get("x-request-id"); len(got) != 1 || got[0] != "req-grpc-1" {
+			t.Errorf("x-request-id = %v, want the one sent", got)
+		}
+	}
+	if len(charges.charged) != 1 || charges.charged[0] != 42.5 {
+		t.Errorf("charged = %v, want [42.5]", charges.charged)
+	}
+
+	charges.decline = true
+	_, _, err = charge("grpc-2")
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("declined charge = %v, want FailedPrecondition", err)
+	}
+	var reason string
+	for _, d := range status.Convert(err).Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			reason = info.GetReason()
+		}
+	}
+	if reason != "payment_declined" {
+		t.Errorf("reason = %q, want payment_declined", reason)
+	}
+}
+
+func TestServer_ChargesNeedAServiceSignature(t *testing.T) {
+	const keys = "order:0123456789abcdef0123456789abcdef"
+	t.Setenv("SERVICE_AUTH_ENABLED", "true")
+	t.Setenv("SERVICE_AUTH_KEYS", keys)
+	charges := &fakeCharges{}
+	server := newTestServer(t, charges)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer server.Shutdown(context.Background())
+	url := "http://" + server.Addr()
+
+	code, body := postCharge(t, url, "unsigned")
+	if code != http.StatusUnauthorized || !strings.Contains(body, `"code":"unauthenticated"`) {
+		t.Fatalf("unsigned charge = %d %s, want 401 unauthenticated", code, body)
+	}
+	parsed, _ := hmacauth.ParseKeys(keys)
+	signed := &http.Client{Transport: &hmacauth.Transport{Signer: hmacauth.NewSigner(parsed[0])}}
+	for _, path := range []string{"/charge", "/v2/charge"} {
+		req, _ := http.NewRequest(http.MethodPost, url+path, strings.NewReader(`{"amount":42.5,"amountCents":4250}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "signed"+path)
+		resp, err := signed.Do(req)
+		if err != nil {
+			t.Fatalf("charge: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("signed charge on %s = %d, want 200", path, resp.StatusCode)
+		}
+	}
+
+	conn, err := grpc.NewClient(server.GRPCAddr(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "idempotency-key", "grpc-unsigned")
+	_, err = paymentv1.NewPaymentServiceClient(conn).Charge(ctx, &paymentv1.ChargeRequest{AmountCents: 4250})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("unsigned gRPC charge = %v, want Unauthenticated", err)
+	}
+	signedConn, err := grpc.NewClient(server.GRPCAddr(), grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(hmacauth.UnaryClientInterceptor(hmacauth.NewSigner(parsed[0]))))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer signedConn.Close()
+	ctx = metadata.AppendToOutgoingContext(context.Background(), "idempotency-key", "grpc-signed")
+	if _, err := paymentv1.NewPaymentServiceClient(signedConn).Charge(ctx, &paymentv1.ChargeRequest{AmountCents: 4250}); err != nil {
+		t.Fatalf("signed gRPC charge: %v", err)
+	}
+	if len(charges.charged) != 3 {
+		t.Errorf("charged = %v, want the three signed charges", charges.charged)
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giovaniif/e-commerce/hmacauth"
+	"github.com/giovaniif/e-commerce/payment/infra/backends"
+	"github.com/giovaniif/e-commerce/payment/infra/problem"
+	paymentv1 "github.com/giovaniif/e-commerce/proto/payment/v1"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+)
+
+// newServiceVerifier checks the signatures of Order's calls against the
+// keys of cfg.ServiceAuth, or is nil when service authentication is off.
+// Nonces are claimed in Redis when REDIS_ADDR is set, so a replay is caught
+// by any replica, and in memory otherwise; like the idempotency store, an
+// unreachable Redis falls back to memory unless strict. The Redis client is
+// closed on Shutdown.
+func (s *Server) newServiceVerifier(ctx context.Context) (*hmacauth.Verifier, *backends.Check, error) {
+	cfg := s.cfg
+	if !cfg.ServiceAuth.Enabled {
+		slog.Warn("service authentication off (set SERVICE_AUTH_ENABLED)")
+		return nil, nil, nil
+	}
+	keys, err := hmacauth.ParseKeys(cfg.ServiceAuth.Keys)
+	if err != nil {
+		return nil, nil, fmt.Errorf("SERVICE_AUTH_KEYS: %w", err)
+	}
+	if cfg.RedisAddr == "" {
+		slog.Warn("service authentication nonces kept in memory (set REDIS_ADDR)", "keys", len(keys))
+		return hmacauth.NewVerifier(keys, hmacauth.NewMemoryNonces(), cfg.ServiceAuth.MaxSkew), nil, nil
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: cfg.RedisAddr})
+	check := backends.Check{Name: "service_auth_redis", Probe: func(ctx context.Context) error { return rdb.Ping(ctx).Err() }}
+	if err := check.Probe(ctx); err != nil {
+		if !cfg.Strict() {
+			slog.Warn("failed to ping Redis, keeping service authentication nonces in memory", "error", err)
+			rdb.Close()
+			return hmacauth.NewVerifier(keys, hmacauth.NewMemoryNonces(), cfg.ServiceAuth.MaxSkew), nil, nil
+		}
+		slog.Warn("service authentication Redis unavailable, waiting for it", "error", err)
+	}
+	s.closers = append(s.closers, rdb.Close)
+	slog.Info("service authentication: HMAC, nonces in Redis", "keys", len(keys))
+	return hmacauth.NewVerifier(keys, hmacauth.NewRedisNonces(rdb), cfg.ServiceAuth.MaxSkew), &check, nil
+}
+
+// serviceAuth lets through only charges signed by a service key, or every
+// charge when service authentication is off.
+func (s *Server) serviceAuth() gin.HandlerFunc {
+	if s.verifier == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return hmacauth.Middleware(s.verifier)
+}
+
+// serviceAuthInterceptor is serviceAuth for gRPC, nil when service
+// authentication is off.
+func (s *Server) serviceAuthInterceptor() grpc.UnaryServerInterceptor {
+	if s.verifier == nil {
+		return nil
+	}
+	return hmacauth.UnaryServerInterceptor(s.verifier, paymentv1.PaymentService_Charge_FullMethodName)
+}
+
+// adminAuth lets through only calls bearing the admin token, as
+// "Authorization: Bearer <token>". The /admin routes change how the service
+// behaves, so without a token configured they refuse every call.
+func (s *Server) adminAuth() gin.HandlerFunc {
+	want := []byte("Bearer " + s.cfg.AdminToken)
+	return func(c *gin.Context) {
+		if s.cfg.AdminToken == "" || subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), want) != 1 {
+			c.Header("WWW-Authenticate", "Bearer")
+			problem.Abort(c, problem.New(http.StatusUnauthorized, problem.Unauthenticated, "admin token required"))
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,198 @@
+// Package config loads the Payment service configuration. Every setting has
+// a default, can be set in the YAML file named by CONFIG_FILE, and is
+// overridden by its environment variable, read from the process environment
+// or from a .env file (ENV_FILE, default .env). Load validates the result and
+// reports every problem at once.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/giovaniif/e-commerce/payment/infra/faults"
+)
+
+type Config struct {
+	// Env is the deployment profile (APP_ENV); "production" turns on strict
+	// startup by default.
+	Env string `yaml:"env"`
+	// StartupMode is "strict" or "lenient" (STARTUP_MODE): strict refuses
+	// in-process substitutes for unreachable backends.
+	StartupMode     string        `yaml:"startup_mode"`
+	Port            int           `yaml:"port"`
+	GRPCPort        int           `yaml:"grpc_port"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// AdminEnabled serves GET /admin/config (ADMIN_ENABLED).
+	AdminEnabled bool `yaml:"admin_enabled"`
+	// AdminToken is the bearer token the /admin routes require
+	// (ADMIN_TOKEN); without one they refuse every call.
+	AdminToken string `yaml:"admin_token"`
+	// Faults injects failures for chaos tests; never in production.
+	Faults FaultsConfig `yaml:"faults"`
+	// ServiceAuth requires Order to sign its calls.
+	ServiceAuth ServiceAuthConfig `yaml:"service_auth"`
+
+	RedisAddr   string            `yaml:"redis_addr"`
+	MongoURL    string            `yaml:"mongo_url"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+
+	LokiURL      string `yaml:"loki_url"`
+	OTLPEndpoint string `yaml:"otlp_endpoint"`
+}
+
+// IdempotencyConfig picks the store behind the charge idempotency keys:
+// "postgres", "redis" or "memory". Empty means Redis when RedisAddr is set.
+type IdempotencyConfig struct {
+	Store         string        `yaml:"store"`
+	PostgresURL   string        `yaml:"postgres_url"`
+	PurgeInterval time.Duration `yaml:"purge_interval"`
+}
+
+// ServiceAuthConfig requires the charge endpoints to be signed with HMAC
+// (SERVICE_AUTH_ENABLED) by one of Keys (SERVICE_AUTH_KEYS,
+// "id:secret,..."), at most MaxSkew apart from our clock
+// (SERVICE_AUTH_MAX_SKEW_SECONDS). Listing two keys lets the callers move to
+// a new one.
+type ServiceAuthConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Keys    string        `yaml:"keys"`
+	MaxSkew time.Duration `yaml:"max_skew"`
+}
+
+// FaultsConfig turns fault injection on (FAULTS_ENABLED) and sets the rules
+// it starts with (FAULTS, a JSON list); PUT /admin/faults replaces them at
+// run time.
+type FaultsConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Rules   []faults.Rule `yaml:"rules"`
+}
+
+// minAdminTokenLength is the shortest ADMIN_TOKEN accepted, the same as a
+// service key's secret.
+const minAdminTokenLength = 32
+
+func defaults() Config {
+	return Config{
+		Port:            3132,
+		GRPCPort:        4132,
+		ShutdownTimeout: 10 * time.Second,
+		ServiceAuth:     ServiceAuthConfig{MaxSkew: 5 * time.Minute},
+		Idempotency:     IdempotencyConfig{PurgeInterval: 5 * time.Minute},
+	}
+}
+
+// Load builds the configuration from defaults, the YAML file, .env and the
+// environment, and validates it.
+func Load() (Config, error) {
+	cfg := defaults()
+	if err := readYAML(&cfg); err != nil {
+		return Config{}, err
+	}
+	env, err := newSource()
+	if err != nil {
+		return Config{}, err
+	}
+	env.String("APP_ENV", &cfg.Env)
+	env.String("STARTUP_MODE", &cfg.StartupMode)
+	env.Int("PORT", &cfg.Port)
+	env.Int("GRPC_PORT", &cfg.GRPCPort)
+	env.Count("SHUTDOWN_TIMEOUT_SECONDS", time.Second, &cfg.ShutdownTimeout)
+	env.Bool("ADMIN_ENABLED", &cfg.AdminEnabled)
+	env.String("ADMIN_TOKEN", &cfg.AdminToken)
+	env.Bool("FAULTS_ENABLED", &cfg.Faults.Enabled)
+	if v, ok := env.lookup("FAULTS"); ok && v != "" {
+		rules, err := faults.ParseRules([]byte(v))
+		if err != nil {
+			env.fail("FAULTS", v, err)
+		}
+		cfg.Faults.Rules = rules
+	}
+	env.Bool("SERVICE_AUTH_ENABLED", &cfg.ServiceAuth.Enabled)
+	env.String("SERVICE_AUTH_KEYS", &cfg.ServiceAuth.Keys)
+	env.Count("SERVICE_AUTH_MAX_SKEW_SECONDS", time.Second, &cfg.ServiceAuth.MaxSkew)
+	env.String("REDIS_ADDR", &cfg.RedisAddr)
+	env.String("MONGO_URL", &cfg.MongoURL)
+	env.String("IDEMPOTENCY_STORE", &cfg.Idempotency.Store)
+	env.String("IDEMPOTENCY_POSTGRES_URL", &cfg.Idempotency.PostgresURL)
+	env.Count("IDEMPOTENCY_PURGE_INTERVAL_SECONDS", time.Second, &cfg.Idempotency.PurgeInterval)
+	env.String("LOKI_URL", &cfg.LokiURL)
+	env.String("OTEL_EXPORTER_OTLP_ENDPOINT", &cfg.OTLPEndpoint)
+	if err := env.err(); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.StartupMode == "" {
+		cfg.StartupMode = "lenient"
+		if cfg.Env == "production" {
+			cfg.StartupMode = "strict"
+		}
+	}
+	if cfg.Idempotency.Store == "" {
+		cfg.Idempotency.Store = "memory"
+		if cfg.RedisAddr != "" {
+			cfg.Idempotency.Store = "redis"
+		}
+	}
+	return cfg, cfg.validate()
+}
+
+func (cfg Config) validate() error {
+	var c checks
+	c.oneOf("STARTUP_MODE", cfg.StartupMode, "strict", "lenient")
+	c.port("PORT", cfg.Port)
+	c.port("GRPC_PORT", cfg.GRPCPort)
+	c.add(cfg.GRPCPort != cfg.Port, "GRPC_PORT must differ from PORT")
+	c.duration("SHUTDOWN_TIMEOUT_SECONDS", cfg.ShutdownTimeout)
+	c.url("MONGO_URL", cfg.MongoURL, cfg.Strict())
+	c.oneOf("IDEMPOTENCY_STORE", cfg.Idempotency.Store, "postgres", "redis", "memory")
+	switch cfg.Idempotency.Store {
+	case "postgres":
+		c.url("IDEMPOTENCY_POSTGRES_URL", cfg.Idempotency.PostgresURL, true)
+		c.duration("IDEMPOTENCY_PURGE_INTERVAL_SECONDS", cfg.Idempotency.PurgeInterval)
+	case "redis":
+		c.add(cfg.RedisAddr != "", "REDIS_ADDR is required for the redis idempotency store")
+	case "memory":
+		c.add(!cfg.Strict(), "the memory idempotency store is not allowed in strict mode: set IDEMPOTENCY_STORE or REDIS_ADDR")
+	}
+	if cfg.ServiceAuth.Enabled {
+		c.serviceKeys("SERVICE_AUTH_KEYS", cfg.ServiceAuth.Keys)
+		c.duration("SERVICE_AUTH_MAX_SKEW_SECONDS", cfg.ServiceAuth.MaxSkew)
+		c.add(!cfg.Strict() || cfg.RedisAddr != "", "REDIS_ADDR is required for SERVICE_AUTH_ENABLED in strict mode")
+	} else {
+		c.add(cfg.Env != "production", "SERVICE_AUTH_ENABLED is required with APP_ENV=production")
+	}
+	c.url("LOKI_URL", cfg.LokiURL, false)
+	c.add(!cfg.AdminEnabled || cfg.AdminToken != "", "ADMIN_ENABLED needs ADMIN_TOKEN")
+	c.add(cfg.AdminToken == "" || len(cfg.AdminToken) >= minAdminTokenLength, "ADMIN_TOKEN must be at least %d characters", minAdminTokenLength)
+	if cfg.Faults.Enabled {
+		c.add(cfg.Env != "production", "FAULTS_ENABLED is not allowed with APP_ENV=production")
+		for _, r := range cfg.Faults.Rules {
+			if err := r.Validate(); err != nil {
+				c = append(c, fmt.Errorf("FAULTS: %w", err))
+			}
+		}
+	} else {
+		c.add(len(cfg.Faults.Rules) == 0, "FAULTS needs FAULTS_ENABLED=true")
+	}
+	return errors.Join(c...)
+}
+
+// Strict reports whether the service must fail closed instead of falling
+// back to in-process substitutes for unreachable backends.
+func (cfg Config) Strict() bool {
+	return cfg.StartupMode == "strict"
+}
+
+// Effective returns the configuration for display, with credentials in
+// connection URLs and service keys redacted.
+func (cfg Config) Effective() (map[string]any, error) {
+	cfg.ServiceAuth.Keys = redactKeys(cfg.ServiceAuth.Keys)
+	if cfg.AdminToken != "" {
+		cfg.AdminToken = "xxxxx"
+	}
+	cfg.MongoURL = redactURL(cfg.MongoURL)
+	cfg.Idempotency.PostgresURL = redactURL(cfg.Idempotency.PostgresURL)
+	cfg.LokiURL = redactURL(cfg.LokiURL)
+	return effective(cfg)
+}
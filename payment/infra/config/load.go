@@ -0,0 +1,292 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/giovaniif/e-commerce/hmacauth"
+	"gopkg.in/yaml.v3"
+)
+
+// source resolves settings by environment variable name: the process
+// environment wins over the .env file. Parse errors are collected so Load
+// reports every bad value at once.
+type source struct {
+	dotenv map[string]string
+	errs   []error
+}
+
+func (s *source) lookup(name string) (string, bool) {
+	if v, ok := os.LookupEnv(name); ok {
+		return v, true
+	}
+	v, ok := s.dotenv[name]
+	return v, ok
+}
+
+func (s *source) fail(name, value string, err error) {
+	s.errs = append(s.errs, fmt.Errorf("%s=%q: %w", name, value, err))
+}
+
+func (s *source) String(name string, dst *string) {
+	if v, ok := s.lookup(name); ok {
+		*dst = v
+	}
+}
+
+func (s *source) Int(name string, dst *int) {
+	if v, ok := s.lookup(name); ok && v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			s.fail(name, v, errors.New("not an integer"))
+			return
+		}
+		*dst = n
+	}
+}
+
+func (s *source) Int64(name string, dst *int64) {
+	if v, ok := s.lookup(name); ok && v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			s.fail(name, v, errors.New("not an integer"))
+			return
+		}
+		*dst = n
+	}
+}
+
+func (s *source) Bool(name string, dst *bool) {
+	if v, ok := s.lookup(name); ok && v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			s.fail(name, v, errors.New("not a boolean"))
+			return
+		}
+		*dst = b
+	}
+}
+
+// Duration reads a Go duration such as "250ms" or "24h".
+func (s *source) Duration(name string, dst *time.Duration) {
+	if v, ok := s.lookup(name); ok && v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			s.fail(name, v, errors.New("not a duration"))
+			return
+		}
+		*dst = d
+	}
+}
+
+// Count reads an integer number of unit, for the variables named *_SECONDS
+// or *_MS.
+func (s *source) Count(name string, unit time.Duration, dst *time.Duration) {
+	if v, ok := s.lookup(name); ok && v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			s.fail(name, v, errors.New("not an integer"))
+			return
+		}
+		*dst = time.Duration(n) * unit
+	}
+}
+
+func (s *source) err() error {
+	return errors.Join(s.errs...)
+}
+
+// newSource reads the .env file at ENV_FILE (default .env); a missing file
+// is fine, a malformed one is not.
+func newSource() (*source, error) {
+	path, explicit := os.LookupEnv("ENV_FILE")
+	if !explicit {
+		path = ".env"
+	} else if path == "" {
+		// An empty ENV_FILE turns the .env file off.
+		return &source{}, nil
+	}
+	dotenv, err := readDotenv(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &source{dotenv: dotenv}, nil
+}
+
+// readDotenv parses KEY=VALUE lines, skipping blank lines and # comments.
+// An "export " prefix and surrounding quotes are dropped.
+func readDotenv(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, n)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	return values, scanner.Err()
+}
+
+// readYAML decodes the file at CONFIG_FILE into dst, when set. Unknown keys
+// are rejected so a typo does not silently keep a default.
+func readYAML(dst any) error {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(dst); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// checks collects validation errors.
+type checks []error
+
+func (c *checks) add(ok bool, format string, args ...any) {
+	if !ok {
+		*c = append(*c, fmt.Errorf(format, args...))
+	}
+}
+
+func (c *checks) url(name, value string, required bool) {
+	if value == "" {
+		c.add(!required, "%s is required", name)
+		return
+	}
+	u, err := url.Parse(value)
+	c.add(err == nil && u.Scheme != "" && u.Host != "", "%s %q is not an absolute URL", name, value)
+}
+
+func (c *checks) port(name string, value int) {
+	c.add(value > 0 && value <= 65535, "%s %d is not a valid port", name, value)
+}
+
+func (c *checks) positive(name string, value int) {
+	c.add(value > 0, "%s must be positive, got %d", name, value)
+}
+
+func (c *checks) duration(name string, value time.Duration) {
+	c.add(value > 0, "%s must be positive, got %s", name, value)
+}
+
+func (c *checks) oneOf(name, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	c.add(false, "%s %q must be one of %s", name, value, strings.Join(allowed, ", "))
+}
+
+func (c *checks) serviceKeys(name, value string) {
+	if _, err := hmacauth.ParseKeys(value); err != nil {
+		c.add(false, "%s: %v", name, err)
+	}
+}
+
+// redactURL hides the password of a connection URL, or the whole value when
+// it is not a URL.
+func redactURL(value string) string {
+	if value == "" {
+		return ""
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" {
+		return "[redacted]"
+	}
+	if _, hasPassword := u.User.Password(); hasPassword {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	q := u.Query()
+	for key := range q {
+		if strings.Contains(strings.ToLower(key), "password") || strings.Contains(strings.ToLower(key), "secret") {
+			q.Set(key, "xxxxx")
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// redactKeys hides the secrets of an "id:secret,..." key list, keeping the
+// ids.
+func redactKeys(value string) string {
+	if value == "" {
+		return ""
+	}
+	var ids []string
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair != "" {
+			id, _, _ := strings.Cut(pair, ":")
+			ids = append(ids, id+":xxxxx")
+		}
+	}
+	return strings.Join(ids, ",")
+}
+
+// effective renders cfg as a generic map, durations as strings, for the
+// admin endpoint.
+func effective(cfg any) (map[string]any, error) {
+	raw, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]any
+	if err := yaml.Unmarshal(raw, &out); err != nil {
+		return nil, err
+	}
+	return stringKeys(out).(map[string]any), nil
+}
+
+// stringKeys turns the map[any]any YAML decodes non-string keys into, such
+// as item ids, into map[string]any so the result encodes as JSON.
+func stringKeys(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = stringKeys(e)
+		}
+		return v
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = stringKeys(e)
+		}
+		return m
+	case []any:
+		for i, e := range v {
+			v[i] = stringKeys(e)
+		}
+	}
+	return v
+}
@@ -0,0 +1,213 @@
+// Package faults fails requests on purpose so chaos tests can check how the
+// callers cope: added latency, 5xx answers and dropped connections, each on a
+// share of the calls to a route or gRPC method. It is off unless
+// FAULTS_ENABLED is set.
+package faults
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giovaniif/e-commerce/payment/infra/metrics"
+	"github.com/giovaniif/e-commerce/payment/infra/problem"
+)
+
+// Rule is a fault on one route, written as its method and path pattern
+// ("POST /v2/charge"). A matching call waits LatencyMs, then is answered with
+// Status or has its connection dropped; a rule with latency alone lets the
+// call through afterwards. Percent is the share of calls the rule fires on,
+// all of them when zero. A gRPC method is targeted as GRPC and its full name
+// ("GRPC /payment.v1.PaymentService/Charge").
+type Rule struct {
+	Target    string  `json:"target" yaml:"target"`
+	LatencyMs int     `json:"latencyMs,omitempty" yaml:"latency_ms"`
+	Status    int     `json:"status,omitempty" yaml:"status"`
+	Drop      bool    `json:"drop,omitempty" yaml:"drop"`
+	Percent   float64 `json:"percent,omitempty" yaml:"percent"`
+}
+
+func (r Rule) Validate() error {
+	method, path, ok := strings.Cut(r.Target, " ")
+	switch {
+	case !ok || method == "" || method != strings.ToUpper(method) || !strings.HasPrefix(path, "/"):
+		return fmt.Errorf("target %q is not a route such as \"POST /v2/charge\"", r.Target)
+	case strings.HasPrefix(path, "/admin/"):
+		return fmt.Errorf("target %q: the admin routes cannot be faulted", r.Target)
+	case r.LatencyMs < 0:
+		return fmt.Errorf("%s: latencyMs must not be negative", r.Target)
+	case r.Status != 0 && (r.Status < 500 || r.Status > 599):
+		return fmt.Errorf("%s: status %d is not a 5xx", r.Target, r.Status)
+	case r.Drop && r.Status != 0:
+		return fmt.Errorf("%s: drop and status are exclusive", r.Target)
+	case r.Percent < 0 || r.Percent > 100:
+		return fmt.Errorf("%s: percent must be between 0 and 100", r.Target)
+	case r.LatencyMs == 0 && r.Status == 0 && !r.Drop:
+		return fmt.Errorf("%s: no fault: set latencyMs, status or drop", r.Target)
+	}
+	return nil
+}
+
+// kind labels what the rule does to a call in the metrics.
+func (r Rule) kind() string {
+	switch {
+	case r.Drop:
+		return "drop"
+	case r.Status != 0:
+		return "status"
+	}
+	return "latency"
+}
+
+// ParseRules reads a JSON list of rules, as FAULTS and PUT /admin/faults
+// take them.
+func ParseRules(raw []byte) ([]Rule, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	var rules []Rule
+	if err := dec.Decode(&rules); err != nil {
+		return nil, err
+	}
+	if err := validate(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func validate(rules []Rule) error {
+	seen := make(map[string]bool, len(rules))
+	var errs []error
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			errs = append(errs, err)
+		} else if seen[r.Target] {
+			errs = append(errs, fmt.Errorf("%s: more than one rule", r.Target))
+		}
+		seen[r.Target] = true
+	}
+	return errors.Join(errs...)
+}
+
+// Injector holds the active rules, at most one per route, and applies them.
+type Injector struct {
+	mu    sync.RWMutex
+	rules map[string]Rule
+}
+
+// NewInjector starts with rules, which are expected to be valid.
+func NewInjector(rules []Rule) *Injector {
+	i := &Injector{}
+	i.replace(rules)
+	return i
+}
+
+// Rules returns the active rules ordered by target.
+func (i *Injector) Rules() []Rule {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	rules := make([]Rule, 0, len(i.rules))
+	for _, r := range i.rules {
+		rules = append(rules, r)
+	}
+	slices.SortFunc(rules, func(a, b Rule) int { return strings.Compare(a.Target, b.Target) })
+	return rules
+}
+
+func (i *Injector) replace(rules []Rule) {
+	byTarget := make(map[string]Rule, len(rules))
+	for _, r := range rules {
+		byTarget[r.Target] = r
+	}
+	i.mu.Lock()
+	i.rules = byTarget
+	i.mu.Unlock()
+}
+
+// fire returns the rule for target when it fires on this call.
+func (i *Injector) fire(target string) (Rule, bool) {
+	i.mu.RLock()
+	r, ok := i.rules[target]
+	i.mu.RUnlock()
+	if !ok || (r.Percent > 0 && rand.Float64()*100 >= r.Percent) {
+		return Rule{}, false
+	}
+	return r, true
+}
+
+// Middleware applies the rule for the matched route, if any.
+func (i *Injector) Middleware(c *gin.Context) {
+	r, ok := i.fire(c.Request.Method + " " + c.FullPath())
+	if !ok {
+		c.Next()
+		return
+	}
+	metrics.FaultsInjected.WithLabelValues(r.Target, r.kind()).Inc()
+	if r.LatencyMs > 0 {
+		select {
+		case <-time.After(time.Duration(r.LatencyMs) * time.Millisecond):
+		case <-c.Request.Context().Done():
+			c.Abort()
+			return
+		}
+	}
+	switch {
+	case r.Drop:
+		// Closing the connection unanswered is what a crashed replica
+		// looks like to the caller.
+		conn, _, err := c.Writer.Hijack()
+		if err != nil {
+			c.AbortWithStatus(http.StatusBadGateway)
+			return
+		}
+		conn.Close()
+		c.Abort()
+	case r.Status != 0:
+		c.Header("X-Fault-Injected", "true")
+		code := problem.Internal
+		switch r.Status {
+		case http.StatusServiceUnavailable:
+			code = problem.Unavailable
+		case http.StatusGatewayTimeout:
+			code = problem.Timeout
+		}
+		problem.Abort(c, problem.New(r.Status, code, "injected fault"))
+	default:
+		c.Next()
+	}
+}
+
+// List answers GET /admin/faults with the active rules.
+func (i *Injector) List(c *gin.Context) {
+	c.JSON(http.StatusOK, i.Rules())
+}
+
+// Replace answers PUT /admin/faults: the JSON list in the body becomes the
+// whole set of rules.
+func (i *Injector) Replace(c *gin.Context) {
+	raw, err := c.GetRawData()
+	if err != nil {
+		problem.Abort(c, problem.New(http.StatusBadRequest, problem.InvalidRequest, err.Error()))
+		return
+	}
+	rules, err := ParseRules(raw)
+	if err != nil {
+		problem.Abort(c, problem.New(http.StatusBadRequest, problem.InvalidRequest, err.Error()))
+		return
+	}
+	i.replace(rules)
+	c.JSON(http.StatusOK, i.Rules())
+}
+
+// Clear answers DELETE /admin/faults by removing every rule.
+func (i *Injector) Clear(c *gin.Context) {
+	i.replace(nil)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,48 @@
+package faults
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/giovaniif/e-commerce/payment/infra/metrics"
+	"github.com/giovaniif/e-commerce/payment/infra/problem"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor is Middleware for gRPC. A status is answered with
+// the gRPC code of its problem; a drop, which a gRPC handler cannot do to
+// its connection, with the Unavailable a dropped connection gives the
+// caller.
+func (i *Injector) UnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	r, ok := i.fire("GRPC " + info.FullMethod)
+	if !ok {
+		return handler(ctx, req)
+	}
+	metrics.FaultsInjected.WithLabelValues(r.Target, r.kind()).Inc()
+	if r.LatencyMs > 0 {
+		select {
+		case <-time.After(time.Duration(r.LatencyMs) * time.Millisecond):
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	switch {
+	case r.Drop:
+		return nil, status.Error(codes.Unavailable, "injected connection drop")
+	case r.Status != 0:
+		_ = grpc.SetHeader(ctx, metadata.Pairs("x-fault-injected", "true"))
+		code := problem.Internal
+		switch r.Status {
+		case http.StatusServiceUnavailable:
+			code = problem.Unavailable
+		case http.StatusGatewayTimeout:
+			code = problem.Timeout
+		}
+		return nil, problem.New(r.Status, code, "injected fault").GRPCStatus().Err()
+	}
+	return handler(ctx, req)
+}
@@ -1,6 +1,12 @@
 package gateways
 
+import (
+	"context"
+	"sync"
+)
+
 type ChargeGatewayMemory struct {
+	mu      sync.Mutex
 	charged []float64
 }
 
@@ -8,7 +14,16 @@ func NewChargeGatewayMemory() *ChargeGatewayMemory {
 	return &ChargeGatewayMemory{}
 }
 
-func (c *ChargeGatewayMemory) Charge(amount float64) error {
+func (c *ChargeGatewayMemory) Charge(ctx context.Context, amount float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.charged = append(c.charged, amount)
 	return nil
 }
+
+// Charged returns the amounts charged so far, oldest first.
+func (c *ChargeGatewayMemory) Charged() []float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]float64(nil), c.charged...)
+}
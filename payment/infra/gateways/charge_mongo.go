@@ -2,6 +2,7 @@ package gateways
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"go.mongodb.org/mongo-driver/v2/mongo"
@@ -21,12 +22,12 @@ func NewChargeGatewayMongo(client *mongo.Client) *ChargeGatewayMongo {
 	return &ChargeGatewayMongo{collection: col}
 }
 
-func (g *ChargeGatewayMongo) Charge(amount float64) error {
-	go func() {
-		g.collection.InsertOne(context.Background(), chargeRecord{
-			Amount:    amount,
-			CreatedAt: time.Now(),
-		})
-	}()
+func (g *ChargeGatewayMongo) Charge(ctx context.Context, amount float64) error {
+	if _, err := g.collection.InsertOne(ctx, chargeRecord{
+		Amount:    amount,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		return fmt.Errorf("insert charge: %w", err)
+	}
 	return nil
 }
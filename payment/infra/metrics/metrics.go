@@ -1,35 +1,83 @@
 package metrics
 
 import (
+	"errors"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 var (
-	RequestTotal = promauto.NewCounterVec(
+	RequestTotal = register(prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "http_requests_total",
 			Help: "Total number of HTTP requests",
 		},
 		[]string{"method", "path", "status"},
-	)
-	RequestDuration = promauto.NewHistogramVec(
+	))
+	RequestDuration = register(prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "http_request_duration_seconds",
 			Help:    "HTTP request duration in seconds",
 			Buckets: prometheus.DefBuckets,
 		},
 		[]string{"method", "path"},
-	)
+	))
+	GRPCRequestTotal = register(prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "Total number of gRPC calls handled, by method and status code",
+		},
+		[]string{"method", "code"},
+	))
+	GRPCRequestDuration = register(prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "gRPC call duration in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"method"},
+	))
+	FaultsInjected = register(prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "faults_injected_total",
+			Help: "Total number of faults injected on purpose, by target and kind",
+		},
+		[]string{"target", "kind"},
+	))
+	DeprecatedRequests = register(prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_deprecated_requests_total",
+			Help: "Total number of requests to deprecated API versions, by version and path",
+		},
+		[]string{"version", "path"},
+	))
 )
 
+// register adds c to the default registry, or returns the collector already
+// registered under its name: every service defines the HTTP metrics, and
+// the integration tests run all of them in one process.
+func register[T prometheus.Collector](c T) T {
+	if err := prometheus.Register(c); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+		if errors.As(err, &registered) {
+			return registered.ExistingCollector.(T)
+		}
+		panic(err)
+	}
+	return c
+}
+
+// NormalizePath labels a request by the first segment of its path after the
+// API version, so every version of a route shares its series.
 func NormalizePath(p string) string {
 	p = strings.TrimPrefix(p, "/")
+	if version, rest, ok := strings.Cut(p, "/"); ok && IsVersion(version) {
+		p = rest
+	}
 	if idx := strings.Index(p, "/"); idx >= 0 {
 		p = p[:idx]
 	}
@@ -39,6 +87,15 @@ func NormalizePath(p string) string {
 	return p
 }
 
+// IsVersion reports whether segment names an API version, such as v1.
+func IsVersion(segment string) bool {
+	if len(segment) < 2 || segment[0] != 'v' {
+		return false
+	}
+	_, err := strconv.Atoi(segment[1:])
+	return err == nil
+}
+
 func Middleware(c *gin.Context) {
 	if c.Request.URL.Path == "/metrics" {
 		c.Next()
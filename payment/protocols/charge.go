@@ -1,5 +1,14 @@
 package protocols
 
+import (
+	"context"
+	"errors"
+)
+
+// ErrDeclined is returned, wrapped, when the charge was refused rather than
+// failed: retrying it gets the same answer.
+var ErrDeclined = errors.New("payment declined")
+
 type ChargeGateway interface {
-	Charge(amount float64) error
-}
\ No newline at end of file
+	Charge(ctx context.Context, amount float64) error
+}
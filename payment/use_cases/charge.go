@@ -1,52 +1,27 @@
 package charge
 
 import (
-	"fmt"
+	"context"
 
 	protocols "github.com/giovaniif/e-commerce/payment/protocols"
 )
 
-func NewCharge(chargeGateway protocols.ChargeGateway, idempotencyGateway protocols.IdempotencyGateway) *Charge {
+func NewCharge(chargeGateway protocols.ChargeGateway) *Charge {
 	return &Charge{
-		chargeGateway:      chargeGateway,
-		idempotencyGateway: idempotencyGateway,
+		chargeGateway: chargeGateway,
 	}
 }
 
-func (c *Charge) Charge(input ChargeInput) error {
-	result, err := c.idempotencyGateway.ReserveIdempotencyKey(input.IdempotencyKey)
-	if err != nil {
-		fmt.Println("failed to check idempotency key")
-		return err
-	}
-	if result != nil {
-		return nil
-	}
-
-	success := false
-	defer func() {
-		if success {
-			c.idempotencyGateway.MarkSuccess(input.IdempotencyKey)
-		} else {
-			c.idempotencyGateway.MarkFailure(input.IdempotencyKey)
-		}
-	}()
-
-	err = c.chargeGateway.Charge(input.Amount)
-	if err != nil {
-		return err
-	}
-
-	success = true
-	return nil
+// Charge charges the amount once per call. Retries with the same
+// idempotency key are answered by the HTTP layer with the first response.
+func (c *Charge) Charge(ctx context.Context, input ChargeInput) error {
+	return c.chargeGateway.Charge(ctx, input.Amount)
 }
 
 type Charge struct {
-	chargeGateway      protocols.ChargeGateway
-	idempotencyGateway protocols.IdempotencyGateway
+	chargeGateway protocols.ChargeGateway
 }
 
 type ChargeInput struct {
-	Amount         float64
-	IdempotencyKey string
+	Amount float64
 }
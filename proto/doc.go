@@ -0,0 +1,8 @@
+// Package proto holds the protobuf definitions of the gRPC APIs Stock and
+// Payment serve to Order, and the code generated from them. Each API lives
+// under <service>/v<N>, so a breaking change gets a new package beside the
+// old one, as the HTTP routes do.
+package proto
+
+// Needs protoc with protoc-gen-go v1.36.11 and protoc-gen-go-grpc v1.5.1.
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative stock/v1/stock.proto payment/v1/payment.proto
@@ -0,0 +1,177 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v5.29.3
+// source: payment/v1/payment.proto
+
+// Charges Order takes during a checkout. The same use case serves the HTTP
+// routes of the Payment API.
+
+package paymentv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ChargeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AmountCents   int64                  `protobuf:"varint,1,opt,name=amount_cents,json=amountCents,proto3" json:"amount_cents,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChargeRequest) Reset() {
+	*x = ChargeRequest{}
+	mi := &file_payment_v1_payment_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChargeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChargeRequest) ProtoMessage() {}
+
+func (x *ChargeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_payment_v1_payment_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChargeRequest.ProtoReflect.Descriptor instead.
+func (*ChargeRequest) Descriptor() ([]byte, []int) {
+	return file_payment_v1_payment_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ChargeRequest) GetAmountCents() int64 {
+	if x != nil {
+		return x.AmountCents
+	}
+	return 0
+}
+
+type ChargeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AmountCents   int64                  `protobuf:"varint,1,opt,name=amount_cents,json=amountCents,proto3" json:"amount_cents,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChargeResponse) Reset() {
+	*x = ChargeResponse{}
+	mi := &file_payment_v1_payment_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChargeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChargeResponse) ProtoMessage() {}
+
+func (x *ChargeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_payment_v1_payment_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChargeResponse.ProtoReflect.Descriptor instead.
+func (*ChargeResponse) Descriptor() ([]byte, []int) {
+	return file_payment_v1_payment_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ChargeResponse) GetAmountCents() int64 {
+	if x != nil {
+		return x.AmountCents
+	}
+	return 0
+}
+
+var File_payment_v1_payment_proto protoreflect.FileDescriptor
+
+const file_payment_v1_payment_proto_rawDesc = "" +
+	"\n" +
+	"\x18payment/v1/payment.proto\x12\n" +
+	"payment.v1\"2\n" +
+	"\rChargeRequest\x12!\n" +
+	"\famount_cents\x18\x01 \x01(\x03R\vamountCents\"3\n" +
+	"\x0eChargeResponse\x12!\n" +
+	"\famount_cents\x18\x01 \x01(\x03R\vamountCents2Q\n" +
+	"\x0ePaymentService\x12?\n" +
+	"\x06Charge\x12\x19.payment.v1.ChargeRequest\x1a\x1a.payment.v1.ChargeResponseB<Z:github.com/giovaniif/e-commerce/proto/payment/v1;paymentv1b\x06proto3"
+
+var (
+	file_payment_v1_payment_proto_rawDescOnce sync.Once
+	file_payment_v1_payment_proto_rawDescData []byte
+)
+
+func file_payment_v1_payment_proto_rawDescGZIP() []byte {
+	file_payment_v1_payment_proto_rawDescOnce.Do(func() {
+		file_payment_v1_payment_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_payment_v1_payment_proto_rawDesc), len(file_payment_v1_payment_proto_rawDesc)))
+	})
+	return file_payment_v1_payment_proto_rawDescData
+}
+
+var file_payment_v1_payment_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_payment_v1_payment_proto_goTypes = []any{
+	(*ChargeRequest)(nil),  // 0: payment.v1.ChargeRequest
+	(*ChargeResponse)(nil), // 1: payment.v1.ChargeResponse
+}
+var file_payment_v1_payment_proto_depIdxs = []int32{
+	0, // 0: payment.v1.PaymentService.Charge:input_type -> payment.v1.ChargeRequest
+	1, // 1: payment.v1.PaymentService.Charge:output_type -> payment.v1.ChargeResponse
+	1, // [1:2] is the sub-list for method output_type
+	0, // [0:1] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_payment_v1_payment_proto_init() }
+func file_payment_v1_payment_proto_init() {
+	if File_payment_v1_payment_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_payment_v1_payment_proto_rawDesc), len(file_payment_v1_payment_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_payment_v1_payment_proto_goTypes,
+		DependencyIndexes: file_payment_v1_payment_proto_depIdxs,
+		MessageInfos:      file_payment_v1_payment_proto_msgTypes,
+	}.Build()
+	File_payment_v1_payment_proto = out.File
+	file_payment_v1_payment_proto_goTypes = nil
+	file_payment_v1_payment_proto_depIdxs = nil
+}
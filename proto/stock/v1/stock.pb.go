@@ -0,0 +1,545 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v5.29.3
+// source: stock/v1/stock.proto
+
+// Reservations Order takes against the stock of an item during a checkout.
+// The same use cases serve the /v1 HTTP routes of the Stock API.
+
+package stockv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ReservationStatus int32
+
+const (
+	ReservationStatus_RESERVATION_STATUS_UNSPECIFIED ReservationStatus = 0
+	ReservationStatus_RESERVATION_STATUS_RESERVED    ReservationStatus = 1
+	// Waiting for a restock of the warehouse.
+	ReservationStatus_RESERVATION_STATUS_BACKORDERED ReservationStatus = 2
+)
+
+// Enum value maps for ReservationStatus.
+var (
+	ReservationStatus_name = map[int32]string{
+		0: "RESERVATION_STATUS_UNSPECIFIED",
+		1: "RESERVATION_STATUS_RESERVED",
+		2: "RESERVATION_STATUS_BACKORDERED",
+	}
+	ReservationStatus_value = map[string]int32{
+		"RESERVATION_STATUS_UNSPECIFIED": 0,
+		"RESERVATION_STATUS_RESERVED":    1,
+		"RESERVATION_STATUS_BACKORDERED": 2,
+	}
+)
+
+func (x ReservationStatus) Enum() *ReservationStatus {
+	p := new(ReservationStatus)
+	*p = x
+	return p
+}
+
+func (x ReservationStatus) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ReservationStatus) Descriptor() protoreflect.EnumDescriptor {
+	return file_stock_v1_stock_proto_enumTypes[0].Descriptor()
+}
+
+func (ReservationStatus) Type() protoreflect.EnumType {
+	return &file_stock_v1_stock_proto_enumTypes[0]
+}
+
+func (x ReservationStatus) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ReservationStatus.Descriptor instead.
+func (ReservationStatus) EnumDescriptor() ([]byte, []int) {
+	return file_stock_v1_stock_proto_rawDescGZIP(), []int{0}
+}
+
+type ReserveRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	ItemId   int32                  `protobuf:"varint,1,opt,name=item_id,json=itemId,proto3" json:"item_id,omitempty"`
+	Quantity int32                  `protobuf:"varint,2,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	// The customer whose purchase limits apply; empty for none.
+	CustomerId string `protobuf:"bytes,3,opt,name=customer_id,json=customerId,proto3" json:"customer_id,omitempty"`
+	// The warehouse to take the stock from when it can; 0 for any.
+	PreferredWarehouseId int32 `protobuf:"varint,4,opt,name=preferred_warehouse_id,json=preferredWarehouseId,proto3" json:"preferred_warehouse_id,omitempty"`
+	// The tenant the customer belongs to; purchase limits are kept per tenant.
+	TenantId      string `protobuf:"bytes,5,opt,name=tenant_id,json=tenantId,proto3" json:"tenant_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReserveRequest) Reset() {
+	*x = ReserveRequest{}
+	mi := &file_stock_v1_stock_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReserveRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReserveRequest) ProtoMessage() {}
+
+func (x *ReserveRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_stock_v1_stock_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReserveRequest.ProtoReflect.Descriptor instead.
+func (*ReserveRequest) Descriptor() ([]byte, []int) {
+	return file_stock_v1_stock_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ReserveRequest) GetItemId() int32 {
+	if x != nil {
+		return x.ItemId
+	}
+	return 0
+}
+
+func (x *ReserveRequest) GetQuantity() int32 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+func (x *ReserveRequest) GetCustomerId() string {
+	if x != nil {
+		return x.CustomerId
+	}
+	return ""
+}
+
+func (x *ReserveRequest) GetPreferredWarehouseId() int32 {
+	if x != nil {
+		return x.PreferredWarehouseId
+	}
+	return 0
+}
+
+func (x *ReserveRequest) GetTenantId() string {
+	if x != nil {
+		return x.TenantId
+	}
+	return ""
+}
+
+// Allocation is the share of a reservation taken from one warehouse.
+type Allocation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	WarehouseId   int32                  `protobuf:"varint,1,opt,name=warehouse_id,json=warehouseId,proto3" json:"warehouse_id,omitempty"`
+	Quantity      int32                  `protobuf:"varint,2,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Allocation) Reset() {
+	*x = Allocation{}
+	mi := &file_stock_v1_stock_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Allocation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Allocation) ProtoMessage() {}
+
+func (x *Allocation) ProtoReflect() protoreflect.Message {
+	mi := &file_stock_v1_stock_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Allocation.ProtoReflect.Descriptor instead.
+func (*Allocation) Descriptor() ([]byte, []int) {
+	return file_stock_v1_stock_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Allocation) GetWarehouseId() int32 {
+	if x != nil {
+		return x.WarehouseId
+	}
+	return 0
+}
+
+func (x *Allocation) GetQuantity() int32 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+type ReserveResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ReservationId int32                  `protobuf:"varint,1,opt,name=reservation_id,json=reservationId,proto3" json:"reservation_id,omitempty"`
+	TotalFee      float64                `protobuf:"fixed64,2,opt,name=total_fee,json=totalFee,proto3" json:"total_fee,omitempty"`
+	Status        ReservationStatus      `protobuf:"varint,3,opt,name=status,proto3,enum=stock.v1.ReservationStatus" json:"status,omitempty"`
+	WarehouseId   int32                  `protobuf:"varint,4,opt,name=warehouse_id,json=warehouseId,proto3" json:"warehouse_id,omitempty"`
+	Allocations   []*Allocation          `protobuf:"bytes,5,rep,name=allocations,proto3" json:"allocations,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReserveResponse) Reset() {
+	*x = ReserveResponse{}
+	mi := &file_stock_v1_stock_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReserveResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReserveResponse) ProtoMessage() {}
+
+func (x *ReserveResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_stock_v1_stock_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReserveResponse.ProtoReflect.Descriptor instead.
+func (*ReserveResponse) Descriptor() ([]byte, []int) {
+	return file_stock_v1_stock_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ReserveResponse) GetReservationId() int32 {
+	if x != nil {
+		return x.ReservationId
+	}
+	return 0
+}
+
+func (x *ReserveResponse) GetTotalFee() float64 {
+	if x != nil {
+		return x.TotalFee
+	}
+	return 0
+}
+
+func (x *ReserveResponse) GetStatus() ReservationStatus {
+	if x != nil {
+		return x.Status
+	}
+	return ReservationStatus_RESERVATION_STATUS_UNSPECIFIED
+}
+
+func (x *ReserveResponse) GetWarehouseId() int32 {
+	if x != nil {
+		return x.WarehouseId
+	}
+	return 0
+}
+
+func (x *ReserveResponse) GetAllocations() []*Allocation {
+	if x != nil {
+		return x.Allocations
+	}
+	return nil
+}
+
+type ReleaseRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ReservationId int32                  `protobuf:"varint,1,opt,name=reservation_id,json=reservationId,proto3" json:"reservation_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReleaseRequest) Reset() {
+	*x = ReleaseRequest{}
+	mi := &file_stock_v1_stock_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReleaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReleaseRequest) ProtoMessage() {}
+
+func (x *ReleaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_stock_v1_stock_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReleaseRequest.ProtoReflect.Descriptor instead.
+func (*ReleaseRequest) Descriptor() ([]byte, []int) {
+	return file_stock_v1_stock_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ReleaseRequest) GetReservationId() int32 {
+	if x != nil {
+		return x.ReservationId
+	}
+	return 0
+}
+
+type ReleaseResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReleaseResponse) Reset() {
+	*x = ReleaseResponse{}
+	mi := &file_stock_v1_stock_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReleaseResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReleaseResponse) ProtoMessage() {}
+
+func (x *ReleaseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_stock_v1_stock_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReleaseResponse.ProtoReflect.Descriptor instead.
+func (*ReleaseResponse) Descriptor() ([]byte, []int) {
+	return file_stock_v1_stock_proto_rawDescGZIP(), []int{4}
+}
+
+type CompleteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ReservationId int32                  `protobuf:"varint,1,opt,name=reservation_id,json=reservationId,proto3" json:"reservation_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CompleteRequest) Reset() {
+	*x = CompleteRequest{}
+	mi := &file_stock_v1_stock_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CompleteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CompleteRequest) ProtoMessage() {}
+
+func (x *CompleteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_stock_v1_stock_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CompleteRequest.ProtoReflect.Descriptor instead.
+func (*CompleteRequest) Descriptor() ([]byte, []int) {
+	return file_stock_v1_stock_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CompleteRequest) GetReservationId() int32 {
+	if x != nil {
+		return x.ReservationId
+	}
+	return 0
+}
+
+type CompleteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CompleteResponse) Reset() {
+	*x = CompleteResponse{}
+	mi := &file_stock_v1_stock_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CompleteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CompleteResponse) ProtoMessage() {}
+
+func (x *CompleteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_stock_v1_stock_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CompleteResponse.ProtoReflect.Descriptor instead.
+func (*CompleteResponse) Descriptor() ([]byte, []int) {
+	return file_stock_v1_stock_proto_rawDescGZIP(), []int{6}
+}
+
+var File_stock_v1_stock_proto protoreflect.FileDescriptor
+
+const file_stock_v1_stock_proto_rawDesc = "" +
+	"\n" +
+	"\x14stock/v1/stock.proto\x12\bstock.v1\"\xb9\x01\n" +
+	"\x0eReserveRequest\x12\x17\n" +
+	"\aitem_id\x18\x01 \x01(\x05R\x06itemId\x12\x1a\n" +
+	"\bquantity\x18\x02 \x01(\x05R\bquantity\x12\x1f\n" +
+	"\vcustomer_id\x18\x03 \x01(\tR\n" +
+	"customerId\x124\n" +
+	"\x16preferred_warehouse_id\x18\x04 \x01(\x05R\x14preferredWarehouseId\x12\x1b\n" +
+	"\ttenant_id\x18\x05 \x01(\tR\btenantId\"K\n" +
+	"\n" +
+	"Allocation\x12!\n" +
+	"\fwarehouse_id\x18\x01 \x01(\x05R\vwarehouseId\x12\x1a\n" +
+	"\bquantity\x18\x02 \x01(\x05R\bquantity\"\xe5\x01\n" +
+	"\x0fReserveResponse\x12%\n" +
+	"\x0ereservation_id\x18\x01 \x01(\x05R\rreservationId\x12\x1b\n" +
+	"\ttotal_fee\x18\x02 \x01(\x01R\btotalFee\x123\n" +
+	"\x06status\x18\x03 \x01(\x0e2\x1b.stock.v1.ReservationStatusR\x06status\x12!\n" +
+	"\fwarehouse_id\x18\x04 \x01(\x05R\vwarehouseId\x126\n" +
+	"\vallocations\x18\x05 \x03(\v2\x14.stock.v1.AllocationR\vallocations\"7\n" +
+	"\x0eReleaseRequest\x12%\n" +
+	"\x0ereservation_id\x18\x01 \x01(\x05R\rreservationId\"\x11\n" +
+	"\x0fReleaseResponse\"8\n" +
+	"\x0fCompleteRequest\x12%\n" +
+	"\x0ereservation_id\x18\x01 \x01(\x05R\rreservationId\"\x12\n" +
+	"\x10CompleteResponse*|\n" +
+	"\x11ReservationStatus\x12\"\n" +
+	"\x1eRESERVATION_STATUS_UNSPECIFIED\x10\x00\x12\x1f\n" +
+	"\x1bRESERVATION_STATUS_RESERVED\x10\x01\x12\"\n" +
+	"\x1eRESERVATION_STATUS_BACKORDERED\x10\x022\xd1\x01\n" +
+	"\fStockService\x12>\n" +
+	"\aReserve\x12\x18.stock.v1.ReserveRequest\x1a\x19.stock.v1.ReserveResponse\x12>\n" +
+	"\aRelease\x12\x18.stock.v1.ReleaseRequest\x1a\x19.stock.v1.ReleaseResponse\x12A\n" +
+	"\bComplete\x12\x19.stock.v1.CompleteRequest\x1a\x1a.stock.v1.CompleteResponseB8Z6github.com/giovaniif/e-commerce/proto/stock/v1;stockv1b\x06proto3"
+
+var (
+	file_stock_v1_stock_proto_rawDescOnce sync.Once
+	file_stock_v1_stock_proto_rawDescData []byte
+)
+
+func file_stock_v1_stock_proto_rawDescGZIP() []byte {
+	file_stock_v1_stock_proto_rawDescOnce.Do(func() {
+		file_stock_v1_stock_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_stock_v1_stock_proto_rawDesc), len(file_stock_v1_stock_proto_rawDesc)))
+	})
+	return file_stock_v1_stock_proto_rawDescData
+}
+
+var file_stock_v1_stock_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_stock_v1_stock_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_stock_v1_stock_proto_goTypes = []any{
+	(ReservationStatus)(0),   // 0: stock.v1.ReservationStatus
+	(*ReserveRequest)(nil),   // 1: stock.v1.ReserveRequest
+	(*Allocation)(nil),       // 2: stock.v1.Allocation
+	(*ReserveResponse)(nil),  // 3: stock.v1.ReserveResponse
+	(*ReleaseRequest)(nil),   // 4: stock.v1.ReleaseRequest
+	(*ReleaseResponse)(nil),  // 5: stock.v1.ReleaseResponse
+	(*CompleteRequest)(nil),  // 6: stock.v1.CompleteRequest
+	(*CompleteResponse)(nil), // 7: stock.v1.CompleteResponse
+}
+var file_stock_v1_stock_proto_depIdxs = []int32{
+	0, // 0: stock.v1.ReserveResponse.status:type_name -> stock.v1.ReservationStatus
+	2, // 1: stock.v1.ReserveResponse.allocations:type_name -> stock.v1.Allocation
+	1, // 2: stock.v1.StockService.Reserve:input_type -> stock.v1.ReserveRequest
+	4, // 3: stock.v1.StockService.Release:input_type -> stock.v1.ReleaseRequest
+	6, // 4: stock.v1.StockService.Complete:input_type -> stock.v1.CompleteRequest
+	3, // 5: stock.v1.StockService.Reserve:output_type -> stock.v1.ReserveResponse
+	5, // 6: stock.v1.StockService.Release:output_type -> stock.v1.ReleaseResponse
+	7, // 7: stock.v1.StockService.Complete:output_type -> stock.v1.CompleteResponse
+	5, // [5:8] is the sub-list for method output_type
+	2, // [2:5] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_stock_v1_stock_proto_init() }
+func file_stock_v1_stock_proto_init() {
+	if File_stock_v1_stock_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_stock_v1_stock_proto_rawDesc), len(file_stock_v1_stock_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_stock_v1_stock_proto_goTypes,
+		DependencyIndexes: file_stock_v1_stock_proto_depIdxs,
+		EnumInfos:         file_stock_v1_stock_proto_enumTypes,
+		MessageInfos:      file_stock_v1_stock_proto_msgTypes,
+	}.Build()
+	File_stock_v1_stock_proto = out.File
+	file_stock_v1_stock_proto_goTypes = nil
+	file_stock_v1_stock_proto_depIdxs = nil
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/giovaniif/e-commerce/contracts"
+	"github.com/giovaniif/e-commerce/stock/domain/item"
+)
+
+// TestServer_HonorsOrderContract replays what Order's stock gateway declared
+// in contracts/pacts/order-stock.json against the handlers over the in-memory
+// repository. Each state works on an item of its own: item 1 stays in stock.
+func TestServer_HonorsOrderContract(t *testing.T) {
+	contract, err := contracts.Load("order", "stock")
+	if err != nil {
+		t.Fatalf("load contract: %v", err)
+	}
+	t.Setenv("SERVICE_AUTH_ENABLED", "false")
+	items := newItems()
+	ts := httptest.NewServer(newTestHandler(t, items))
+	defer ts.Close()
+
+	contracts.Verify(t, ts.URL, contract, contracts.States{
+		"the item is in stock": func(t *testing.T) map[string]any {
+			return map[string]any{"itemId": 1}
+		},
+		"the item is out of stock": func(t *testing.T) map[string]any {
+			items.Save(&item.Item{Id: 2, Price: 10})
+			return map[string]any{"itemId": 2}
+		},
+		"the item is out of stock and backorderable": func(t *testing.T) map[string]any {
+			items.Save(&item.Item{Id: 3, Price: 10, Backorderable: true, BackorderCap: 10})
+			return map[string]any{"itemId": 3}
+		},
+		"a reservation is open": func(t *testing.T) map[string]any {
+			items.Save(&item.Item{Id: 4, Price: 10, InitialStock: 1})
+			it, _ := items.GetItem(context.Background(), 4)
+			reservation, err := items.Reserve(context.Background(), it, []item.Allocation{{WarehouseId: 1, Quantity: 1}})
+			if err != nil {
+				t.Fatalf("reserve: %v", err)
+			}
+			return map[string]any{"reservationId": reservation.Id}
+		},
+	})
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/giovaniif/e-commerce/idempotency"
+	stockv1 "github.com/giovaniif/e-commerce/proto/stock/v1"
+	"github.com/giovaniif/e-commerce/stock/infra/metrics"
+	"github.com/giovaniif/e-commerce/stock/infra/requestid"
+	"github.com/giovaniif/e-commerce/stock/infra/tracing"
+	"github.com/giovaniif/e-commerce/stock/use_cases/complete"
+	"github.com/giovaniif/e-commerce/stock/use_cases/release"
+	"github.com/giovaniif/e-commerce/stock/use_cases/reserve"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// requestIDMetadata is the gRPC counterpart of the X-Request-ID header.
+const requestIDMetadata = "x-request-id"
+
+// stockService is the gRPC API of the reserve, release and complete use
+// cases, the same ones the /v1 routes serve.
+type stockService struct {
+	stockv1.UnimplementedStockServiceServer
+	uc useCases
+}
+
+func (s stockService) Reserve(ctx context.Context, req *stockv1.ReserveRequest) (*stockv1.ReserveResponse, error) {
+	reservation, err := s.uc.reserve.Reserve(ctx, reserve.Input{
+		ItemId:               req.GetItemId(),
+		Quantity:             req.GetQuantity(),
+		CustomerId:           req.GetCustomerId(),
+		PreferredWarehouseId: req.GetPreferredWarehouseId(),
+		TenantId:             req.GetTenantId(),
+	})
+	if err != nil {
+		p := problems.For(err)
+		if p.Status >= http.StatusInternalServerError {
+			slog.ErrorContext(ctx, "reserve failed", "request_id", requestid.FromContext(ctx), "item_id", req.GetItemId(), "quantity", req.GetQuantity(), "code", p.Code, "error", err)
+		}
+		return nil, p.GRPCStatus().Err()
+	}
+	return reserveMessage(reservation), nil
+}
+
+func (s stockService) Release(ctx context.Context, req *stockv1.ReleaseRequest) (*stockv1.ReleaseResponse, error) {
+	if err := s.uc.release.Release(ctx, release.Input{ReservationId: req.GetReservationId()}); err != nil {
+		p := problems.For(err)
+		if p.Status >= http.StatusInternalServerError {
+			slog.ErrorContext(ctx, "release failed", "request_id", requestid.FromContext(ctx), "reservation_id", req.GetReservationId(), "error", err)
+		}
+		return nil, p.GRPCStatus().Err()
+	}
+	return &stockv1.ReleaseResponse{}, nil
+}
+
+func (s stockService) Complete(ctx context.Context, req *stockv1.CompleteRequest) (*stockv1.CompleteResponse, error) {
+	if err := s.uc.complete.Complete(ctx, complete.Input{ReservationId: req.GetReservationId()}); err != nil {
+		p := problems.For(err)
+		if p.Status >= http.StatusInternalServerError {
+			slog.ErrorContext(ctx, "complete failed", "request_id", requestid.FromContext(ctx), "reservation_id", req.GetReservationId(), "error", err)
+		}
+		return nil, p.GRPCStatus().Err()
+	}
+	return &stockv1.CompleteResponse{}, nil
+}
+
+// reserveMessage is reserveResponse for gRPC.
+func reserveMessage(result reserve.Output) *stockv1.ReserveResponse {
+	resp := &stockv1.ReserveResponse{
+		ReservationId: result.ReservationId,
+		TotalFee:      result.TotalFee,
+		Status:        stockv1.ReservationStatus_RESERVATION_STATUS_RESERVED,
+		Allocations:   make([]*stockv1.Allocation, len(result.Allocations)),
+	}
+	for i, a := range result.Allocations {
+		resp.Allocations[i] = &stockv1.Allocation{WarehouseId: a.WarehouseId, Quantity: a.Quantity}
+	}
+	if len(resp.Allocations) > 0 {
+		resp.WarehouseId = resp.Allocations[0].WarehouseId
+	}
+	if result.Backordered {
+		resp.Status = stockv1.ReservationStatus_RESERVATION_STATUS_BACKORDERED
+	}
+	return resp
+}
+
+// reservationIdMetadataKey is reservationIdKey for gRPC.
+func reservationIdMetadataKey(ctx context.Context, req any) string {
+	r, ok := req.(interface{ GetReservationId() int32 })
+	if !ok || r.GetReservationId() == 0 {
+		return ""
+	}
+	return strconv.Itoa(int(r.GetReservationId()))
+}
+
+// releasedReserveMessage is releasedReserve for the Reserve method.
+func releasedReserveMessage(reservations reservationStatuses) func(context.Context, idempotency.Response) bool {
+	return func(ctx context.Context, resp idempotency.Response) bool {
+		var msg stockv1.ReserveResponse
+		if proto.Unmarshal(resp.Body, &msg) != nil {
+			return false
+		}
+		return released(ctx, reservations, msg.GetReservationId())
+	}
+}
+
+// grpcServer builds the gRPC API around the use cases, behind the same
+// request id, tracing, metrics, service authentication, faults and
+// idempotency scopes the HTTP routes go through, and the standard health
+// service.
+func (s *Server) grpcServer(uc useCases, reservations reservationStatuses, idempotencyStore idempotency.Store) (*grpc.Server, *health.Server) {
+	interceptors := []grpc.UnaryServerInterceptor{
+		requestIDInterceptor,
+		tracing.UnaryServerInterceptor,
+		metrics.UnaryServerInterceptor,
+	}
+	if auth := s.serviceAuthInterceptor(); auth != nil {
+		interceptors = append(interceptors, auth)
+	}
+	if s.faults != nil {
+		interceptors = append(interceptors, s.faults.UnaryServerInterceptor)
+	}
+	interceptors = append(interceptors, idempotency.UnaryServerInterceptor(idempotencyStore, map[string]idempotency.Method{
+		stockv1.StockService_Reserve_FullMethodName:  {Scope: "stock:reserve", Stale: releasedReserveMessage(reservations)},
+		stockv1.StockService_Release_FullMethodName:  {Scope: "stock:release", Key: reservationIdMetadataKey},
+		stockv1.StockService_Complete_FullMethodName: {Scope: "stock:complete", Key: reservationIdMetadataKey},
+	}))
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors...))
+	stockv1.RegisterStockServiceServer(srv, stockService{uc: uc})
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(srv, healthServer)
+	return srv, healthServer
+}
+
+// requestIDInterceptor takes the request id from the x-request-id metadata,
+// or generates one, and sends it back in the response header.
+func requestIDInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	id := ""
+	if values := metadata.ValueFromIncomingContext(ctx, requestIDMetadata); len(values) > 0 {
+		id = values[0]
+	}
+	if id == "" {
+		id = requestid.Generate()
+	}
+	ctx = requestid.NewContext(ctx, id)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadata, id))
+	resp, err := handler(ctx, req)
+	if err != nil {
+		slog.Error("request", "request_id", id, "method", info.FullMethod, "code", status.Code(err).String())
+	}
+	return resp, err
+}
@@ -1,9 +1,9 @@
 package api
 
 import (
+	"bytes"
 	"context"
-	"database/sql"
-	"errors"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
@@ -15,24 +15,88 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	_ "github.com/lib/pq"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/redis/go-redis/v9"
-	"github.com/giovaniif/e-commerce/stock/infra/gateways"
+	"github.com/giovaniif/e-commerce/idempotency"
+	"github.com/giovaniif/e-commerce/stock/domain/item"
+	"github.com/giovaniif/e-commerce/stock/infra/backends"
+	"github.com/giovaniif/e-commerce/stock/infra/config"
 	"github.com/giovaniif/e-commerce/stock/infra/loki"
 	"github.com/giovaniif/e-commerce/stock/infra/metrics"
-	"github.com/giovaniif/e-commerce/stock/infra/repositories"
+	"github.com/giovaniif/e-commerce/stock/infra/problem"
+	"github.com/giovaniif/e-commerce/stock/infra/projections"
 	"github.com/giovaniif/e-commerce/stock/infra/requestid"
 	"github.com/giovaniif/e-commerce/stock/infra/tracing"
+	"github.com/giovaniif/e-commerce/stock/infra/version"
 	"github.com/giovaniif/e-commerce/stock/use_cases/complete"
 	"github.com/giovaniif/e-commerce/stock/use_cases/release"
 	"github.com/giovaniif/e-commerce/stock/use_cases/reserve"
+	"github.com/giovaniif/e-commerce/stock/use_cases/restock"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-
 type ReserveRequest struct {
-	ItemId int32 `json:"itemId"`
-	Quantity int32 `json:"quantity"`
+	ItemId               int32  `json:"itemId"`
+	Quantity             int32  `json:"quantity"`
+	CustomerId           string `json:"customerId"`
+	PreferredWarehouseId int32  `json:"preferredWarehouseId"`
+	TenantId             string `json:"tenantId"`
+}
+
+type AllocationResponse struct {
+	WarehouseId int32 `json:"warehouseId"`
+	Quantity    int32 `json:"quantity"`
+}
+
+type RestockRequest struct {
+	WarehouseId int32 `json:"warehouseId"`
+	Quantity    int32 `json:"quantity"`
+}
+
+type BackorderPolicyRequest struct {
+	Backorderable bool  `json:"backorderable"`
+	Cap           int32 `json:"cap"`
+}
+
+// reserveResponse reports the warehouse the reservation was taken from; when
+// it was split, warehouseId is the first location and allocations lists all.
+// A backordered reservation is answered with 202: it is accepted but the
+// stock only exists once a restock allocates it.
+func reserveResponse(result reserve.Output) (int, gin.H) {
+	allocations := make([]AllocationResponse, len(result.Allocations))
+	for i, a := range result.Allocations {
+		allocations[i] = AllocationResponse{WarehouseId: a.WarehouseId, Quantity: a.Quantity}
+	}
+	var warehouseId int32
+	if len(allocations) > 0 {
+		warehouseId = allocations[0].WarehouseId
+	}
+	code, status := http.StatusOK, "reserved"
+	if result.Backordered {
+		code, status = http.StatusAccepted, "backordered"
+	}
+	return code, gin.H{
+		"reservationId": result.ReservationId,
+		"totalFee":      result.TotalFee,
+		"status":        status,
+		"warehouseId":   warehouseId,
+		"allocations":   allocations,
+	}
+}
+
+// reservationIdKey keys release and complete calls by the reservation in
+// their body, leaving the body in place for the handler.
+func reservationIdKey(c *gin.Context) string {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return ""
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	var req struct {
+		ReservationId int32 `json:"reservationId"`
+	}
+	if json.Unmarshal(body, &req) != nil || req.ReservationId == 0 {
+		return ""
+	}
+	return strconv.Itoa(int(req.ReservationId))
 }
 
 type ReleaseRequest struct {
@@ -43,71 +107,110 @@ type CompleteRequest struct {
 	ReservationId int32 `json:"reservationId"`
 }
 
+const backendProbeInterval = 2 * time.Second
+
+// unversioned marks the routes as Order and other clients called them before
+// the API moved under /v1: they are served as v1 until their sunset.
+var unversioned = version.Deprecation{
+	To:     "/v1",
+	Since:  time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+	Sunset: time.Date(2027, 4, 30, 0, 0, 0, 0, time.UTC),
+}
+
+// StartServer runs the Stock service until SIGINT or SIGTERM: it loads the
+// configuration, sets up the process-wide logging and tracing, and serves a
+// Server built from it.
 func StartServer() {
-	initialStock := int32(10)
-	if s := os.Getenv("STOCK_INITIAL_QUANTITY"); s != "" {
-		if n, err := strconv.ParseInt(s, 10, 32); err == nil && n > 0 {
-			initialStock = int32(n)
-		}
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Invalid configuration: %v\n", err)
+		os.Exit(1)
 	}
-	_ = initialStock // initial stock is seeded via init.sql
 
-	postgresURL := os.Getenv("POSTGRES_URL")
-	if postgresURL == "" {
-		fmt.Println("POSTGRES_URL is required")
-		os.Exit(1)
+	logOut := io.Writer(os.Stdout)
+	var lokiWriter *loki.Writer
+	if cfg.LokiURL != "" {
+		if lw := loki.NewWriter(cfg.LokiURL, "stock"); lw != nil {
+			lokiWriter = lw
+			logOut = io.MultiWriter(os.Stdout, lw)
+		}
 	}
-	db, err := sql.Open("postgres", postgresURL)
+	slog.SetDefault(slog.New(slog.NewJSONHandler(logOut, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	shutdownTracing := tracing.Init("stock", cfg.OTLPEndpoint)
+
+	server, err := NewServer(context.Background(), cfg, Deps{})
 	if err != nil {
-		fmt.Printf("Failed to open postgres: %v\n", err)
+		fmt.Printf("Stock startup failed: %v\n", err)
 		os.Exit(1)
 	}
-	defer db.Close()
-	db.SetMaxOpenConns(80)
-	db.SetMaxIdleConns(40)
-	db.SetConnMaxLifetime(5 * time.Minute)
-	if err := db.Ping(); err != nil {
-		fmt.Printf("Failed to ping postgres: %v\n", err)
+	if err := server.Start(); err != nil {
+		fmt.Printf("Stock server: %v\n", err)
 		os.Exit(1)
 	}
-	redisAddr := os.Getenv("REDIS_ADDR")
-	if redisAddr == "" {
-		fmt.Println("REDIS_ADDR is required")
-		os.Exit(1)
+	slog.Info("stock service started", "port", cfg.Port, "grpc_port", cfg.GRPCPort)
+	fmt.Printf("Stock is running on port %d\n", cfg.Port)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+	fmt.Println("Stock shutting down...")
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		fmt.Printf("Stock shutdown: %v\n", err)
 	}
-	rdb := redis.NewClient(&redis.Options{Addr: redisAddr})
-	if err := rdb.Ping(context.Background()).Err(); err != nil {
-		fmt.Printf("Failed to ping Redis (%s): %v\n", redisAddr, err)
-		os.Exit(1)
+	if shutdownTracing != nil {
+		shutdownTracing()
 	}
-
-	itemRepository := repositories.NewItemRepositoryPostgres(db, rdb)
-	if err := itemRepository.SeedStockCounters(context.Background()); err != nil {
-		fmt.Printf("Failed to seed stock counters: %v\n", err)
-		os.Exit(1)
+	if lokiWriter != nil {
+		_ = lokiWriter.Close()
 	}
-	fmt.Println("Stock counters seeded in Redis")
+	fmt.Println("Stock stopped")
+}
 
-	idempotencyGateway := gateways.NewIdempotencyGatewayRedis(rdb)
-	reserveUseCase := reserve.NewReserve(itemRepository)
-	releaseUseCase := release.NewRelease(itemRepository)
-	completeUseCase := complete.NewComplete(itemRepository)
+// projectionReads are the queries the read endpoints answer from the
+// projections.
+type projectionReads interface {
+	GetReservation(ctx context.Context, reservationId int32) (*item.Reservation, error)
+	GetStockLevel(ctx context.Context, itemId int32) (*projections.StockLevel, error)
+}
 
-	logOut := io.Writer(os.Stdout)
-	var lokiWriter *loki.Writer
-	if lokiURL := os.Getenv("LOKI_URL"); lokiURL != "" {
-		if lw := loki.NewWriter(lokiURL, "stock"); lw != nil {
-			lokiWriter = lw
-			logOut = io.MultiWriter(os.Stdout, lw)
+// backorderPolicies stores whether an item takes backorders, and how many.
+type backorderPolicies interface {
+	SetBackorderPolicy(ctx context.Context, itemId int32, backorderable bool, backorderCap int32) error
+}
+
+// reservationStatuses reads where a reservation stands.
+type reservationStatuses interface {
+	ReservationStatus(ctx context.Context, reservationId int32) (string, error)
+}
+
+// released reports whether a reservation was released. A recorded reserve
+// response naming one is not replayed: the checkout that released it and
+// then retried with the same key reserves again instead of being handed a
+// reservation whose stock went back on sale.
+func released(ctx context.Context, reservations reservationStatuses, reservationId int32) bool {
+	status, err := reservations.ReservationStatus(ctx, reservationId)
+	return err == nil && status == "canceled"
+}
+
+// releasedReserve is the Stale check of the reserve route.
+func releasedReserve(reservations reservationStatuses) func(*gin.Context, idempotency.Response) bool {
+	return func(c *gin.Context, resp idempotency.Response) bool {
+		var body struct {
+			ReservationId int32 `json:"reservationId"`
 		}
+		if json.Unmarshal(resp.Body, &body) != nil {
+			return false
+		}
+		return released(c.Request.Context(), reservations, body.ReservationId)
 	}
-	slog.SetDefault(slog.New(slog.NewJSONHandler(logOut, &slog.HandlerOptions{Level: slog.LevelInfo})))
-	slog.Info("stock service started", "port", 3133, "initial_stock_item_1", initialStock)
+}
 
-	shutdownTracing := tracing.Init("stock")
-	if shutdownTracing != nil {
-		defer shutdownTracing()
-	}
+// routes builds the Stock API: the use cases and the projection reads
+// under /v1, and the probe endpoints.
+func (s *Server) routes(projectionReader projectionReads, policies backorderPolicies, reservations reservationStatuses, uc useCases, idempotencyStore idempotency.Store, monitor *backends.Monitor) http.Handler {
+	cfg := s.cfg
 
 	r := gin.Default()
 	r.Use(func(c *gin.Context) {
@@ -124,120 +227,239 @@ func StartServer() {
 	})
 	r.Use(tracing.Middleware("stock"))
 	r.Use(metrics.Middleware)
+	if s.faults != nil {
+		r.Use(s.faults.Middleware)
+	}
+	r.Use(s.spec.Validate)
 
+	r.GET("/openapi.json", s.spec.Serve)
 	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
+		status := "healthy"
+		if !monitor.Ready() {
+			status = "degraded"
+		}
+		c.JSON(http.StatusOK, gin.H{"status": status, "checks": monitor.Report().Checks})
 	})
+	r.GET("/livez", monitor.Livez)
+	r.GET("/readyz", monitor.Readyz)
+	// The admin routes are for operators on the internal network, and only
+	// with the admin token; Nginx does not expose them.
+	admin := r.Group("/admin", s.adminAuth())
+	if cfg.AdminEnabled {
+		admin.GET("/config", func(c *gin.Context) {
+			effective, err := cfg.Effective()
+			if err != nil {
+				problems.Abort(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, effective)
+		})
+	}
+	if s.faults != nil {
+		admin.GET("/faults", s.faults.List)
+		admin.PUT("/faults", s.faults.Replace)
+		admin.DELETE("/faults", s.faults.Clear)
+	}
 
-	r.POST("/reserve", func(c *gin.Context) {
+	v1 := r.Group("/v1")
+	v1.GET("/reservations/:id", func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 32)
+		if err != nil {
+			invalid(c, "invalid reservation id")
+			return
+		}
+		reservation, err := projectionReader.GetReservation(c.Request.Context(), int32(id))
+		if err != nil {
+			problems.Abort(c, err)
+			return
+		}
+		allocations := make([]AllocationResponse, len(reservation.Allocations))
+		for i, a := range reservation.Allocations {
+			allocations[i] = AllocationResponse{WarehouseId: a.WarehouseId, Quantity: a.Quantity}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"reservationId": reservation.Id,
+			"itemId":        reservation.ItemId,
+			"quantity":      reservation.Quantity,
+			"status":        reservation.Status,
+			"totalFee":      reservation.TotalFee,
+			"allocations":   allocations,
+		})
+	})
+
+	v1.GET("/items/:id/stock", func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 32)
+		if err != nil {
+			invalid(c, "invalid item id")
+			return
+		}
+		level, err := projectionReader.GetStockLevel(c.Request.Context(), int32(id))
+		if err != nil {
+			problems.Abort(c, err)
+			return
+		}
+		warehouses := make([]gin.H, len(level.Warehouses))
+		for i, w := range level.Warehouses {
+			warehouses[i] = gin.H{
+				"warehouseId": w.WarehouseId,
+				"available":   w.Available,
+				"reserved":    w.Reserved,
+				"completed":   w.Completed,
+				"backordered": w.Backordered,
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"itemId":      level.ItemId,
+			"available":   level.Available,
+			"reserved":    level.Reserved,
+			"completed":   level.Completed,
+			"backordered": level.Backordered,
+			"lastEventId": level.LastEventId,
+			"warehouses":  warehouses,
+		})
+	})
+
+	// Every call that moves stock or changes a policy must be signed with a
+	// service key once service authentication is on: Order signs reserve,
+	// release and complete, and operators sign restocks and backorder
+	// policies with a key of their own.
+	// Without an Idempotency-Key every reserve call takes stock; with one, a
+	// retry gets the first response back, unless that reservation has been
+	// released since, and a concurrent duplicate a 409.
+	reserveIdempotency := idempotency.Middleware(idempotency.Config{Store: idempotencyStore, Scope: "stock:reserve", Stale: releasedReserve(reservations)})
+	v1.POST("/reserve", s.serviceAuth(), reserveIdempotency, func(c *gin.Context) {
 		var reserveRequest ReserveRequest
 		if err := c.ShouldBindJSON(&reserveRequest); err != nil {
-			c.String(http.StatusBadRequest, err.Error())
+			invalid(c, err.Error())
 			return
 		}
 		ctx := c.Request.Context()
 		requestID := requestid.FromContext(ctx)
-		if idempotencyGateway != nil && requestID != "" {
-			if resId, fee, found, err := idempotencyGateway.ReserveIdempotency(ctx, requestID); err == nil && found {
-				c.JSON(http.StatusOK, gin.H{"reservationId": resId, "totalFee": fee})
-				return
-			}
-		}
-		reservation, err := reserveUseCase.Reserve(reserveRequest.ItemId, reserveRequest.Quantity)
+		reservation, err := uc.reserve.Reserve(ctx, reserve.Input{
+			ItemId:               reserveRequest.ItemId,
+			Quantity:             reserveRequest.Quantity,
+			CustomerId:           reserveRequest.CustomerId,
+			PreferredWarehouseId: reserveRequest.PreferredWarehouseId,
+			TenantId:             reserveRequest.TenantId,
+		})
 		if err != nil {
-			switch {
-			case errors.Is(err, repositories.ErrItemNotFound):
-				slog.ErrorContext(ctx, "reserve failed: item not found", "request_id", requestID, "item_id", reserveRequest.ItemId, "quantity", reserveRequest.Quantity, "error", err)
-				c.String(http.StatusNotFound, err.Error())
-			case errors.Is(err, repositories.ErrInsufficientStock):
+			p := problems.For(err)
+			switch p.Code {
+			case problem.InvalidRequest:
+				slog.WarnContext(ctx, "reserve rejected: invalid quantity", "request_id", requestID, "item_id", reserveRequest.ItemId, "quantity", reserveRequest.Quantity, "error", err)
+			case problem.PurchaseLimitExceeded:
+				slog.WarnContext(ctx, "reserve rejected: purchase limit", "request_id", requestID, "item_id", reserveRequest.ItemId, "quantity", reserveRequest.Quantity, "tenant_id", reserveRequest.TenantId, "customer_id", reserveRequest.CustomerId)
+			case problem.InsufficientStock:
 				slog.WarnContext(ctx, "reserve failed: insufficient stock", "request_id", requestID, "item_id", reserveRequest.ItemId, "quantity", reserveRequest.Quantity)
-				c.String(http.StatusConflict, err.Error())
 			default:
-				slog.ErrorContext(ctx, "reserve failed", "request_id", requestID, "item_id", reserveRequest.ItemId, "quantity", reserveRequest.Quantity, "error", err)
-				c.String(http.StatusInternalServerError, err.Error())
+				slog.ErrorContext(ctx, "reserve failed", "request_id", requestID, "item_id", reserveRequest.ItemId, "quantity", reserveRequest.Quantity, "code", p.Code, "error", err)
 			}
+			problem.Abort(c, p)
 			return
 		}
-		if idempotencyGateway != nil && requestID != "" {
-			_ = idempotencyGateway.SaveReserveResult(ctx, requestID, reservation.ReservationId, reservation.TotalFee)
-		}
-		c.JSON(http.StatusOK, gin.H{"reservationId": reservation.ReservationId, "totalFee": reservation.TotalFee})
+		c.JSON(reserveResponse(reservation))
 	})
 
-	r.POST("/release", func(c *gin.Context) {
-		var releaseRequest ReleaseRequest
-		if err := c.ShouldBindJSON(&releaseRequest); err != nil {
-			c.String(http.StatusBadRequest, err.Error())
+	v1.POST("/items/:id/restock", s.serviceAuth(), func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 32)
+		if err != nil {
+			invalid(c, "invalid item id")
+			return
+		}
+		var restockRequest RestockRequest
+		if err := c.ShouldBindJSON(&restockRequest); err != nil {
+			invalid(c, err.Error())
 			return
 		}
 		ctx := c.Request.Context()
-		if idempotencyGateway != nil {
-			if found, err := idempotencyGateway.ReleaseIdempotency(ctx, releaseRequest.ReservationId); err == nil && found {
-				c.String(http.StatusOK, "Release successful")
-				return
+		out, err := uc.restock.Restock(ctx, restock.Input{
+			ItemId:      int32(id),
+			WarehouseId: restockRequest.WarehouseId,
+			Quantity:    restockRequest.Quantity,
+		})
+		if err != nil {
+			p := problems.For(err)
+			if p.Status >= http.StatusInternalServerError {
+				slog.ErrorContext(ctx, "restock failed", "request_id", requestid.FromContext(ctx), "item_id", id, "warehouse_id", restockRequest.WarehouseId, "error", err)
 			}
+			problem.Abort(c, p)
+			return
 		}
-		err := releaseUseCase.Release(release.Input{ReservationId: releaseRequest.ReservationId})
+		slog.InfoContext(ctx, "restocked", "item_id", id, "warehouse_id", restockRequest.WarehouseId, "quantity", restockRequest.Quantity, "backorders_allocated", len(out.AllocatedReservationIds))
+		c.JSON(http.StatusOK, gin.H{
+			"itemId":                  id,
+			"warehouseId":             restockRequest.WarehouseId,
+			"allocatedReservationIds": out.AllocatedReservationIds,
+			"available":               out.Available,
+		})
+	})
+
+	v1.PUT("/items/:id/backorder", s.serviceAuth(), func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 32)
 		if err != nil {
-			slog.ErrorContext(ctx, "release failed", "request_id", requestid.FromContext(ctx), "reservation_id", releaseRequest.ReservationId, "error", err)
-			c.String(http.StatusInternalServerError, err.Error())
+			invalid(c, "invalid item id")
+			return
+		}
+		var policy BackorderPolicyRequest
+		if err := c.ShouldBindJSON(&policy); err != nil {
+			invalid(c, err.Error())
+			return
+		}
+		if policy.Backorderable && policy.Cap <= 0 {
+			invalid(c, "cap must be positive for a backorderable item")
+			return
+		}
+		if err := policies.SetBackorderPolicy(c.Request.Context(), int32(id), policy.Backorderable, policy.Cap); err != nil {
+			if problems.For(err).Status >= http.StatusInternalServerError {
+				slog.ErrorContext(c.Request.Context(), "backorder policy failed", "request_id", requestid.FromContext(c.Request.Context()), "item_id", id, "error", err)
+			}
+			problems.Abort(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"itemId": id, "backorderable": policy.Backorderable, "cap": policy.Cap})
+	})
+
+	// Release and complete are keyed by reservation: repeating either for the
+	// same reservation answers with the first response.
+	releaseIdempotency := idempotency.Middleware(idempotency.Config{Store: idempotencyStore, Scope: "stock:release", Key: reservationIdKey})
+	v1.POST("/release", s.serviceAuth(), releaseIdempotency, func(c *gin.Context) {
+		var releaseRequest ReleaseRequest
+		if err := c.ShouldBindJSON(&releaseRequest); err != nil {
+			invalid(c, err.Error())
 			return
 		}
-		if idempotencyGateway != nil {
-			_ = idempotencyGateway.SaveReleaseResult(ctx, releaseRequest.ReservationId)
+		ctx := c.Request.Context()
+		err := uc.release.Release(ctx, release.Input{ReservationId: releaseRequest.ReservationId})
+		if err != nil {
+			p := problems.For(err)
+			if p.Status >= http.StatusInternalServerError {
+				slog.ErrorContext(ctx, "release failed", "request_id", requestid.FromContext(ctx), "reservation_id", releaseRequest.ReservationId, "error", err)
+			}
+			problem.Abort(c, p)
+			return
 		}
 		c.String(http.StatusOK, "Release successful")
 	})
 
-	r.POST("/complete", func(c *gin.Context) {
+	completeIdempotency := idempotency.Middleware(idempotency.Config{Store: idempotencyStore, Scope: "stock:complete", Key: reservationIdKey})
+	v1.POST("/complete", s.serviceAuth(), completeIdempotency, func(c *gin.Context) {
 		var completeRequest CompleteRequest
 		if err := c.ShouldBindJSON(&completeRequest); err != nil {
-			c.String(http.StatusBadRequest, err.Error())
+			invalid(c, err.Error())
 			return
 		}
 		ctx := c.Request.Context()
-		if idempotencyGateway != nil {
-			if found, err := idempotencyGateway.CompleteIdempotency(ctx, completeRequest.ReservationId); err == nil && found {
-				c.String(http.StatusOK, "Complete successful")
-				return
-			}
-		}
-		err := completeUseCase.Complete(complete.Input{ReservationId: completeRequest.ReservationId})
+		err := uc.complete.Complete(ctx, complete.Input{ReservationId: completeRequest.ReservationId})
 		if err != nil {
-			slog.ErrorContext(ctx, "complete failed", "request_id", requestid.FromContext(ctx), "reservation_id", completeRequest.ReservationId, "error", err)
-			c.String(http.StatusInternalServerError, err.Error())
+			p := problems.For(err)
+			if p.Status >= http.StatusInternalServerError {
+				slog.ErrorContext(ctx, "complete failed", "request_id", requestid.FromContext(ctx), "reservation_id", completeRequest.ReservationId, "error", err)
+			}
+			problem.Abort(c, p)
 			return
 		}
-		if idempotencyGateway != nil {
-			_ = idempotencyGateway.SaveCompleteResult(ctx, completeRequest.ReservationId)
-		}
 		c.String(http.StatusOK, "Complete successful")
 	})
-
-	srv := &http.Server{Addr: ":3133", Handler: r}
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			fmt.Printf("Stock server: %v\n", err)
-		}
-	}()
-	fmt.Println("Stock is running on port 3133")
-
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
-	<-quit
-	fmt.Println("Stock shutting down...")
-	if shutdownTracing != nil {
-		shutdownTracing()
-	}
-	if lokiWriter != nil {
-		_ = lokiWriter.Close()
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		fmt.Printf("Stock shutdown: %v\n", err)
-	} else {
-		fmt.Println("Stock stopped")
-	}
-}
\ No newline at end of file
+	return version.Legacy(r, unversioned, "/reserve", "/release", "/complete", "/reservations/", "/items/")
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giovaniif/e-commerce/stock/infra/problem"
+	"github.com/giovaniif/e-commerce/stock/infra/projections"
+	"github.com/giovaniif/e-commerce/stock/infra/repositories"
+	"github.com/giovaniif/e-commerce/stock/use_cases/reserve"
+	"github.com/giovaniif/e-commerce/stock/use_cases/restock"
+)
+
+// problems maps the errors of the Stock use cases and repositories to the
+// problem each is answered with; anything else is an internal error.
+var problems = problem.Mapper{
+	{Err: reserve.ErrInvalidQuantity, Status: http.StatusBadRequest, Code: problem.InvalidRequest},
+	{Err: reserve.ErrQuantityAboveMax, Status: http.StatusBadRequest, Code: problem.InvalidRequest},
+	{Err: restock.ErrInvalidQuantity, Status: http.StatusBadRequest, Code: problem.InvalidRequest},
+	{Err: reserve.ErrPurchaseLimitExceeded, Status: http.StatusTooManyRequests, Code: problem.PurchaseLimitExceeded},
+	{Err: repositories.ErrItemNotFound, Status: http.StatusNotFound, Code: problem.ItemNotFound},
+	{Err: repositories.ErrWarehouseNotFound, Status: http.StatusNotFound, Code: problem.WarehouseNotFound},
+	{Err: repositories.ErrReservationNotFound, Status: http.StatusNotFound, Code: problem.ReservationNotFound},
+	{Err: projections.ErrReservationNotFound, Status: http.StatusNotFound, Code: problem.ReservationNotFound},
+	{Err: repositories.ErrInsufficientStock, Status: http.StatusConflict, Code: problem.InsufficientStock},
+	{Err: repositories.ErrBackorderCapExceeded, Status: http.StatusConflict, Code: problem.InsufficientStock},
+	{Err: repositories.ErrReservationBackordered, Status: http.StatusConflict, Code: problem.ReservationBackordered},
+	{Err: repositories.ErrReservationClosed, Status: http.StatusConflict, Code: problem.ReservationClosed},
+	{Err: context.DeadlineExceeded, Status: http.StatusGatewayTimeout, Code: problem.Timeout},
+}
+
+// invalid answers a request the handler could not read with a 400.
+func invalid(c *gin.Context, detail string) {
+	problem.Abort(c, problem.New(http.StatusBadRequest, problem.InvalidRequest, detail))
+}
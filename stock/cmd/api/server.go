@@ -0,0 +1,280 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/giovaniif/e-commerce/hmacauth"
+	"github.com/giovaniif/e-commerce/idempotency"
+	"github.com/giovaniif/e-commerce/stock/domain/item"
+	"github.com/giovaniif/e-commerce/stock/infra/backends"
+	"github.com/giovaniif/e-commerce/stock/infra/config"
+	"github.com/giovaniif/e-commerce/stock/infra/faults"
+	"github.com/giovaniif/e-commerce/stock/infra/gateways"
+	"github.com/giovaniif/e-commerce/stock/infra/openapi"
+	"github.com/giovaniif/e-commerce/stock/infra/projections"
+	"github.com/giovaniif/e-commerce/stock/infra/repositories"
+	"github.com/giovaniif/e-commerce/stock/infra/requestid"
+	"github.com/giovaniif/e-commerce/stock/infra/schema"
+	"github.com/giovaniif/e-commerce/stock/use_cases/complete"
+	"github.com/giovaniif/e-commerce/stock/use_cases/release"
+	"github.com/giovaniif/e-commerce/stock/use_cases/reserve"
+	"github.com/giovaniif/e-commerce/stock/use_cases/restock"
+	_ "github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+)
+
+// Deps are the clients the Stock server is built from. A nil field is
+// opened from the configuration and closed on Shutdown; an injected one is
+// left open for its owner.
+type Deps struct {
+	DB    *sql.DB
+	Redis *redis.Client
+}
+
+// Server is a wired Stock service: its HTTP handler, its gRPC server and the
+// journal, projector and probes behind them. Nothing listens or runs in the
+// background until Start.
+type Server struct {
+	cfg        config.Config
+	handler    http.Handler
+	journal    *repositories.EventJournal
+	faults     *faults.Injector
+	spec       *openapi.Spec
+	verifier   *hmacauth.Verifier
+	background []func(context.Context)
+	closers    []func() error
+
+	grpcSrv *grpc.Server
+	health  *health.Server
+
+	listener     net.Listener
+	grpcListener net.Listener
+	srv          *http.Server
+	stop         context.CancelFunc
+	stopJournal  context.CancelFunc
+}
+
+// NewServer connects to Postgres and Redis, migrates the Postgres schema,
+// brings the Redis counters in line with Postgres and builds the Stock service on top. ctx bounds that
+// bootstrap; an unreachable backend is an error.
+func NewServer(ctx context.Context, cfg config.Config, deps Deps) (_ *Server, err error) {
+	s := &Server{cfg: cfg}
+	defer func() {
+		if err != nil {
+			s.close(ctx)
+		}
+	}()
+	if s.spec, err = openapi.Load(); err != nil {
+		return nil, err
+	}
+
+	db := deps.DB
+	if db == nil {
+		db, err = sql.Open("postgres", cfg.Postgres.URL)
+		if err != nil {
+			return nil, fmt.Errorf("open postgres: %w", err)
+		}
+		db.SetMaxOpenConns(cfg.Postgres.MaxOpenConns)
+		db.SetMaxIdleConns(cfg.Postgres.MaxIdleConns)
+		db.SetConnMaxLifetime(cfg.Postgres.ConnMaxLifetime)
+		s.closers = append(s.closers, db.Close)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("ping postgres: %w", err)
+	}
+	if err := schema.Migrate(ctx, db); err != nil {
+		return nil, fmt.Errorf("migrate stock schema: %w", err)
+	}
+	rdb := deps.Redis
+	if rdb == nil {
+		rdb = redis.NewClient(&redis.Options{Addr: cfg.RedisAddr})
+		s.closers = append(s.closers, rdb.Close)
+	}
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("ping Redis (%s): %w", rdb.Options().Addr, err)
+	}
+
+	consumer, _ := os.Hostname()
+	if consumer == "" {
+		consumer = requestid.Generate()
+	}
+	s.journal = repositories.NewEventJournal(db, rdb, consumer, cfg.Journal.BatchSize, cfg.Journal.QueueSize, cfg.Journal.Interval)
+	// Counters are seeded from Postgres, so every journalled event must be there first.
+	if err := s.journal.Drain(ctx); err != nil {
+		return nil, fmt.Errorf("drain event journal: %w", err)
+	}
+
+	itemRepository := repositories.NewItemRepositoryPostgres(db, rdb)
+	if cfg.InitialQuantity > 0 {
+		seeded, err := itemRepository.SeedInitialStock(ctx, cfg.InitialQuantity)
+		if err != nil {
+			return nil, fmt.Errorf("seed initial stock: %w", err)
+		}
+		if seeded {
+			fmt.Printf("Initial stock of every item set to %d\n", cfg.InitialQuantity)
+		} else {
+			fmt.Println("STOCK_INITIAL_QUANTITY ignored: the stock already has history")
+		}
+	}
+	stockCounters, err := projections.LoadStockCounters(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("load stock counters: %w", err)
+	}
+	if err := itemRepository.SeedStockCounters(ctx, stockCounters); err != nil {
+		return nil, fmt.Errorf("seed stock counters: %w", err)
+	}
+	fmt.Println("Stock counters seeded in Redis")
+
+	projector := projections.NewProjector(db, cfg.Projector.BatchSize, cfg.Projector.Interval)
+	snapshotter := projections.NewSnapshotter(db, cfg.Projector.SnapshotInterval)
+	monitor := backends.NewMonitor(
+		backends.Check{Name: "postgres", Probe: db.PingContext},
+		backends.Check{Name: "redis", Probe: func(ctx context.Context) error { return rdb.Ping(ctx).Err() }},
+	)
+	s.background = append(s.background,
+		projector.Run,
+		snapshotter.Run,
+		func(ctx context.Context) { monitor.Run(ctx, backendProbeInterval) },
+	)
+
+	if cfg.Faults.Enabled {
+		s.faults = faults.NewInjector(cfg.Faults.Rules)
+		fmt.Printf("Fault injection enabled with %d rule(s)\n", len(cfg.Faults.Rules))
+	}
+
+	if s.verifier, err = s.newServiceVerifier(rdb); err != nil {
+		return nil, err
+	}
+
+	uc := newUseCases(cfg, itemRepository, gateways.NewPurchaseLimiterRedis(rdb))
+	idempotencyStore := idempotency.NewRedisStore(rdb)
+	s.handler = s.routes(projections.NewReader(db), itemRepository, itemRepository, uc, idempotencyStore, monitor)
+	s.grpcSrv, s.health = s.grpcServer(uc, itemRepository, idempotencyStore)
+	return s, nil
+}
+
+// useCases are the use cases the HTTP and gRPC APIs share.
+type useCases struct {
+	reserve  *reserve.Reserve
+	release  *release.Release
+	complete *complete.Complete
+	restock  *restock.Restock
+}
+
+func newUseCases(cfg config.Config, itemRepository item.Repository, purchaseLimiter item.PurchaseLimiter) useCases {
+	// The strategy name was validated with the rest of the configuration.
+	allocate, _ := item.StrategyByName(cfg.Reserve.AllocationStrategy)
+	reserveRules := reserve.Rules{
+		MaxQuantityPerLine: int32(cfg.Reserve.MaxQuantityPerLine),
+		LimitWindow:        cfg.Reserve.PurchaseLimitWindow,
+		Allocation:         allocate,
+		CustomerLimits:     cfg.Reserve.PurchaseLimits,
+	}
+	return useCases{
+		reserve:  reserve.NewReserve(itemRepository, purchaseLimiter, reserveRules),
+		release:  release.NewRelease(itemRepository),
+		complete: complete.NewComplete(itemRepository),
+		restock:  restock.NewRestock(itemRepository),
+	}
+}
+
+// Handler serves the Stock API. It can be mounted on an httptest.Server
+// without calling Start, but stock events then stay in the Redis journal:
+// only Start moves them into Postgres and its projections.
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// Start listens on the configured HTTP and gRPC ports, port 0 picking a
+// free one, and runs the journal, projector and probes until Shutdown.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.cfg.Port))
+	if err != nil {
+		return err
+	}
+	grpcListener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.cfg.GRPCPort))
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	journalCtx, stopJournal := context.WithCancel(context.Background())
+	go s.journal.Run(journalCtx)
+	for _, run := range s.background {
+		go run(ctx)
+	}
+	s.listener, s.grpcListener, s.stop, s.stopJournal = listener, grpcListener, stop, stopJournal
+	s.srv = &http.Server{Handler: s.handler}
+	go func() {
+		if err := s.srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("Stock server: %v\n", err)
+		}
+	}()
+	go func() {
+		if err := s.grpcSrv.Serve(grpcListener); err != nil {
+			fmt.Printf("Stock gRPC server: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// Addr is the address Start listens on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// GRPCAddr is the address Start serves gRPC on.
+func (s *Server) GRPCAddr() string {
+	return s.grpcListener.Addr().String()
+}
+
+// Shutdown waits for in-flight requests and calls until ctx is done, then
+// commits what the journal has queued and closes the clients the server
+// opened. Entries still in the stream are picked up by the next leader.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.srv == nil {
+		return s.close(ctx)
+	}
+	s.stop()
+	s.health.Shutdown()
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcSrv.GracefulStop()
+		close(stopped)
+	}()
+	err := s.srv.Shutdown(ctx)
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.grpcSrv.Stop()
+	}
+	s.stopJournal()
+	if closeErr := s.journal.Close(ctx); closeErr != nil {
+		err = errors.Join(err, fmt.Errorf("close journal: %w", closeErr))
+	}
+	return errors.Join(err, s.close(ctx))
+}
+
+// close stops the journal's writer when Start never ran it, then closes the
+// clients the server opened.
+func (s *Server) close(ctx context.Context) error {
+	var err error
+	if s.srv == nil && s.journal != nil {
+		if closeErr := s.journal.CloseWriter(ctx); closeErr != nil {
+			err = fmt.Errorf("close journal: %w", closeErr)
+		}
+	}
+	for _, closeClient := range s.closers {
+		err = errors.Join(err, closeClient())
+	}
+	s.closers = nil
+	return err
+}
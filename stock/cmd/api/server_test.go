@@ -0,0 +1,225 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/giovaniif/e-commerce/hmacauth"
+	"github.com/giovaniif/e-commerce/idempotency"
+	"github.com/giovaniif/e-commerce/stock/domain/item"
+	"github.com/giovaniif/e-commerce/stock/infra/backends"
+	"github.com/giovaniif/e-commerce/stock/infra/config"
+	"github.com/giovaniif/e-commerce/stock/infra/openapi"
+	"github.com/giovaniif/e-commerce/stock/infra/projections"
+	"github.com/giovaniif/e-commerce/stock/infra/repositories"
+	"github.com/redis/go-redis/v9"
+)
+
+const serviceKeys = "order:0123456789abcdef0123456789abcdef"
+
+// noProjections answers the read endpoints as a projector that has not
+// caught up with anything yet.
+type noProjections struct{}
+
+func (noProjections) GetReservation(ctx context.Context, reservationId int32) (*item.Reservation, error) {
+	return nil, projections.ErrReservationNotFound
+}
+
+func (noProjections) GetStockLevel(ctx context.Context, itemId int32) (*projections.StockLevel, error) {
+	return &projections.StockLevel{ItemId: itemId}, nil
+}
+
+// newTestHandler serves the Stock API over the in-memory repository,
+// without the Postgres and Redis NewServer needs. Signatures are checked
+// against SERVICE_AUTH_KEYS when SERVICE_AUTH_ENABLED is set.
+func newTestHandler(t *testing.T, repository *repositories.ItemRepository) http.Handler {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	cfg := testConfig(t)
+	s := &Server{cfg: cfg}
+	var err error
+	if s.spec, err = openapi.Load(); err != nil {
+		t.Fatalf("openapi: %v", err)
+	}
+	if cfg.ServiceAuth.Enabled {
+		keys, err := hmacauth.ParseKeys(cfg.ServiceAuth.Keys)
+		if err != nil {
+			t.Fatalf("service keys: %v", err)
+		}
+		s.verifier = hmacauth.NewVerifier(keys, hmacauth.NewMemoryNonces(), cfg.ServiceAuth.MaxSkew)
+	}
+	uc := newUseCases(cfg, repository, nil)
+	return s.routes(noProjections{}, repository, repository, uc, idempotency.NewMemoryStore(), backends.NewMonitor())
+}
+
+// testConfig loads the configuration from the environment the test set.
+func testConfig(t *testing.T) config.Config {
+	t.Helper()
+	t.Setenv("ENV_FILE", "")
+	t.Setenv("STARTUP_MODE", "lenient")
+	// Required by the configuration, though tests inject their own clients.
+	t.Setenv("POSTGRES_URL", "postgres://stock@localhost:5432/stock?sslmode=disable")
+	t.Setenv("REDIS_ADDR", "localhost:6379")
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config: %v", err)
+	}
+	return cfg
+}
+
+func newItems() *repositories.ItemRepository {
+	return repositories.NewItemRepository(
+		map[int32]*item.Item{1: {Id: 1, Price: 10, InitialStock: 5}},
+		map[int32]*item.Reservation{},
+	)
+}
+
+func send(t *testing.T, client *http.Client, method, url, body string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(respBody)
+}
+
+func TestServer_StockChangesNeedAServiceSignature(t *testing.T) {
+	t.Setenv("SERVICE_AUTH_ENABLED", "true")
+	t.Setenv("SERVICE_AUTH_KEYS", serviceKeys)
+	items := newItems()
+	ts := httptest.NewServer(newTestHandler(t, items))
+	defer ts.Close()
+	keys, _ := hmacauth.ParseKeys(serviceKeys)
+	signed := &http.Client{Transport: &hmacauth.Transport{Signer: hmacauth.NewSigner(keys[0])}}
+
+	calls := []struct{ method, path, body string }{
+		{http.MethodPost, "/v1/items/1/restock", `{"warehouseId":1,"quantity":3}`},
+		{http.MethodPost, "/items/1/restock", `{"warehouseId":1,"quantity":3}`},
+		{http.MethodPut, "/v1/items/1/backorder", `{"backorderable":true,"cap":4}`},
+		{http.MethodPost, "/v1/reserve", `{"itemId":1,"quantity":1}`},
+	}
+	for _, call := range calls {
+		code, body := send(t, http.DefaultClient, call.method, ts.URL+call.path, call.body)
+		if code != http.StatusUnauthorized || !strings.Contains(body, `"code":"unauthenticated"`) {
+			t.Errorf("unsigned %s %s = %d %s, want 401 unauthenticated", call.method, call.path, code, body)
+		}
+	}
+	it, _ := items.GetItem(context.Background(), 1)
+	if it.InitialStock != 5 || it.Backorderable {
+		t.Fatalf("unsigned calls changed the item: %+v", it)
+	}
+
+	for _, call := range calls {
+		if code, body := send(t, signed, call.method, ts.URL+call.path, call.body); code != http.StatusOK {
+			t.Errorf("signed %s %s = %d %s, want 200", call.method, call.path, code, body)
+		}
+	}
+	it, _ = items.GetItem(context.Background(), 1)
+	if it.InitialStock != 11 || !it.Backorderable || it.BackorderCap != 4 {
+		t.Errorf("item after signed calls = %+v, want 11 units backorderable up to 4", it)
+	}
+}
+
+// TestServer_ReserveKeyReservesAgainAfterRelease follows a checkout whose
+// charge failed: the reservation is released, and the retry with the same
+// Idempotency-Key must not be handed it back.
+func TestServer_ReserveKeyReservesAgainAfterRelease(t *testing.T) {
+	ts := httptest.NewServer(newTestHandler(t, newItems()))
+	defer ts.Close()
+	reserveWithKey := func() (int, string) {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/v1/reserve", strings.NewReader(`{"itemId":1,"quantity":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(idempotency.HeaderKey, "checkout-1:reserve")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("reserve: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	_, first := reserveWithKey()
+	if _, replayed := reserveWithKey(); replayed != first || !strings.Contains(first, `"reservationId":1`) {
+		t.Fatalf("reserve then retry = %s then %s, want reservation 1 twice", first, replayed)
+	}
+	if code, body := send(t, http.DefaultClient, http.MethodPost, ts.URL+"/v1/release", `{"reservationId":1}`); code != http.StatusOK {
+		t.Fatalf("release = %d %s, want 200", code, body)
+	}
+	code, body := send(t, http.DefaultClient, http.MethodPost, ts.URL+"/v1/complete", `{"reservationId":1}`)
+	if code != http.StatusConflict || !strings.Contains(body, `"code":"reservation_closed"`) {
+		t.Fatalf("complete after release = %d %s, want 409 reservation_closed", code, body)
+	}
+
+	if code, retried := reserveWithKey(); code != http.StatusOK || !strings.Contains(retried, `"reservationId":2`) {
+		t.Fatalf("reserve after release = %d %s, want reservation 2", code, retried)
+	}
+	if code, body := send(t, http.DefaultClient, http.MethodPost, ts.URL+"/v1/complete", `{"reservationId":2}`); code != http.StatusOK {
+		t.Fatalf("complete = %d %s, want 200", code, body)
+	}
+}
+
+var errUnreadable = errors.New("no rows to read")
+
+// unreadableDB is a Postgres that runs every statement but fails every
+// query, so NewServer gets past its connections and migrations and fails on
+// the first read.
+type unreadableDB struct{}
+
+func (d unreadableDB) Connect(context.Context) (driver.Conn, error) { return d, nil }
+func (d unreadableDB) Driver() driver.Driver                        { return d }
+func (d unreadableDB) Open(string) (driver.Conn, error)             { return d, nil }
+func (unreadableDB) Prepare(string) (driver.Stmt, error)            { return nil, errUnreadable }
+func (d unreadableDB) Begin() (driver.Tx, error)                    { return d, nil }
+func (unreadableDB) Commit() error                                  { return nil }
+func (unreadableDB) Rollback() error                                { return nil }
+func (unreadableDB) Close() error                                   { return nil }
+func (unreadableDB) Ping(context.Context) error                     { return nil }
+
+func (unreadableDB) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (unreadableDB) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return nil, errUnreadable
+}
+
+// eventWriterRunning reports whether any goroutine is in an EventWriter's
+// loop.
+func eventWriterRunning() bool {
+	buf := make([]byte, 1<<20)
+	return bytes.Contains(buf[:runtime.Stack(buf, true)], []byte("(*EventWriter).run"))
+}
+
+func TestServer_FailedNewServerStopsTheEventWriter(t *testing.T) {
+	cfg := testConfig(t)
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	defer rdb.Close()
+	db := sql.OpenDB(unreadableDB{})
+	defer db.Close()
+
+	if _, err := NewServer(context.Background(), cfg, Deps{DB: db, Redis: rdb}); !errors.Is(err, errUnreadable) {
+		t.Fatalf("NewServer = %v, want it to fail on the first read", err)
+	}
+	for deadline := time.Now().Add(time.Second); eventWriterRunning(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("event writer still running after NewServer failed")
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	eventarchive "github.com/giovaniif/e-commerce/stock/infra/archive"
+	_ "github.com/lib/pq"
+)
+
+const (
+	defaultHorizon = 30 * 24 * time.Hour
+	batchSize      = 5000
+)
+
+// Run moves stock_events older than the horizon and already covered by a
+// snapshot into the archive partitions, or into compressed files with -dir.
+func Run(args []string) {
+	horizon := defaultHorizon
+	if s := os.Getenv("STOCK_ARCHIVE_HORIZON"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil && d > 0 {
+			horizon = d
+		}
+	}
+	fs := flag.NewFlagSet("archive-events", flag.ExitOnError)
+	fs.DurationVar(&horizon, "horizon", horizon, "archive events older than this (env STOCK_ARCHIVE_HORIZON)")
+	dir := fs.String("dir", "", "write gzip JSON lines files to this directory instead of archive tables")
+	_ = fs.Parse(args)
+
+	postgresURL := os.Getenv("POSTGRES_URL")
+	if postgresURL == "" {
+		fmt.Println("POSTGRES_URL is required")
+		os.Exit(1)
+	}
+	db, err := sql.Open("postgres", postgresURL)
+	if err != nil {
+		fmt.Printf("Failed to open postgres: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	before := time.Now().Add(-horizon)
+	archiver := eventarchive.NewArchiver(db, batchSize)
+	var moved int64
+	if *dir != "" {
+		moved, err = archiver.ArchiveToFiles(ctx, before, *dir)
+	} else {
+		moved, err = archiver.ArchiveToTables(ctx, before)
+	}
+	if err != nil {
+		fmt.Printf("Archive failed after %d events: %v\n", moved, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Archived %d events older than %s\n", moved, before.Format(time.RFC3339))
+}
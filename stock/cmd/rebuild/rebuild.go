@@ -0,0 +1,52 @@
+package rebuild
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/giovaniif/e-commerce/stock/infra/projections"
+	_ "github.com/lib/pq"
+)
+
+const batchSize = 5000
+
+// Run rebuilds the reservations and item_stock_levels projections into fresh
+// tables and swaps them in, starting from the latest snapshot unless
+// -from-scratch is given. Safe to run while the API is serving.
+func Run(args []string) {
+	fs := flag.NewFlagSet("rebuild-projections", flag.ExitOnError)
+	fromScratch := fs.Bool("from-scratch", false, "replay the full history, archive tables included, instead of starting from the latest snapshot")
+	_ = fs.Parse(args)
+
+	postgresURL := os.Getenv("POSTGRES_URL")
+	if postgresURL == "" {
+		fmt.Println("POSTGRES_URL is required")
+		os.Exit(1)
+	}
+	db, err := sql.Open("postgres", postgresURL)
+	if err != nil {
+		fmt.Printf("Failed to open postgres: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Println("Rebuilding stock projections...")
+	rebuildProjections := projections.RebuildFromSnapshot
+	if *fromScratch {
+		rebuildProjections = projections.Rebuild
+	}
+	last, err := rebuildProjections(ctx, db, batchSize)
+	if err != nil {
+		fmt.Printf("Rebuild failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Projections rebuilt up to event %d\n", last)
+}
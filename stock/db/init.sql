@@ -1,23 +1,131 @@
 CREATE TABLE IF NOT EXISTS items (
     id INT PRIMARY KEY,
     price DECIMAL(10,2) NOT NULL,
-    initial_stock BIGINT NOT NULL
+    initial_stock BIGINT NOT NULL,
+    -- Backorderable items accept reservations beyond the available stock, up
+    -- to backorder_cap units waiting for a restock.
+    backorderable BOOLEAN NOT NULL DEFAULT FALSE,
+    backorder_cap INT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS warehouses (
+    id INT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL
+);
+
+-- Initial stock of each item per warehouse. items.initial_stock is the total.
+CREATE TABLE IF NOT EXISTS item_warehouse_stock (
+    item_id INT NOT NULL REFERENCES items(id),
+    warehouse_id INT NOT NULL REFERENCES warehouses(id),
+    initial_stock BIGINT NOT NULL,
+    PRIMARY KEY (item_id, warehouse_id)
 );
 
 CREATE SEQUENCE IF NOT EXISTS reservation_id_seq;
 
+-- Written by the journal consumer from the Redis Stream the reserve scripts append to.
+-- A reservation split across warehouses has one row per warehouse for each event.
+-- Backorders are 'backordered' until a restock 'allocated' them stock; restocks
+-- themselves are recorded with reservation_id 0.
 CREATE TABLE IF NOT EXISTS stock_events (
     id BIGSERIAL PRIMARY KEY,
     reservation_id BIGINT NOT NULL,
     item_id INT NOT NULL REFERENCES items(id),
-    event_type VARCHAR(20) NOT NULL CHECK (event_type IN ('reserved', 'released', 'completed')),
+    warehouse_id INT NOT NULL REFERENCES warehouses(id),
+    event_type VARCHAR(20) NOT NULL CHECK (event_type IN (
+        'reserved', 'released', 'completed',
+        'backordered', 'allocated', 'backorder_canceled', 'restocked'
+    )),
     quantity INT NOT NULL,
-    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- Redis Stream entry id the event was persisted from (see EventJournal).
+    journal_id VARCHAR(32)
 );
 
 CREATE INDEX IF NOT EXISTS idx_stock_events_item_id ON stock_events(item_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stock_events_journal_id ON stock_events(journal_id);
 CREATE INDEX IF NOT EXISTS idx_stock_events_reservation_id ON stock_events(reservation_id);
 
+-- Projections of stock_events maintained by the projector (infra/projections).
+CREATE TABLE IF NOT EXISTS reservations (
+    reservation_id BIGINT NOT NULL,
+    warehouse_id INT NOT NULL REFERENCES warehouses(id),
+    item_id INT NOT NULL REFERENCES items(id),
+    quantity INT NOT NULL,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('reserved', 'backordered', 'canceled', 'completed')),
+    last_event_id BIGINT NOT NULL,
+    reserved_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (reservation_id, warehouse_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reservations_item_id ON reservations(item_id);
+
+CREATE TABLE IF NOT EXISTS item_stock_levels (
+    item_id INT NOT NULL REFERENCES items(id),
+    warehouse_id INT NOT NULL REFERENCES warehouses(id),
+    available BIGINT NOT NULL,
+    reserved BIGINT NOT NULL DEFAULT 0,
+    completed BIGINT NOT NULL DEFAULT 0,
+    backordered BIGINT NOT NULL DEFAULT 0,
+    last_event_id BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (item_id, warehouse_id)
+);
+
+CREATE TABLE IF NOT EXISTS projection_checkpoints (
+    name VARCHAR(64) PRIMARY KEY,
+    last_event_id BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO projection_checkpoints (name, last_event_id) VALUES ('stock', 0)
+ON CONFLICT DO NOTHING;
+
+-- Periodic snapshots taken at the projector checkpoint: per-item stock levels
+-- and the reservations still open at that event id. stock_snapshots records
+-- every snapshot taken, including those where no item level changed; only
+-- the latest one is kept, along with the item rows it still reads.
+CREATE TABLE IF NOT EXISTS stock_snapshots (
+    event_id BIGINT PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS item_stock_snapshots (
+    item_id INT NOT NULL REFERENCES items(id),
+    warehouse_id INT NOT NULL REFERENCES warehouses(id),
+    event_id BIGINT NOT NULL,
+    available BIGINT NOT NULL,
+    reserved BIGINT NOT NULL,
+    completed BIGINT NOT NULL,
+    backordered BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (item_id, warehouse_id, event_id)
+);
+
+CREATE TABLE IF NOT EXISTS reservation_snapshots (
+    event_id BIGINT NOT NULL,
+    reservation_id BIGINT NOT NULL,
+    warehouse_id INT NOT NULL REFERENCES warehouses(id),
+    item_id INT NOT NULL REFERENCES items(id),
+    quantity INT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'reserved',
+    last_event_id BIGINT NOT NULL,
+    reserved_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (event_id, reservation_id, warehouse_id)
+);
+
+-- Archived stock_events, one partition per month (created by the archive command).
+CREATE TABLE IF NOT EXISTS stock_events_archive (
+    id BIGINT NOT NULL,
+    reservation_id BIGINT NOT NULL,
+    item_id INT NOT NULL,
+    warehouse_id INT NOT NULL,
+    event_type VARCHAR(20) NOT NULL,
+    quantity INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+) PARTITION BY RANGE (created_at);
+
 INSERT INTO items (id, price, initial_stock) VALUES
     (1,  10.00, 1000000000),
     (2,  25.00, 1000000000),
@@ -30,3 +138,12 @@ INSERT INTO items (id, price, initial_stock) VALUES
     (9,   8.50, 1000000000),
     (10, 19.99, 1000000000)
 ON CONFLICT DO NOTHING;
+
+INSERT INTO warehouses (id, name) VALUES
+    (1, 'sao-paulo'),
+    (2, 'recife')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO item_warehouse_stock (item_id, warehouse_id, initial_stock)
+SELECT i.id, w.id, i.initial_stock / 2 FROM items i CROSS JOIN warehouses w
+ON CONFLICT DO NOTHING;
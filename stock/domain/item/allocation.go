@@ -0,0 +1,90 @@
+package item
+
+import (
+	"errors"
+	"sort"
+)
+
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+const (
+	StrategyPreferredWarehouse = "preferred"
+	StrategyMostStock          = "most_stock"
+	StrategySplit              = "split"
+)
+
+// AllocationStrategy decides which warehouses a reservation of quantity is
+// taken from. preferredWarehouseId is 0 when the caller has no preference.
+type AllocationStrategy func(quantity int32, stock []WarehouseStock, preferredWarehouseId int32) ([]Allocation, error)
+
+func StrategyByName(name string) (AllocationStrategy, bool) {
+	switch name {
+	case StrategyPreferredWarehouse:
+		return AllocatePreferredWarehouse, true
+	case StrategyMostStock:
+		return AllocateMostStock, true
+	case StrategySplit:
+		return AllocateSplit, true
+	}
+	return nil, false
+}
+
+// AllocatePreferredWarehouse takes everything from the preferred warehouse when
+// it can cover the quantity, otherwise falls back to AllocateMostStock.
+func AllocatePreferredWarehouse(quantity int32, stock []WarehouseStock, preferredWarehouseId int32) ([]Allocation, error) {
+	for _, s := range stock {
+		if s.WarehouseId == preferredWarehouseId && s.Available >= int64(quantity) {
+			return []Allocation{{WarehouseId: s.WarehouseId, Quantity: quantity}}, nil
+		}
+	}
+	return AllocateMostStock(quantity, stock, preferredWarehouseId)
+}
+
+// AllocateMostStock takes everything from the single warehouse with the most
+// available stock. Ties go to the lowest warehouse id.
+func AllocateMostStock(quantity int32, stock []WarehouseStock, _ int32) ([]Allocation, error) {
+	var best *WarehouseStock
+	for i := range stock {
+		s := &stock[i]
+		if best == nil || s.Available > best.Available || (s.Available == best.Available && s.WarehouseId < best.WarehouseId) {
+			best = s
+		}
+	}
+	if best == nil || best.Available < int64(quantity) {
+		return nil, ErrInsufficientStock
+	}
+	return []Allocation{{WarehouseId: best.WarehouseId, Quantity: quantity}}, nil
+}
+
+// AllocateSplit spreads the quantity over as few warehouses as possible,
+// starting with the preferred one and then the ones with most stock.
+func AllocateSplit(quantity int32, stock []WarehouseStock, preferredWarehouseId int32) ([]Allocation, error) {
+	ordered := append([]WarehouseStock(nil), stock...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		pi, pj := ordered[i].WarehouseId == preferredWarehouseId, ordered[j].WarehouseId == preferredWarehouseId
+		if pi != pj {
+			return pi
+		}
+		if ordered[i].Available != ordered[j].Available {
+			return ordered[i].Available > ordered[j].Available
+		}
+		return ordered[i].WarehouseId < ordered[j].WarehouseId
+	})
+	remaining := int64(quantity)
+	var allocations []Allocation
+	for _, s := range ordered {
+		if remaining == 0 {
+			break
+		}
+		if s.Available <= 0 {
+			continue
+		}
+		take := min(s.Available, remaining)
+		allocations = append(allocations, Allocation{WarehouseId: s.WarehouseId, Quantity: int32(take)})
+		remaining -= take
+	}
+	if remaining > 0 {
+		return nil, ErrInsufficientStock
+	}
+	return allocations, nil
+}
@@ -0,0 +1,73 @@
+package item
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var testStock = []WarehouseStock{
+	{WarehouseId: 1, Available: 3},
+	{WarehouseId: 2, Available: 8},
+	{WarehouseId: 3, Available: 5},
+}
+
+func TestAllocatePreferredWarehouse(t *testing.T) {
+	got, err := AllocatePreferredWarehouse(3, testStock, 1)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if want := []Allocation{{WarehouseId: 1, Quantity: 3}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	got, err = AllocatePreferredWarehouse(4, testStock, 1)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if want := []Allocation{{WarehouseId: 2, Quantity: 4}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected fallback to most stock %v, got %v", want, got)
+	}
+}
+
+func TestAllocateMostStock(t *testing.T) {
+	got, err := AllocateMostStock(8, testStock, 0)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if want := []Allocation{{WarehouseId: 2, Quantity: 8}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	if _, err := AllocateMostStock(9, testStock, 0); !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("expected ErrInsufficientStock, got %v", err)
+	}
+}
+
+func TestAllocateSplit(t *testing.T) {
+	got, err := AllocateSplit(12, testStock, 1)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	want := []Allocation{{WarehouseId: 1, Quantity: 3}, {WarehouseId: 2, Quantity: 8}, {WarehouseId: 3, Quantity: 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	if _, err := AllocateSplit(17, testStock, 0); !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("expected ErrInsufficientStock, got %v", err)
+	}
+}
+
+func TestBackorderWarehouse(t *testing.T) {
+	stock := []WarehouseStock{{WarehouseId: 1}, {WarehouseId: 2}}
+	if w, _ := BackorderWarehouse(stock, 2); w != 2 {
+		t.Errorf("expected preferred warehouse 2, got %d", w)
+	}
+	if w, _ := BackorderWarehouse(stock, 9); w != 1 {
+		t.Errorf("expected first warehouse 1, got %d", w)
+	}
+	if _, err := BackorderWarehouse(nil, 1); err != ErrInsufficientStock {
+		t.Errorf("expected ErrInsufficientStock without warehouses, got %v", err)
+	}
+}
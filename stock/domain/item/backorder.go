@@ -0,0 +1,29 @@
+package item
+
+import "errors"
+
+var (
+	ErrBackorderCapExceeded   = errors.New("backorder cap exceeded")
+	ErrReservationBackordered = errors.New("reservation is waiting on a backorder")
+)
+
+// RestockResult reports the backorders a restock filled, oldest first, and
+// how much of the restocked quantity was left over as available stock.
+type RestockResult struct {
+	Allocated []Reservation
+	Available int32
+}
+
+// BackorderWarehouse picks the warehouse a backorder waits on: the preferred
+// one when it stocks the item, otherwise the first listed.
+func BackorderWarehouse(stock []WarehouseStock, preferredWarehouseId int32) (int32, error) {
+	if len(stock) == 0 {
+		return 0, ErrInsufficientStock
+	}
+	for _, s := range stock {
+		if s.WarehouseId == preferredWarehouseId {
+			return s.WarehouseId, nil
+		}
+	}
+	return stock[0].WarehouseId, nil
+}
@@ -1,16 +1,20 @@
 package item
 
 type Item struct {
-	Id int32
-	Price float64
-  InitialStock int32
-  Reservations []Reservation
+	Id           int32
+	Price        float64
+	InitialStock int32
+	Reservations []Reservation
+	// Backorderable items accept reservations beyond the available stock, up
+	// to BackorderCap units waiting for a restock at any time.
+	Backorderable bool
+	BackorderCap  int32
 }
 
 func (i *Item) GetAvailableStock() int32 {
 	availableStock := i.InitialStock
 	for _, reservation := range i.Reservations {
-		if reservation.Status != "canceled" {
+		if reservation.Status != "canceled" && reservation.Status != "backordered" {
 			availableStock -= reservation.Quantity
 		}
 	}
@@ -18,9 +22,10 @@ func (i *Item) GetAvailableStock() int32 {
 }
 
 type Reservation struct {
-	Id int32
-	TotalFee float64
-	Quantity int32
-	ItemId int32
-	Status string
-}
\ No newline at end of file
+	Id          int32
+	TotalFee    float64
+	Quantity    int32
+	ItemId      int32
+	Status      string
+	Allocations []Allocation
+}
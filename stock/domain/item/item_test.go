@@ -18,4 +18,8 @@ func TestGetAvailableStock(t *testing.T) {
 	if item.GetAvailableStock() != 5 {
 		t.Errorf("Expected available stock to be 5, got %d", item.GetAvailableStock())
 	}
+	item.Reservations = []Reservation{{Quantity: 5, Status: "backordered"}}
+	if item.GetAvailableStock() != 10 {
+		t.Errorf("Expected available stock to be 10, got %d", item.GetAvailableStock())
+	}
 }
\ No newline at end of file
@@ -0,0 +1,17 @@
+package item
+
+import (
+	"context"
+	"time"
+)
+
+// PurchaseLimiter tracks how much of an item each customer reserved within a
+// rolling window. Customers are told apart per tenant: the same customer id
+// in two tenants has two windows.
+type PurchaseLimiter interface {
+	// Acquire records quantity against the customer's window for the item if the
+	// total stays within limit. It returns ok=false when the limit would be
+	// exceeded, and a token that Release uses to give the quantity back.
+	Acquire(ctx context.Context, tenantId string, customerId string, itemId int32, quantity int32, limit int32, window time.Duration) (token string, ok bool, err error)
+	Release(ctx context.Context, tenantId string, customerId string, itemId int32, token string) error
+}
@@ -1,8 +1,13 @@
 package item
 
+import "context"
+
 type Repository interface {
-	GetItem(itemId int32) (*Item, error)
-  Reserve(reservationItem *Item, quantity int32) (*Reservation, error)
-  ReleaseReservation(reservationId int32) error
-	CompleteReservation(reservationId int32) error
-}
\ No newline at end of file
+	GetItem(ctx context.Context, itemId int32) (*Item, error)
+	GetWarehouseStock(ctx context.Context, itemId int32) ([]WarehouseStock, error)
+	Reserve(ctx context.Context, reservationItem *Item, allocations []Allocation) (*Reservation, error)
+	Backorder(ctx context.Context, reservationItem *Item, warehouseId int32, quantity int32) (*Reservation, error)
+	Restock(ctx context.Context, itemId int32, warehouseId int32, quantity int32) (*RestockResult, error)
+	ReleaseReservation(ctx context.Context, reservationId int32) error
+	CompleteReservation(ctx context.Context, reservationId int32) error
+}
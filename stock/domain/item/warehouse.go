@@ -0,0 +1,31 @@
+package item
+
+type Warehouse struct {
+	Id   int32
+	Name string
+}
+
+// StockKey identifies the stock counter of an item in one warehouse.
+type StockKey struct {
+	ItemId      int32
+	WarehouseId int32
+}
+
+// WarehouseStock is the quantity of an item currently available in a warehouse.
+type WarehouseStock struct {
+	WarehouseId int32
+	Available   int64
+}
+
+// Allocation is the part of a reservation taken from one warehouse.
+type Allocation struct {
+	WarehouseId int32
+	Quantity    int32
+}
+
+// StockCounters are the live counters kept for an item in one warehouse:
+// units available to reserve and units on backorder waiting for a restock.
+type StockCounters struct {
+	Available   int64
+	Backordered int64
+}
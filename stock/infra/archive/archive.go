@@ -0,0 +1,209 @@
+package archive
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/giovaniif/e-commerce/stock/infra/projections"
+	"github.com/lib/pq"
+)
+
+// notOpen filters out events of reservations still reserved or on backorder.
+const notOpen = `reservation_id NOT IN (SELECT reservation_id FROM reservations WHERE status IN ('reserved', 'backordered'))`
+
+type event struct {
+	Id            int64     `json:"id"`
+	ReservationId int64     `json:"reservation_id"`
+	ItemId        int32     `json:"item_id"`
+	WarehouseId   int32     `json:"warehouse_id"`
+	EventType     string    `json:"event_type"`
+	Quantity      int32     `json:"quantity"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Archiver moves stock_events older than a horizon out of the hot table.
+// Only events covered by the latest snapshot are eligible, so projections can
+// always be rebuilt from the snapshot plus what stays in stock_events. Events
+// of reservations still open stay behind: release and restock read them.
+type Archiver struct {
+	db        *sql.DB
+	batchSize int
+}
+
+func NewArchiver(db *sql.DB, batchSize int) *Archiver {
+	return &Archiver{db: db, batchSize: batchSize}
+}
+
+// ArchiveToTables moves eligible events into the monthly partitions of
+// stock_events_archive, creating partitions as needed. Returns the number of
+// events moved.
+func (a *Archiver) ArchiveToTables(ctx context.Context, before time.Time) (int64, error) {
+	upTo, err := projections.LatestSnapshotId(ctx, a.db)
+	if err != nil || upTo == 0 {
+		return 0, err
+	}
+	if err := a.ensurePartitions(ctx, upTo, before); err != nil {
+		return 0, err
+	}
+	var moved int64
+	for {
+		res, err := a.db.ExecContext(ctx, `
+			WITH moved AS (
+				DELETE FROM stock_events
+				WHERE id IN (
+					SELECT id FROM stock_events
+					WHERE id <= $1 AND created_at < $2 AND `+notOpen+`
+					ORDER BY id
+					LIMIT $3
+				)
+				RETURNING id, reservation_id, item_id, warehouse_id, event_type, quantity, created_at
+			)
+			INSERT INTO stock_events_archive (id, reservation_id, item_id, warehouse_id, event_type, quantity, created_at)
+			SELECT id, reservation_id, item_id, warehouse_id, event_type, quantity, created_at FROM moved
+		`, upTo, before, a.batchSize)
+		if err != nil {
+			return moved, fmt.Errorf("archive batch: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return moved, err
+		}
+		moved += n
+		if n < int64(a.batchSize) {
+			return moved, nil
+		}
+	}
+}
+
+func (a *Archiver) ensurePartitions(ctx context.Context, upTo int64, before time.Time) error {
+	rows, err := a.db.QueryContext(ctx, `
+		SELECT DISTINCT date_trunc('month', created_at AT TIME ZONE 'UTC')
+		FROM stock_events WHERE id <= $1 AND created_at < $2 AND `+notOpen+`
+	`, upTo, before)
+	if err != nil {
+		return fmt.Errorf("list archive months: %w", err)
+	}
+	var months []time.Time
+	for rows.Next() {
+		var m time.Time
+		if err := rows.Scan(&m); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan archive month: %w", err)
+		}
+		months = append(months, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, m := range months {
+		from := time.Date(m.Year(), m.Month(), 1, 0, 0, 0, 0, time.UTC)
+		to := from.AddDate(0, 1, 0)
+		stmt := fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS stock_events_archive_%s PARTITION OF stock_events_archive FOR VALUES FROM ('%s') TO ('%s')`,
+			from.Format("200601"), from.Format(time.RFC3339), to.Format(time.RFC3339),
+		)
+		if _, err := a.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("create archive partition %s: %w", from.Format("200601"), err)
+		}
+	}
+	return nil
+}
+
+// ArchiveToFiles writes eligible events to gzip-compressed JSON lines files in
+// dir, one file per batch, and deletes them from stock_events once the file is
+// synced. A crash between the two steps leaves events in both places, never in
+// neither. Returns the number of events moved.
+func (a *Archiver) ArchiveToFiles(ctx context.Context, before time.Time, dir string) (int64, error) {
+	upTo, err := projections.LatestSnapshotId(ctx, a.db)
+	if err != nil || upTo == 0 {
+		return 0, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, err
+	}
+	var moved int64
+	for {
+		events, err := a.loadBatch(ctx, upTo, before)
+		if err != nil {
+			return moved, err
+		}
+		if len(events) == 0 {
+			return moved, nil
+		}
+		first, last := events[0].Id, events[len(events)-1].Id
+		name := filepath.Join(dir, fmt.Sprintf("stock_events_%020d_%020d.jsonl.gz", first, last))
+		if err := writeFile(name, events); err != nil {
+			return moved, err
+		}
+		// Delete exactly what was written: a reservation may have closed since.
+		ids := make([]int64, len(events))
+		for i, e := range events {
+			ids[i] = e.Id
+		}
+		res, err := a.db.ExecContext(ctx, `DELETE FROM stock_events WHERE id = ANY($1)`, pq.Array(ids))
+		if err != nil {
+			return moved, fmt.Errorf("delete archived events: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		moved += n
+		if len(events) < a.batchSize {
+			return moved, nil
+		}
+	}
+}
+
+func (a *Archiver) loadBatch(ctx context.Context, upTo int64, before time.Time) ([]event, error) {
+	rows, err := a.db.QueryContext(ctx, `
+		SELECT id, reservation_id, item_id, warehouse_id, event_type, quantity, created_at
+		FROM stock_events
+		WHERE id <= $1 AND created_at < $2 AND `+notOpen+`
+		ORDER BY id
+		LIMIT $3
+	`, upTo, before, a.batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("load archive batch: %w", err)
+	}
+	defer rows.Close()
+	var events []event
+	for rows.Next() {
+		var e event
+		if err := rows.Scan(&e.Id, &e.ReservationId, &e.ItemId, &e.WarehouseId, &e.EventType, &e.Quantity, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan archive event: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func writeFile(name string, events []event) error {
+	tmp := name + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	enc := json.NewEncoder(zw)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("encode archive event: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
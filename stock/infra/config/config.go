@@ -0,0 +1,274 @@
+// Package config loads the Stock service configuration. Every setting has a
+// default, can be set in the YAML file named by CONFIG_FILE, and is
+// overridden by its environment variable, read from the process environment
+// or from a .env file (ENV_FILE, default .env). Load validates the result and
+// reports every problem at once.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/giovaniif/e-commerce/stock/domain/item"
+	"github.com/giovaniif/e-commerce/stock/infra/faults"
+)
+
+type Config struct {
+	Env             string        `yaml:"env"`
+	Port            int           `yaml:"port"`
+	GRPCPort        int           `yaml:"grpc_port"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// AdminEnabled serves GET /admin/config (ADMIN_ENABLED).
+	AdminEnabled bool `yaml:"admin_enabled"`
+	// AdminToken is the bearer token the /admin routes require
+	// (ADMIN_TOKEN); without one they refuse every call.
+	AdminToken string `yaml:"admin_token"`
+	// Faults injects failures for chaos tests; never in production.
+	Faults FaultsConfig `yaml:"faults"`
+	// ServiceAuth requires Order to sign its calls.
+	ServiceAuth ServiceAuthConfig `yaml:"service_auth"`
+
+	Postgres  PostgresConfig `yaml:"postgres"`
+	RedisAddr string         `yaml:"redis_addr"`
+
+	// InitialQuantity, when set, replaces the seeded initial stock of every
+	// item on a database with no stock events yet, split evenly across the
+	// warehouses (STOCK_INITIAL_QUANTITY). Zero keeps the seeded catalog.
+	InitialQuantity int64 `yaml:"initial_quantity"`
+
+	Journal   JournalConfig   `yaml:"journal"`
+	Projector ProjectorConfig `yaml:"projector"`
+	Reserve   ReserveConfig   `yaml:"reserve"`
+
+	LokiURL      string `yaml:"loki_url"`
+	OTLPEndpoint string `yaml:"otlp_endpoint"`
+}
+
+type PostgresConfig struct {
+	URL             string        `yaml:"url"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+// JournalConfig tunes how stock events move from the Redis Stream to
+// Postgres.
+type JournalConfig struct {
+	Interval  time.Duration `yaml:"interval"`
+	BatchSize int           `yaml:"batch_size"`
+	QueueSize int           `yaml:"queue_size"`
+}
+
+type ProjectorConfig struct {
+	Interval         time.Duration `yaml:"interval"`
+	BatchSize        int           `yaml:"batch_size"`
+	SnapshotInterval time.Duration `yaml:"snapshot_interval"`
+}
+
+// ReserveConfig holds the reservation rules. PurchaseLimits caps how much of
+// an item one customer may hold within PurchaseLimitWindow.
+type ReserveConfig struct {
+	MaxQuantityPerLine  int             `yaml:"max_quantity_per_line"`
+	PurchaseLimitWindow time.Duration   `yaml:"purchase_limit_window"`
+	AllocationStrategy  string          `yaml:"allocation_strategy"`
+	PurchaseLimits      map[int32]int32 `yaml:"purchase_limits"`
+}
+
+// ServiceAuthConfig requires the reserve, release and complete endpoints to be signed with HMAC
+// (SERVICE_AUTH_ENABLED) by one of Keys (SERVICE_AUTH_KEYS,
+// "id:secret,..."), at most MaxSkew apart from our clock
+// (SERVICE_AUTH_MAX_SKEW_SECONDS). Listing two keys lets the callers move to
+// a new one.
+type ServiceAuthConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Keys    string        `yaml:"keys"`
+	MaxSkew time.Duration `yaml:"max_skew"`
+}
+
+// FaultsConfig turns fault injection on (FAULTS_ENABLED) and sets the rules
+// it starts with (FAULTS, a JSON list); PUT /admin/faults replaces them at
+// run time.
+type FaultsConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Rules   []faults.Rule `yaml:"rules"`
+}
+
+// minAdminTokenLength is the shortest ADMIN_TOKEN accepted, the same as a
+// service key's secret.
+const minAdminTokenLength = 32
+
+func defaults() Config {
+	return Config{
+		Port:            3133,
+		GRPCPort:        4133,
+		ShutdownTimeout: 10 * time.Second,
+		ServiceAuth:     ServiceAuthConfig{MaxSkew: 5 * time.Minute},
+		Postgres: PostgresConfig{
+			MaxOpenConns:    80,
+			MaxIdleConns:    40,
+			ConnMaxLifetime: 5 * time.Minute,
+		},
+		Journal: JournalConfig{
+			Interval:  100 * time.Millisecond,
+			BatchSize: 500,
+			QueueSize: 10000,
+		},
+		Projector: ProjectorConfig{
+			Interval:         time.Second,
+			BatchSize:        500,
+			SnapshotInterval: time.Minute,
+		},
+		Reserve: ReserveConfig{
+			MaxQuantityPerLine:  100,
+			PurchaseLimitWindow: 24 * time.Hour,
+			AllocationStrategy:  item.StrategyPreferredWarehouse,
+		},
+	}
+}
+
+// Load builds the configuration from defaults, the YAML file, .env and the
+// environment, and validates it.
+func Load() (Config, error) {
+	cfg := defaults()
+	if err := readYAML(&cfg); err != nil {
+		return Config{}, err
+	}
+	env, err := newSource()
+	if err != nil {
+		return Config{}, err
+	}
+	env.String("APP_ENV", &cfg.Env)
+	env.Int("PORT", &cfg.Port)
+	env.Int("GRPC_PORT", &cfg.GRPCPort)
+	env.Count("SHUTDOWN_TIMEOUT_SECONDS", time.Second, &cfg.ShutdownTimeout)
+	env.Bool("ADMIN_ENABLED", &cfg.AdminEnabled)
+	env.String("ADMIN_TOKEN", &cfg.AdminToken)
+	env.Bool("FAULTS_ENABLED", &cfg.Faults.Enabled)
+	if v, ok := env.lookup("FAULTS"); ok && v != "" {
+		rules, err := faults.ParseRules([]byte(v))
+		if err != nil {
+			env.fail("FAULTS", v, err)
+		}
+		cfg.Faults.Rules = rules
+	}
+	env.String("POSTGRES_URL", &cfg.Postgres.URL)
+	env.Int("POSTGRES_MAX_OPEN_CONNS", &cfg.Postgres.MaxOpenConns)
+	env.Int("POSTGRES_MAX_IDLE_CONNS", &cfg.Postgres.MaxIdleConns)
+	env.Count("POSTGRES_CONN_MAX_LIFETIME_SECONDS", time.Second, &cfg.Postgres.ConnMaxLifetime)
+	env.Bool("SERVICE_AUTH_ENABLED", &cfg.ServiceAuth.Enabled)
+	env.String("SERVICE_AUTH_KEYS", &cfg.ServiceAuth.Keys)
+	env.Count("SERVICE_AUTH_MAX_SKEW_SECONDS", time.Second, &cfg.ServiceAuth.MaxSkew)
+	env.String("REDIS_ADDR", &cfg.RedisAddr)
+	env.Int64("STOCK_INITIAL_QUANTITY", &cfg.InitialQuantity)
+	env.Count("STOCK_JOURNAL_INTERVAL_MS", time.Millisecond, &cfg.Journal.Interval)
+	env.Int("STOCK_JOURNAL_BATCH_SIZE", &cfg.Journal.BatchSize)
+	env.Int("STOCK_JOURNAL_QUEUE_SIZE", &cfg.Journal.QueueSize)
+	env.Count("STOCK_PROJECTOR_INTERVAL_MS", time.Millisecond, &cfg.Projector.Interval)
+	env.Int("STOCK_PROJECTOR_BATCH_SIZE", &cfg.Projector.BatchSize)
+	env.Count("STOCK_SNAPSHOT_INTERVAL_MS", time.Millisecond, &cfg.Projector.SnapshotInterval)
+	env.Int("STOCK_MAX_QUANTITY_PER_LINE", &cfg.Reserve.MaxQuantityPerLine)
+	env.Duration("STOCK_PURCHASE_LIMIT_WINDOW", &cfg.Reserve.PurchaseLimitWindow)
+	env.String("STOCK_ALLOCATION_STRATEGY", &cfg.Reserve.AllocationStrategy)
+	if v, ok := env.lookup("STOCK_PURCHASE_LIMITS"); ok && v != "" {
+		limits, err := parsePurchaseLimits(v)
+		if err != nil {
+			env.fail("STOCK_PURCHASE_LIMITS", v, err)
+		}
+		cfg.Reserve.PurchaseLimits = limits
+	}
+	env.String("LOKI_URL", &cfg.LokiURL)
+	env.String("OTEL_EXPORTER_OTLP_ENDPOINT", &cfg.OTLPEndpoint)
+	if err := env.err(); err != nil {
+		return Config{}, err
+	}
+	return cfg, cfg.validate()
+}
+
+// parsePurchaseLimits reads per-customer limits in the form "itemId:limit,...",
+// e.g. STOCK_PURCHASE_LIMITS=1:5,3:2.
+func parsePurchaseLimits(s string) (map[int32]int32, error) {
+	limits := make(map[int32]int32)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		itemStr, limitStr, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid purchase limit %q", pair)
+		}
+		itemId, err := strconv.ParseInt(strings.TrimSpace(itemStr), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid purchase limit item %q", itemStr)
+		}
+		limit, err := strconv.ParseInt(strings.TrimSpace(limitStr), 10, 32)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid purchase limit %q", limitStr)
+		}
+		limits[int32(itemId)] = int32(limit)
+	}
+	return limits, nil
+}
+
+func (cfg Config) validate() error {
+	var c checks
+	c.port("PORT", cfg.Port)
+	c.port("GRPC_PORT", cfg.GRPCPort)
+	c.add(cfg.GRPCPort != cfg.Port, "GRPC_PORT must differ from PORT")
+	c.duration("SHUTDOWN_TIMEOUT_SECONDS", cfg.ShutdownTimeout)
+	c.url("POSTGRES_URL", cfg.Postgres.URL, true)
+	c.positive("POSTGRES_MAX_OPEN_CONNS", cfg.Postgres.MaxOpenConns)
+	c.positive("POSTGRES_MAX_IDLE_CONNS", cfg.Postgres.MaxIdleConns)
+	c.add(cfg.Postgres.MaxIdleConns <= cfg.Postgres.MaxOpenConns, "POSTGRES_MAX_IDLE_CONNS %d exceeds POSTGRES_MAX_OPEN_CONNS %d", cfg.Postgres.MaxIdleConns, cfg.Postgres.MaxOpenConns)
+	c.duration("POSTGRES_CONN_MAX_LIFETIME_SECONDS", cfg.Postgres.ConnMaxLifetime)
+	c.add(cfg.RedisAddr != "", "REDIS_ADDR is required")
+	c.add(cfg.InitialQuantity >= 0, "STOCK_INITIAL_QUANTITY must not be negative, got %d", cfg.InitialQuantity)
+	c.duration("STOCK_JOURNAL_INTERVAL_MS", cfg.Journal.Interval)
+	c.positive("STOCK_JOURNAL_BATCH_SIZE", cfg.Journal.BatchSize)
+	c.positive("STOCK_JOURNAL_QUEUE_SIZE", cfg.Journal.QueueSize)
+	c.duration("STOCK_PROJECTOR_INTERVAL_MS", cfg.Projector.Interval)
+	c.positive("STOCK_PROJECTOR_BATCH_SIZE", cfg.Projector.BatchSize)
+	c.duration("STOCK_SNAPSHOT_INTERVAL_MS", cfg.Projector.SnapshotInterval)
+	c.add(cfg.Reserve.MaxQuantityPerLine >= 0 && cfg.Reserve.MaxQuantityPerLine <= 1<<31-1, "STOCK_MAX_QUANTITY_PER_LINE %d is out of range", cfg.Reserve.MaxQuantityPerLine)
+	c.duration("STOCK_PURCHASE_LIMIT_WINDOW", cfg.Reserve.PurchaseLimitWindow)
+	_, ok := item.StrategyByName(cfg.Reserve.AllocationStrategy)
+	c.add(ok, "STOCK_ALLOCATION_STRATEGY %q must be one of %s, %s, %s", cfg.Reserve.AllocationStrategy, item.StrategyPreferredWarehouse, item.StrategyMostStock, item.StrategySplit)
+	for itemId, limit := range cfg.Reserve.PurchaseLimits {
+		c.add(limit > 0, "purchase limit of item %d must be positive, got %d", itemId, limit)
+	}
+	if cfg.ServiceAuth.Enabled {
+		c.serviceKeys("SERVICE_AUTH_KEYS", cfg.ServiceAuth.Keys)
+		c.duration("SERVICE_AUTH_MAX_SKEW_SECONDS", cfg.ServiceAuth.MaxSkew)
+	} else {
+		c.add(cfg.Env != "production", "SERVICE_AUTH_ENABLED is required with APP_ENV=production")
+	}
+	c.url("LOKI_URL", cfg.LokiURL, false)
+	c.add(!cfg.AdminEnabled || cfg.AdminToken != "", "ADMIN_ENABLED needs ADMIN_TOKEN")
+	c.add(cfg.AdminToken == "" || len(cfg.AdminToken) >= minAdminTokenLength, "ADMIN_TOKEN must be at least %d characters", minAdminTokenLength)
+	if cfg.Faults.Enabled {
+		c.add(cfg.Env != "production", "FAULTS_ENABLED is not allowed with APP_ENV=production")
+		for _, r := range cfg.Faults.Rules {
+			if err := r.Validate(); err != nil {
+				c = append(c, fmt.Errorf("FAULTS: %w", err))
+			}
+		}
+	} else {
+		c.add(len(cfg.Faults.Rules) == 0, "FAULTS needs FAULTS_ENABLED=true")
+	}
+	return errors.Join(c...)
+}
+
+// Effective returns the configuration for display, with credentials in
+// connection URLs and service keys redacted.
+func (cfg Config) Effective() (map[string]any, error) {
+	cfg.ServiceAuth.Keys = redactKeys(cfg.ServiceAuth.Keys)
+	if cfg.AdminToken != "" {
+		cfg.AdminToken = "xxxxx"
+	}
+	cfg.Postgres.URL = redactURL(cfg.Postgres.URL)
+	cfg.LokiURL = redactURL(cfg.LokiURL)
+	return effective(cfg)
+}
@@ -0,0 +1,66 @@
+package gateways
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/giovaniif/e-commerce/stock/infra/requestid"
+	"github.com/redis/go-redis/v9"
+)
+
+// acquireScript keeps one sorted set per (tenant, item, customer) whose
+// members are "<token>:<quantity>" scored by acquisition time. Expired members
+// are trimmed, the remaining quantities summed and the new one added only if
+// the total stays within the limit — all in one round trip so concurrent
+// reserves for the same customer cannot both slip under the cap.
+var acquireScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local qty = tonumber(ARGV[3])
+local limit = tonumber(ARGV[4])
+local member = ARGV[5]
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local total = 0
+for _, m in ipairs(redis.call('ZRANGE', key, 0, -1)) do
+  total = total + tonumber(string.match(m, ':(%d+)$'))
+end
+if total + qty > limit then
+  return 0
+end
+redis.call('ZADD', key, now, member)
+redis.call('PEXPIRE', key, window)
+return 1
+`)
+
+type PurchaseLimiterRedis struct {
+	client *redis.Client
+}
+
+func NewPurchaseLimiterRedis(client *redis.Client) *PurchaseLimiterRedis {
+	return &PurchaseLimiterRedis{client: client}
+}
+
+// purchaseLimitKey escapes the tenant so that one holding a colon cannot
+// reach into another tenant's keys; the customer id comes last and needs none.
+func purchaseLimitKey(tenantId string, customerId string, itemId int32) string {
+	return fmt.Sprintf("stock:limit:%s:%d:%s", url.QueryEscape(tenantId), itemId, customerId)
+}
+
+func (p *PurchaseLimiterRedis) Acquire(ctx context.Context, tenantId string, customerId string, itemId int32, quantity int32, limit int32, window time.Duration) (string, bool, error) {
+	token := fmt.Sprintf("%s:%d", requestid.Generate(), quantity)
+	res, err := acquireScript.Run(ctx, p.client,
+		[]string{purchaseLimitKey(tenantId, customerId, itemId)},
+		time.Now().UnixMilli(), window.Milliseconds(), quantity, limit, token,
+	).Int()
+	if err != nil {
+		return "", false, fmt.Errorf("redis purchase limit: %w", err)
+	}
+	return token, res == 1, nil
+}
+
+func (p *PurchaseLimiterRedis) Release(ctx context.Context, tenantId string, customerId string, itemId int32, token string) error {
+	return p.client.ZRem(ctx, purchaseLimitKey(tenantId, customerId, itemId), token).Err()
+}
@@ -0,0 +1,58 @@
+package gateways
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestPurchaseLimiterRedis_KeepsTenantsApart(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	limiter := NewPurchaseLimiterRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+
+	acquire := func(tenantId, customerId string, itemId, quantity int32) (string, bool) {
+		t.Helper()
+		token, ok, err := limiter.Acquire(ctx, tenantId, customerId, itemId, quantity, 3, time.Hour)
+		if err != nil {
+			t.Fatalf("acquire: %v", err)
+		}
+		return token, ok
+	}
+
+	token, ok := acquire("acme", "customer-1", 1, 3)
+	if !ok {
+		t.Fatal("first acquire in acme refused")
+	}
+	if _, ok := acquire("acme", "customer-1", 1, 1); ok {
+		t.Fatal("acquire beyond the limit in acme allowed")
+	}
+	// The same customer id in another tenant is another customer.
+	if _, ok := acquire("globex", "customer-1", 1, 3); !ok {
+		t.Fatal("acquire in globex refused by acme's window")
+	}
+	// Nor can a tenant id with a colon land on acme's key for item 1.
+	if _, ok := acquire("acme:1", "customer-1", 1, 3); !ok {
+		t.Fatal("acquire in acme:1 refused by another tenant's window")
+	}
+	// A caller without tenants has a scope of its own, kept like any other.
+	if _, ok := acquire("", "customer-1", 1, 3); !ok {
+		t.Fatal("acquire without a tenant refused by a tenant's window")
+	}
+	if _, ok := acquire("", "customer-1", 1, 1); ok {
+		t.Fatal("acquire beyond the limit without a tenant allowed")
+	}
+	if !mr.Exists("stock:limit:acme:1:customer-1") || !mr.Exists("stock:limit:globex:1:customer-1") || !mr.Exists("stock:limit::1:customer-1") {
+		t.Errorf("keys = %v, want one per tenant", mr.Keys())
+	}
+
+	if err := limiter.Release(ctx, "acme", "customer-1", 1, token); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if _, ok := acquire("acme", "customer-1", 1, 3); !ok {
+		t.Fatal("acquire after release refused")
+	}
+}
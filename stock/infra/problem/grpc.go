@@ -0,0 +1,53 @@
+package problem
+
+import (
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Domain is the domain of the google.rpc.ErrorInfo a gRPC error carries;
+// its reason is the problem code.
+const Domain = "e-commerce"
+
+// grpcCodes are the gRPC codes the problem codes are answered with.
+var grpcCodes = map[string]codes.Code{
+	InvalidRequest:         codes.InvalidArgument,
+	Unauthenticated:        codes.Unauthenticated,
+	ItemNotFound:           codes.NotFound,
+	WarehouseNotFound:      codes.NotFound,
+	ReservationNotFound:    codes.NotFound,
+	InsufficientStock:      codes.FailedPrecondition,
+	PurchaseLimitExceeded:  codes.ResourceExhausted,
+	ReservationBackordered: codes.FailedPrecondition,
+	ReservationClosed:      codes.FailedPrecondition,
+	IdempotencyInProgress:  codes.Aborted,
+	IdempotencyKeyReused:   codes.FailedPrecondition,
+	PaymentDeclined:        codes.FailedPrecondition,
+	Timeout:                codes.DeadlineExceeded,
+	Unavailable:            codes.Unavailable,
+	Internal:               codes.Internal,
+}
+
+// GRPCStatus is the problem as a gRPC status, for the gRPC API to answer
+// with what the HTTP one would.
+func (d Details) GRPCStatus() *status.Status {
+	code, ok := grpcCodes[d.Code]
+	if !ok {
+		code = codes.Unknown
+	}
+	message := d.Detail
+	if message == "" {
+		message = d.Title
+	}
+	st, err := status.New(code, message).WithDetails(&errdetails.ErrorInfo{Reason: d.Code, Domain: Domain})
+	if err != nil {
+		return status.New(code, message)
+	}
+	return st
+}
+
+// Status returns the gRPC error for err.
+func (m Mapper) Status(err error) error {
+	return m.For(err).GRPCStatus().Err()
+}
@@ -0,0 +1,239 @@
+package projections
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const checkpointName = "stock"
+
+// Event is a row of stock_events as consumed by the projector.
+type Event struct {
+	Id            int64
+	ReservationId int64
+	ItemId        int32
+	WarehouseId   int32
+	Type          string
+	Quantity      int32
+	CreatedAt     time.Time
+}
+
+// tables names the projection tables an apply pass writes to, so a rebuild
+// can replay into shadow tables while the live ones keep serving reads.
+type tables struct {
+	reservations string
+	levels       string
+}
+
+var liveTables = tables{reservations: "reservations", levels: "item_stock_levels"}
+
+// Event sources for loadEvents. The full history includes events moved to the
+// archive tables; the live projector only ever needs stock_events.
+const (
+	liveEvents = "stock_events"
+	allEvents  = `(SELECT id, reservation_id, item_id, warehouse_id, event_type, quantity, created_at FROM stock_events
+		UNION ALL
+		SELECT id, reservation_id, item_id, warehouse_id, event_type, quantity, created_at FROM stock_events_archive) e`
+)
+
+// Projector keeps the reservations and item_stock_levels tables up to date
+// with stock_events. Progress is stored in projection_checkpoints; the
+// checkpoint row is locked for the duration of a batch so several replicas
+// can run a projector without applying the same event twice. Writers insert
+// under repositories.StockEventsLockId, so ids commit in order and no event
+// can show up below the checkpoint once it has moved past.
+type Projector struct {
+	db        *sql.DB
+	batchSize int
+	interval  time.Duration
+}
+
+func NewProjector(db *sql.DB, batchSize int, interval time.Duration) *Projector {
+	return &Projector{db: db, batchSize: batchSize, interval: interval}
+}
+
+// Run applies batches until ctx is cancelled. While batches come back full it
+// keeps going without waiting for the next tick so it can catch up quickly.
+func (p *Projector) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		applied, err := p.ApplyBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("projector batch failed", "error", err)
+		}
+		if err == nil && applied == p.batchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ApplyBatch applies up to batchSize events after the checkpoint in a single
+// transaction and returns how many were applied.
+func (p *Projector) ApplyBatch(ctx context.Context) (int, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin projector tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var checkpoint int64
+	if err := tx.QueryRowContext(ctx, `SELECT last_event_id FROM projection_checkpoints WHERE name = $1 FOR UPDATE`, checkpointName).Scan(&checkpoint); err != nil {
+		return 0, fmt.Errorf("lock checkpoint: %w", err)
+	}
+	if err := seedLevels(ctx, tx, liveTables); err != nil {
+		return 0, err
+	}
+	events, err := loadEvents(ctx, tx, liveEvents, checkpoint, p.batchSize)
+	if err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+	if err := applyEvents(ctx, tx, liveTables, events); err != nil {
+		return 0, err
+	}
+	if err := saveCheckpoint(ctx, tx, events[len(events)-1].Id); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit projector tx: %w", err)
+	}
+	return len(events), nil
+}
+
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func loadEvents(ctx context.Context, q querier, source string, afterId int64, limit int) ([]Event, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, reservation_id, item_id, warehouse_id, event_type, quantity, created_at
+		FROM `+source+`
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2
+	`, afterId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("load events: %w", err)
+	}
+	defer rows.Close()
+	var events []Event
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.Id, &e.ReservationId, &e.ItemId, &e.WarehouseId, &e.Type, &e.Quantity, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan event: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// seedLevels makes sure every item has a stock level row per warehouse to
+// adjust, starting from its initial stock there.
+func seedLevels(ctx context.Context, q querier, t tables) error {
+	_, err := q.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO %s (item_id, warehouse_id, available)
+		SELECT item_id, warehouse_id, initial_stock FROM item_warehouse_stock
+		ON CONFLICT (item_id, warehouse_id) DO NOTHING
+	`, t.levels))
+	if err != nil {
+		return fmt.Errorf("seed stock levels: %w", err)
+	}
+	return nil
+}
+
+func applyEvents(ctx context.Context, q querier, t tables, events []Event) error {
+	for _, e := range events {
+		if err := applyEvent(ctx, q, t, e); err != nil {
+			return fmt.Errorf("apply event %d: %w", e.Id, err)
+		}
+	}
+	return nil
+}
+
+// transitions maps each reservation event to the status change it makes and
+// how it moves the stock level of the warehouse. Transitions only apply to
+// reservations in the from state, so a duplicated release or complete does
+// not move stock twice.
+var transitions = map[string]struct {
+	from, to                                        string
+	dAvailable, dReserved, dCompleted, dBackordered int64
+}{
+	"released":           {from: "reserved", to: "canceled", dAvailable: 1, dReserved: -1},
+	"completed":          {from: "reserved", to: "completed", dReserved: -1, dCompleted: 1},
+	"allocated":          {from: "backordered", to: "reserved", dAvailable: -1, dReserved: 1, dBackordered: -1},
+	"backorder_canceled": {from: "backordered", to: "canceled", dBackordered: -1},
+}
+
+// applyEvent folds one event into the projections.
+func applyEvent(ctx context.Context, q querier, t tables, e Event) error {
+	var (
+		res                                             sql.Result
+		err                                             error
+		dAvailable, dReserved, dCompleted, dBackordered int64
+	)
+	qty := int64(e.Quantity)
+	switch e.Type {
+	case "reserved", "backordered":
+		res, err = q.ExecContext(ctx, fmt.Sprintf(`
+			INSERT INTO %s (reservation_id, warehouse_id, item_id, quantity, status, last_event_id, reserved_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+			ON CONFLICT (reservation_id, warehouse_id) DO NOTHING
+		`, t.reservations), e.ReservationId, e.WarehouseId, e.ItemId, e.Quantity, e.Type, e.Id, e.CreatedAt)
+		if e.Type == "reserved" {
+			dAvailable, dReserved = -qty, qty
+		} else {
+			dBackordered = qty
+		}
+	case "restocked":
+		// Not tied to a reservation; only the stock level moves.
+		dAvailable = qty
+	default:
+		tr, ok := transitions[e.Type]
+		if !ok {
+			return fmt.Errorf("unknown event type %q", e.Type)
+		}
+		res, err = q.ExecContext(ctx, fmt.Sprintf(`
+			UPDATE %s SET status = $5, last_event_id = $3, updated_at = $4
+			WHERE reservation_id = $1 AND warehouse_id = $2 AND status = $6
+		`, t.reservations), e.ReservationId, e.WarehouseId, e.Id, e.CreatedAt, tr.to, tr.from)
+		dAvailable, dReserved, dCompleted, dBackordered = tr.dAvailable*qty, tr.dReserved*qty, tr.dCompleted*qty, tr.dBackordered*qty
+	}
+	if err != nil {
+		return err
+	}
+	if res != nil {
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+	}
+	_, err = q.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE %s
+		SET available = available + $3, reserved = reserved + $4, completed = completed + $5,
+		    backordered = backordered + $6, last_event_id = $7, updated_at = $8
+		WHERE item_id = $1 AND warehouse_id = $2
+	`, t.levels), e.ItemId, e.WarehouseId, dAvailable, dReserved, dCompleted, dBackordered, e.Id, e.CreatedAt)
+	return err
+}
+
+func saveCheckpoint(ctx context.Context, q querier, lastEventId int64) error {
+	_, err := q.ExecContext(ctx, `
+		UPDATE projection_checkpoints SET last_event_id = $2, updated_at = NOW() WHERE name = $1
+	`, checkpointName, lastEventId)
+	if err != nil {
+		return fmt.Errorf("save checkpoint: %w", err)
+	}
+	return nil
+}
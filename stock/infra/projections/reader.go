@@ -0,0 +1,112 @@
+package projections
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/giovaniif/e-commerce/stock/domain/item"
+	"github.com/giovaniif/e-commerce/stock/infra/repositories"
+)
+
+var ErrReservationNotFound = errors.New("reservation not found")
+
+type StockLevel struct {
+	ItemId      int32
+	Available   int64
+	Reserved    int64
+	Completed   int64
+	Backordered int64
+	LastEventId int64
+	Warehouses  []WarehouseStockLevel
+}
+
+type WarehouseStockLevel struct {
+	WarehouseId int32
+	Available   int64
+	Reserved    int64
+	Completed   int64
+	Backordered int64
+}
+
+// Reader serves reservation and stock level reads from the projections
+// instead of scanning stock_events. Results lag the event log by at most one
+// projector interval.
+type Reader struct {
+	db *sql.DB
+}
+
+func NewReader(db *sql.DB) *Reader {
+	return &Reader{db: db}
+}
+
+// GetReservation folds the per-warehouse rows of a reservation into one.
+func (r *Reader) GetReservation(ctx context.Context, reservationId int32) (*item.Reservation, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT r.reservation_id, r.item_id, r.warehouse_id, r.quantity, r.status, i.price
+		FROM reservations r JOIN items i ON i.id = r.item_id
+		WHERE r.reservation_id = $1
+		ORDER BY r.warehouse_id
+	`, reservationId)
+	if err != nil {
+		return nil, fmt.Errorf("get reservation: %w", err)
+	}
+	defer rows.Close()
+	var res *item.Reservation
+	for rows.Next() {
+		var a item.Allocation
+		var id, itemId int32
+		var status string
+		var price float64
+		if err := rows.Scan(&id, &itemId, &a.WarehouseId, &a.Quantity, &status, &price); err != nil {
+			return nil, fmt.Errorf("get reservation: %w", err)
+		}
+		if res == nil {
+			res = &item.Reservation{Id: id, ItemId: itemId, Status: status}
+		}
+		res.Quantity += a.Quantity
+		res.TotalFee += float64(a.Quantity) * price
+		res.Allocations = append(res.Allocations, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("get reservation: %w", err)
+	}
+	if res == nil {
+		return nil, ErrReservationNotFound
+	}
+	return res, nil
+}
+
+func (r *Reader) GetStockLevel(ctx context.Context, itemId int32) (*StockLevel, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT warehouse_id, available, reserved, completed, backordered, last_event_id
+		FROM item_stock_levels WHERE item_id = $1
+		ORDER BY warehouse_id
+	`, itemId)
+	if err != nil {
+		return nil, fmt.Errorf("get stock level: %w", err)
+	}
+	defer rows.Close()
+	level := StockLevel{ItemId: itemId}
+	for rows.Next() {
+		var w WarehouseStockLevel
+		var lastEventId int64
+		if err := rows.Scan(&w.WarehouseId, &w.Available, &w.Reserved, &w.Completed, &w.Backordered, &lastEventId); err != nil {
+			return nil, fmt.Errorf("get stock level: %w", err)
+		}
+		level.Available += w.Available
+		level.Reserved += w.Reserved
+		level.Completed += w.Completed
+		level.Backordered += w.Backordered
+		level.LastEventId = max(level.LastEventId, lastEventId)
+		level.Warehouses = append(level.Warehouses, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("get stock level: %w", err)
+	}
+	if len(level.Warehouses) == 0 {
+		return nil, repositories.ErrItemNotFound
+	}
+	return &level, nil
+}
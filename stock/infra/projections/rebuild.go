@@ -0,0 +1,158 @@
+package projections
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+var rebuildTables = tables{reservations: "reservations_rebuild", levels: "item_stock_levels_rebuild"}
+
+// Rebuild replays the full event history, archive tables included, from the
+// first event into fresh shadow tables and swaps them in place of the live
+// projections. Returns the id of the last event applied.
+func Rebuild(ctx context.Context, db *sql.DB, batchSize int) (int64, error) {
+	return rebuild(ctx, db, batchSize, func(ctx context.Context) (int64, error) {
+		return 0, seedLevels(ctx, db, rebuildTables)
+	})
+}
+
+// RebuildFromSnapshot seeds the shadow tables from the latest snapshot and
+// only replays the events after it, so it works after older events have been
+// archived. Only the reservations open at the snapshot are carried over; those
+// closed before it are left out of the rebuilt table. Falls back to a full
+// rebuild when no snapshot has been taken yet.
+func RebuildFromSnapshot(ctx context.Context, db *sql.DB, batchSize int) (int64, error) {
+	return rebuild(ctx, db, batchSize, func(ctx context.Context) (int64, error) {
+		snapshotId, err := latestSnapshotId(ctx, db)
+		if err != nil {
+			return 0, err
+		}
+		if snapshotId > 0 {
+			if err := seedFromSnapshot(ctx, db, snapshotId); err != nil {
+				return 0, err
+			}
+		}
+		return snapshotId, seedLevels(ctx, db, rebuildTables)
+	})
+}
+
+// rebuild runs the bulk of the replay without blocking the live projector;
+// only the final catch-up and the swap hold the checkpoint lock. seed fills
+// the shadow tables and returns the event id the replay starts after.
+func rebuild(ctx context.Context, db *sql.DB, batchSize int, seed func(context.Context) (int64, error)) (int64, error) {
+	if err := createShadowTables(ctx, db); err != nil {
+		return 0, err
+	}
+	last, err := seed(ctx)
+	if err != nil {
+		return 0, err
+	}
+	source := allEvents
+	if last > 0 {
+		source = liveEvents
+	}
+	for {
+		applied, err := replayBatch(ctx, db, source, &last, batchSize)
+		if err != nil {
+			return 0, err
+		}
+		if applied < batchSize {
+			break
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin swap tx: %w", err)
+	}
+	defer tx.Rollback()
+	var checkpoint int64
+	if err := tx.QueryRowContext(ctx, `SELECT last_event_id FROM projection_checkpoints WHERE name = $1 FOR UPDATE`, checkpointName).Scan(&checkpoint); err != nil {
+		return 0, fmt.Errorf("lock checkpoint: %w", err)
+	}
+	for {
+		events, err := loadEvents(ctx, tx, liveEvents, last, batchSize)
+		if err != nil {
+			return 0, err
+		}
+		if len(events) == 0 {
+			break
+		}
+		if err := applyEvents(ctx, tx, rebuildTables, events); err != nil {
+			return 0, err
+		}
+		last = events[len(events)-1].Id
+	}
+	for _, stmt := range []string{
+		`DROP TABLE reservations`,
+		`ALTER TABLE reservations_rebuild RENAME TO reservations`,
+		`DROP TABLE item_stock_levels`,
+		`ALTER TABLE item_stock_levels_rebuild RENAME TO item_stock_levels`,
+	} {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return 0, fmt.Errorf("swap projections: %w", err)
+		}
+	}
+	if err := saveCheckpoint(ctx, tx, last); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit swap tx: %w", err)
+	}
+	return last, nil
+}
+
+func createShadowTables(ctx context.Context, db *sql.DB) error {
+	for _, stmt := range []string{
+		`DROP TABLE IF EXISTS reservations_rebuild`,
+		`DROP TABLE IF EXISTS item_stock_levels_rebuild`,
+		`CREATE TABLE reservations_rebuild (LIKE reservations INCLUDING ALL)`,
+		`CREATE TABLE item_stock_levels_rebuild (LIKE item_stock_levels INCLUDING ALL)`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("create shadow tables: %w", err)
+		}
+	}
+	return nil
+}
+
+func seedFromSnapshot(ctx context.Context, db *sql.DB, snapshotId int64) error {
+	for _, stmt := range []string{
+		`INSERT INTO item_stock_levels_rebuild (item_id, warehouse_id, available, reserved, completed, backordered, last_event_id, updated_at)
+		 SELECT DISTINCT ON (item_id, warehouse_id) item_id, warehouse_id, available, reserved, completed, backordered, event_id, created_at
+		 FROM item_stock_snapshots WHERE event_id <= $1
+		 ORDER BY item_id, warehouse_id, event_id DESC`,
+		`INSERT INTO reservations_rebuild (reservation_id, warehouse_id, item_id, quantity, status, last_event_id, reserved_at, updated_at)
+		 SELECT reservation_id, warehouse_id, item_id, quantity, status, last_event_id, reserved_at, reserved_at
+		 FROM reservation_snapshots WHERE event_id = $1 AND status IN ('reserved', 'backordered')`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt, snapshotId); err != nil {
+			return fmt.Errorf("seed from snapshot %d: %w", snapshotId, err)
+		}
+	}
+	return nil
+}
+
+func replayBatch(ctx context.Context, db *sql.DB, source string, last *int64, batchSize int) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin replay tx: %w", err)
+	}
+	defer tx.Rollback()
+	events, err := loadEvents(ctx, tx, source, *last, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+	if err := applyEvents(ctx, tx, rebuildTables, events); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit replay tx: %w", err)
+	}
+	*last = events[len(events)-1].Id
+	return len(events), nil
+}
@@ -0,0 +1,159 @@
+package projections
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/giovaniif/e-commerce/stock/domain/item"
+)
+
+// Snapshotter periodically records the projected stock level of every item
+// that changed since its previous snapshot, plus the reservations still open,
+// at the current projector checkpoint. Snapshots bound how much of the log a
+// rebuild or a counter reseed has to read and let older events be archived.
+type Snapshotter struct {
+	db       *sql.DB
+	interval time.Duration
+}
+
+func NewSnapshotter(db *sql.DB, interval time.Duration) *Snapshotter {
+	return &Snapshotter{db: db, interval: interval}
+}
+
+func (s *Snapshotter) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := s.TakeSnapshot(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("stock snapshot failed", "error", err)
+		}
+	}
+}
+
+// TakeSnapshot writes a snapshot at the projector checkpoint and returns its
+// event id, or 0 when nothing changed since the last one. Holding the
+// checkpoint lock keeps the projections still while they are copied. The
+// snapshot is recorded, and the previous one pruned, in the same transaction
+// as its rows, so a rebuild never finds item levels and open reservations
+// from different points of the log.
+func (s *Snapshotter) TakeSnapshot(ctx context.Context) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin snapshot tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var checkpoint int64
+	if err := tx.QueryRowContext(ctx, `SELECT last_event_id FROM projection_checkpoints WHERE name = $1 FOR UPDATE`, checkpointName).Scan(&checkpoint); err != nil {
+		return 0, fmt.Errorf("lock checkpoint: %w", err)
+	}
+	latest, err := latestSnapshotId(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	if checkpoint == 0 || checkpoint <= latest {
+		return 0, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO stock_snapshots (event_id) VALUES ($1)`, checkpoint); err != nil {
+		return 0, fmt.Errorf("record snapshot: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO item_stock_snapshots (item_id, warehouse_id, event_id, available, reserved, completed, backordered)
+		SELECT l.item_id, l.warehouse_id, $1, l.available, l.reserved, l.completed, l.backordered
+		FROM item_stock_levels l
+		WHERE l.last_event_id > COALESCE((
+			SELECT MAX(s.event_id) FROM item_stock_snapshots s
+			WHERE s.item_id = l.item_id AND s.warehouse_id = l.warehouse_id
+		), -1)
+	`, checkpoint); err != nil {
+		return 0, fmt.Errorf("snapshot stock levels: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO reservation_snapshots (event_id, reservation_id, warehouse_id, item_id, quantity, status, last_event_id, reserved_at)
+		SELECT $1, reservation_id, warehouse_id, item_id, quantity, status, last_event_id, reserved_at
+		FROM reservations WHERE status IN ('reserved', 'backordered')
+	`, checkpoint); err != nil {
+		return 0, fmt.Errorf("snapshot open reservations: %w", err)
+	}
+	// Only the latest snapshot is ever read back: its open reservations, and
+	// for each location the newest level at or before it.
+	for _, stmt := range []string{
+		`DELETE FROM stock_snapshots WHERE event_id < $1`,
+		`DELETE FROM reservation_snapshots WHERE event_id < $1`,
+		`DELETE FROM item_stock_snapshots s
+		 WHERE s.event_id < $1 AND EXISTS (
+			SELECT 1 FROM item_stock_snapshots n
+			WHERE n.item_id = s.item_id AND n.warehouse_id = s.warehouse_id AND n.event_id > s.event_id
+		 )`,
+	} {
+		if _, err := tx.ExecContext(ctx, stmt, checkpoint); err != nil {
+			return 0, fmt.Errorf("prune snapshots: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit snapshot tx: %w", err)
+	}
+	return checkpoint, nil
+}
+
+func latestSnapshotId(ctx context.Context, q querier) (int64, error) {
+	var id int64
+	if err := q.QueryRowContext(ctx, `SELECT COALESCE(MAX(event_id), 0) FROM stock_snapshots`).Scan(&id); err != nil {
+		return 0, fmt.Errorf("latest snapshot: %w", err)
+	}
+	return id, nil
+}
+
+// LatestSnapshotId returns the event id of the most recent snapshot, 0 if none.
+func LatestSnapshotId(ctx context.Context, db *sql.DB) (int64, error) {
+	return latestSnapshotId(ctx, db)
+}
+
+// LoadStockCounters computes the current available and backordered stock
+// per item and warehouse from the latest snapshot of each plus the events
+// recorded after it, without replaying the log from the beginning. Locations
+// never snapshotted start from their initial stock.
+func LoadStockCounters(ctx context.Context, db *sql.DB) (map[item.StockKey]item.StockCounters, error) {
+	rows, err := db.QueryContext(ctx, `
+		WITH latest AS (
+			SELECT DISTINCT ON (item_id, warehouse_id) item_id, warehouse_id, event_id, available, backordered
+			FROM item_stock_snapshots
+			ORDER BY item_id, warehouse_id, event_id DESC
+		)
+		SELECT s.item_id, s.warehouse_id,
+		       COALESCE(l.available, s.initial_stock)
+		       - COALESCE(SUM(e.quantity) FILTER (WHERE e.event_type IN ('reserved', 'allocated')), 0)
+		       + COALESCE(SUM(e.quantity) FILTER (WHERE e.event_type IN ('released', 'restocked')), 0),
+		       COALESCE(l.backordered, 0)
+		       + COALESCE(SUM(e.quantity) FILTER (WHERE e.event_type = 'backordered'), 0)
+		       - COALESCE(SUM(e.quantity) FILTER (WHERE e.event_type IN ('allocated', 'backorder_canceled')), 0)
+		FROM item_warehouse_stock s
+		LEFT JOIN latest l ON l.item_id = s.item_id AND l.warehouse_id = s.warehouse_id
+		LEFT JOIN stock_events e ON e.item_id = s.item_id AND e.warehouse_id = s.warehouse_id
+		     AND e.id > COALESCE(l.event_id, 0)
+		GROUP BY s.item_id, s.warehouse_id, l.available, l.backordered, s.initial_stock
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("load stock counters: %w", err)
+	}
+	defer rows.Close()
+	counters := make(map[item.StockKey]item.StockCounters)
+	for rows.Next() {
+		var key item.StockKey
+		var c item.StockCounters
+		if err := rows.Scan(&key.ItemId, &key.WarehouseId, &c.Available, &c.Backordered); err != nil {
+			return nil, fmt.Errorf("scan stock counters: %w", err)
+		}
+		counters[key] = c
+	}
+	return counters, rows.Err()
+}
@@ -0,0 +1,259 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/giovaniif/e-commerce/stock/infra/metrics"
+	"github.com/lib/pq"
+)
+
+var ErrEventWriterClosed = errors.New("event writer closed")
+
+const (
+	flushRetryMin = 100 * time.Millisecond
+	flushRetryMax = 5 * time.Second
+)
+
+// StockEventsLockId is the Postgres advisory lock every transaction writing
+// stock_events holds from before its first insert until it commits. Ids are
+// then handed out in commit order, so a reader that has seen an id has seen
+// every lower one that will ever exist, even across a journal leader change.
+const StockEventsLockId = 7_100_032
+
+// StockEvent is a row bound for stock_events. JournalId is the stream entry
+// it came from and makes writing it more than once harmless.
+type StockEvent struct {
+	JournalId     string
+	ReservationId int64
+	ItemId        int64
+	WarehouseId   int64
+	EventType     string
+	Quantity      int64
+}
+
+// EventWriter queues stock events and writes them to Postgres in batches with
+// COPY, flushing when a batch fills up or the flush interval passes, whichever
+// comes first. The queue is bounded: Write blocks while it is full, so a slow
+// database slows the producer down instead of growing memory. Batches are
+// written in the order they were queued and a failed flush is retried until
+// it succeeds; onFlush only sees a batch once it is committed.
+type EventWriter struct {
+	db            *sql.DB
+	queue         chan StockEvent
+	batchSize     int
+	flushInterval time.Duration
+	onFlush       func(context.Context, []StockEvent)
+
+	flushes   chan chan struct{}
+	stopping  chan struct{}
+	closing   chan struct{}
+	abort     chan struct{}
+	done      chan struct{}
+	mu        sync.RWMutex
+	closed    bool
+	stopOnce  sync.Once
+	abortOnce sync.Once
+}
+
+func NewEventWriter(db *sql.DB, capacity, batchSize int, flushInterval time.Duration, onFlush func(context.Context, []StockEvent)) *EventWriter {
+	w := &EventWriter{
+		db:            db,
+		queue:         make(chan StockEvent, capacity),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		onFlush:       onFlush,
+		flushes:       make(chan chan struct{}),
+		stopping:      make(chan struct{}),
+		closing:       make(chan struct{}),
+		abort:         make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Write queues events, blocking while the queue is full. It returns early
+// when ctx is done or the writer is closing; events queued before that are
+// still written.
+func (w *EventWriter) Write(ctx context.Context, events ...StockEvent) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrEventWriterClosed
+	}
+	for _, e := range events {
+		select {
+		case w.queue <- e:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-w.stopping:
+			return ErrEventWriterClosed
+		}
+	}
+	metrics.EventWriterQueueDepth.Set(float64(len(w.queue)))
+	return nil
+}
+
+// Flush returns once every event queued before the call is committed.
+func (w *EventWriter) Flush(ctx context.Context) error {
+	reply := make(chan struct{})
+	select {
+	case w.flushes <- reply:
+	case <-w.done:
+		return ErrEventWriterClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-reply:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting events and writes everything still queued. When ctx
+// ends first the pending flush is abandoned and ctx's error returned.
+func (w *EventWriter) Close(ctx context.Context) error {
+	w.stopOnce.Do(func() {
+		close(w.stopping)
+		w.mu.Lock()
+		w.closed = true
+		w.mu.Unlock()
+		close(w.closing)
+	})
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		w.abortOnce.Do(func() { close(w.abort) })
+		return ctx.Err()
+	}
+}
+
+func (w *EventWriter) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+	batch := make([]StockEvent, 0, w.batchSize)
+	for {
+		select {
+		case e := <-w.queue:
+			batch = append(batch, e)
+			if len(batch) >= w.batchSize {
+				batch = w.flush(batch)
+			}
+		case <-ticker.C:
+			batch = w.flush(batch)
+		case reply := <-w.flushes:
+			batch = w.flush(w.drain(batch))
+			close(reply)
+		case <-w.closing:
+			w.flush(w.drain(batch))
+			return
+		}
+		metrics.EventWriterQueueDepth.Set(float64(len(w.queue)))
+	}
+}
+
+// drain moves whatever is queued right now onto batch.
+func (w *EventWriter) drain(batch []StockEvent) []StockEvent {
+	for {
+		select {
+		case e := <-w.queue:
+			batch = append(batch, e)
+		default:
+			return batch
+		}
+	}
+}
+
+// flush writes batch in chunks of batchSize, retrying each until it commits
+// or the writer is aborted, and returns batch emptied for reuse.
+func (w *EventWriter) flush(batch []StockEvent) []StockEvent {
+	for start := 0; start < len(batch); start += w.batchSize {
+		chunk := batch[start:min(start+w.batchSize, len(batch))]
+		backoff := flushRetryMin
+		for {
+			began := time.Now()
+			err := w.copyEvents(chunk)
+			if err == nil {
+				metrics.EventWriterFlushDuration.Observe(time.Since(began).Seconds())
+				metrics.EventWriterFlushedTotal.Add(float64(len(chunk)))
+				if w.onFlush != nil {
+					w.onFlush(context.Background(), chunk)
+				}
+				break
+			}
+			metrics.EventWriterFlushErrors.Inc()
+			slog.Error("stock event flush failed", "events", len(chunk), "error", err)
+			select {
+			case <-w.abort:
+				return batch[:0]
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, flushRetryMax)
+		}
+	}
+	return batch[:0]
+}
+
+// copyEvents streams the events into a staging table with COPY and moves
+// them into stock_events in one statement: COPY cannot skip duplicates on its
+// own, and the seq column keeps the ids in queue order. The insert runs under
+// StockEventsLockId.
+func (w *EventWriter) copyEvents(events []StockEvent) error {
+	ctx := context.Background()
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin event flush: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `
+		CREATE TEMP TABLE stock_events_staging (
+			seq INT, journal_id VARCHAR(32), reservation_id BIGINT, item_id INT,
+			warehouse_id INT, event_type VARCHAR(20), quantity INT
+		) ON COMMIT DROP
+	`); err != nil {
+		return fmt.Errorf("create event staging: %w", err)
+	}
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("stock_events_staging",
+		"seq", "journal_id", "reservation_id", "item_id", "warehouse_id", "event_type", "quantity"))
+	if err != nil {
+		return fmt.Errorf("prepare event copy: %w", err)
+	}
+	for i, e := range events {
+		if _, err := stmt.ExecContext(ctx, i, e.JournalId, e.ReservationId, e.ItemId, e.WarehouseId, e.EventType, e.Quantity); err != nil {
+			stmt.Close()
+			return fmt.Errorf("copy event: %w", err)
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return fmt.Errorf("copy events: %w", err)
+	}
+	if err := stmt.Close(); err != nil {
+		return fmt.Errorf("close event copy: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, StockEventsLockId); err != nil {
+		return fmt.Errorf("lock stock events: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO stock_events (journal_id, reservation_id, item_id, warehouse_id, event_type, quantity)
+		SELECT journal_id, reservation_id, item_id, warehouse_id, event_type, quantity
+		FROM stock_events_staging ORDER BY seq
+		ON CONFLICT (journal_id) DO NOTHING
+	`); err != nil {
+		return fmt.Errorf("insert staged events: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit event flush: %w", err)
+	}
+	return nil
+}
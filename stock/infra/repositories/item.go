@@ -1,16 +1,20 @@
 package repositories
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/giovaniif/e-commerce/stock/domain/item"
 )
 
 var (
-	ErrItemNotFound     = errors.New("item not found")
-	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrItemNotFound           = errors.New("item not found")
+	ErrInsufficientStock      = item.ErrInsufficientStock
+	ErrBackorderCapExceeded   = item.ErrBackorderCapExceeded
+	ErrReservationBackordered = item.ErrReservationBackordered
 )
 
 type ItemRepository struct {
@@ -23,7 +27,7 @@ func NewItemRepository(items map[int32]*item.Item, reservations map[int32]*item.
 	return &ItemRepository{items: items, reservations: reservations}
 }
 
-func (r *ItemRepository) GetItem(itemId int32) (*item.Item, error) {
+func (r *ItemRepository) GetItem(ctx context.Context, itemId int32) (*item.Item, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	repositoryItem, ok := r.items[itemId]
@@ -40,62 +44,165 @@ func (r *ItemRepository) GetItem(itemId int32) (*item.Item, error) {
 	return repositoryItem, nil
 }
 
-func (r *ItemRepository) Reserve(reservationItem *item.Item, quantity int32) (*item.Reservation, error) {
+// GetWarehouseStock reports all of an item's stock in a single warehouse 1;
+// the in-memory repository does not model locations.
+func (r *ItemRepository) GetWarehouseStock(ctx context.Context, itemId int32) ([]item.WarehouseStock, error) {
+	repositoryItem, err := r.GetItem(ctx, itemId)
+	if err != nil {
+		return nil, err
+	}
+	return []item.WarehouseStock{{WarehouseId: 1, Available: int64(repositoryItem.GetAvailableStock())}}, nil
+}
+
+func (r *ItemRepository) Reserve(ctx context.Context, reservationItem *item.Item, allocations []item.Allocation) (*item.Reservation, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	var quantity int32
+	for _, a := range allocations {
+		quantity += a.Quantity
+	}
 	if reservationItem.GetAvailableStock() < quantity {
 		return nil, ErrInsufficientStock
 	}
 
 	newId := int32(len(r.reservations) + 1)
 	reservation := &item.Reservation{
-		Id: newId,
-		TotalFee: float64(quantity) * reservationItem.Price,
-		Quantity: quantity,
-		ItemId: reservationItem.Id,
-		Status: "reserved",
+		Id:          newId,
+		TotalFee:    float64(quantity) * reservationItem.Price,
+		Quantity:    quantity,
+		ItemId:      reservationItem.Id,
+		Status:      "reserved",
+		Allocations: allocations,
+	}
+	r.reservations[newId] = reservation
+	return reservation, nil
+}
+
+func (r *ItemRepository) Backorder(ctx context.Context, reservationItem *item.Item, warehouseId int32, quantity int32) (*item.Reservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	backordered := quantity
+	for _, reservation := range r.reservations {
+		if reservation.ItemId == reservationItem.Id && reservation.Status == "backordered" {
+			backordered += reservation.Quantity
+		}
+	}
+	if backordered > reservationItem.BackorderCap {
+		return nil, ErrBackorderCapExceeded
+	}
+
+	newId := int32(len(r.reservations) + 1)
+	reservation := &item.Reservation{
+		Id:          newId,
+		TotalFee:    float64(quantity) * reservationItem.Price,
+		Quantity:    quantity,
+		ItemId:      reservationItem.Id,
+		Status:      "backordered",
+		Allocations: []item.Allocation{{WarehouseId: warehouseId, Quantity: quantity}},
 	}
 	r.reservations[newId] = reservation
 	return reservation, nil
 }
 
-func (r *ItemRepository) ReleaseReservation(reservationId int32) error {
+// Restock adds to the item's initial stock and fills backorders in id order,
+// stopping at the first one the remaining quantity cannot cover.
+func (r *ItemRepository) Restock(ctx context.Context, itemId int32, warehouseId int32, quantity int32) (*item.RestockResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repositoryItem, ok := r.items[itemId]
+	if !ok {
+		return nil, ErrItemNotFound
+	}
+	repositoryItem.InitialStock += quantity
+
+	var pending []*item.Reservation
+	for _, reservation := range r.reservations {
+		if reservation.ItemId == itemId && reservation.Status == "backordered" {
+			pending = append(pending, reservation)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Id < pending[j].Id })
+	result := &item.RestockResult{Available: quantity}
+	for _, reservation := range pending {
+		if reservation.Quantity > result.Available {
+			break
+		}
+		reservation.Status = "reserved"
+		result.Available -= reservation.Quantity
+		result.Allocated = append(result.Allocated, *reservation)
+	}
+	return result, nil
+}
+
+func (r *ItemRepository) ReleaseReservation(ctx context.Context, reservationId int32) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	reservation, ok := r.reservations[reservationId]
 	if !ok {
-		return errors.New("reservation not found")
+		return ErrReservationNotFound
 	}
 	r.reservations[reservationId] = &item.Reservation{
-		Id: reservationId,
+		Id:       reservationId,
 		TotalFee: reservation.TotalFee,
 		Quantity: reservation.Quantity,
-		ItemId: reservation.ItemId,
-		Status: "canceled",
+		ItemId:   reservation.ItemId,
+		Status:   "canceled",
 	}
 	return nil
 }
 
-func (r *ItemRepository) CompleteReservation(reservationId int32) error {
+func (r *ItemRepository) CompleteReservation(ctx context.Context, reservationId int32) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	reservation, ok := r.reservations[reservationId]
 	if !ok {
 		fmt.Printf("reservation %d not found", reservationId)
-		return errors.New("reservation not found")
+		return ErrReservationNotFound
+	}
+	if reservation.Status == "backordered" {
+		return ErrReservationBackordered
+	}
+	if reservation.Status == "canceled" {
+		return ErrReservationClosed
 	}
 	r.reservations[reservationId] = &item.Reservation{
-		Id: reservationId,
+		Id:       reservationId,
 		TotalFee: reservation.TotalFee,
 		Quantity: reservation.Quantity,
-		ItemId: reservation.ItemId,
-		Status: "completed",
+		ItemId:   reservation.ItemId,
+		Status:   "completed",
 	}
 	return nil
 }
 
+func (r *ItemRepository) ReservationStatus(ctx context.Context, reservationId int32) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	reservation, ok := r.reservations[reservationId]
+	if !ok {
+		return "", ErrReservationNotFound
+	}
+	return reservation.Status, nil
+}
+
+// SetBackorderPolicy flags an item as backorderable with a cap, or clears
+// the flag. Backorders already placed are kept.
+func (r *ItemRepository) SetBackorderPolicy(ctx context.Context, itemId int32, backorderable bool, backorderCap int32) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repositoryItem, ok := r.items[itemId]
+	if !ok {
+		return ErrItemNotFound
+	}
+	if !backorderable {
+		backorderCap = 0
+	}
+	repositoryItem.Backorderable, repositoryItem.BackorderCap = backorderable, backorderCap
+	return nil
+}
+
 func (r *ItemRepository) Save(it *item.Item) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.items[it.Id] = it
-}
\ No newline at end of file
+}
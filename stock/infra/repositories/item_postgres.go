@@ -5,62 +5,219 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/redis/go-redis/v9"
-	_ "github.com/lib/pq"
 	"github.com/giovaniif/e-commerce/stock/domain/item"
+	_ "github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
 )
 
 type ItemRepositoryPostgres struct {
 	db  *sql.DB
 	rdb *redis.Client
+
+	// warehouses lists, per item, the warehouses that stock it. Loaded by
+	// SeedStockCounters so GetWarehouseStock is a single MGET.
+	mu         sync.RWMutex
+	warehouses map[int32][]int32
 }
 
 func NewItemRepositoryPostgres(db *sql.DB, rdb *redis.Client) *ItemRepositoryPostgres {
-	return &ItemRepositoryPostgres{db: db, rdb: rdb}
+	return &ItemRepositoryPostgres{db: db, rdb: rdb, warehouses: make(map[int32][]int32)}
+}
+
+var (
+	ErrWarehouseNotFound   = errors.New("warehouse does not stock item")
+	ErrReservationNotFound = errors.New("reservation not found")
+	// ErrReservationClosed is a complete for a reservation already
+	// released: its stock went back on sale and cannot be taken again.
+	ErrReservationClosed = errors.New("reservation was released")
+)
+
+func stockKey(itemId, warehouseId int32) string {
+	return fmt.Sprintf("stock:item:%d:warehouse:%d", itemId, warehouseId)
+}
+
+// backorderKey counts the units of an item on backorder across warehouses,
+// checked against the item's cap.
+func backorderKey(itemId int32) string {
+	return fmt.Sprintf("stock:item:%d:backordered", itemId)
+}
+
+// backorderCapKey caches the item's backorder cap; 0 or missing means the
+// item is not backorderable.
+func backorderCapKey(itemId int32) string {
+	return fmt.Sprintf("stock:item:backorder_cap:%d", itemId)
+}
+
+const reservationIdKey = "stock:reservation:id"
+
+// reservationKey holds a reservation's item_id, status and allocations
+// ("warehouse:quantity,..."), so release and complete never wait for the
+// journal to reach Postgres. Closed reservations expire after
+// closedReservationTTL.
+func reservationKey(reservationId int32) string {
+	return fmt.Sprintf("stock:reservation:%d", reservationId)
+}
+
+// backorderQueueKey orders the backorders waiting on a warehouse by
+// reservation id; members are "reservationId:quantity".
+func backorderQueueKey(itemId, warehouseId int32) string {
+	return fmt.Sprintf("stock:backorders:%d:%d", itemId, warehouseId)
 }
 
-// SeedStockCounters initialises Redis counters and price cache from the items table.
-// Called once at startup so the atomic DECRBY path has a baseline and GetItem never hits Postgres.
-func (r *ItemRepositoryPostgres) SeedStockCounters(ctx context.Context) error {
-	rows, err := r.db.QueryContext(ctx, `SELECT id, price, initial_stock FROM items`)
+const closedReservationTTL = 24 * time.Hour
+
+// SeedInitialStock replaces the initial stock of every item with quantity,
+// split evenly across its warehouses with the remainder on the first one. It
+// only applies to a fresh database: once any stock event, archived event or
+// snapshot exists, changing the starting point would rewrite history, and it
+// returns false without touching anything.
+func (r *ItemRepositoryPostgres) SeedInitialStock(ctx context.Context, quantity int64) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	var used bool
+	if err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM stock_events)
+			OR EXISTS (SELECT 1 FROM stock_events_archive)
+			OR EXISTS (SELECT 1 FROM stock_snapshots)
+	`).Scan(&used); err != nil {
+		return false, fmt.Errorf("check stock history: %w", err)
+	}
+	if used {
+		return false, nil
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE items SET initial_stock = $1`, quantity); err != nil {
+		return false, fmt.Errorf("seed item initial stock: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE item_warehouse_stock s
+		SET initial_stock = $1 / w.n + CASE WHEN s.warehouse_id = w.first THEN $1 % w.n ELSE 0 END
+		FROM (
+			SELECT item_id, COUNT(*) AS n, MIN(warehouse_id) AS first
+			FROM item_warehouse_stock GROUP BY item_id
+		) w
+		WHERE w.item_id = s.item_id
+	`, quantity); err != nil {
+		return false, fmt.Errorf("seed warehouse initial stock: %w", err)
+	}
+	// Levels seeded from the old initial stock are seeded again by the
+	// projector from the new one.
+	if _, err := tx.ExecContext(ctx, `DELETE FROM item_stock_levels`); err != nil {
+		return false, fmt.Errorf("reset stock levels: %w", err)
+	}
+	return true, tx.Commit()
+}
+
+// SeedStockCounters initialises Redis counters and price cache from the items table, and
+// the reservation hashes and backorder queues from the open reservations in stock_events.
+// Called once at startup, after the journal is drained, so the reserve scripts have a
+// baseline and GetItem never hits Postgres.
+// counters holds the stock reconciled from snapshots and later events; locations missing
+// from it are seeded with their initial stock and nothing on backorder.
+func (r *ItemRepositoryPostgres) SeedStockCounters(ctx context.Context, counters map[item.StockKey]item.StockCounters) error {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT i.id, i.price, i.backorderable, i.backorder_cap, s.warehouse_id, s.initial_stock
+		FROM items i JOIN item_warehouse_stock s ON s.item_id = i.id
+		ORDER BY i.id, s.warehouse_id
+	`)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
+	warehouses := make(map[int32][]int32)
+	backordered := make(map[int32]int64)
 	for rows.Next() {
-		var id int32
+		var id, warehouseId, backorderCap int32
 		var price float64
+		var backorderable bool
 		var initialStock int64
-		if err := rows.Scan(&id, &price, &initialStock); err != nil {
+		if err := rows.Scan(&id, &price, &backorderable, &backorderCap, &warehouseId, &initialStock); err != nil {
 			return err
 		}
-		stockKey := fmt.Sprintf("stock:item:%d", id)
-		if err := r.rdb.Set(ctx, stockKey, initialStock, 0).Err(); err != nil {
-			return fmt.Errorf("seed item %d stock: %w", id, err)
+		stock := initialStock
+		if c, ok := counters[item.StockKey{ItemId: id, WarehouseId: warehouseId}]; ok {
+			stock = c.Available
+			backordered[id] += c.Backordered
+		}
+		if err := r.rdb.Set(ctx, stockKey(id, warehouseId), stock, 0).Err(); err != nil {
+			return fmt.Errorf("seed item %d warehouse %d stock: %w", id, warehouseId, err)
 		}
 		priceKey := fmt.Sprintf("stock:item:price:%d", id)
 		if err := r.rdb.Set(ctx, priceKey, price, 0).Err(); err != nil {
 			return fmt.Errorf("seed item %d price: %w", id, err)
 		}
+		if !backorderable {
+			backorderCap = 0
+		}
+		if err := r.rdb.Set(ctx, backorderCapKey(id), backorderCap, 0).Err(); err != nil {
+			return fmt.Errorf("seed item %d backorder cap: %w", id, err)
+		}
+		warehouses[id] = append(warehouses[id], warehouseId)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id := range warehouses {
+		if err := r.rdb.Set(ctx, backorderKey(id), backordered[id], 0).Err(); err != nil {
+			return fmt.Errorf("seed item %d backordered: %w", id, err)
+		}
+	}
+	if err := r.seedReservations(ctx, warehouses); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.warehouses = warehouses
+	r.mu.Unlock()
+	return nil
+}
+
+// SetBackorderPolicy flags an item as backorderable with a cap, or clears
+// the flag. Backorders already placed are kept.
+func (r *ItemRepositoryPostgres) SetBackorderPolicy(ctx context.Context, itemId int32, backorderable bool, backorderCap int32) error {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE items SET backorderable = $2, backorder_cap = $3 WHERE id = $1
+	`, itemId, backorderable, backorderCap)
+	if err != nil {
+		return fmt.Errorf("set backorder policy: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrItemNotFound
+	}
+	if !backorderable {
+		backorderCap = 0
+	}
+	if err := r.rdb.Set(ctx, backorderCapKey(itemId), backorderCap, 0).Err(); err != nil {
+		return fmt.Errorf("cache backorder cap: %w", err)
 	}
 	return nil
 }
 
-func (r *ItemRepositoryPostgres) GetItem(itemId int32) (*item.Item, error) {
-	ctx := context.Background()
+func (r *ItemRepositoryPostgres) GetItem(ctx context.Context, itemId int32) (*item.Item, error) {
 	priceKey := fmt.Sprintf("stock:item:price:%d", itemId)
-	priceStr, err := r.rdb.Get(ctx, priceKey).Result()
+	cached, err := r.rdb.MGet(ctx, priceKey, backorderCapKey(itemId)).Result()
 	if err == nil {
+		priceStr, _ := cached[0].(string)
 		var price float64
 		if _, scanErr := fmt.Sscanf(priceStr, "%f", &price); scanErr == nil {
-			return &item.Item{Id: itemId, Price: price}, nil
+			it := &item.Item{Id: itemId, Price: price}
+			if capStr, ok := cached[1].(string); ok {
+				fmt.Sscanf(capStr, "%d", &it.BackorderCap)
+				it.Backorderable = it.BackorderCap > 0
+			}
+			return it, nil
 		}
 	}
 	// Fallback to Postgres if cache miss (e.g. unknown item).
-	row := r.db.QueryRow(`SELECT id, price, initial_stock FROM items WHERE id = $1`, itemId)
+	row := r.db.QueryRowContext(ctx, `SELECT id, price, initial_stock, backorderable, backorder_cap FROM items WHERE id = $1`, itemId)
 	var it item.Item
-	if err := row.Scan(&it.Id, &it.Price, &it.InitialStock); err != nil {
+	if err := row.Scan(&it.Id, &it.Price, &it.InitialStock, &it.Backorderable, &it.BackorderCap); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrItemNotFound
 		}
@@ -69,90 +226,299 @@ func (r *ItemRepositoryPostgres) GetItem(itemId int32) (*item.Item, error) {
 	return &it, nil
 }
 
-func (r *ItemRepositoryPostgres) Reserve(reservationItem *item.Item, quantity int32) (*item.Reservation, error) {
-	ctx := context.Background()
-	key := fmt.Sprintf("stock:item:%d", reservationItem.Id)
+// GetWarehouseStock reads the current Redis counters of every warehouse that
+// stocks the item. The values are a point-in-time view used for allocation;
+// Reserve re-checks them atomically.
+func (r *ItemRepositoryPostgres) GetWarehouseStock(ctx context.Context, itemId int32) ([]item.WarehouseStock, error) {
+	r.mu.RLock()
+	warehouseIds := r.warehouses[itemId]
+	r.mu.RUnlock()
+	if len(warehouseIds) == 0 {
+		return nil, ErrItemNotFound
+	}
+	keys := make([]string, len(warehouseIds))
+	for i, w := range warehouseIds {
+		keys[i] = stockKey(itemId, w)
+	}
+	values, err := r.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis get warehouse stock: %w", err)
+	}
+	stock := make([]item.WarehouseStock, 0, len(warehouseIds))
+	for i, v := range values {
+		var available int64
+		if s, ok := v.(string); ok {
+			fmt.Sscanf(s, "%d", &available)
+		}
+		stock = append(stock, item.WarehouseStock{WarehouseId: warehouseIds[i], Available: available})
+	}
+	return stock, nil
+}
 
-	// Atomically decrement — no row lock, no queue, sub-millisecond.
-	remaining, err := r.rdb.DecrBy(ctx, key, int64(quantity)).Result()
+// seedReservations moves the reservation id counter past every id in
+// Postgres and rebuilds the hash of each open reservation and the backorder
+// queues. Open reservations are never archived, so stock_events has them all.
+func (r *ItemRepositoryPostgres) seedReservations(ctx context.Context, warehouses map[int32][]int32) error {
+	var maxId int64
+	if err := r.db.QueryRowContext(ctx, `
+		SELECT GREATEST((SELECT last_value FROM reservation_id_seq), (SELECT COALESCE(MAX(reservation_id), 0) FROM stock_events))
+	`).Scan(&maxId); err != nil {
+		return fmt.Errorf("max reservation id: %w", err)
+	}
+	if err := seedIdScript.Run(ctx, r.rdb, []string{reservationIdKey}, maxId).Err(); err != nil {
+		return fmt.Errorf("seed reservation id: %w", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		WITH candidates AS (
+			SELECT reservation_id FROM reservations WHERE status IN ('reserved', 'backordered')
+			UNION
+			SELECT reservation_id FROM stock_events
+			WHERE reservation_id <> 0
+			  AND id > (SELECT last_event_id FROM projection_checkpoints WHERE name = 'stock')
+		)
+		SELECT e.reservation_id, e.item_id, e.warehouse_id,
+		       COALESCE(MAX(e.quantity) FILTER (WHERE e.event_type IN ('reserved', 'backordered')), 0),
+		       BOOL_OR(e.event_type = 'backordered') AND NOT BOOL_OR(e.event_type = 'allocated')
+		FROM stock_events e JOIN candidates c ON c.reservation_id = e.reservation_id
+		GROUP BY e.reservation_id, e.item_id, e.warehouse_id
+		HAVING NOT BOOL_OR(e.event_type IN ('released', 'completed', 'backorder_canceled'))
+		ORDER BY e.reservation_id, e.warehouse_id
+	`)
 	if err != nil {
-		return nil, fmt.Errorf("redis decr stock: %w", err)
+		return fmt.Errorf("load open reservations: %w", err)
 	}
-	if remaining < 0 {
-		// Not enough stock — compensate and reject.
-		r.rdb.IncrBy(ctx, key, int64(quantity))
-		return nil, ErrInsufficientStock
+	defer rows.Close()
+	type open struct {
+		itemId      int32
+		waiting     bool
+		allocations []string
+	}
+	reservations := make(map[int32]*open)
+	var order []int32
+	for rows.Next() {
+		var id, itemId, warehouseId, quantity int32
+		var waiting bool
+		if err := rows.Scan(&id, &itemId, &warehouseId, &quantity, &waiting); err != nil {
+			return fmt.Errorf("scan open reservation: %w", err)
+		}
+		o, ok := reservations[id]
+		if !ok {
+			o = &open{itemId: itemId, waiting: waiting}
+			reservations[id] = o
+			order = append(order, id)
+		}
+		o.allocations = append(o.allocations, fmt.Sprintf("%d:%d", warehouseId, quantity))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("load open reservations: %w", err)
+	}
+
+	pipe := r.rdb.Pipeline()
+	for itemId, warehouseIds := range warehouses {
+		for _, w := range warehouseIds {
+			pipe.Del(ctx, backorderQueueKey(itemId, w))
+		}
+	}
+	for _, id := range order {
+		o := reservations[id]
+		status := "reserved"
+		if o.waiting {
+			status = "backordered"
+			warehouseId, quantity, _ := strings.Cut(o.allocations[0], ":")
+			w, _ := strconv.ParseInt(warehouseId, 10, 32)
+			pipe.ZAdd(ctx, backorderQueueKey(o.itemId, int32(w)), redis.Z{Score: float64(id), Member: fmt.Sprintf("%d:%s", id, quantity)})
+		}
+		pipe.HSet(ctx, reservationKey(id), "item_id", o.itemId, "status", status, "allocations", strings.Join(o.allocations, ","))
+		pipe.Persist(ctx, reservationKey(id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("seed open reservations: %w", err)
+	}
+	return nil
+}
+
+// Reserve takes every allocation and journals the reservation in a single
+// Redis round trip; the events reach stock_events through the EventJournal.
+func (r *ItemRepositoryPostgres) Reserve(ctx context.Context, reservationItem *item.Item, allocations []item.Allocation) (*item.Reservation, error) {
+	if len(allocations) == 0 {
+		return nil, errors.New("reserve without allocations")
+	}
+	keys := []string{reservationIdKey, JournalStream}
+	args := []any{reservationItem.Id}
+	var quantity int32
+	for _, a := range allocations {
+		if a.Quantity <= 0 {
+			// DECRBY with a negative amount would add stock.
+			return nil, fmt.Errorf("invalid reserve quantity %d", a.Quantity)
+		}
+		quantity += a.Quantity
+		keys = append(keys, stockKey(reservationItem.Id, a.WarehouseId))
+		args = append(args, a.WarehouseId, a.Quantity)
 	}
 
-	// Postgres is now append-only — no transaction or FOR UPDATE needed.
-	var reservationId int64
-	if err := r.db.QueryRow(`SELECT nextval('reservation_id_seq')`).Scan(&reservationId); err != nil {
-		r.rdb.IncrBy(ctx, key, int64(quantity))
-		return nil, fmt.Errorf("next reservation id: %w", err)
+	reservationId, err := reserveScript.Run(ctx, r.rdb, keys, args...).Int64()
+	if err != nil {
+		return nil, fmt.Errorf("redis reserve: %w", err)
+	}
+	if reservationId < 0 {
+		return nil, ErrInsufficientStock
 	}
 
-	_, err = r.db.Exec(`
-		INSERT INTO stock_events (reservation_id, item_id, event_type, quantity)
-		VALUES ($1, $2, 'reserved', $3)
-	`, reservationId, reservationItem.Id, quantity)
+	return &item.Reservation{
+		Id:          int32(reservationId),
+		TotalFee:    float64(quantity) * reservationItem.Price,
+		Quantity:    quantity,
+		ItemId:      reservationItem.Id,
+		Status:      "reserved",
+		Allocations: allocations,
+	}, nil
+}
+
+// Backorder queues a reservation on the warehouse until a restock fills it,
+// as long as the item's backorder cap allows.
+func (r *ItemRepositoryPostgres) Backorder(ctx context.Context, reservationItem *item.Item, warehouseId int32, quantity int32) (*item.Reservation, error) {
+	if quantity <= 0 {
+		return nil, fmt.Errorf("invalid backorder quantity %d", quantity)
+	}
+	keys := []string{reservationIdKey, JournalStream, backorderKey(reservationItem.Id), backorderQueueKey(reservationItem.Id, warehouseId)}
+	reservationId, err := backorderScript.Run(ctx, r.rdb, keys,
+		reservationItem.Id, warehouseId, quantity, reservationItem.BackorderCap,
+	).Int64()
 	if err != nil {
-		r.rdb.IncrBy(ctx, key, int64(quantity))
-		return nil, fmt.Errorf("insert reserved event: %w", err)
+		return nil, fmt.Errorf("redis backorder: %w", err)
+	}
+	if reservationId < 0 {
+		return nil, ErrBackorderCapExceeded
 	}
 
 	return &item.Reservation{
-		Id:       int32(reservationId),
-		TotalFee: float64(quantity) * reservationItem.Price,
-		Quantity: quantity,
-		ItemId:   reservationItem.Id,
-		Status:   "reserved",
+		Id:          int32(reservationId),
+		TotalFee:    float64(quantity) * reservationItem.Price,
+		Quantity:    quantity,
+		ItemId:      reservationItem.Id,
+		Status:      "backordered",
+		Allocations: []item.Allocation{{WarehouseId: warehouseId, Quantity: quantity}},
 	}, nil
 }
 
-func (r *ItemRepositoryPostgres) ReleaseReservation(reservationId int32) error {
-	ctx := context.Background()
+// Restock adds stock to a warehouse, filling the backorders waiting on it in
+// the order they were placed. Allocation stops at the first backorder the
+// remaining quantity cannot cover, so a large order is not overtaken by
+// smaller later ones.
+func (r *ItemRepositoryPostgres) Restock(ctx context.Context, itemId int32, warehouseId int32, quantity int32) (*item.RestockResult, error) {
+	if quantity <= 0 {
+		return nil, fmt.Errorf("invalid restock quantity %d", quantity)
+	}
+	r.mu.RLock()
+	warehouseIds := r.warehouses[itemId]
+	r.mu.RUnlock()
+	if len(warehouseIds) == 0 {
+		return nil, ErrItemNotFound
+	}
+	stocked := false
+	for _, w := range warehouseIds {
+		stocked = stocked || w == warehouseId
+	}
+	if !stocked {
+		return nil, ErrWarehouseNotFound
+	}
 
-	var quantity int32
-	var itemId int32
-	err := r.db.QueryRow(`
-		SELECT quantity, item_id FROM stock_events
-		WHERE reservation_id = $1 AND event_type = 'reserved'
-	`, reservationId).Scan(&quantity, &itemId)
+	keys := []string{stockKey(itemId, warehouseId), backorderKey(itemId), backorderQueueKey(itemId, warehouseId), JournalStream}
+	values, err := restockScript.Run(ctx, r.rdb, keys, itemId, warehouseId, quantity).Int64Slice()
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return errors.New("reservation not found")
-		}
-		return fmt.Errorf("get reservation: %w", err)
-	}
-
-	// Return stock to Redis before writing the event.
-	key := fmt.Sprintf("stock:item:%d", itemId)
-	r.rdb.IncrBy(ctx, key, int64(quantity))
-
-	_, err = r.db.Exec(`
-		INSERT INTO stock_events (reservation_id, item_id, event_type, quantity)
-		VALUES ($1, $2, 'released', $3)
-	`, reservationId, itemId, quantity)
-	return err
-}
-
-func (r *ItemRepositoryPostgres) CompleteReservation(reservationId int32) error {
-	// Stock was already decremented on reserve and stays consumed — no Redis change.
-	// Write the audit event asynchronously to keep the critical path fast.
-	go func() {
-		var quantity int32
-		var itemId int32
-		err := r.db.QueryRow(`
-			SELECT quantity, item_id FROM stock_events
-			WHERE reservation_id = $1 AND event_type = 'reserved'
-		`, reservationId).Scan(&quantity, &itemId)
-		if err != nil {
-			return
-		}
-		r.db.Exec(`
-			INSERT INTO stock_events (reservation_id, item_id, event_type, quantity)
-			VALUES ($1, $2, 'completed', $3)
-		`, reservationId, itemId, quantity)
-	}()
+		return nil, fmt.Errorf("redis restock: %w", err)
+	}
+	result := &item.RestockResult{Available: int32(values[0])}
+	for i := 1; i+1 < len(values); i += 2 {
+		allocations := []item.Allocation{{WarehouseId: warehouseId, Quantity: int32(values[i+1])}}
+		result.Allocated = append(result.Allocated, item.Reservation{
+			Id:          int32(values[i]),
+			Quantity:    int32(values[i+1]),
+			ItemId:      itemId,
+			Status:      "reserved",
+			Allocations: allocations,
+		})
+	}
+	return result, nil
+}
+
+// reservation reads a reservation's item and allocations from its hash.
+func (r *ItemRepositoryPostgres) reservation(ctx context.Context, reservationId int32) (int32, []item.Allocation, error) {
+	fields, err := r.rdb.HMGet(ctx, reservationKey(reservationId), "item_id", "allocations").Result()
+	if err != nil {
+		return 0, nil, fmt.Errorf("redis get reservation: %w", err)
+	}
+	itemStr, _ := fields[0].(string)
+	allocationsStr, _ := fields[1].(string)
+	itemId, err := strconv.ParseInt(itemStr, 10, 32)
+	if err != nil || allocationsStr == "" {
+		return 0, nil, ErrReservationNotFound
+	}
+	var allocations []item.Allocation
+	for _, pair := range strings.Split(allocationsStr, ",") {
+		var a item.Allocation
+		if _, err := fmt.Sscanf(pair, "%d:%d", &a.WarehouseId, &a.Quantity); err != nil {
+			return 0, nil, fmt.Errorf("parse reservation %d allocations: %w", reservationId, err)
+		}
+		allocations = append(allocations, a)
+	}
+	return int32(itemId), allocations, nil
+}
+
+func (r *ItemRepositoryPostgres) ReleaseReservation(ctx context.Context, reservationId int32) error {
+	itemId, allocations, err := r.reservation(ctx, reservationId)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{reservationKey(reservationId), JournalStream, backorderKey(itemId), backorderQueueKey(itemId, allocations[0].WarehouseId)}
+	args := []any{reservationId, itemId, int64(closedReservationTTL / time.Second)}
+	for _, a := range allocations {
+		keys = append(keys, stockKey(itemId, a.WarehouseId))
+		args = append(args, a.WarehouseId, a.Quantity)
+	}
+	res, err := releaseScript.Run(ctx, r.rdb, keys, args...).Int()
+	if err != nil {
+		return fmt.Errorf("redis release: %w", err)
+	}
+	if res < 0 {
+		return ErrReservationNotFound
+	}
 	return nil
 }
+
+// CompleteReservation journals the completion; the stock was already taken
+// on reserve and stays consumed.
+func (r *ItemRepositoryPostgres) CompleteReservation(ctx context.Context, reservationId int32) error {
+	res, err := completeScript.Run(ctx, r.rdb,
+		[]string{reservationKey(reservationId), JournalStream},
+		reservationId, int64(closedReservationTTL/time.Second),
+	).Int()
+	if err != nil {
+		return fmt.Errorf("redis complete: %w", err)
+	}
+	switch res {
+	case -1:
+		return ErrReservationNotFound
+	case -2:
+		return ErrReservationBackordered
+	case -3:
+		return ErrReservationClosed
+	}
+	return nil
+}
+
+// ReservationStatus reads a reservation's status from its hash: reserved,
+// backordered, completed or canceled. A closed reservation is only known
+// until its hash expires.
+func (r *ItemRepositoryPostgres) ReservationStatus(ctx context.Context, reservationId int32) (string, error) {
+	status, err := r.rdb.HGet(ctx, reservationKey(reservationId), "status").Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrReservationNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("redis get reservation status: %w", err)
+	}
+	return status, nil
+}
@@ -0,0 +1,292 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// JournalStream is the Redis Stream every stock event is appended to by
+	// the reservation scripts before it reaches stock_events.
+	JournalStream = "stock:events"
+	journalGroup  = "stock-persister"
+	// journalLockId is the Postgres advisory lock held by the replica
+	// leading the journal.
+	journalLockId = 7_100_031
+)
+
+// EventJournal persists the journal stream into stock_events through a
+// consumer group. One replica at a time leads, holding a session advisory
+// lock on a dedicated connection, so stock_events ids follow stream order.
+// The leader first claims whatever is still pending from earlier leaders,
+// then reads new entries and hands them to an EventWriter; entries are
+// acknowledged and deleted only after their batch is committed. An entry
+// committed but not acknowledged before a crash is written again and skipped
+// by the unique journal_id.
+type EventJournal struct {
+	db        *sql.DB
+	rdb       *redis.Client
+	consumer  string
+	batchSize int
+	interval  time.Duration
+	writer    *EventWriter
+	done      chan struct{}
+}
+
+func NewEventJournal(db *sql.DB, rdb *redis.Client, consumer string, batchSize, queueSize int, interval time.Duration) *EventJournal {
+	j := &EventJournal{db: db, rdb: rdb, consumer: consumer, batchSize: batchSize, interval: interval, done: make(chan struct{})}
+	j.writer = NewEventWriter(db, queueSize, batchSize, interval, j.ack)
+	return j
+}
+
+// Run competes for leadership until ctx is cancelled and persists the
+// stream while it leads.
+func (j *EventJournal) Run(ctx context.Context) {
+	defer close(j.done)
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		if err := j.lead(ctx, false); err != nil && ctx.Err() == nil {
+			slog.Error("journal leadership lost", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Drain returns once every entry in the stream when it was called is in
+// stock_events. Called before the counters are seeded from Postgres. When
+// another replica leads, Drain waits for it rather than taking over.
+func (j *EventJournal) Drain(ctx context.Context) error {
+	last, err := j.lastEntryId(ctx)
+	if err != nil || last == "" {
+		return err
+	}
+	if err := j.lead(ctx, true); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		first, err := j.rdb.XRangeN(ctx, JournalStream, "-", "+", 1).Result()
+		if err != nil {
+			return fmt.Errorf("peek journal: %w", err)
+		}
+		if len(first) == 0 || streamIdAfter(first[0].ID, last) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close waits for Run to return, then writes what the leader had queued.
+// Entries read but not queued stay pending for the next leader.
+func (j *EventJournal) Close(ctx context.Context) error {
+	select {
+	case <-j.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return j.writer.Close(ctx)
+}
+
+// CloseWriter stops the writer of a journal whose Run never started, which
+// Close would wait for forever, after writing what Drain left queued.
+func (j *EventJournal) CloseWriter(ctx context.Context) error {
+	return j.writer.Close(ctx)
+}
+
+// lead persists the stream while this replica holds the journal lock. It
+// returns at once when the lock is held elsewhere, and when drain is set,
+// as soon as the stream has nothing new.
+func (j *EventJournal) lead(ctx context.Context, drain bool) error {
+	conn, err := j.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("journal lock connection: %w", err)
+	}
+	defer conn.Close()
+	var leader bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, journalLockId).Scan(&leader); err != nil {
+		return fmt.Errorf("lock journal: %w", err)
+	}
+	if !leader {
+		return nil
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, journalLockId)
+
+	if err := j.rdb.XGroupCreateMkStream(ctx, JournalStream, journalGroup, "0").Err(); err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("create journal group: %w", err)
+	}
+	// Holding the lock, nothing pending is being persisted by anyone else:
+	// it is either from a leader that died or already committed and about
+	// to be acknowledged. Both are safe to take over at once.
+	start := "0-0"
+	for {
+		messages, next, err := j.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   JournalStream,
+			Group:    journalGroup,
+			Consumer: j.consumer,
+			Start:    start,
+			Count:    int64(j.batchSize),
+		}).Result()
+		if err != nil {
+			return fmt.Errorf("claim journal entries: %w", err)
+		}
+		if err := j.writer.Write(ctx, j.events(ctx, messages)...); err != nil {
+			return err
+		}
+		if next == "0-0" {
+			break
+		}
+		start = next
+	}
+
+	block := j.interval
+	if drain {
+		block = -1
+	}
+	for {
+		streams, err := j.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    journalGroup,
+			Consumer: j.consumer,
+			Streams:  []string{JournalStream, ">"},
+			Count:    int64(j.batchSize),
+			Block:    block,
+		}).Result()
+		if err != nil && err != redis.Nil {
+			return fmt.Errorf("read journal: %w", err)
+		}
+		var messages []redis.XMessage
+		for _, s := range streams {
+			messages = append(messages, s.Messages...)
+		}
+		if err := j.writer.Write(ctx, j.events(ctx, messages)...); err != nil {
+			return err
+		}
+		if len(messages) > 0 {
+			continue
+		}
+		if drain {
+			// Hold the lock until the batch is committed so no other replica
+			// writes past it in the meantime.
+			return j.writer.Flush(ctx)
+		}
+		if err := conn.PingContext(ctx); err != nil {
+			return fmt.Errorf("journal lock connection: %w", err)
+		}
+	}
+}
+
+// ack acknowledges and deletes entries once the writer has committed them.
+func (j *EventJournal) ack(ctx context.Context, events []StockEvent) {
+	ids := make([]string, len(events))
+	for i, e := range events {
+		ids[i] = e.JournalId
+	}
+	pipe := j.rdb.Pipeline()
+	pipe.XAck(ctx, JournalStream, journalGroup, ids...)
+	pipe.XDel(ctx, JournalStream, ids...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		// Left pending; the next claim writes them again as no-ops.
+		slog.Error("journal ack failed", "entries", len(ids), "error", err)
+	}
+}
+
+func (j *EventJournal) lastEntryId(ctx context.Context) (string, error) {
+	last, err := j.rdb.XRevRangeN(ctx, JournalStream, "+", "-", 1).Result()
+	if err != nil {
+		return "", fmt.Errorf("peek journal: %w", err)
+	}
+	if len(last) == 0 {
+		return "", nil
+	}
+	return last[0].ID, nil
+}
+
+// streamIdAfter compares two stream entry ids of the form ms-seq.
+func streamIdAfter(a, b string) bool {
+	parse := func(id string) (uint64, uint64) {
+		ms, seq, _ := strings.Cut(id, "-")
+		m, _ := strconv.ParseUint(ms, 10, 64)
+		s, _ := strconv.ParseUint(seq, 10, 64)
+		return m, s
+	}
+	am, as := parse(a)
+	bm, bs := parse(b)
+	return am > bm || am == bm && as > bs
+}
+
+// events turns stream entries into stock events. A malformed entry is
+// acknowledged and dropped rather than retried forever; the counters already
+// moved.
+func (j *EventJournal) events(ctx context.Context, messages []redis.XMessage) []StockEvent {
+	events := make([]StockEvent, 0, len(messages))
+	var skipped []StockEvent
+	for _, m := range messages {
+		e, err := journalEvent(m)
+		if err != nil {
+			slog.Error("journal entry skipped", "id", m.ID, "error", err)
+			skipped = append(skipped, StockEvent{JournalId: m.ID})
+			continue
+		}
+		events = append(events, e)
+	}
+	if len(skipped) > 0 {
+		j.ack(ctx, skipped)
+	}
+	return events
+}
+
+// journalEvent turns a stream entry into a stock event.
+func journalEvent(m redis.XMessage) (StockEvent, error) {
+	field := func(name string) (int64, error) {
+		s, _ := m.Values[name].(string)
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("field %s: %w", name, err)
+		}
+		return n, nil
+	}
+	reservationId, err := field("reservation_id")
+	if err != nil {
+		return StockEvent{}, err
+	}
+	itemId, err := field("item_id")
+	if err != nil {
+		return StockEvent{}, err
+	}
+	warehouseId, err := field("warehouse_id")
+	if err != nil {
+		return StockEvent{}, err
+	}
+	quantity, err := field("quantity")
+	if err != nil {
+		return StockEvent{}, err
+	}
+	eventType, _ := m.Values["event_type"].(string)
+	if eventType == "" {
+		return StockEvent{}, fmt.Errorf("field event_type missing")
+	}
+	return StockEvent{
+		JournalId:     m.ID,
+		ReservationId: reservationId,
+		ItemId:        itemId,
+		WarehouseId:   warehouseId,
+		EventType:     eventType,
+		Quantity:      quantity,
+	}, nil
+}
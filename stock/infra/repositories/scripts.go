@@ -0,0 +1,163 @@
+package repositories
+
+import "github.com/redis/go-redis/v9"
+
+// The scripts below change the stock counters and append the matching events
+// to the journal stream in one atomic step, so a counter never moves without
+// its event and concurrent callers never observe a half-applied change.
+// Every journal entry has the fields reservation_id, item_id, warehouse_id,
+// event_type and quantity, one entry per warehouse touched.
+//
+// The reservation hash key is built inside reserveScript and backorderScript
+// because its id is only known there; the stock service runs against a
+// single Redis node, not a cluster.
+
+// reserveScript checks every allocation before decrementing any of them, so
+// a reserve that cannot be served leaves the counters untouched.
+//
+// KEYS: reservation id counter, journal stream, one stock counter per allocation.
+// ARGV: item id, then warehouse id and quantity per allocation.
+// Returns the reservation id, or -1 when any warehouse is short.
+var reserveScript = redis.NewScript(`
+local n = #KEYS - 2
+for i = 1, n do
+  if tonumber(redis.call('GET', KEYS[i + 2]) or '0') < tonumber(ARGV[2 * i + 1]) then
+    return -1
+  end
+end
+local id = redis.call('INCR', KEYS[1])
+local allocations = {}
+for i = 1, n do
+  local warehouse, qty = ARGV[2 * i], ARGV[2 * i + 1]
+  redis.call('DECRBY', KEYS[i + 2], qty)
+  redis.call('XADD', KEYS[2], '*', 'reservation_id', id, 'item_id', ARGV[1], 'warehouse_id', warehouse, 'event_type', 'reserved', 'quantity', qty)
+  allocations[i] = warehouse .. ':' .. qty
+end
+redis.call('HSET', 'stock:reservation:' .. id, 'item_id', ARGV[1], 'status', 'reserved', 'allocations', table.concat(allocations, ','))
+return id
+`)
+
+// backorderScript places a backorder in its warehouse queue, scored by
+// reservation id so restocks serve them in the order they were placed.
+//
+// KEYS: reservation id counter, journal stream, item backordered counter, warehouse backorder queue.
+// ARGV: item id, warehouse id, quantity, backorder cap.
+// Returns the reservation id, or -1 when the cap would be exceeded.
+var backorderScript = redis.NewScript(`
+local qty = tonumber(ARGV[3])
+if tonumber(redis.call('GET', KEYS[3]) or '0') + qty > tonumber(ARGV[4]) then
+  return -1
+end
+redis.call('INCRBY', KEYS[3], qty)
+local id = redis.call('INCR', KEYS[1])
+redis.call('ZADD', KEYS[4], id, id .. ':' .. qty)
+redis.call('XADD', KEYS[2], '*', 'reservation_id', id, 'item_id', ARGV[1], 'warehouse_id', ARGV[2], 'event_type', 'backordered', 'quantity', qty)
+redis.call('HSET', 'stock:reservation:' .. id, 'item_id', ARGV[1], 'status', 'backordered', 'allocations', ARGV[2] .. ':' .. qty)
+return id
+`)
+
+// restockScript fills the oldest backorders of the warehouse first and stops
+// at the first one the remaining quantity cannot cover; the rest becomes
+// available stock.
+//
+// KEYS: stock counter, item backordered counter, warehouse backorder queue, journal stream.
+// ARGV: item id, warehouse id, quantity.
+// Returns the leftover quantity followed by reservation id and quantity of
+// each backorder filled.
+var restockScript = redis.NewScript(`
+local remaining = tonumber(ARGV[3])
+redis.call('XADD', KEYS[4], '*', 'reservation_id', 0, 'item_id', ARGV[1], 'warehouse_id', ARGV[2], 'event_type', 'restocked', 'quantity', remaining)
+local result = {}
+for _, member in ipairs(redis.call('ZRANGE', KEYS[3], 0, -1)) do
+  local id, qty = string.match(member, '^(%d+):(%d+)$')
+  qty = tonumber(qty)
+  if qty > remaining then
+    break
+  end
+  remaining = remaining - qty
+  redis.call('ZREM', KEYS[3], member)
+  redis.call('DECRBY', KEYS[2], qty)
+  redis.call('HSET', 'stock:reservation:' .. id, 'status', 'reserved')
+  redis.call('XADD', KEYS[4], '*', 'reservation_id', id, 'item_id', ARGV[1], 'warehouse_id', ARGV[2], 'event_type', 'allocated', 'quantity', qty)
+  table.insert(result, tonumber(id))
+  table.insert(result, qty)
+end
+if remaining > 0 then
+  redis.call('INCRBY', KEYS[1], remaining)
+end
+table.insert(result, 1, remaining)
+return result
+`)
+
+// releaseScript re-reads the reservation status so a restock filling the
+// backorder in between is honoured: a reserved reservation returns its stock,
+// a waiting backorder leaves the queue.
+//
+// KEYS: reservation hash, journal stream, item backordered counter, backorder
+// queue of the first allocation's warehouse, then one stock counter per allocation.
+// ARGV: reservation id, item id, closed reservation ttl in seconds, then
+// warehouse id and quantity per allocation.
+// Returns 1 when released, 0 when already closed, -1 when unknown.
+var releaseScript = redis.NewScript(`
+local status = redis.call('HGET', KEYS[1], 'status')
+if not status then
+  return -1
+end
+if status == 'reserved' then
+  for i = 5, #KEYS do
+    local warehouse, qty = ARGV[2 * i - 6], ARGV[2 * i - 5]
+    redis.call('INCRBY', KEYS[i], qty)
+    redis.call('XADD', KEYS[2], '*', 'reservation_id', ARGV[1], 'item_id', ARGV[2], 'warehouse_id', warehouse, 'event_type', 'released', 'quantity', qty)
+  end
+elseif status == 'backordered' then
+  local warehouse, qty = ARGV[4], ARGV[5]
+  redis.call('ZREM', KEYS[4], ARGV[1] .. ':' .. qty)
+  redis.call('DECRBY', KEYS[3], qty)
+  redis.call('XADD', KEYS[2], '*', 'reservation_id', ARGV[1], 'item_id', ARGV[2], 'warehouse_id', warehouse, 'event_type', 'backorder_canceled', 'quantity', qty)
+else
+  return 0
+end
+redis.call('HSET', KEYS[1], 'status', 'canceled')
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+// completeScript marks a reserved reservation completed. The stock stays
+// consumed, so no counter moves.
+//
+// KEYS: reservation hash, journal stream.
+// ARGV: reservation id, closed reservation ttl in seconds.
+// Returns 1 when completed, 0 when already completed, -1 when unknown, -2
+// when the reservation is still waiting on a backorder and -3 when it was
+// released.
+var completeScript = redis.NewScript(`
+local fields = redis.call('HMGET', KEYS[1], 'status', 'item_id', 'allocations')
+local status = fields[1]
+if not status then
+  return -1
+end
+if status == 'backordered' then
+  return -2
+end
+if status == 'canceled' then
+  return -3
+end
+if status ~= 'reserved' then
+  return 0
+end
+for warehouse, qty in string.gmatch(fields[3], '(%d+):(%d+)') do
+  redis.call('XADD', KEYS[2], '*', 'reservation_id', ARGV[1], 'item_id', fields[2], 'warehouse_id', warehouse, 'event_type', 'completed', 'quantity', qty)
+end
+redis.call('HSET', KEYS[1], 'status', 'completed')
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+// seedIdScript moves the reservation id counter forward to at least ARGV[1],
+// never back, so ids stay unique across restarts.
+var seedIdScript = redis.NewScript(`
+if tonumber(redis.call('GET', KEYS[1]) or '0') < tonumber(ARGV[1]) then
+  redis.call('SET', KEYS[1], ARGV[1])
+end
+return redis.call('GET', KEYS[1])
+`)
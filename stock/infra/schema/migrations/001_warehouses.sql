@@ -0,0 +1,58 @@
+-- Warehouses came after the first Stock databases were created. Stock from
+-- before them, and every event and projection row that moved it, is put
+-- whole in warehouse 1. A database created from db/init.sql already has all
+-- of this and is left as it is.
+CREATE TABLE IF NOT EXISTS warehouses (
+    id INT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS item_warehouse_stock (
+    item_id INT NOT NULL REFERENCES items(id),
+    warehouse_id INT NOT NULL REFERENCES warehouses(id),
+    initial_stock BIGINT NOT NULL,
+    PRIMARY KEY (item_id, warehouse_id)
+);
+
+INSERT INTO warehouses (id, name) VALUES
+    (1, 'sao-paulo'),
+    (2, 'recife')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO item_warehouse_stock (item_id, warehouse_id, initial_stock)
+SELECT i.id, w.id, CASE WHEN w.id = 1 THEN i.initial_stock ELSE 0 END
+FROM items i CROSS JOIN warehouses w
+WHERE NOT EXISTS (SELECT 1 FROM item_warehouse_stock s WHERE s.item_id = i.id)
+ON CONFLICT DO NOTHING;
+
+-- Each table that lacks warehouse_id gets it, set to 1 for the rows it
+-- holds, and the primary key it is now part of.
+DO $$
+DECLARE
+    t RECORD;
+BEGIN
+    FOR t IN SELECT * FROM (VALUES
+        ('stock_events', NULL, TRUE),
+        ('reservations', 'reservation_id, warehouse_id', TRUE),
+        ('item_stock_levels', 'item_id, warehouse_id', TRUE),
+        ('item_stock_snapshots', 'item_id, warehouse_id, event_id', TRUE),
+        ('reservation_snapshots', 'event_id, reservation_id, warehouse_id', TRUE),
+        ('stock_events_archive', NULL, FALSE)
+    ) AS tables (name, primary_key, referenced)
+    LOOP
+        IF to_regclass(t.name) IS NULL OR EXISTS (
+            SELECT 1 FROM information_schema.columns
+            WHERE table_schema = current_schema() AND table_name = t.name AND column_name = 'warehouse_id'
+        ) THEN
+            CONTINUE;
+        END IF;
+        EXECUTE format('ALTER TABLE %I ADD COLUMN warehouse_id INT NOT NULL DEFAULT 1', t.name);
+        EXECUTE format('ALTER TABLE %I ALTER COLUMN warehouse_id DROP DEFAULT', t.name);
+        IF t.referenced THEN
+            EXECUTE format('ALTER TABLE %I ADD FOREIGN KEY (warehouse_id) REFERENCES warehouses(id)', t.name);
+        END IF;
+        IF t.primary_key IS NOT NULL THEN
+            EXECUTE format('ALTER TABLE %I DROP CONSTRAINT %I, ADD PRIMARY KEY (%s)', t.name, t.name || '_pkey', t.primary_key);
+        END IF;
+    END LOOP;
+END $$;
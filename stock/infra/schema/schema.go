@@ -0,0 +1,78 @@
+// Package schema brings a Stock database created by an earlier db/init.sql
+// up to the schema the service reads and writes. db/init.sql always holds
+// the whole current schema for new databases; every change to it comes with
+// a migration here that makes the same change to an existing one, written to
+// do nothing where the change is already in place.
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+)
+
+// migrateLockId is the advisory lock Migrate holds while it runs.
+const migrateLockId = 7_100_029
+
+// migrations are applied in file name order by Migrate.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Migrate applies the migrations not applied yet, each in its own
+// transaction, and records them in stock_schema_migrations. Replicas
+// starting together serialize on an advisory lock.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrateLockId); err != nil {
+		return fmt.Errorf("migrate lock: %w", err)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, migrateLockId)
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS stock_schema_migrations (
+			name VARCHAR(255) PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`); err != nil {
+		return fmt.Errorf("create migrations table: %w", err)
+	}
+	for _, name := range names {
+		if err := migrate(ctx, conn, name); err != nil {
+			return fmt.Errorf("migration %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func migrate(ctx context.Context, conn *sql.Conn, name string) error {
+	script, err := migrations.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `INSERT INTO stock_schema_migrations (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -25,10 +24,10 @@ var propagator = propagation.NewCompositeTextMapPropagator(
 	propagation.Baggage{},
 )
 
-// Init initializes the global tracer provider and returns a shutdown function.
-// If OTEL_EXPORTER_OTLP_ENDPOINT is not set, returns nil (tracing disabled).
-func Init(serviceName string) func() {
-	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+// Init initializes the global tracer provider exporting to the OTLP endpoint
+// and returns a shutdown function. If endpoint is empty, returns nil (tracing
+// disabled).
+func Init(serviceName, endpoint string) func() {
 	if endpoint == "" {
 		return nil
 	}
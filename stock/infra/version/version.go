@@ -0,0 +1,76 @@
+// Package version serves the API under /v<N> route groups and marks the
+// versions on their way out with the Deprecation (RFC 9745), Sunset
+// (RFC 8594) and Link headers.
+package version
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/giovaniif/e-commerce/stock/infra/metrics"
+)
+
+// Deprecation describes a version being replaced: From is its path prefix
+// ("" for the unversioned routes), To the prefix of its successor.
+type Deprecation struct {
+	From   string
+	To     string
+	Since  time.Time
+	Sunset time.Time
+}
+
+// headers marks the response to a request for path. An alias that already
+// marked it, such as an unversioned route served by a deprecated v1, keeps
+// its own headers: they announce the earlier sunset.
+func (d Deprecation) headers(h http.Header, path string) {
+	if h.Get("Deprecation") != "" {
+		return
+	}
+	h.Set("Deprecation", "@"+strconv.FormatInt(d.Since.Unix(), 10))
+	h.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+	h.Set("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", d.To, strings.TrimPrefix(path, d.From)))
+}
+
+// Middleware marks every response of a route group as deprecated.
+func (d Deprecation) Middleware(c *gin.Context) {
+	d.headers(c.Writer.Header(), c.Request.URL.Path)
+	metrics.DeprecatedRequests.WithLabelValues(label(d.From), metrics.NormalizePath(c.Request.URL.Path)).Inc()
+	c.Next()
+}
+
+// Legacy serves the routes clients called before the API was versioned by
+// rewriting their paths under d.To, the version they became. paths lists
+// the legacy routes; one ending in "/" covers everything below it.
+func Legacy(next http.Handler, d Deprecation, paths ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !legacy(r.URL.Path, paths) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		d.headers(w.Header(), r.URL.Path)
+		metrics.DeprecatedRequests.WithLabelValues(label(d.From), metrics.NormalizePath(r.URL.Path)).Inc()
+		r.URL.Path = d.To + r.URL.Path
+		r.URL.RawPath = ""
+		next.ServeHTTP(w, r)
+	})
+}
+
+func legacy(path string, paths []string) bool {
+	for _, p := range paths {
+		if path == p || strings.HasSuffix(p, "/") && strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func label(prefix string) string {
+	if prefix == "" {
+		return "unversioned"
+	}
+	return strings.TrimPrefix(prefix, "/")
+}
@@ -1,9 +1,23 @@
 package main
 
 import (
+	"os"
+
 	"github.com/giovaniif/e-commerce/stock/cmd/api"
+	"github.com/giovaniif/e-commerce/stock/cmd/archive"
+	"github.com/giovaniif/e-commerce/stock/cmd/rebuild"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "rebuild-projections":
+			rebuild.Run(os.Args[2:])
+			return
+		case "archive-events":
+			archive.Run(os.Args[2:])
+			return
+		}
+	}
 	api.StartServer()
 }
@@ -1,6 +1,8 @@
 package complete
 
 import (
+	"context"
+
 	"github.com/giovaniif/e-commerce/stock/domain/item"
 )
 
@@ -14,8 +16,8 @@ func NewComplete(itemRepository item.Repository) *Complete {
 	}
 }
 
-func (c *Complete) Complete(input Input) (error) {
-	err := c.itemRepository.CompleteReservation(input.ReservationId)
+func (c *Complete) Complete(ctx context.Context, input Input) (error) {
+	err := c.itemRepository.CompleteReservation(ctx, input.ReservationId)
 	if err != nil {
 		return err
 	}
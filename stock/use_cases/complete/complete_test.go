@@ -1,6 +1,7 @@
 package complete
 
 import (
+	"context"
 	"errors"
 	"testing"
 
@@ -18,12 +19,25 @@ type mockRepository struct {
 	completeCalledWithId int32
 }
 
-func (m *mockRepository) GetItem(itemId int32) (*stockitem.Item, error) { return m.getItemResult, m.getItemErr }
-func (m *mockRepository) Reserve(reservationItem *stockitem.Item, quantity int32) (*stockitem.Reservation, error) {
+func (m *mockRepository) GetItem(ctx context.Context, itemId int32) (*stockitem.Item, error) {
+	return m.getItemResult, m.getItemErr
+}
+func (m *mockRepository) GetWarehouseStock(ctx context.Context, itemId int32) ([]stockitem.WarehouseStock, error) {
+	return nil, nil
+}
+func (m *mockRepository) Reserve(ctx context.Context, reservationItem *stockitem.Item, allocations []stockitem.Allocation) (*stockitem.Reservation, error) {
 	return m.reserveResult, m.reserveErr
 }
-func (m *mockRepository) ReleaseReservation(reservationId int32) error { return m.releaseErr }
-func (m *mockRepository) CompleteReservation(reservationId int32) error {
+func (m *mockRepository) Backorder(ctx context.Context, reservationItem *stockitem.Item, warehouseId int32, quantity int32) (*stockitem.Reservation, error) {
+	return nil, nil
+}
+func (m *mockRepository) Restock(ctx context.Context, itemId int32, warehouseId int32, quantity int32) (*stockitem.RestockResult, error) {
+	return nil, nil
+}
+func (m *mockRepository) ReleaseReservation(ctx context.Context, reservationId int32) error {
+	return m.releaseErr
+}
+func (m *mockRepository) CompleteReservation(ctx context.Context, reservationId int32) error {
 	m.completeCalledWithId = reservationId
 	return m.completeErr
 }
@@ -32,7 +46,7 @@ func TestComplete_Success(t *testing.T) {
 	repo := &mockRepository{}
 	uc := NewComplete(repo)
 
-	err := uc.Complete(Input{ReservationId: 22})
+	err := uc.Complete(context.Background(), Input{ReservationId: 22})
 	if err != nil {
 		t.Fatalf("expected nil error, got %v", err)
 	}
@@ -45,10 +59,8 @@ func TestComplete_Error(t *testing.T) {
 	repo := &mockRepository{completeErr: errors.New("cannot complete")}
 	uc := NewComplete(repo)
 
-	err := uc.Complete(Input{ReservationId: 22})
+	err := uc.Complete(context.Background(), Input{ReservationId: 22})
 	if err == nil {
 		t.Fatalf("expected error, got nil")
 	}
 }
-
-
@@ -1,6 +1,8 @@
 package release
 
 import (
+	"context"
+
 	"github.com/giovaniif/e-commerce/stock/domain/item"
 )
 
@@ -14,8 +16,8 @@ func NewRelease(itemRepository item.Repository) *Release {
 	}
 }
 
-func (r *Release) Release(input Input) (error) {
-	err := r.itemRepository.ReleaseReservation(input.ReservationId)
+func (r *Release) Release(ctx context.Context, input Input) (error) {
+	err := r.itemRepository.ReleaseReservation(ctx, input.ReservationId)
 	if err != nil {
 		return err
 	}
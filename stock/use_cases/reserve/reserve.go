@@ -1,42 +1,144 @@
 package reserve
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/giovaniif/e-commerce/stock/domain/item"
 )
 
+var (
+	ErrInvalidQuantity       = errors.New("quantity must be positive")
+	ErrQuantityAboveMax      = errors.New("quantity exceeds the maximum per line")
+	ErrPurchaseLimitExceeded = errors.New("purchase limit exceeded")
+)
+
+// Rules are the validations applied before any stock is touched, plus the
+// strategy used to pick warehouses. A zero MaxQuantityPerLine disables the
+// per-line cap; items missing from CustomerLimits have no per-customer cap;
+// a nil Allocation defaults to item.AllocatePreferredWarehouse.
+//
+// CustomerLimits count only reserves that name a customer. One without
+// CustomerId, which Order sends for checkouts it does not authenticate, is
+// reserved uncounted: there is no customer to hold it against.
+type Rules struct {
+	MaxQuantityPerLine int32
+	CustomerLimits     map[int32]int32
+	LimitWindow        time.Duration
+	Allocation         item.AllocationStrategy
+}
+
 type Reserve struct {
-	itemRepository item.Repository
+	itemRepository  item.Repository
+	purchaseLimiter item.PurchaseLimiter
+	rules           Rules
 }
 
-func NewReserve(itemRepository item.Repository) *Reserve {
+func NewReserve(itemRepository item.Repository, purchaseLimiter item.PurchaseLimiter, rules Rules) *Reserve {
 	return &Reserve{
-		itemRepository: itemRepository,
+		itemRepository:  itemRepository,
+		purchaseLimiter: purchaseLimiter,
+		rules:           rules,
 	}
 }
 
-func (r *Reserve) Reserve(itemId int32, quantity int32) (Output, error) {
-	item, err := r.itemRepository.GetItem(itemId)
+func (r *Reserve) Reserve(ctx context.Context, input Input) (Output, error) {
+	if input.Quantity <= 0 {
+		return Output{}, ErrInvalidQuantity
+	}
+	if r.rules.MaxQuantityPerLine > 0 && input.Quantity > r.rules.MaxQuantityPerLine {
+		return Output{}, fmt.Errorf("%w: %d > %d", ErrQuantityAboveMax, input.Quantity, r.rules.MaxQuantityPerLine)
+	}
+
+	reservationItem, err := r.itemRepository.GetItem(ctx, input.ItemId)
+	if err != nil {
+		return Output{}, err
+	}
+	stock, err := r.itemRepository.GetWarehouseStock(ctx, input.ItemId)
 	if err != nil {
 		return Output{}, err
 	}
+	allocate := r.rules.Allocation
+	if allocate == nil {
+		allocate = item.AllocatePreferredWarehouse
+	}
+	allocations, err := allocate(input.Quantity, stock, input.PreferredWarehouseId)
+	backorder := false
+	if err != nil {
+		if !errors.Is(err, item.ErrInsufficientStock) || !reservationItem.Backorderable {
+			return Output{}, err
+		}
+		backorder = true
+	}
 
-	reservation, err := r.itemRepository.Reserve(item, quantity)
+	limit, limited := r.rules.CustomerLimits[input.ItemId]
+	// Without a customer the limit is skipped, as Rules documents.
+	limited = limited && input.CustomerId != "" && r.purchaseLimiter != nil
+	var limitToken string
+	if limited {
+		token, ok, err := r.purchaseLimiter.Acquire(ctx, input.TenantId, input.CustomerId, input.ItemId, input.Quantity, limit, r.rules.LimitWindow)
+		if err != nil {
+			return Output{}, err
+		}
+		if !ok {
+			return Output{}, fmt.Errorf("%w: item %d allows %d per customer every %s", ErrPurchaseLimitExceeded, input.ItemId, limit, r.rules.LimitWindow)
+		}
+		limitToken = token
+	}
+
+	var reservation *item.Reservation
+	if !backorder {
+		reservation, err = r.itemRepository.Reserve(ctx, reservationItem, allocations)
+		// The stock read for allocation may have been taken in the meantime.
+		backorder = errors.Is(err, item.ErrInsufficientStock) && reservationItem.Backorderable
+	}
+	if backorder {
+		reservation, err = r.backorder(ctx, reservationItem, stock, input)
+	}
 	if err != nil {
+		if limited {
+			// Given back even when ctx was cancelled, or the customer's window
+			// keeps a quantity that was never reserved.
+			_ = r.purchaseLimiter.Release(context.WithoutCancel(ctx), input.TenantId, input.CustomerId, input.ItemId, limitToken)
+		}
 		return Output{}, err
 	}
 
 	return Output{
 		ReservationId: reservation.Id,
-		TotalFee: reservation.TotalFee,
+		TotalFee:      reservation.TotalFee,
+		Allocations:   reservation.Allocations,
+		Backordered:   backorder,
 	}, nil
 }
 
+// backorder places the whole quantity on backorder in a single warehouse,
+// where it waits for a restock.
+func (r *Reserve) backorder(ctx context.Context, reservationItem *item.Item, stock []item.WarehouseStock, input Input) (*item.Reservation, error) {
+	warehouseId, err := item.BackorderWarehouse(stock, input.PreferredWarehouseId)
+	if err != nil {
+		return nil, err
+	}
+	return r.itemRepository.Backorder(ctx, reservationItem, warehouseId, input.Quantity)
+}
+
 type Input struct {
-	ItemId int32
-	Quantity int32
+	ItemId               int32
+	Quantity             int32
+	CustomerId           string
+	PreferredWarehouseId int32
+	// TenantId scopes CustomerId's purchase limits; empty for single-tenant
+	// callers.
+	TenantId string
 }
 
 type Output struct {
-  ReservationId int32
-	TotalFee float64
+	ReservationId int32
+	TotalFee      float64
+	Allocations   []item.Allocation
+	// Backordered is set when the item was out of stock and the reservation
+	// waits for a restock instead of failing.
+	Backordered bool
 }
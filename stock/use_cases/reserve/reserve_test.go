@@ -1,8 +1,10 @@
 package reserve
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 
 	stockitem "github.com/giovaniif/e-commerce/stock/domain/item"
 )
@@ -14,33 +16,62 @@ type mockRepository struct {
 	reserveErr    error
 	releaseErr    error
 	completeErr   error
+	// warehouseStock defaults to a single warehouse with plenty of stock.
+	warehouseStock []stockitem.WarehouseStock
 
-	getItemCalledWithId        int32
-	reserveCalledWithItemId    int32
-	reserveCalledWithQuantity  int32
-	releaseCalledWithId        int32
-	completeCalledWithId       int32
+	backorderResult *stockitem.Reservation
+	backorderErr    error
+
+	reserveCalledWithAllocations []stockitem.Allocation
+	backorderCalledWithWarehouse int32
+	backorderCalledWithQuantity  int32
+	getItemCalledWithId          int32
+	reserveCalledWithItemId      int32
+	reserveCalledWithQuantity    int32
+	releaseCalledWithId          int32
+	completeCalledWithId         int32
 }
 
-func (m *mockRepository) GetItem(itemId int32) (*stockitem.Item, error) {
+func (m *mockRepository) GetItem(ctx context.Context, itemId int32) (*stockitem.Item, error) {
 	m.getItemCalledWithId = itemId
 	return m.getItemResult, m.getItemErr
 }
 
-func (m *mockRepository) Reserve(reservationItem *stockitem.Item, quantity int32) (*stockitem.Reservation, error) {
+func (m *mockRepository) GetWarehouseStock(ctx context.Context, itemId int32) ([]stockitem.WarehouseStock, error) {
+	if m.warehouseStock == nil {
+		return []stockitem.WarehouseStock{{WarehouseId: 1, Available: 1000}}, nil
+	}
+	return m.warehouseStock, nil
+}
+
+func (m *mockRepository) Reserve(ctx context.Context, reservationItem *stockitem.Item, allocations []stockitem.Allocation) (*stockitem.Reservation, error) {
 	if reservationItem != nil {
 		m.reserveCalledWithItemId = reservationItem.Id
 	}
-	m.reserveCalledWithQuantity = quantity
+	m.reserveCalledWithAllocations = allocations
+	m.reserveCalledWithQuantity = 0
+	for _, a := range allocations {
+		m.reserveCalledWithQuantity += a.Quantity
+	}
 	return m.reserveResult, m.reserveErr
 }
 
-func (m *mockRepository) ReleaseReservation(reservationId int32) error {
+func (m *mockRepository) Backorder(ctx context.Context, reservationItem *stockitem.Item, warehouseId int32, quantity int32) (*stockitem.Reservation, error) {
+	m.backorderCalledWithWarehouse = warehouseId
+	m.backorderCalledWithQuantity = quantity
+	return m.backorderResult, m.backorderErr
+}
+
+func (m *mockRepository) Restock(ctx context.Context, itemId int32, warehouseId int32, quantity int32) (*stockitem.RestockResult, error) {
+	return nil, nil
+}
+
+func (m *mockRepository) ReleaseReservation(ctx context.Context, reservationId int32) error {
 	m.releaseCalledWithId = reservationId
 	return m.releaseErr
 }
 
-func (m *mockRepository) CompleteReservation(reservationId int32) error {
+func (m *mockRepository) CompleteReservation(ctx context.Context, reservationId int32) error {
 	m.completeCalledWithId = reservationId
 	return m.completeErr
 }
@@ -50,9 +81,9 @@ func TestReserve_Success(t *testing.T) {
 		getItemResult: &stockitem.Item{Id: 1, Price: 10, InitialStock: 5},
 		reserveResult: &stockitem.Reservation{Id: 2, TotalFee: 30, Quantity: 3, ItemId: 1},
 	}
-	uc := NewReserve(repo)
+	uc := NewReserve(repo, nil, Rules{})
 
-	out, err := uc.Reserve(1, 3)
+	out, err := uc.Reserve(context.Background(), Input{ItemId: 1, Quantity: 3})
 	if err != nil {
 		t.Fatalf("expected nil error, got %v", err)
 	}
@@ -71,9 +102,9 @@ func TestReserve_GetItemError(t *testing.T) {
 	repo := &mockRepository{
 		getItemErr: errors.New("not found"),
 	}
-	uc := NewReserve(repo)
+	uc := NewReserve(repo, nil, Rules{})
 
-	_, err := uc.Reserve(1, 3)
+	_, err := uc.Reserve(context.Background(), Input{ItemId: 1, Quantity: 3})
 	if err == nil {
 		t.Fatalf("expected error, got nil")
 	}
@@ -82,14 +113,268 @@ func TestReserve_GetItemError(t *testing.T) {
 func TestReserve_ReserveError(t *testing.T) {
 	repo := &mockRepository{
 		getItemResult: &stockitem.Item{Id: 1, Price: 10, InitialStock: 5},
-		reserveErr: errors.New("cannot reserve"),
+		reserveErr:    errors.New("cannot reserve"),
+	}
+	uc := NewReserve(repo, nil, Rules{})
+
+	_, err := uc.Reserve(context.Background(), Input{ItemId: 1, Quantity: 3})
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+}
+
+type mockPurchaseLimiter struct {
+	allow    bool
+	acquired []int32
+	released []string
+	// tenants are the tenants Acquire and Release were called with, in order.
+	tenants []string
+	// releaseCtxErr is the error of the context Release was called with.
+	releaseCtxErr error
+}
+
+func (m *mockPurchaseLimiter) Acquire(ctx context.Context, tenantId string, customerId string, itemId int32, quantity int32, limit int32, window time.Duration) (string, bool, error) {
+	m.tenants = append(m.tenants, tenantId)
+	if !m.allow {
+		return "", false, nil
+	}
+	m.acquired = append(m.acquired, quantity)
+	return "token-1", true, nil
+}
+
+func (m *mockPurchaseLimiter) Release(ctx context.Context, tenantId string, customerId string, itemId int32, token string) error {
+	m.released = append(m.released, token)
+	m.tenants = append(m.tenants, tenantId)
+	m.releaseCtxErr = ctx.Err()
+	return nil
+}
+
+func TestReserve_InvalidQuantity(t *testing.T) {
+	for _, qty := range []int32{0, -5} {
+		repo := &mockRepository{getItemResult: &stockitem.Item{Id: 1, Price: 10}}
+		uc := NewReserve(repo, nil, Rules{})
+
+		_, err := uc.Reserve(context.Background(), Input{ItemId: 1, Quantity: qty})
+		if !errors.Is(err, ErrInvalidQuantity) {
+			t.Fatalf("quantity %d: expected ErrInvalidQuantity, got %v", qty, err)
+		}
+		if repo.reserveCalledWithQuantity != 0 {
+			t.Fatalf("quantity %d: expected Reserve not to be called", qty)
+		}
+	}
+}
+
+func TestReserve_QuantityAboveMax(t *testing.T) {
+	repo := &mockRepository{getItemResult: &stockitem.Item{Id: 1, Price: 10}}
+	uc := NewReserve(repo, nil, Rules{MaxQuantityPerLine: 5})
+
+	_, err := uc.Reserve(context.Background(), Input{ItemId: 1, Quantity: 6})
+	if !errors.Is(err, ErrQuantityAboveMax) {
+		t.Fatalf("expected ErrQuantityAboveMax, got %v", err)
 	}
-	uc := NewReserve(repo)
+}
+
+func TestReserve_PurchaseLimitExceeded(t *testing.T) {
+	repo := &mockRepository{getItemResult: &stockitem.Item{Id: 1, Price: 10}}
+	limiter := &mockPurchaseLimiter{allow: false}
+	uc := NewReserve(repo, limiter, Rules{CustomerLimits: map[int32]int32{1: 2}, LimitWindow: time.Hour})
+
+	_, err := uc.Reserve(context.Background(), Input{ItemId: 1, Quantity: 2, CustomerId: "c-1"})
+	if !errors.Is(err, ErrPurchaseLimitExceeded) {
+		t.Fatalf("expected ErrPurchaseLimitExceeded, got %v", err)
+	}
+	if repo.reserveCalledWithQuantity != 0 {
+		t.Fatalf("expected Reserve not to be called when the limit is exceeded")
+	}
+}
+
+func TestReserve_PurchaseLimitReleasedOnReserveError(t *testing.T) {
+	repo := &mockRepository{
+		getItemResult: &stockitem.Item{Id: 1, Price: 10},
+		reserveErr:    errors.New("insufficient stock"),
+	}
+	limiter := &mockPurchaseLimiter{allow: true}
+	uc := NewReserve(repo, limiter, Rules{CustomerLimits: map[int32]int32{1: 2}, LimitWindow: time.Hour})
 
-	_, err := uc.Reserve(1, 3)
+	_, err := uc.Reserve(context.Background(), Input{ItemId: 1, Quantity: 2, CustomerId: "c-1", TenantId: "t-1"})
 	if err == nil {
 		t.Fatalf("expected error, got nil")
 	}
+	if len(limiter.acquired) != 1 || len(limiter.released) != 1 || limiter.released[0] != "token-1" {
+		t.Fatalf("expected the acquired quantity to be released, got acquired=%v released=%v", limiter.acquired, limiter.released)
+	}
+	if len(limiter.tenants) != 2 || limiter.tenants[0] != "t-1" || limiter.tenants[1] != "t-1" {
+		t.Fatalf("expected the limit to be tracked in tenant t-1, got %v", limiter.tenants)
+	}
+}
+
+// TestReserve_NoLimitWithoutCustomer pins the documented bypass: a reserve
+// naming no customer is neither refused nor counted, even above the limit.
+func TestReserve_NoLimitWithoutCustomer(t *testing.T) {
+	repo := &mockRepository{
+		getItemResult: &stockitem.Item{Id: 1, Price: 10},
+		reserveResult: &stockitem.Reservation{Id: 2, TotalFee: 20, Quantity: 2, ItemId: 1},
+	}
+	limiter := &mockPurchaseLimiter{allow: false}
+	uc := NewReserve(repo, limiter, Rules{CustomerLimits: map[int32]int32{1: 1}, LimitWindow: time.Hour})
+
+	if _, err := uc.Reserve(context.Background(), Input{ItemId: 1, Quantity: 2, TenantId: "t-1"}); err != nil {
+		t.Fatalf("expected nil error without customer id, got %v", err)
+	}
+	if len(limiter.tenants) != 0 {
+		t.Fatalf("expected the limiter not to be called without a customer, got calls in %v", limiter.tenants)
+	}
 }
 
+func TestReserve_PreferredWarehouseHonored(t *testing.T) {
+	repo := &mockRepository{
+		getItemResult: &stockitem.Item{Id: 1, Price: 10},
+		reserveResult: &stockitem.Reservation{Id: 2, TotalFee: 30, Quantity: 3, ItemId: 1},
+		warehouseStock: []stockitem.WarehouseStock{
+			{WarehouseId: 1, Available: 10},
+			{WarehouseId: 2, Available: 10},
+		},
+	}
+	uc := NewReserve(repo, nil, Rules{})
+
+	if _, err := uc.Reserve(context.Background(), Input{ItemId: 1, Quantity: 3, PreferredWarehouseId: 2}); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(repo.reserveCalledWithAllocations) != 1 || repo.reserveCalledWithAllocations[0].WarehouseId != 2 {
+		t.Errorf("expected allocation from warehouse 2, got %+v", repo.reserveCalledWithAllocations)
+	}
+}
 
+func TestReserve_SplitStrategy(t *testing.T) {
+	repo := &mockRepository{
+		getItemResult: &stockitem.Item{Id: 1, Price: 10},
+		reserveResult: &stockitem.Reservation{Id: 2, TotalFee: 50, Quantity: 5, ItemId: 1},
+		warehouseStock: []stockitem.WarehouseStock{
+			{WarehouseId: 1, Available: 3},
+			{WarehouseId: 2, Available: 4},
+		},
+	}
+	uc := NewReserve(repo, nil, Rules{Allocation: stockitem.AllocateSplit})
+
+	if _, err := uc.Reserve(context.Background(), Input{ItemId: 1, Quantity: 5}); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(repo.reserveCalledWithAllocations) != 2 {
+		t.Errorf("expected reservation split across 2 warehouses, got %+v", repo.reserveCalledWithAllocations)
+	}
+	if repo.reserveCalledWithQuantity != 5 {
+		t.Errorf("expected total quantity 5, got %d", repo.reserveCalledWithQuantity)
+	}
+}
+
+func TestReserve_InsufficientStockSkipsRepository(t *testing.T) {
+	repo := &mockRepository{
+		getItemResult:  &stockitem.Item{Id: 1, Price: 10},
+		warehouseStock: []stockitem.WarehouseStock{{WarehouseId: 1, Available: 2}},
+	}
+	uc := NewReserve(repo, nil, Rules{})
+
+	_, err := uc.Reserve(context.Background(), Input{ItemId: 1, Quantity: 3})
+	if !errors.Is(err, stockitem.ErrInsufficientStock) {
+		t.Fatalf("expected ErrInsufficientStock, got %v", err)
+	}
+	if repo.reserveCalledWithAllocations != nil {
+		t.Error("expected repository Reserve not to be called")
+	}
+}
+
+func TestReserve_BackorderWhenOutOfStock(t *testing.T) {
+	repo := &mockRepository{
+		getItemResult:   &stockitem.Item{Id: 1, Price: 10, Backorderable: true, BackorderCap: 10},
+		warehouseStock:  []stockitem.WarehouseStock{{WarehouseId: 1, Available: 0}, {WarehouseId: 2, Available: 1}},
+		backorderResult: &stockitem.Reservation{Id: 7, TotalFee: 30, Quantity: 3, ItemId: 1, Status: "backordered"},
+	}
+	uc := NewReserve(repo, nil, Rules{})
+
+	out, err := uc.Reserve(context.Background(), Input{ItemId: 1, Quantity: 3, PreferredWarehouseId: 2})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if !out.Backordered || out.ReservationId != 7 {
+		t.Errorf("expected backordered reservation 7, got %+v", out)
+	}
+	if repo.reserveCalledWithAllocations != nil {
+		t.Error("expected repository Reserve not to be called")
+	}
+	if repo.backorderCalledWithWarehouse != 2 || repo.backorderCalledWithQuantity != 3 {
+		t.Errorf("expected backorder of 3 in warehouse 2, got %d in %d", repo.backorderCalledWithQuantity, repo.backorderCalledWithWarehouse)
+	}
+}
+
+func TestReserve_BackorderWhenStockTakenConcurrently(t *testing.T) {
+	repo := &mockRepository{
+		getItemResult:   &stockitem.Item{Id: 1, Price: 10, Backorderable: true, BackorderCap: 10},
+		reserveErr:      stockitem.ErrInsufficientStock,
+		backorderResult: &stockitem.Reservation{Id: 8, Quantity: 3, ItemId: 1, Status: "backordered"},
+	}
+	uc := NewReserve(repo, nil, Rules{})
+
+	out, err := uc.Reserve(context.Background(), Input{ItemId: 1, Quantity: 3})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if !out.Backordered || out.ReservationId != 8 {
+		t.Errorf("expected backordered reservation 8, got %+v", out)
+	}
+}
+
+func TestReserve_NotBackorderable(t *testing.T) {
+	repo := &mockRepository{
+		getItemResult:  &stockitem.Item{Id: 1, Price: 10},
+		warehouseStock: []stockitem.WarehouseStock{{WarehouseId: 1, Available: 0}},
+	}
+	uc := NewReserve(repo, nil, Rules{})
+
+	_, err := uc.Reserve(context.Background(), Input{ItemId: 1, Quantity: 3})
+	if !errors.Is(err, stockitem.ErrInsufficientStock) {
+		t.Fatalf("expected ErrInsufficientStock, got %v", err)
+	}
+	if repo.backorderCalledWithQuantity != 0 {
+		t.Error("expected Backorder not to be called")
+	}
+}
+
+func TestReserve_BackorderCapReleasesLimit(t *testing.T) {
+	repo := &mockRepository{
+		getItemResult:  &stockitem.Item{Id: 1, Price: 10, Backorderable: true, BackorderCap: 2},
+		warehouseStock: []stockitem.WarehouseStock{{WarehouseId: 1, Available: 0}},
+		backorderErr:   stockitem.ErrBackorderCapExceeded,
+	}
+	limiter := &mockPurchaseLimiter{allow: true}
+	uc := NewReserve(repo, limiter, Rules{CustomerLimits: map[int32]int32{1: 5}, LimitWindow: time.Hour})
+
+	_, err := uc.Reserve(context.Background(), Input{ItemId: 1, Quantity: 3, CustomerId: "c-1"})
+	if !errors.Is(err, stockitem.ErrBackorderCapExceeded) {
+		t.Fatalf("expected ErrBackorderCapExceeded, got %v", err)
+	}
+	if len(limiter.released) != 1 || limiter.released[0] != "token-1" {
+		t.Errorf("expected limit token released, got %v", limiter.released)
+	}
+}
+
+func TestReserve_CancelledContextStillReleasesLimit(t *testing.T) {
+	repo := &mockRepository{
+		getItemResult: &stockitem.Item{Id: 1, Price: 10},
+		reserveErr:    context.Canceled,
+	}
+	limiter := &mockPurchaseLimiter{allow: true}
+	uc := NewReserve(repo, limiter, Rules{CustomerLimits: map[int32]int32{1: 5}, LimitWindow: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := uc.Reserve(ctx, Input{ItemId: 1, Quantity: 2, CustomerId: "c-1"})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if len(limiter.released) != 1 {
+		t.Fatalf("expected limit token released, got %v", limiter.released)
+	}
+	if limiter.releaseCtxErr != nil {
+		t.Errorf("expected Release with a live context, got %v", limiter.releaseCtxErr)
+	}
+}
@@ -0,0 +1,51 @@
+package restock
+
+import (
+	"context"
+	"errors"
+
+	"github.com/giovaniif/e-commerce/stock/domain/item"
+)
+
+var ErrInvalidQuantity = errors.New("quantity must be positive")
+
+type Restock struct {
+	itemRepository item.Repository
+}
+
+func NewRestock(itemRepository item.Repository) *Restock {
+	return &Restock{
+		itemRepository: itemRepository,
+	}
+}
+
+// Restock adds stock to a warehouse. Backorders waiting on it are filled
+// first, oldest first; whatever is left becomes available stock.
+func (r *Restock) Restock(ctx context.Context, input Input) (Output, error) {
+	if input.Quantity <= 0 {
+		return Output{}, ErrInvalidQuantity
+	}
+	result, err := r.itemRepository.Restock(ctx, input.ItemId, input.WarehouseId, input.Quantity)
+	if err != nil {
+		return Output{}, err
+	}
+	allocated := make([]int32, len(result.Allocated))
+	for i, reservation := range result.Allocated {
+		allocated[i] = reservation.Id
+	}
+	return Output{
+		AllocatedReservationIds: allocated,
+		Available:               result.Available,
+	}, nil
+}
+
+type Input struct {
+	ItemId      int32
+	WarehouseId int32
+	Quantity    int32
+}
+
+type Output struct {
+	AllocatedReservationIds []int32
+	Available               int32
+}
@@ -0,0 +1,87 @@
+package restock
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	stockitem "github.com/giovaniif/e-commerce/stock/domain/item"
+)
+
+type mockRepository struct {
+	restockResult *stockitem.RestockResult
+	restockErr    error
+
+	restockCalled             bool
+	restockCalledWithItem     int32
+	restockCalledWithQuantity int32
+}
+
+func (m *mockRepository) GetItem(ctx context.Context, itemId int32) (*stockitem.Item, error) {
+	return nil, nil
+}
+func (m *mockRepository) GetWarehouseStock(ctx context.Context, itemId int32) ([]stockitem.WarehouseStock, error) {
+	return nil, nil
+}
+func (m *mockRepository) Reserve(ctx context.Context, reservationItem *stockitem.Item, allocations []stockitem.Allocation) (*stockitem.Reservation, error) {
+	return nil, nil
+}
+func (m *mockRepository) Backorder(ctx context.Context, reservationItem *stockitem.Item, warehouseId int32, quantity int32) (*stockitem.Reservation, error) {
+	return nil, nil
+}
+func (m *mockRepository) Restock(ctx context.Context, itemId int32, warehouseId int32, quantity int32) (*stockitem.RestockResult, error) {
+	m.restockCalled = true
+	m.restockCalledWithItem = itemId
+	m.restockCalledWithQuantity = quantity
+	return m.restockResult, m.restockErr
+}
+func (m *mockRepository) ReleaseReservation(ctx context.Context, reservationId int32) error {
+	return nil
+}
+func (m *mockRepository) CompleteReservation(ctx context.Context, reservationId int32) error {
+	return nil
+}
+
+func TestRestock_Success(t *testing.T) {
+	repo := &mockRepository{restockResult: &stockitem.RestockResult{
+		Allocated: []stockitem.Reservation{{Id: 4, Quantity: 2}, {Id: 9, Quantity: 3}},
+		Available: 5,
+	}}
+	uc := NewRestock(repo)
+
+	out, err := uc.Restock(context.Background(), Input{ItemId: 1, WarehouseId: 2, Quantity: 10})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(out.AllocatedReservationIds) != 2 || out.AllocatedReservationIds[0] != 4 || out.AllocatedReservationIds[1] != 9 {
+		t.Errorf("expected allocated reservations [4 9], got %v", out.AllocatedReservationIds)
+	}
+	if out.Available != 5 {
+		t.Errorf("expected 5 available, got %d", out.Available)
+	}
+	if repo.restockCalledWithItem != 1 || repo.restockCalledWithQuantity != 10 {
+		t.Errorf("expected Restock(1, _, 10), got item %d quantity %d", repo.restockCalledWithItem, repo.restockCalledWithQuantity)
+	}
+}
+
+func TestRestock_InvalidQuantity(t *testing.T) {
+	repo := &mockRepository{}
+	uc := NewRestock(repo)
+
+	_, err := uc.Restock(context.Background(), Input{ItemId: 1, WarehouseId: 1, Quantity: 0})
+	if !errors.Is(err, ErrInvalidQuantity) {
+		t.Fatalf("expected ErrInvalidQuantity, got %v", err)
+	}
+	if repo.restockCalled {
+		t.Error("expected repository Restock not to be called")
+	}
+}
+
+func TestRestock_Error(t *testing.T) {
+	repo := &mockRepository{restockErr: errors.New("db down")}
+	uc := NewRestock(repo)
+
+	if _, err := uc.Restock(context.Background(), Input{ItemId: 1, WarehouseId: 1, Quantity: 3}); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}